@@ -1,27 +1,63 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sohWenMing/lenslocked/controllers"
 	"github.com/sohWenMing/lenslocked/gomailer"
+	"github.com/sohWenMing/lenslocked/janitor"
 	"github.com/sohWenMing/lenslocked/migrations"
 	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/oidc"
+	"github.com/sohWenMing/lenslocked/ratelimit"
 	"github.com/sohWenMing/lenslocked/services"
+	"github.com/sohWenMing/lenslocked/storage"
 	"github.com/sohWenMing/lenslocked/views"
+	"github.com/sohWenMing/lenslocked/webauthn"
 )
 
 type config struct {
-	isDev         bool
-	baseUrl       string
-	csrfSecretKey string
-	emailEnvVars  *models.EmailEnvs
-	pgConfig      models.PgConfig
+	isDev            bool
+	baseUrl          string
+	csrfSecretKey    string
+	emailEnvVars     *models.EmailEnvs
+	pgConfig         models.PgConfig
+	imageStore       storage.Store
+	sessionLifetimes models.SessionLifetimes
+	janitorConfig    janitor.Config
+	// whether the IP address of requests is read from the X-Forwarded-For header set by a reverse proxy
+	trustProxyHeaders bool
+	rateLimits        rateLimitConfig
+	passwordPolicy    models.PasswordPolicy
+	oidcProviders     []oidc.Config
+	relyingParty      webauthn.RelyingParty
 }
 
+// rateLimitConfig holds where rate limits are kept, and the limit of each group of routes
+type rateLimitConfig struct {
+	storeType string
+	authForms ratelimit.Limit
+	uploads   ratelimit.Limit
+	api       ratelimit.Limit
+}
+
+// how long requests that are still being served are waited on when the server is shut down
+const shutdownTimeout = 10 * time.Second
+
+// how long requests to OpenID Connect providers can take before signing in with them fails
+const oidcRequestTimeout = 10 * time.Second
+
 func loadEnvConfig() (*config, error) {
 	envVars, err := loadEnvVars()
 	if err != nil {
@@ -47,22 +83,148 @@ func loadEnvConfig() (*config, error) {
 	if err != nil {
 		return nil, err
 	}
+	imageStore, err := envVars.LoadImageStore()
+	if err != nil {
+		return nil, err
+	}
+	sessionLifetimes, err := envVars.LoadSessionLifetimes()
+	if err != nil {
+		return nil, err
+	}
+	janitorConfig, err := readJanitorConfig(envVars)
+	if err != nil {
+		return nil, err
+	}
+	trustProxyHeaders, err := envVars.GetTrustProxyHeaders()
+	if err != nil {
+		return nil, err
+	}
+	passwordPolicy, err := envVars.LoadPasswordPolicy()
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders, err := envVars.LoadOIDCProviders(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	relyingParty, err := envVars.LoadRelyingParty(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	rateLimits, err := readRateLimitConfig(envVars)
+	if err != nil {
+		return nil, err
+	}
 	return &config{
-		isDev, baseUrl, csrfSecretKey, emailEnvVars, pgConfig,
+		isDev, baseUrl, csrfSecretKey, emailEnvVars, pgConfig, imageStore, sessionLifetimes, janitorConfig,
+		trustProxyHeaders, rateLimits, passwordPolicy, oidcProviders, relyingParty,
 	}, nil
 }
 
 func main() {
+	isJanitorOnly := flag.Bool("janitor", false,
+		"run the janitor's clean up tasks once and exit, instead of starting the server")
+	isBackfillImagesOnly := flag.Bool("backfill-images", false,
+		"record the images stored before the images table existed and exit, instead of starting the server")
+	grantAdminEmail := flag.String("grant-admin", "",
+		"make the user with this email address an admin and exit, instead of starting the server")
+	flag.Parse()
 	cfg, err := loadEnvConfig()
 	if err != nil {
 		panic(err)
 	}
+	if *isBackfillImagesOnly {
+		err = backfillImages(cfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *grantAdminEmail != "" {
+		err = grantAdmin(cfg, *grantAdminEmail)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *isJanitorOnly {
+		err = runJanitorOnce(cfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	err = run(cfg)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// initialises the database connections, runs any migrations that have not been run yet and configures the services
+func initDBConnections(cfg *config) (*models.DBConnections, error) {
+	dbc, err := models.InitDBConnections(cfg.pgConfig)
+	if err != nil {
+		return nil, err
+	}
+	err = models.Migrate(dbc.DB, ".", migrations.GetMigrations())
+	if err != nil {
+		dbc.DB.Close()
+		return nil, err
+	}
+	fmt.Println("Migrations successfully ran")
+	dbc.GalleryService.Store = cfg.imageStore
+	dbc.SessionService.Lifetimes = cfg.sessionLifetimes
+	dbc.UserService.PasswordPolicy = cfg.passwordPolicy
+	dbc.PasskeyService.RelyingParty = cfg.relyingParty
+	return dbc, nil
+}
+
+// runs every clean up task of the janitor once, for running from cron or by hand
+func runJanitorOnce(cfg *config) error {
+	dbc, err := initDBConnections(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbc.DB.Close()
+	return janitor.New(janitor.Tasks(dbc, cfg.janitorConfig)).RunOnce()
+}
+
+/*
+records the images that were stored before the images table existed, which are not shown until they are. It should be
+run once after upgrading, before the server is started
+*/
+func backfillImages(cfg *config) error {
+	dbc, err := initDBConnections(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbc.DB.Close()
+	numRecorded, err := dbc.GalleryService.BackfillImages()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("recorded %d images\n", numRecorded)
+	return nil
+}
+
+// makes the user with the input email address an admin, which is how the first admin is made
+func grantAdmin(cfg *config, email string) error {
+	dbc, err := initDBConnections(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbc.DB.Close()
+	err = dbc.AdminService.SetRole(email, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an admin\n", email)
+	return nil
+}
+
 func run(cfg *config) error {
 
 	initGoMailer := gomailer.NewGoMailer(
@@ -73,16 +235,10 @@ func run(cfg *config) error {
 
 	emailService := services.InitEmailService(initGoMailer, services.LoadEmailTemplates())
 
-	dbc, err := models.InitDBConnections(cfg.pgConfig)
-	if err != nil {
-		return err
-	}
-	err = models.Migrate(dbc.DB, ".", migrations.GetMigrations())
+	dbc, err := initDBConnections(cfg)
 	if err != nil {
 		return err
 	}
-	fmt.Println("Migrations successfully ran")
-
 	defer dbc.DB.Close()
 
 	mainPagesTemplate := views.LoadPageTemplates(views.MainPagesFS, "templates")
@@ -119,12 +275,46 @@ func run(cfg *config) error {
 		"templates")
 	//panic would occur if error occured during the loading of templates.
 	r := chi.NewRouter()
+	if cfg.trustProxyHeaders {
+		// failed sign ins are counted against the IP address of the client, not the one of the reverse proxy
+		r.Use(middleware.RealIP)
+	}
 	// r.Use(middleware.Logger)
 	// r.Handle("/images/*", http.StripPrefix("/images/", models.LoadImageFileServer("./images")))
 
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.rateLimits.storeType == "postgres" {
+		rateLimitStore = dbc.RateLimitService
+	}
+	// the forms are limited by IP address, as whoever is sending them is usually not signed in yet
+	authFormsRateLimit := controllers.RateLimit(
+		rateLimitStore, "auth_forms", cfg.rateLimits.authForms, controllers.RateLimitByIP)
+	uploadsRateLimit := controllers.RateLimit(
+		rateLimitStore, "uploads", cfg.rateLimits.uploads, controllers.RateLimitByUser)
+	apiRateLimit := controllers.RateLimit(
+		rateLimitStore, "api", cfg.rateLimits.api, controllers.RateLimitByUser)
+
 	userContext := controllers.NewUserContext(dbc.UserService)
 	makeHandler, render := controllers.InitTemplateHandler(mainPagesTemplate, userContext)
 
+	users := &controllers.Users{
+		Template:               mainPagesTemplate,
+		UserService:            dbc.UserService,
+		APITokenService:        dbc.APITokenService,
+		TwoFactorService:       dbc.TwoFactorService,
+		SessionService:         dbc.SessionService,
+		EmailChangeService:     dbc.EmailChangeService,
+		IdentityService:        dbc.IdentityService,
+		PasskeyService:         dbc.PasskeyService,
+		DataExportService:      dbc.DataExportService,
+		AccountDeletionService: dbc.AccountDeletionService,
+	}
+	oidcProviders := controllers.NewOIDCProviders(cfg.oidcProviders, &http.Client{Timeout: oidcRequestTimeout})
+	for _, provider := range cfg.oidcProviders {
+		views.SocialSignInProviders = append(views.SocialSignInProviders,
+			views.SocialProvider{Name: provider.Name, DisplayName: provider.DisplayName})
+	}
+
 	// ##### Get Method Handlers #####
 	// these are not protected routes, so we just use the CookieAuthMiddleWare to test for existence of logged in user
 	r.Route("/", func(sr chi.Router) {
@@ -132,16 +322,31 @@ func run(cfg *config) error {
 		sr.Get("/contact", makeHandler("contact.gohtml"))
 		sr.Get("/signup", makeHandler("signup.gohtml"))
 		sr.Get("/signin", makeHandler("signin.gohtml"))
+		sr.Get("/signin/two_factor", makeHandler("two_factor.gohtml"))
 		sr.Get("/faq", makeHandler("faq.gohtml"))
 		sr.Get("/check_email", makeHandler("check_email.gohtml"))
 		sr.Get("/", makeHandler("home.gohtml"))
 		sr.Get("/forgot_password", makeHandler("forgot_password.gohtml"))
 		sr.Get("/reset_password", makeHandler("reset_password.gohtml"))
-		sr.Post("/signup", controllers.HandleSignupForm(dbc, render))
-		sr.Post("/signin", controllers.HandleSignInForm(dbc, render))
+		sr.Get("/signin/magic_link", makeHandler("magic_link.gohtml"))
+		sr.With(userContext.SetUserMW()).Get("/verify_email", controllers.HandleVerifyEmail(dbc, render))
+		sr.With(userContext.SetUserMW()).Get("/change_email", controllers.HandleConfirmEmailChange(dbc, render))
 		sr.Post("/signout", controllers.HandlerSignOut(dbc.SessionService, nil))
-		sr.Post("/reset_password", controllers.HandleForgotPasswordForm(dbc, cfg.baseUrl, emailService, render))
-		sr.Post("/reset_password_submit", controllers.HandlerResetPasswordForm(dbc, render))
+		sr.Group(func(sr chi.Router) {
+			sr.Use(authFormsRateLimit)
+			sr.Post("/signup", controllers.HandleSignupForm(dbc, cfg.baseUrl, emailService, render))
+			sr.Post("/signin", controllers.HandleSignInForm(dbc, cfg.baseUrl, emailService, render))
+			sr.Post("/signin/two_factor", controllers.HandleTwoFactorForm(dbc, cfg.baseUrl, emailService, render))
+			sr.Post("/reset_password", controllers.HandleForgotPasswordForm(dbc, cfg.baseUrl, emailService, render))
+			sr.Post("/reset_password_submit", controllers.HandlerResetPasswordForm(dbc, render))
+			sr.Post("/signin/magic_link", controllers.HandleMagicLinkRequestForm(dbc, cfg.baseUrl, emailService, render))
+			sr.Post("/signin/magic_link/confirm", controllers.HandleMagicLinkSignIn(dbc, render))
+			sr.Post("/signin/passkey/begin", controllers.BeginPasskeySignIn(dbc))
+			sr.Post("/signin/passkey", controllers.HandlePasskeySignIn(dbc, render))
+			sr.Post("/signin/oidc/{provider}", controllers.StartOIDCSignIn(dbc, oidcProviders, render))
+			sr.With(userContext.SetUserMW()).Get("/signin/oidc/{provider}/callback",
+				controllers.HandleOIDCCallback(dbc, oidcProviders, users, cfg.baseUrl, emailService, render))
+		})
 	})
 
 	// these are protected routes, so we use the CookieAuthMiddleWare to test for existence of logged in user and redirect
@@ -149,14 +354,43 @@ func run(cfg *config) error {
 	r.Route("/user", func(sr chi.Router) {
 		sr.Use(controllers.CookieAuthMiddleWare(dbc.SessionService, nil, true, false))
 		sr.Use(userContext.SetUserMW())
-		sr.Get("/about", makeHandler("user_info.gohtml"))
+		sr.Get("/about", users.About)
+		sr.Get("/verify_email", makeHandler("verify_email.gohtml"))
+		sr.With(authFormsRateLimit).Post("/verify_email/resend",
+			controllers.HandleResendVerificationEmail(dbc, cfg.baseUrl, emailService, render))
+		sr.With(authFormsRateLimit).Post("/change_email", users.RequestEmailChange(cfg.baseUrl, emailService))
+		sr.Post("/change_email/cancel", users.CancelEmailChange)
+		sr.With(authFormsRateLimit).Post("/change_password", users.ChangePassword(cfg.baseUrl, emailService))
+		sr.Post("/api_tokens", users.CreateAPIToken)
+		sr.Post("/api_tokens/{tokenId}/revoke", users.RevokeAPIToken)
+		sr.Get("/sessions", users.Sessions)
+		sr.Post("/sessions/{sessionId}/revoke", users.RevokeSession)
+		sr.Post("/sessions/revoke_others", users.RevokeOtherSessions)
+		sr.Post("/two_factor/setup", users.SetupTwoFactor)
+		sr.Post("/two_factor/confirm", users.ConfirmTwoFactor)
+		sr.Post("/two_factor/disable", users.DisableTwoFactor)
+		sr.Post("/two_factor/recovery_codes", users.RegenerateRecoveryCodes)
+		sr.Post("/identities/{provider}/link", users.LinkIdentity(oidcProviders))
+		sr.Post("/identities/{identityId}/unlink", users.UnlinkIdentity)
+		sr.Get("/passkeys", users.Passkeys)
+		sr.Post("/passkeys/register/begin", users.BeginPasskeyRegistration)
+		sr.Post("/passkeys", users.FinishPasskeyRegistration)
+		sr.Post("/passkeys/{passkeyId}/delete", users.DeletePasskey)
+		sr.Post("/data_export", users.RequestDataExport(cfg.baseUrl, emailService))
+		sr.Get("/data_export/download", users.DownloadDataExport)
+		sr.With(authFormsRateLimit).Post("/delete", users.ScheduleAccountDeletion(cfg.baseUrl, emailService))
+		sr.Post("/delete/cancel", users.CancelAccountDeletion)
 	})
 	r.Route("/galleries", func(sr chi.Router) {
 		sr.Group(func(sr chi.Router) {
 			sr.Use(controllers.CookieAuthMiddleWare(dbc.SessionService, nil, false, false))
 			sr.Use(userContext.SetUserMW())
 			sr.Get("/{id}", galleries.View(dbc.GalleryService))
-			sr.Handle("/{id}/images/{filename}", controllers.ServeImage())
+			sr.Handle("/{id}/images/{filename}", controllers.ServeImage(dbc.GalleryService))
+			sr.Get("/{id}/download", galleries.DownloadGallery(dbc.GalleryService))
+			sr.Get("/u/{slug}", galleries.View(dbc.GalleryService))
+			sr.Get("/u/{slug}/download", galleries.DownloadGallery(dbc.GalleryService))
+			sr.Handle("/u/{slug}/images/{filename}", controllers.ServeImage(dbc.GalleryService))
 		})
 		sr.Group(func(sr chi.Router) {
 			sr.Use(middleware.Logger)
@@ -169,10 +403,66 @@ func run(cfg *config) error {
 			sr.Post("/edit", galleries.HandleEdit(dbc.GalleryService))
 			sr.Post("/{id}/delete", galleries.HandleDelete(dbc.GalleryService))
 			sr.Post("/{id}/images/{filename}/delete", galleries.DeleteImage(dbc.GalleryService))
-			sr.Post("/{id}/images", galleries.UploadImage(dbc.GalleryService))
+			sr.Post("/{id}/images/{filename}/caption", galleries.UpdateImageCaption(dbc.GalleryService))
+			sr.With(uploadsRateLimit).Post("/{id}/images", galleries.UploadImage(dbc.GalleryService))
+			sr.Post("/{id}/members", galleries.InviteMember(dbc.GalleryService, cfg.baseUrl, emailService))
+			sr.Post("/{id}/members/{memberId}/delete", galleries.RemoveMember(dbc.GalleryService))
+			sr.Get("/invites/accept", galleries.AcceptInvite(dbc.GalleryService))
+			sr.Post("/{id}/share_links", galleries.CreateShareLink(dbc.GalleryService, cfg.baseUrl))
+			sr.Post("/{id}/share_links/{linkId}/revoke", galleries.RevokeShareLink(dbc.GalleryService))
 		})
 	})
 
+	// share links are used by people without accounts, so never redirect to sign in
+	r.Route("/s/{token}", func(sr chi.Router) {
+		sr.Use(controllers.CookieAuthMiddleWare(dbc.SessionService, nil, false, false))
+		sr.Use(userContext.SetUserMW())
+		sr.Get("/", galleries.SharedView(dbc.GalleryService))
+		sr.With(authFormsRateLimit).Post("/unlock", galleries.UnlockShareLink(dbc.GalleryService, dbc.LoginThrottleService))
+		sr.Get("/download", galleries.DownloadSharedGallery(dbc.GalleryService))
+		sr.Handle("/images/{filename}", controllers.ServeSharedImage(dbc.GalleryService))
+	})
+
+	// the admin console answers everyone but signed in admins with a 404, as if it were not there
+	admin := &controllers.Admin{
+		Template:       mainPagesTemplate,
+		AdminService:   dbc.AdminService,
+		GalleryService: dbc.GalleryService,
+		SessionService: dbc.SessionService,
+	}
+	r.Route("/admin", func(sr chi.Router) {
+		sr.Use(middleware.Logger)
+		sr.Use(controllers.CookieAuthMiddleWare(dbc.SessionService, nil, true, false))
+		sr.Use(userContext.SetUserMW())
+		sr.Use(controllers.RequireAdmin)
+		sr.Get("/", http.RedirectHandler("/admin/users", http.StatusFound).ServeHTTP)
+		sr.Get("/users", admin.Users)
+		sr.Get("/users/{userId}", admin.User)
+		sr.Post("/users/{userId}/disable", admin.DisableUser)
+		sr.Post("/users/{userId}/enable", admin.EnableUser)
+		sr.Post("/users/{userId}/reset_password", admin.ForcePasswordReset(cfg.baseUrl, emailService))
+		sr.Post("/users/{userId}/revoke_sessions", admin.RevokeSessions)
+		sr.Get("/galleries/{galleryId}", admin.Gallery)
+		sr.Get("/galleries/{galleryId}/images/{filename}", admin.GalleryImage)
+	})
+
+	api := &controllers.API{GalleryService: dbc.GalleryService}
+	r.Route("/api/v1", func(sr chi.Router) {
+		sr.Use(controllers.APIAuthMiddleWare(dbc.SessionService, dbc.APITokenService))
+		sr.Use(controllers.RequireAPIUser)
+		sr.Use(apiRateLimit)
+		sr.NotFound(controllers.APINotFound)
+		sr.Get("/galleries", api.ListGalleries)
+		sr.Post("/galleries", api.CreateGallery)
+		sr.Get("/galleries/{id}", api.GetGallery)
+		sr.Patch("/galleries/{id}", api.RenameGallery)
+		sr.Delete("/galleries/{id}", api.DeleteGallery)
+		sr.Get("/galleries/{id}/images", api.ListImages)
+		sr.With(uploadsRateLimit).Post("/galleries/{id}/images", api.UploadImages)
+		sr.Put("/galleries/{id}/images/order", api.ReorderImages)
+		sr.Delete("/galleries/{id}/images/{filename}", api.DeleteImage)
+	})
+
 	r.Get("/test_cookie", makeHandler("test_cookie.gohtml"))
 	r.Get("/send_cookie", controllers.TestSendCookie)
 	r.Get("/test_alert", makeHandler("test_alert.gohtml"))
@@ -184,8 +474,42 @@ func run(cfg *config) error {
 
 	CSRFMw := controllers.CSRFProtect(cfg.isDev, cfg.csrfSecretKey)
 
-	fmt.Println("Starting the server on :3000...")
-	return (http.ListenAndServe(":3000", CSRFMw(r)))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var janitorWG sync.WaitGroup
+	janitorWG.Add(1)
+	go func() {
+		defer janitorWG.Done()
+		janitor.New(janitor.Tasks(dbc, cfg.janitorConfig)).Run(ctx)
+	}()
+
+	server := &http.Server{
+		Addr:    ":3000",
+		Handler: controllers.SkipCSRFForAPITokens(CSRFMw(r)),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Println("Starting the server on :3000...")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		// the server failed to start, so the janitor is stopped before returning
+		stop()
+	case <-ctx.Done():
+		fmt.Println("Shutting down the server...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	}
+	// the database is only closed once the janitor has finished whatever task it was running
+	janitorWG.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
 func readBaseUrl(envVars *models.Envs) (string, error) {
@@ -212,6 +536,41 @@ func readIsDev(envVars *models.Envs) (bool, error) {
 	return envIsDev, nil
 }
 
+func readJanitorConfig(envVars *models.Envs) (janitor.Config, error) {
+	janitorConfig := janitor.DefaultConfig()
+	interval, err := envVars.GetOptionalDuration("JANITORINTERVAL", janitorConfig.Interval)
+	if err != nil {
+		return janitor.Config{}, err
+	}
+	imageInterval, err := envVars.GetOptionalDuration("JANITORIMAGEINTERVAL", janitorConfig.ImageInterval)
+	if err != nil {
+		return janitor.Config{}, err
+	}
+	janitorConfig.Interval = interval
+	janitorConfig.ImageInterval = imageInterval
+	return janitorConfig, nil
+}
+
+func readRateLimitConfig(envVars *models.Envs) (rateLimitConfig, error) {
+	storeType, err := envVars.GetRateLimitStoreType()
+	if err != nil {
+		return rateLimitConfig{}, err
+	}
+	authForms, err := envVars.GetOptionalRateLimit("RATELIMITAUTHFORMS", ratelimit.Limit{Requests: 10, Per: time.Minute})
+	if err != nil {
+		return rateLimitConfig{}, err
+	}
+	uploads, err := envVars.GetOptionalRateLimit("RATELIMITUPLOADS", ratelimit.Limit{Requests: 30, Per: time.Minute})
+	if err != nil {
+		return rateLimitConfig{}, err
+	}
+	api, err := envVars.GetOptionalRateLimit("RATELIMITAPI", ratelimit.Limit{Requests: 120, Per: time.Minute})
+	if err != nil {
+		return rateLimitConfig{}, err
+	}
+	return rateLimitConfig{storeType, authForms, uploads, api}, nil
+}
+
 func getEmailEnvVars(envVars *models.Envs) (*models.EmailEnvs, error) {
 	emailEnvs, err := envVars.LoadEmailEnvs()
 	if err != nil {
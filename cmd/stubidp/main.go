@@ -0,0 +1,39 @@
+/*
+stubidp runs the stub OpenID Connect provider of oidctest, for trying out social sign in locally without registering with
+a real provider. It signs in whichever user the flags describe without asking. To use it, add to .env:
+
+	OIDCPROVIDERS="stub"
+	OIDC_STUB_ISSUER="http://localhost:9096"
+	OIDC_STUB_CLIENTID="lenslocked"
+	OIDC_STUB_CLIENTSECRET="stub-secret"
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/sohWenMing/lenslocked/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9096", "the address to listen on")
+	clientID := flag.String("client-id", "lenslocked", "the client id lenslocked is configured with")
+	clientSecret := flag.String("client-secret", "stub-secret", "the client secret lenslocked is configured with")
+	subject := flag.String("sub", "stub-user", "the subject of the user that is signed in")
+	email := flag.String("email", "user@example.com", "the email address of the user that is signed in")
+	isEmailVerified := flag.Bool("email-verified", true, "whether the email address of the user is verified")
+	flag.Parse()
+
+	provider, err := oidctest.New("http://"+*addr, *clientID, *clientSecret)
+	if err != nil {
+		panic(err)
+	}
+	provider.SetUser(oidctest.User{Subject: *subject, Email: *email, EmailVerified: *isEmailVerified, Name: *subject})
+	fmt.Printf("stub provider listening at http://%s, signing in %s\n", *addr, *email)
+	err = http.ListenAndServe(*addr, provider)
+	if err != nil {
+		panic(err)
+	}
+}
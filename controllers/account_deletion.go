@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+ScheduleAccountDeletion schedules the signed in user's account to be deleted once they enter their password again. The
+account is only deleted once the grace period has passed, and the user is emailed in case they did not ask for it, so
+they can sign in and cancel.
+*/
+func (u *Users) ScheduleAccountDeletion(baseUrl string, emailer *services.EmailService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		userInfo, _ := GetUserInfoFromContext(r)
+		scheduledFor, err := u.AccountDeletionService.Schedule(userId, r.FormValue("password"))
+		if err != nil {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error scheduling account deletion: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			u.renderAbout(w, r, nil, []string{err.Error()})
+			return
+		}
+		err = emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      userInfo.Email,
+			Subject: "Your account is going to be deleted",
+			Cc:      []string{},
+		}, "account_deletion_email.gohtml", services.AccountDeletionEmailData{
+			URL:          fmt.Sprintf("%s/user/about", baseUrl),
+			ScheduledFor: scheduledFor.UTC().Format("2 Jan 2006 15:04 MST"),
+		})
+		if err != nil {
+			fmt.Println("error sending account deletion email: ", err)
+		}
+		http.Redirect(w, r, "/user/about", http.StatusFound)
+	}
+}
+
+// CancelAccountDeletion cancels the deletion of the signed in user's account
+func (u *Users) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	err := u.AccountDeletionService.Cancel(userId)
+	if err != nil {
+		u.renderAbout(w, r, nil, []string{models.MapHandledGenericError(err).Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/about", http.StatusFound)
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+/*
+Admin serves the admin console, where admins can find users, look at their galleries whatever their visibility, and
+disable their accounts, reset their passwords or sign them out. Every route of the console must be behind RequireAdmin.
+The accounts of admins cannot be changed from the console - admins are only made or unmade with -grant-admin.
+*/
+type Admin struct {
+	Template       ExecutorTemplateWithCSRF
+	AdminService   *models.AdminService
+	GalleryService *models.GalleryService
+	SessionService *models.SessionService
+}
+
+/*
+RequireAdmin only lets through requests from signed in admins, and must be used after SetUserMW. Everyone else gets a
+404, so that the console cannot be found by trying routes.
+*/
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userInfo, _ := GetUserInfoFromContext(r)
+		if !userInfo.IsAdmin() {
+			ErrNotFoundHandler(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Users renders a page of the users whose email address contains the "q" query param, or of every user without it
+func (a *Admin) Users(w http.ResponseWriter, r *http.Request) {
+	adminId, _ := GetUserIdFromRequestContext(r)
+	query := r.URL.Query().Get("q")
+	// pages that are out of range or not numbers fall back to the first page
+	pageNumber, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page := models.NewPage(pageNumber, models.DefaultPageSize)
+	users, total, err := a.AdminService.SearchUsers(query, page)
+	if err != nil {
+		fmt.Println("error searching users: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	csrfToken := GetCSRFTokenFromRequest(r)
+	w.Header().Set("content-type", "text/html")
+	a.Template.ExecTemplateWithCSRF(w, r, csrfToken, "admin_users.gohtml",
+		views.InitPageData(adminId, views.InitAdminUsersData(query, users, total, page)), nil)
+}
+
+/*
+User renders the page of a single user, with their galleries, the devices they are signed in on and what admins have
+done to their account.
+*/
+func (a *Admin) User(w http.ResponseWriter, r *http.Request) {
+	user, isFound := a.getUserFromRequest(w, r)
+	if !isFound {
+		return
+	}
+	a.renderUser(w, r, user, nil)
+}
+
+// DisableUser disables the account of a user and signs them out everywhere
+func (a *Admin) DisableUser(w http.ResponseWriter, r *http.Request) {
+	a.handleUserAction(w, r, models.AdminDisabledUser, a.AdminService.DisableUser)
+}
+
+// EnableUser lets a user that was disabled sign in again
+func (a *Admin) EnableUser(w http.ResponseWriter, r *http.Request) {
+	a.handleUserAction(w, r, models.AdminEnabledUser, a.AdminService.EnableUser)
+}
+
+// RevokeSessions signs a user out of every device they are signed in on
+func (a *Admin) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	a.handleUserAction(w, r, models.AdminRevokedSessions, a.SessionService.ExpireSessionsTokensByUserId)
+}
+
+/*
+ForcePasswordReset replaces a user's password with one nobody knows and signs them out everywhere, then emails them to
+choose a new password with the forgot password form.
+*/
+func (a *Admin) ForcePasswordReset(baseUrl string, emailer *services.EmailService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, isDone := a.doUserAction(w, r, models.AdminForcedPasswordReset, a.AdminService.ForcePasswordReset)
+		if !isDone {
+			return
+		}
+		err := emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      user.Email,
+			Subject: "Your password has been reset",
+			Cc:      []string{},
+		}, "password_reset_required_email.gohtml", services.EmailData{
+			URL: fmt.Sprintf("%s/forgot_password", baseUrl),
+		})
+		if err != nil {
+			fmt.Println("error sending password reset required email: ", err)
+		}
+		http.Redirect(w, r, views.AdminUserPath(user.ID), http.StatusFound)
+	}
+}
+
+// Gallery renders the images of any gallery, whatever its visibility
+func (a *Admin) Gallery(w http.ResponseWriter, r *http.Request) {
+	adminId, _ := GetUserIdFromRequestContext(r)
+	gallery, isFound := a.getGalleryFromRequest(w, r)
+	if !isFound {
+		return
+	}
+	images, err := a.GalleryService.GetImagesByGalleryId(gallery.ID)
+	if err != nil {
+		fmt.Println("error getting gallery images: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	csrfToken := GetCSRFTokenFromRequest(r)
+	w.Header().Set("content-type", "text/html")
+	a.Template.ExecTemplateWithCSRF(w, r, csrfToken, "admin_gallery.gohtml",
+		views.InitPageData(adminId, views.InitAdminGalleryData(gallery, images)), nil)
+}
+
+// GalleryImage serves an image of any gallery, whatever its visibility
+func (a *Admin) GalleryImage(w http.ResponseWriter, r *http.Request) {
+	gallery, isFound := a.getGalleryFromRequest(w, r)
+	if !isFound {
+		return
+	}
+	w.Header().Set("Cache-Control", "private")
+	writeImage(w, r, a.GalleryService, gallery.ID, getImageFilenameFromRequest(r), r.URL.Query().Get("size"), false)
+}
+
+// runs action on the user in the "userId" URL param, then sends the admin back to the user's page
+func (a *Admin) handleUserAction(w http.ResponseWriter, r *http.Request, actionKind models.AdminActionKind,
+	action func(userId int) error) {
+	user, isDone := a.doUserAction(w, r, actionKind, action)
+	if !isDone {
+		return
+	}
+	http.Redirect(w, r, views.AdminUserPath(user.ID), http.StatusFound)
+}
+
+/*
+runs action on the user in the "userId" URL param, and records which admin did it as actionKind. Actions are refused on
+admins, including the admin running them, so that one admin cannot lock another out of the console. isDone is false if a
+response has already been written, because the user could not be found, is an admin or the action failed.
+*/
+func (a *Admin) doUserAction(w http.ResponseWriter, r *http.Request, actionKind models.AdminActionKind,
+	action func(userId int) error) (user models.AdminUser, isDone bool) {
+	adminId, _ := GetUserIdFromRequestContext(r)
+	user, isFound := a.getUserFromRequest(w, r)
+	if !isFound {
+		return models.AdminUser{}, false
+	}
+	if user.IsAdmin() {
+		a.renderUser(w, r, user, []string{"the accounts of admins cannot be changed from the admin console"})
+		return models.AdminUser{}, false
+	}
+	err := action(user.ID)
+	if err != nil {
+		if !models.IsUserFacingErr(err) {
+			fmt.Println("error running admin action: ", err)
+			err = models.MapHandledGenericError(err)
+		}
+		a.renderUser(w, r, user, []string{err.Error()})
+		return models.AdminUser{}, false
+	}
+	err = a.AdminService.RecordAction(adminId, user.ID, actionKind)
+	if err != nil {
+		// the action has already been done, so it is not undone because it could not be recorded
+		fmt.Println("error recording admin action: ", err)
+	}
+	return user, true
+}
+
+func (a *Admin) renderUser(w http.ResponseWriter, r *http.Request, user models.AdminUser, errorMsgs []string) {
+	adminId, _ := GetUserIdFromRequestContext(r)
+	galleries, err := a.GalleryService.GetGalleryListByUserId(user.ID)
+	if err != nil {
+		fmt.Println("error getting galleries of user: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sessions, err := a.SessionService.GetActiveSessionsByUserId(user.ID)
+	if err != nil {
+		fmt.Println("error getting sessions of user: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	actions, err := a.AdminService.GetActionsByUserId(user.ID)
+	if err != nil {
+		fmt.Println("error getting admin actions of user: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	csrfToken := GetCSRFTokenFromRequest(r)
+	w.Header().Set("content-type", "text/html")
+	a.Template.ExecTemplateWithCSRF(w, r, csrfToken, "admin_user.gohtml",
+		views.InitPageData(adminId, views.InitAdminUserData(user, galleries, sessions, actions)), errorMsgs)
+}
+
+// returns the user in the "userId" URL param. isFound is false if a response has already been written
+func (a *Admin) getUserFromRequest(w http.ResponseWriter, r *http.Request) (user models.AdminUser, isFound bool) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return models.AdminUser{}, false
+	}
+	user, err = a.AdminService.GetUser(userId)
+	if models.IsNoRowsErr(err) {
+		ErrNotFoundHandler(w, r)
+		return models.AdminUser{}, false
+	}
+	if err != nil {
+		fmt.Println("error getting user: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return models.AdminUser{}, false
+	}
+	return user, true
+}
+
+// returns the gallery in the "galleryId" URL param. isFound is false if a response has already been written
+func (a *Admin) getGalleryFromRequest(w http.ResponseWriter, r *http.Request) (gallery *models.Gallery, isFound bool) {
+	galleryId, err := strconv.Atoi(chi.URLParam(r, "galleryId"))
+	if err != nil {
+		ErrNotFoundHandler(w, r)
+		return nil, false
+	}
+	gallery, err = a.GalleryService.GetById(galleryId)
+	if models.IsNoRowsErr(err) {
+		ErrNotFoundHandler(w, r)
+		return nil, false
+	}
+	if err != nil {
+		fmt.Println("error getting gallery: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return gallery, true
+}
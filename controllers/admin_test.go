@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/models"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	handler := RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	type test struct {
+		name           string
+		userInfo       *models.UserInfo
+		expectedStatus int
+	}
+	tests := []test{
+		{"no user", nil, http.StatusNotFound},
+		{"user", &models.UserInfo{ID: 1, Email: "user@test.com", Role: models.RoleUser}, http.StatusNotFound},
+		{"admin", &models.UserInfo{ID: 1, Email: "admin@test.com", Role: models.RoleAdmin}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			if test.userInfo != nil {
+				r = r.WithContext(context.WithValue(r.Context(), userInfoKey, *test.userInfo))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+			if rr.Code != test.expectedStatus {
+				t.Errorf("got status %d, want %d", rr.Code, test.expectedStatus)
+			}
+		})
+	}
+}
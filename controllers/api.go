@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+// maxAPIBodyBytes caps the size of the JSON bodies the API will decode. Image uploads are multipart, and capped separately
+const maxAPIBodyBytes = 1 << 20
+
+/*
+API serves the versioned JSON API at /api/v1, so that clients other than browsers can work with galleries and images
+without scraping the HTML pages. It goes through the same GalleryService methods and role checks as Galleries.
+
+Every error is written as a JSON body of the form {"error": {"status": 404, "message": "..."}} - see writeAPIError.
+*/
+type API struct {
+	GalleryService *models.GalleryService
+}
+
+type apiGallery struct {
+	ID                int    `json:"id"`
+	Title             string `json:"title"`
+	Visibility        string `json:"visibility"`
+	Slug              string `json:"slug,omitempty"`
+	KeepPhotoMetadata bool   `json:"keep_photo_metadata"`
+	URL               string `json:"url"`
+}
+
+type apiImage struct {
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	SizeBytes   int64      `json:"size_bytes"`
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Position    int        `json:"position"`
+	Caption     string     `json:"caption"`
+	UploadedAt  time.Time  `json:"uploaded_at"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"`
+	URL         string     `json:"url"`
+}
+
+type apiPagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+type apiData struct {
+	Data       any            `json:"data"`
+	Pagination *apiPagination `json:"pagination,omitempty"`
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+/*
+RequireAPIUser is used in place of a redirect to the sign in page for API routes - requests without a signed in user
+are answered with a 401 error body, and requests that would change data made with a read scoped API token with a 403.
+
+For clients signed in with a session cookie, the CSRF token for the session is sent back in the X-CSRF-Token header,
+which they must echo back on POST, PATCH, PUT and DELETE requests.
+*/
+func RequireAPIUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		if userId == 0 {
+			writeAPIError(w, http.StatusUnauthorized, "you must be signed in or send an API token to use the API")
+			return
+		}
+		apiToken, isFound := getAPITokenFromContext(r)
+		if !isFound {
+			w.Header().Set("X-CSRF-Token", csrf.Token(r))
+			next.ServeHTTP(w, r)
+			return
+		}
+		isReadOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if !isReadOnly && !apiToken.Scope.CanWrite() {
+			writeAPIError(w, http.StatusForbidden, "this API token can only be used to read")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// APINotFound answers requests for API routes that do not exist with a 404 error body
+func APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "no API route matches "+r.Method+" "+r.URL.Path)
+}
+
+// ListGalleries lists a page of the galleries created by the signed in user
+func (a *API) ListGalleries(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	page, err := getPageFromRequest(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	galleries, total, err := a.GalleryService.GetGalleryPageByUserId(userId, page)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	data := make([]apiGallery, len(galleries))
+	for i, gallery := range galleries {
+		data[i] = toAPIGallery(gallery)
+	}
+	writeJSON(w, http.StatusOK, apiData{data, getAPIPagination(page, total)})
+}
+
+// CreateGallery creates a gallery owned by the signed in user from a body of the form {"title": "..."}
+func (a *API) CreateGallery(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	var body struct {
+		Title string `json:"title"`
+	}
+	err := decodeAPIBody(w, r, &body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		writeAPIError(w, http.StatusBadRequest, "title cannot be blank")
+		return
+	}
+	gallery, err := a.GalleryService.Create(title, userId)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/galleries/%d", gallery.ID))
+	writeJSON(w, http.StatusCreated, apiData{Data: toAPIGallery(gallery)})
+}
+
+// GetGallery returns a gallery to anyone allowed to view it. Galleries the user cannot view are reported as not found
+func (a *API) GetGallery(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, _, err := getViewableGallery(r, a.GalleryService, userId)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, models.NoGalleryFound.String())
+		return
+	}
+	writeJSON(w, http.StatusOK, apiData{Data: toAPIGallery(gallery)})
+}
+
+// RenameGallery sets the title of a gallery from a body of the form {"title": "..."}
+func (a *API) RenameGallery(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, _, err := getAuthorizedGallery(r, a.GalleryService, userId, models.GalleryRole.CanEdit)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	var body struct {
+		Title string `json:"title"`
+	}
+	err = decodeAPIBody(w, r, &body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		writeAPIError(w, http.StatusBadRequest, "title cannot be blank")
+		return
+	}
+	err = a.GalleryService.UpdateTitle(gallery.ID, title)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	gallery.Title = title
+	writeJSON(w, http.StatusOK, apiData{Data: toAPIGallery(gallery)})
+}
+
+// DeleteGallery deletes a gallery along with its images
+func (a *API) DeleteGallery(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, _, err := getAuthorizedGallery(r, a.GalleryService, userId, models.GalleryRole.CanDeleteGallery)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	err = a.GalleryService.DeleteById(gallery.ID)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListImages lists a page of the images in a gallery, in display order
+func (a *API) ListImages(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, _, err := getViewableGallery(r, a.GalleryService, userId)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, models.NoGalleryFound.String())
+		return
+	}
+	page, err := getPageFromRequest(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	images, total, err := a.GalleryService.GetImagePageByGalleryId(gallery.ID, page)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiData{toAPIImages(gallery, images), getAPIPagination(page, total)})
+}
+
+/*
+UploadImages adds the files sent as the "images" field of a multipart form to a gallery, in the same way as
+Galleries.UploadImage. The records of the uploaded images are returned.
+*/
+func (a *API) UploadImages(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, _, err := getAuthorizedGallery(r, a.GalleryService, userId, models.GalleryRole.CanUpload)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	isTooLarge, err := parseUploadForm(w, r)
+	if isTooLarge {
+		writeAPIError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("uploads can be at most %d MB", maxUploadBodyBytes>>20))
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "images must be sent as a multipart form")
+		return
+	}
+	fileHeaders := r.MultipartForm.File["images"]
+	if len(fileHeaders) == 0 {
+		writeAPIError(w, http.StatusBadRequest, `no files were sent in the "images" field`)
+		return
+	}
+	uploaded := []*models.Image{}
+	for _, fileHeader := range fileHeaders {
+		file, err := fileHeader.Open()
+		if err != nil {
+			writeAPIErr(w, err)
+			return
+		}
+		defer file.Close()
+		err = models.ValidateContentType(file, a.GalleryService.GetAllowableContentTypes())
+		if err != nil {
+			writeAPIError(w, http.StatusUnsupportedMediaType, err.Error())
+			return
+		}
+		img, err := a.GalleryService.CreateImage(gallery.ID, userId, fileHeader.Filename, file)
+		if err != nil {
+			writeAPIErr(w, err)
+			return
+		}
+		uploaded = append(uploaded, img)
+	}
+	writeJSON(w, http.StatusCreated, apiData{Data: toAPIImages(gallery, uploaded)})
+}
+
+/*
+ReorderImages sets the display order of the images in a gallery from a body of the form {"filenames": ["a.jpg", ...]},
+which must list every image in the gallery. The images are returned in their new order.
+*/
+func (a *API) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, _, err := getAuthorizedGallery(r, a.GalleryService, userId, models.GalleryRole.CanEdit)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	var body struct {
+		Filenames []string `json:"filenames"`
+	}
+	err = decodeAPIBody(w, r, &body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = a.GalleryService.ReorderImages(gallery.ID, body.Filenames)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	images, err := a.GalleryService.GetImagesByGalleryId(gallery.ID)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiData{Data: toAPIImages(gallery, images)})
+}
+
+// DeleteImage deletes an image from a gallery, if the user's role allows them to manage it
+func (a *API) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	gallery, img, err := getAuthorizedImage(r, a.GalleryService, userId)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	err = a.GalleryService.DeleteImage(gallery.ID, img.Filename)
+	if err != nil {
+		writeAPIErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toAPIGallery(gallery *models.Gallery) apiGallery {
+	return apiGallery{
+		ID:                gallery.ID,
+		Title:             gallery.Title,
+		Visibility:        string(gallery.Visibility),
+		Slug:              gallery.Slug,
+		KeepPhotoMetadata: gallery.KeepPhotoMetadata,
+		URL:               views.GalleryPath(gallery.ID),
+	}
+}
+
+func toAPIImages(gallery *models.Gallery, images []*models.Image) []apiImage {
+	data := make([]apiImage, len(images))
+	for i, img := range images {
+		data[i] = apiImage{
+			Filename:    img.Filename,
+			ContentType: img.ContentType,
+			SizeBytes:   img.SizeBytes,
+			Width:       img.Width,
+			Height:      img.Height,
+			Position:    img.Position,
+			Caption:     img.Caption,
+			UploadedAt:  img.UploadedAt,
+			URL:         views.GalleryImagePath(views.GalleryPath(gallery.ID), img.Filename),
+		}
+		if !img.TakenAt.IsZero() {
+			data[i].TakenAt = &img.TakenAt
+		}
+	}
+	return data
+}
+
+func getAPIPagination(page models.Page, total int) *apiPagination {
+	return &apiPagination{
+		Page:       page.Number,
+		PerPage:    page.Size,
+		Total:      total,
+		TotalPages: (total + page.Size - 1) / page.Size,
+	}
+}
+
+// reads the "page" and "per_page" query parameters. Either can be left out, and per_page is capped at models.MaxPageSize
+func getPageFromRequest(r *http.Request) (models.Page, error) {
+	params := map[string]int{"page": 1, "per_page": models.DefaultPageSize}
+	for name := range params {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return models.Page{}, fmt.Errorf("%s must be a whole number greater than 0", name)
+		}
+		params[name] = number
+	}
+	return models.NewPage(params["page"], params["per_page"]), nil
+}
+
+// decodes a JSON request body in to dst. Unknown fields are rejected, so that typos in field names are not silently ignored
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodyBytes))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("request body is not valid JSON: %s", err.Error())
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		fmt.Println("writing API response: ", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiErrorBody{apiError{status, message}})
+}
+
+/*
+writes the error body for an error returned from the models package or the gallery authorization helpers. Errors from
+models.HandlePgError keep their message - rows that could not be found are reported as 404, and other user facing
+errors as 400. Anything else is reported as a 500 with the generic message, so internal details are not given away.
+*/
+func writeAPIErr(w http.ResponseWriter, err error) {
+	var numErr *strconv.NumError
+	switch {
+	case errors.Is(err, errGalleryForbidden), errors.Is(err, models.ErrEmailNotVerified):
+		writeAPIError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, models.ErrImageExists):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &numErr):
+		writeAPIError(w, http.StatusBadRequest, "ids in the path must be whole numbers")
+	case models.IsNoRowsErr(err):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case models.IsUserFacingErr(err):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	default:
+		fmt.Println("API error: ", err)
+		writeAPIError(w, http.StatusInternalServerError, models.MapHandledGenericError(err).Error())
+	}
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/csrf"
+	"github.com/sohWenMing/lenslocked/models"
+)
+
+func TestGetPageFromRequest(t *testing.T) {
+	type test struct {
+		name         string
+		query        string
+		expectedPage models.Page
+		isExpectErr  bool
+	}
+	tests := []test{
+		{"defaults", "", models.Page{Number: 1, Size: models.DefaultPageSize}, false},
+		{"page and per_page", "?page=3&per_page=5", models.Page{Number: 3, Size: 5}, false},
+		{"per_page is capped", "?per_page=1000", models.Page{Number: 1, Size: models.MaxPageSize}, false},
+		{"page is not a number", "?page=two", models.Page{}, true},
+		{"per_page is zero", "?per_page=0", models.Page{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/galleries"+test.query, nil)
+			got, err := getPageFromRequest(r)
+			if test.isExpectErr {
+				if err == nil {
+					t.Errorf("expected error, didn't get one")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("didn't expect error, got %v", err)
+				return
+			}
+			if got != test.expectedPage {
+				t.Errorf("got %+v, want %+v", got, test.expectedPage)
+			}
+		})
+	}
+}
+
+func TestWriteAPIErr(t *testing.T) {
+	_, numErr := strconv.Atoi("abc")
+	type test struct {
+		name           string
+		err            error
+		expectedStatus int
+	}
+	tests := []test{
+		{"forbidden", errGalleryForbidden, http.StatusForbidden},
+		{"gallery not viewable", errGalleryNotFound, http.StatusNotFound},
+		{"email not verified", models.ErrEmailNotVerified, http.StatusForbidden},
+		{"invalid id", numErr, http.StatusBadRequest},
+		{"not found", models.HandlePgError(sql.ErrNoRows, models.UserNotFoundByUserIdErr()), http.StatusNotFound},
+		{"user facing", models.MapHandledError(errors.New("duplicate"), "email has already been used"), http.StatusBadRequest},
+		{"internal", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			writeAPIErr(rr, test.err)
+			if rr.Code != test.expectedStatus {
+				t.Errorf("got status %d, want %d", rr.Code, test.expectedStatus)
+			}
+			var body apiErrorBody
+			err := json.NewDecoder(rr.Body).Decode(&body)
+			if err != nil {
+				t.Errorf("didn't expect error decoding body, got %v", err)
+				return
+			}
+			if body.Error.Status != test.expectedStatus || body.Error.Message == "" {
+				t.Errorf("got error body %+v, want status %d and a message", body.Error, test.expectedStatus)
+			}
+			if test.expectedStatus == http.StatusInternalServerError && body.Error.Message == test.err.Error() {
+				t.Errorf("internal error message was written to the response")
+			}
+		})
+	}
+}
+
+func TestParseUploadForm(t *testing.T) {
+	type test struct {
+		name             string
+		fileSize         int64
+		isExpectTooLarge bool
+	}
+	tests := []test{
+		{"upload under the limit", 1 << 20, false},
+		{"upload over the limit", maxUploadBodyBytes + 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the file is streamed into the body, so the test does not hold it all in memory
+			var head bytes.Buffer
+			writer := multipart.NewWriter(&head)
+			_, err := writer.CreateFormFile("images", "photo.jpg")
+			if err != nil {
+				t.Fatalf("didn't expect error, got %v\n", err)
+			}
+			tail := "\r\n--" + writer.Boundary() + "--\r\n"
+			body := io.MultiReader(&head, io.LimitReader(zeroReader{}, test.fileSize), strings.NewReader(tail))
+			r := httptest.NewRequest(http.MethodPost, "/api/galleries/1/images", body)
+			r.Header.Set("Content-Type", writer.FormDataContentType())
+			isTooLarge, err := parseUploadForm(httptest.NewRecorder(), r)
+			if isTooLarge != test.isExpectTooLarge {
+				t.Errorf("got too large %t %v, want %t\n", isTooLarge, err, test.isExpectTooLarge)
+			}
+			if !test.isExpectTooLarge && (err != nil || len(r.MultipartForm.File["images"]) != 1) {
+				t.Errorf("got %v, want the file parsed\n", err)
+			}
+			if r.MultipartForm != nil {
+				r.MultipartForm.RemoveAll()
+			}
+		})
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestRequireAPIUser(t *testing.T) {
+	handler := RequireAPIUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	type test struct {
+		name           string
+		method         string
+		userId         int
+		apiToken       *models.APIToken
+		expectedStatus int
+	}
+	tests := []test{
+		{"no user", http.MethodGet, 0, nil, http.StatusUnauthorized},
+		{"session user", http.MethodPost, 1, nil, http.StatusOK},
+		{"read token reading", http.MethodGet, 1, &models.APIToken{UserID: 1, Scope: models.ScopeRead}, http.StatusOK},
+		{"read token writing", http.MethodDelete, 1, &models.APIToken{UserID: 1, Scope: models.ScopeRead}, http.StatusForbidden},
+		{"write token writing", http.MethodPost, 1, &models.APIToken{UserID: 1, Scope: models.ScopeWrite}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "/api/v1/galleries", nil)
+			ctx := context.WithValue(r.Context(), userIdKey, test.userId)
+			if test.apiToken != nil {
+				ctx = context.WithValue(ctx, apiTokenKey, test.apiToken)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r.WithContext(ctx))
+			if rr.Code != test.expectedStatus {
+				t.Errorf("got status %d, want %d", rr.Code, test.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestSkipCSRFForAPITokens(t *testing.T) {
+	protected := csrf.Protect([]byte("32-byte-long-auth-key-for-tests!"), csrf.Secure(false))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	handler := SkipCSRFForAPITokens(protected)
+	type test struct {
+		name           string
+		path           string
+		authorization  string
+		expectedStatus int
+	}
+	tests := []test{
+		{"api request with bearer token", "/api/v1/galleries", "Bearer abc123", http.StatusOK},
+		{"api request with lower case scheme", "/api/v1/galleries", "bearer abc123", http.StatusOK},
+		{"api request without token", "/api/v1/galleries", "", http.StatusForbidden},
+		{"api request with blank token", "/api/v1/galleries", "Bearer ", http.StatusForbidden},
+		{"page request with bearer token", "/galleries/new", "Bearer abc123", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, test.path, nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+			if rr.Code != test.expectedStatus {
+				t.Errorf("got status %d, want %d", rr.Code, test.expectedStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+ChangePassword changes the signed in user's password once they enter their current one. Every other session of the user
+is signed out, in case the password is being changed because someone else knows it, and the user is emailed about the
+change.
+*/
+func (u *Users) ChangePassword(baseUrl string, emailer *services.EmailService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		userInfo, _ := GetUserInfoFromContext(r)
+		newPassword := r.FormValue("new_password")
+		if newPassword != r.FormValue("confirm_password") {
+			u.renderAbout(w, r, nil, []string{"passwords must match"})
+			return
+		}
+		err := u.UserService.ChangePassword(userId, r.FormValue("current_password"), newPassword)
+		if err != nil {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error changing password: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			u.renderAbout(w, r, nil, errorMsgsFromErr(err))
+			return
+		}
+		token, _ := GetSessionCookieFromRequest(r)
+		err = u.SessionService.ExpireOtherSessionsByUserId(userId, token)
+		if err != nil {
+			fmt.Println("error expiring other sessions after changing password: ", err)
+		}
+		err = emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      userInfo.Email,
+			Subject: "Your password has been changed",
+			Cc:      []string{},
+		}, "password_changed_email.gohtml", services.EmailData{
+			URL: fmt.Sprintf("%s/forgot_password", baseUrl),
+		})
+		if err != nil {
+			fmt.Println("error sending password changed email: ", err)
+		}
+		http.Redirect(w, r, "/user/about", http.StatusFound)
+	}
+}
@@ -2,6 +2,9 @@ package controllers
 
 import "io"
 
+// emailFromAddress is the address every email sent by the application is sent from
+const emailFromAddress = "wenming.soh@gmail.com"
+
 type Email struct {
 	From        string
 	To          string
@@ -81,8 +81,8 @@ If a session cookie is not found, then it will redirect user to the sign in page
 if a session cookie is found but it is expired, will redirect user to to login page after expiring the session,
 setting isExpired to true in database.
 
-If a session cookie is found but not expired, will refresh the session adding 15 minutes to the session and set the UserId in the context
-before passing on to the next middleware.
+If a session cookie is found but not expired, will refresh the session, pushing back its idle expiry as set by the
+SessionService's Lifetimes, and set the UserId in the context before passing on to the next middleware.
 
 Writer passed in is used to record results from the middleware to be used for testing purposes, can set to nil for actual usage
 isTestExpiry bool is used for testing purposes, can set to nil for actual usage
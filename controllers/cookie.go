@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"net/http"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/models"
 )
 
 /*
@@ -19,14 +22,68 @@ func SetExpireSessionCookieToResponseWriter(sessionToken string, w http.Response
 	http.SetCookie(w, cookie)
 }
 
+/*
+MapSessionCookie maps the cookie of a session that was not signed in with "remember me". It has no expiry, so it is
+removed when the browser is closed - how long the session lasts otherwise is enforced by the SessionService.
+*/
 func MapSessionCookie(token string) *http.Cookie {
-	return mapCookie("sessionToken", token, "/", true, 15)
+	return mapCookie("sessionToken", token, "/", true, 0)
+}
+
+// MapRememberMeSessionCookie maps the cookie of a "remember me" session, which lasts as long as the session can
+func MapRememberMeSessionCookie(token string, lifetime time.Duration) *http.Cookie {
+	return mapCookie("sessionToken", token, "/", true, int(lifetime/time.Minute))
 }
 
 func MapExpireSessionCookie(token string) *http.Cookie {
 	return mapCookie("sessionToken", token, "/", true, -1)
 }
 
+/*
+the two factor cookie holds the token of the challenge a sign in is held in until a code is entered. It only needs to
+be sent to the two factor page, and lasts as long as the challenge does. Whether "remember me" was checked is held
+alongside it, so the session created once the code is entered can be remembered.
+*/
+func SetTwoFactorCookieToResponseWriter(token string, isRememberMe bool, w http.ResponseWriter) {
+	maxAgeInMinutes := int(models.TwoFactorChallengeDuration / time.Minute)
+	http.SetCookie(w, mapCookie("twoFactorToken", token, "/signin", true, maxAgeInMinutes))
+	if isRememberMe {
+		http.SetCookie(w, mapCookie("twoFactorRememberMe", "true", "/signin", true, maxAgeInMinutes))
+	}
+}
+func SetExpireTwoFactorCookieToResponseWriter(w http.ResponseWriter) {
+	http.SetCookie(w, mapCookie("twoFactorToken", "", "/signin", true, -1))
+	http.SetCookie(w, mapCookie("twoFactorRememberMe", "", "/signin", true, -1))
+}
+func GetTwoFactorCookieFromRequest(r *http.Request) (token string, isRememberMe bool, isFound bool) {
+	cookie, err := r.Cookie("twoFactorToken")
+	if err != nil || cookie.Value == "" {
+		return "", false, false
+	}
+	rememberMeCookie, err := r.Cookie("twoFactorRememberMe")
+	isRememberMe = err == nil && rememberMeCookie.Value == "true"
+	return cookie.Value, isRememberMe, true
+}
+
+/*
+the OIDC state cookie holds the state of a sign in with an OpenID Connect provider, so that the callback can check it was
+started in the same browser. It is only sent to the callback, and lasts as long as the sign in can take.
+*/
+func SetOIDCStateCookieToResponseWriter(state string, w http.ResponseWriter) {
+	maxAgeInMinutes := int(models.OIDCAuthRequestDuration / time.Minute)
+	http.SetCookie(w, mapCookie("oidcState", state, "/signin/oidc", true, maxAgeInMinutes))
+}
+func SetExpireOIDCStateCookieToResponseWriter(w http.ResponseWriter) {
+	http.SetCookie(w, mapCookie("oidcState", "", "/signin/oidc", true, -1))
+}
+func GetOIDCStateCookieFromRequest(r *http.Request) (state string, isFound bool) {
+	cookie, err := r.Cookie("oidcState")
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
 func mapCookie(name, value, path string, HTTPOnly bool, maxAgeInMinutes int) *http.Cookie {
 	return &http.Cookie{
 		Name:     name,
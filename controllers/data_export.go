@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+RequestDataExport asks for an export of everything the signed in user has stored. The export is built in the background,
+as it means reading every image the user owns, and the user is emailed once it is ready to download from their account
+page.
+*/
+func (u *Users) RequestDataExport(baseUrl string, emailer *services.EmailService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userInfo, _ := GetUserInfoFromContext(r)
+		export, err := u.DataExportService.Request(userInfo.ID)
+		if err != nil {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error requesting data export: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			u.renderAbout(w, r, nil, []string{err.Error()})
+			return
+		}
+		go u.buildDataExport(export, userInfo.Email, baseUrl, emailer)
+		http.Redirect(w, r, "/user/about", http.StatusFound)
+	}
+}
+
+func (u *Users) buildDataExport(export models.DataExport, email string, baseUrl string, emailer *services.EmailService) {
+	err := u.DataExportService.Build(export)
+	if err != nil {
+		// the export has been marked as failed, which the account page shows
+		fmt.Println("error building data export: ", err)
+		return
+	}
+	err = emailer.SendTemplateMail(services.Email{
+		From:    emailFromAddress,
+		To:      email,
+		Subject: "Your data is ready to download",
+		Cc:      []string{},
+	}, "data_export_email.gohtml", services.EmailData{
+		URL: fmt.Sprintf("%s/user/about", baseUrl),
+	})
+	if err != nil {
+		fmt.Println("error sending data export email: ", err)
+	}
+}
+
+// DownloadDataExport sends the signed in user the archive of their export, once it is ready
+func (u *Users) DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	contents, export, err := u.DataExportService.Open(userId)
+	if models.IsNoRowsErr(err) {
+		u.renderAbout(w, r, nil, []string{err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("error opening data export: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer contents.Close()
+	filename := fmt.Sprintf("lenslocked-data-%s.zip", export.CompletedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if seeker, ok := contents.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, filename, export.CompletedAt, seeker)
+		return
+	}
+	io.Copy(w, contents)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+RequestEmailChange asks for the signed in user's email address to be changed, once they enter their password again. A
+link to confirm the change is sent to the new address, and a notice is sent to the current one in case someone else
+asked for it.
+*/
+func (u *Users) RequestEmailChange(baseUrl string, emailer *services.EmailService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		token, change, err := u.EmailChangeService.Request(userId, r.FormValue("password"), r.FormValue("new_email"))
+		if err != nil && !models.IsUserFacingErr(err) {
+			fmt.Println("error requesting email change: ", err)
+			err = models.MapHandledGenericError(err)
+		}
+		if err != nil {
+			u.renderAbout(w, r, nil, []string{err.Error()})
+			return
+		}
+		err = emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      change.NewEmail,
+			Subject: "Confirm your new email address",
+			Cc:      []string{},
+		}, "confirm_email_change_email.gohtml", services.EmailChangeEmailData{
+			URL:      fmt.Sprintf("%s/change_email?token=%s", baseUrl, url.QueryEscape(token)),
+			OldEmail: change.OldEmail,
+			NewEmail: change.NewEmail,
+		})
+		if err != nil {
+			fmt.Println("error sending email change confirmation: ", err)
+			// the link was never sent, so the change is cancelled rather than left waiting on it
+			u.EmailChangeService.Cancel(userId)
+			u.renderAbout(w, r, nil, []string{"There was a problem sending the email. Please try again in a while."})
+			return
+		}
+		err = emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      change.OldEmail,
+			Subject: "A change of your email address was asked for",
+			Cc:      []string{},
+		}, "email_change_notice_email.gohtml", services.EmailChangeEmailData{
+			URL:      fmt.Sprintf("%s/forgot_password", baseUrl),
+			OldEmail: change.OldEmail,
+			NewEmail: change.NewEmail,
+		})
+		if err != nil {
+			fmt.Println("error sending email change notice: ", err)
+		}
+		http.Redirect(w, r, "/user/about", http.StatusFound)
+	}
+}
+
+// CancelEmailChange cancels the change of email address the signed in user is waiting to confirm
+func (u *Users) CancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	err := u.EmailChangeService.Cancel(userId)
+	if err != nil {
+		u.renderAbout(w, r, nil, []string{models.MapHandledGenericError(err).Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/about", http.StatusFound)
+}
+
+/*
+HandleConfirmEmailChange changes a user's email address once the link sent to the new address is opened. The link can
+be opened in a browser that is not signed in, in which case the user is asked to sign in with the new address.
+*/
+func HandleConfirmEmailChange(dbc *models.DBConnections,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err := dbc.EmailChangeService.Confirm(getTokenFromRequest(r))
+		if err != nil {
+			render(w, r, "change_email.gohtml", []string{err.Error()})
+			return
+		}
+		http.Redirect(w, r, "/user/about", http.StatusFound)
+	}
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+HandleVerifyEmail verifies the email address a verification link was sent to. The link can be opened in a browser that
+is not signed in, so on success the user is sent to the verify_email page, which asks them to sign in if they need to.
+*/
+func HandleVerifyEmail(dbc *models.DBConnections,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err := dbc.EmailVerificationService.Verify(getTokenFromRequest(r))
+		if err != nil {
+			render(w, r, "verify_email.gohtml", []string{err.Error()})
+			return
+		}
+		http.Redirect(w, r, "/user/verify_email", http.StatusFound)
+	}
+}
+
+// HandleResendVerificationEmail sends the signed in user another verification email, if they have waited long enough
+func HandleResendVerificationEmail(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userInfo, _ := GetUserInfoFromContext(r)
+		err := sendVerificationEmail(dbc, baseUrl, emailer, userInfo)
+		if err != nil {
+			render(w, r, "verify_email.gohtml", []string{err.Error()})
+			return
+		}
+		http.Redirect(w, r, "/user/verify_email", http.StatusFound)
+	}
+}
+
+/*
+RequireVerifiedEmail sends users who have not verified their email address to the verify_email page. It must come after
+UserContext.SetUserMW, which sets the user information it checks.
+*/
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userInfo, _ := GetUserInfoFromContext(r)
+		if !userInfo.EmailVerified {
+			http.Redirect(w, r, "/user/verify_email", http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// creates a new verification token for the user, and emails them the link to verify their email address with
+func sendVerificationEmail(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
+	userInfo models.UserInfo) error {
+	token, err := dbc.EmailVerificationService.NewToken(userInfo.ID)
+	if err != nil {
+		return err
+	}
+	err = emailer.SendTemplateMail(services.Email{
+		From:    emailFromAddress,
+		To:      userInfo.Email,
+		Subject: "Verify your email address",
+		Cc:      []string{},
+	}, "verify_email.gohtml", services.EmailData{
+		URL: fmt.Sprintf("%s/verify_email?token=%s", baseUrl, url.QueryEscape(token)),
+	})
+	if err != nil {
+		fmt.Println("error sending verification email: ", err)
+		return fmt.Errorf("there was a problem sending the email. Please try again in a while")
+	}
+	return nil
+}
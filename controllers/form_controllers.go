@@ -14,7 +14,7 @@ import (
 )
 
 func HandleSignupForm(
-	dbc *models.DBConnections,
+	dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
 	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
 ) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -29,20 +29,33 @@ func HandleSignupForm(
 		}
 		user, err := dbc.UserService.CreateUser(newUserToCreate)
 		if err != nil {
-			render(w, r, "signup.gohtml", []string{err.Error()})
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error creating user: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			render(w, r, "signup.gohtml", errorMsgsFromErr(err))
 			return
 		}
 		sessionInformation := user.Session
 		sessionToken := sessionInformation.Token
-		SetSessionCookietoResponseWriter(sessionToken, w)
-		http.Redirect(w, r, "/user/about", http.StatusFound)
+		SetNewSessionToResponseWriter(dbc.SessionService, sessionToken, false, w, r)
+		// the account is still created if the email cannot be sent, as another can be asked for from verify_email
+		err = sendVerificationEmail(dbc, baseUrl, emailer, models.UserInfo{ID: user.ID, Email: strings.ToLower(emailAddress)})
+		if err != nil {
+			fmt.Println("error sending verification email on sign up: ", err)
+		}
+		http.Redirect(w, r, "/user/verify_email", http.StatusFound)
 	}
 }
 
 // closure function to allow access to the models.DBConnections type that returns a handler that can be used in main
 // program
 
-func HandleSignInForm(dbc *models.DBConnections,
+/*
+HandleSignInForm signs in users. Failed attempts are counted against both the email address and the IP address they
+came from, and once too many have failed further attempts are turned away before the password is checked.
+*/
+func HandleSignInForm(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
 	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
 ) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -51,21 +64,92 @@ func HandleSignInForm(dbc *models.DBConnections,
 			render(w, r, "signin.gohtml", []string{"form could not be parsed. please reload, and try again"})
 			return
 		}
+		ipAddress := getIPAddressFromRequest(r)
+		throttleKeys := models.SignInThrottleKeys(emailAddress, ipAddress)
+		if errorMsg, isThrottled := checkLoginThrottle(dbc.LoginThrottleService, throttleKeys); isThrottled {
+			render(w, r, "signin.gohtml", []string{errorMsg})
+			return
+		}
 		userToPassword := models.UserEmailToPlainTextPassword{
 			Email:             emailAddress,
 			PlainTextPassword: password}
 
+		isRememberMe := r.PostForm.Get("remember_me") != ""
 		loggedInUserInfo, err := dbc.UserService.LoginUser(userToPassword)
 
-		if err != nil {
+		var twoFactorRequiredErr *models.TwoFactorRequiredError
+		if errors.Is(err, models.ErrAccountDisabled) {
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		if err != nil && !errors.As(err, &twoFactorRequiredErr) {
+			recordLoginFailure(dbc, baseUrl, emailer, throttleKeys, ipAddress)
 			render(w, r, "signin.gohtml", []string{"there was a problem with the username and password. please check and try again"})
 			return
 		}
+		// the failed attempts against the account are only forgotten once the sign in is complete, so that starting
+		// new two factor challenges does not let anyone who knows the password keep guessing codes
+		if twoFactorRequiredErr != nil {
+			SetTwoFactorCookieToResponseWriter(twoFactorRequiredErr.Token, isRememberMe, w)
+			http.Redirect(w, r, "/signin/two_factor", http.StatusFound)
+			return
+		}
+		resetLoginThrottle(dbc.LoginThrottleService, throttleKeys)
 		sessionToken := loggedInUserInfo.Session.Token
-		SetSessionCookietoResponseWriter(sessionToken, w)
+		SetNewSessionToResponseWriter(dbc.SessionService, sessionToken, isRememberMe, w, r)
 		http.Redirect(w, r, "/galleries/list", http.StatusFound)
 	}
 }
+
+/*
+HandleTwoFactorForm finishes a sign in that was held after the password was entered, once the code from the user's
+authenticator app or one of their recovery codes is entered. Wrong codes are counted against the account and the IP
+address in the same way as wrong passwords, so they lead to the account being locked out too.
+*/
+func HandleTwoFactorForm(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, isRememberMe, isFound := GetTwoFactorCookieFromRequest(r)
+		if !isFound {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+		email, err := dbc.TwoFactorService.GetChallengeEmail(token)
+		if models.IsNoRowsErr(err) {
+			SetExpireTwoFactorCookieToResponseWriter(w)
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Println("error getting two factor challenge: ", err)
+			render(w, r, "two_factor.gohtml", []string{models.MapHandledGenericError(err).Error()})
+			return
+		}
+		ipAddress := getIPAddressFromRequest(r)
+		throttleKeys := models.SignInThrottleKeys(email, ipAddress)
+		if errorMsg, isThrottled := checkLoginThrottle(dbc.LoginThrottleService, throttleKeys); isThrottled {
+			render(w, r, "two_factor.gohtml", []string{errorMsg})
+			return
+		}
+		loggedInUserInfo, err := dbc.UserService.CompleteTwoFactorLogin(token, r.FormValue("code"))
+		if models.IsNoRowsErr(err) || errors.Is(err, models.ErrAccountDisabled) {
+			SetExpireTwoFactorCookieToResponseWriter(w)
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		if err != nil {
+			recordLoginFailure(dbc, baseUrl, emailer, throttleKeys, ipAddress)
+			render(w, r, "two_factor.gohtml", []string{err.Error()})
+			return
+		}
+		resetLoginThrottle(dbc.LoginThrottleService, throttleKeys)
+		SetExpireTwoFactorCookieToResponseWriter(w)
+		SetNewSessionToResponseWriter(dbc.SessionService, loggedInUserInfo.Session.Token, isRememberMe, w, r)
+		http.Redirect(w, r, "/galleries/list", http.StatusFound)
+	}
+}
+
 func HandleForgotPasswordForm(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
 	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
 ) func(w http.ResponseWriter, r *http.Request) {
@@ -75,6 +159,14 @@ func HandleForgotPasswordForm(dbc *models.DBConnections, baseUrl string, emailer
 			render(w, r, "forgot_password.gohtml", []string{"form could not be parsed. please reload, and try again"})
 			return
 		}
+		// every request counts as a failed attempt, so that neither inboxes nor the email server can be flooded
+		ipAddress := getIPAddressFromRequest(r)
+		throttleKeys := models.ResetPasswordThrottleKeys(email, ipAddress)
+		if errorMsg, isThrottled := checkLoginThrottle(dbc.LoginThrottleService, throttleKeys); isThrottled {
+			render(w, r, "forgot_password.gohtml", []string{errorMsg})
+			return
+		}
+		recordLoginFailure(dbc, baseUrl, emailer, throttleKeys, ipAddress)
 		userInfo, err := dbc.UserService.GetUserByEmail(strings.ToLower(email))
 		if err != nil {
 			render(w, r, "forgot_password.gohtml", []string{"No user exists with that email. Please try again"})
@@ -101,7 +193,7 @@ func HandleForgotPasswordForm(dbc *models.DBConnections, baseUrl string, emailer
 		}
 
 		err = emailer.SendMail(services.Email{
-			From:        "wenming.soh@gmail.com",
+			From:        emailFromAddress,
 			To:          email,
 			Content:     emailBuf.String(),
 			ContentType: "text/html",
@@ -133,35 +225,18 @@ func HandlerResetPasswordForm(dbc *models.DBConnections,
 			return
 		}
 
-		token, err := getForgotPWToken(r, dbc)
-		if err != nil {
-			render(w, r, "reset_password.gohtml", []string{"this link has expired - please make a new request."})
-			return
-		}
-
-		isValid := token.CheckIsValid()
-		if !isValid {
-			render(w, r, "reset_password.gohtml", []string{"this link has expired - please make a new request."})
-			return
-		}
-
-		confirmedPassword := r.Form.Get("confirm-password")
-
-		newHash, err := models.GenerateBcryptHash(confirmedPassword)
+		token, err := uuid.Parse(r.Form.Get("forgot_password_token"))
 		if err != nil {
-			render(w, r, "reset_password.gohtml", []string{"there was an internal error - please try again and contact support if the problem persists."})
+			render(w, r, "reset_password.gohtml", []string{models.NoResetPasswordTokenFound.String()})
 			return
 		}
-
-		err = dbc.ForgotPWService.DeleteForgetPasswordToken(token.UserId)
+		err = dbc.UserService.ResetPasswordWithToken(token, r.Form.Get("confirm-password"))
 		if err != nil {
-			render(w, r, "reset_password.gohtml", []string{"there was an internal error - please try again and contact support if the problem persists."})
-			return
-		}
-
-		err = dbc.UserService.UpdatePasswordHash(token.UserId, newHash)
-		if err != nil {
-			render(w, r, "reset_password.gohtml", []string{"there was an internal error - please try again and contact support if the problem persists."})
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error resetting password: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			render(w, r, "reset_password.gohtml", errorMsgsFromErr(err))
 			return
 		}
 
@@ -170,17 +245,6 @@ func HandlerResetPasswordForm(dbc *models.DBConnections,
 	})
 }
 
-func getForgotPWToken(r *http.Request, dbc *models.DBConnections) (models.ForgotPasswordToken, error) {
-	var forgotPasswordToken models.ForgotPasswordToken
-	token := r.Form.Get("forgot_password_token")
-	tokenUUID, err := uuid.Parse(token)
-	if err != nil {
-		return forgotPasswordToken, nil
-	}
-	forgotPasswordToken, err = dbc.ForgotPWService.GetForgotPWToken(tokenUUID)
-	return forgotPasswordToken, err
-}
-
 func validatePasswordReset(form url.Values) error {
 	confirmPassword := form.Get("confirm-password")
 	enterPassword := form.Get("enter-password")
@@ -190,6 +254,18 @@ func validatePasswordReset(form url.Values) error {
 	return nil
 }
 
+/*
+returns the messages to show on a form for err. Each rule of the password policy that a password did not meet gets a
+message of its own, rather than being joined into one long line.
+*/
+func errorMsgsFromErr(err error) []string {
+	var policyErr *models.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Problems
+	}
+	return []string{err.Error()}
+}
+
 func parseEmailAndPasswordFromForm(r *http.Request) (email, password string, err error) {
 	err = r.ParseForm()
 	if err != nil {
@@ -1,14 +1,20 @@
 package controllers
 
 import (
+	"database/sql"
 	"embed"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/imaging"
 	"github.com/sohWenMing/lenslocked/models"
 	"github.com/sohWenMing/lenslocked/views"
 )
@@ -45,13 +51,17 @@ type GalleryTemplateConstructor interface {
 	ConstructTemplate(fs embed.FS, templateStrings []string, baseFolderName string) *views.Template
 }
 
+// Role is the role of the signed in user in the gallery, which is "owner" for galleries they created
 type GalleryListing struct {
-	Id    int
-	Title string
+	Id         int
+	Title      string
+	Visibility string
+	Role       string
 }
 type GalleryListData struct {
-	UserId          int
-	GalleryListings []GalleryListing
+	UserId                int
+	GalleryListings       []GalleryListing
+	SharedGalleryListings []GalleryListing
 }
 
 func (g *Galleries) List(w http.ResponseWriter, r *http.Request) {
@@ -63,15 +73,31 @@ func (g *Galleries) List(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("error %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
+	memberGalleries, err := g.GalleryService.GetMemberGalleryListByUserId(userId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
 	galleryListings := make([]GalleryListing, len(galleries))
 	for i, gallery := range galleries {
 		galleryListings[i] = GalleryListing{
-			Id:    gallery.ID,
-			Title: gallery.Title,
+			Id:         gallery.ID,
+			Title:      gallery.Title,
+			Visibility: string(gallery.Visibility),
+			Role:       string(models.RoleOwner),
+		}
+	}
+	sharedGalleryListings := make([]GalleryListing, len(memberGalleries))
+	for i, memberGallery := range memberGalleries {
+		sharedGalleryListings[i] = GalleryListing{
+			Id:         memberGallery.ID,
+			Title:      memberGallery.Title,
+			Visibility: string(memberGallery.Visibility),
+			Role:       string(memberGallery.Role),
 		}
 	}
 	galleryData := GalleryListData{
-		userId, galleryListings,
+		userId, galleryListings, sharedGalleryListings,
 	}
 	g.Templates.List.ExecTemplateWithCSRF(w, r, csrfToken, "gallery_index.gohtml", galleryData, nil)
 }
@@ -108,33 +134,83 @@ func (g *Galleries) Create(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, getEditPath(gallery.ID), http.StatusFound)
 }
 
+/*
+Edit renders the edit page of a gallery to anyone with a role that can upload to it. The parts of the page the user's
+role does not allow them to use (settings, deleting the gallery, managing members) are left out by the template.
+*/
 func (g *Galleries) Edit(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		csrfToken := GetCSRFTokenFromRequest(r)
 		userId, _ := GetUserIdFromRequestContext(r)
-		gallery, err := getValidatedUserGallery(r, gs, userId)
+		gallery, role, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanUpload)
+		if err != nil {
+			writeGalleryAuthError(w, err)
+			return
+		}
+		g.renderEdit(w, r, gs, userId, gallery, role, "")
+	}
+}
+
+// renders the edit page. newShareLinkURL is only set straight after a share link is created, as it cannot be shown again
+func (g *Galleries) renderEdit(w http.ResponseWriter, r *http.Request, gs *models.GalleryService, userId int,
+	gallery *models.Gallery, role models.GalleryRole, newShareLinkURL string) {
+	csrfToken := GetCSRFTokenFromRequest(r)
+	galleryImages, err := gs.GetImagesByGalleryId(gallery.ID)
+	if err != nil {
+		http.Error(w, "Internal SErver Error", http.StatusInternalServerError)
+		return
+	}
+	members := []*models.GalleryMember{}
+	if role.CanManageMembers() {
+		members, err = gs.GetMembersByGalleryId(gallery.ID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		galleryData, err := views.InitEditGalleryData(userId, gallery.ID, gallery.Title, g.GalleryService.GetImageExtensions())
+	}
+	shareLinks := []*models.ShareLink{}
+	if role.CanEdit() {
+		shareLinks, err = gs.GetActiveShareLinksByGalleryId(gallery.ID)
 		if err != nil {
-			http.Error(w, "Internal SErver Error", http.StatusInternalServerError)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		g.Templates.Edit.ExecTemplateWithCSRF(w, r, csrfToken, "edit_gallery.gohtml", galleryData, nil)
 	}
+	galleryData := views.InitEditGalleryData(userId, gallery, role, galleryImages, members, shareLinks)
+	galleryData.NewShareLinkURL = newShareLinkURL
+	g.Templates.Edit.ExecTemplateWithCSRF(w, r, csrfToken, "edit_gallery.gohtml", galleryData, nil)
+}
+
+/*
+maxUploadBodyBytes is the most an upload of images can send, however many images it holds. Anything over it is refused
+before it is read any further, rather than being spooled to disk.
+*/
+const maxUploadBodyBytes = 50 << 20
+
+/*
+parses the multipart form of an image upload, reading no more than maxUploadBodyBytes of the body. isTooLarge is set if
+the body was over it.
+*/
+func parseUploadForm(w http.ResponseWriter, r *http.Request) (isTooLarge bool, err error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBodyBytes)
+	err = r.ParseMultipartForm(5 << 20)
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr), err
 }
 
 func (g *Galleries) UploadImage(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userId, _ := GetUserIdFromRequestContext(r)
-		gallery, err := getValidatedUserGallery(r, gs, userId)
+		gallery, _, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanUpload)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeGalleryAuthError(w, err)
+			return
+		}
+		isTooLarge, err := parseUploadForm(w, r)
+		if isTooLarge {
+			http.Error(w, fmt.Sprintf("uploads can be at most %d MB", maxUploadBodyBytes>>20),
+				http.StatusRequestEntityTooLarge)
 			return
 		}
-		err = r.ParseMultipartForm(5 << 20)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -153,7 +229,15 @@ func (g *Galleries) UploadImage(gs *models.GalleryService) func(w http.ResponseW
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			err = gs.CreateImage(gallery.ID, fileHeader.Filename, file)
+			_, err = gs.CreateImage(gallery.ID, userId, fileHeader.Filename, file)
+			if errors.Is(err, models.ErrImageExists) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if models.IsUserFacingErr(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -167,47 +251,107 @@ func (g *Galleries) UploadImage(gs *models.GalleryService) func(w http.ResponseW
 	}
 }
 
-func getValidatedUserGallery(r *http.Request, gs *models.GalleryService, userId int) (gallery *models.Gallery, err error) {
-	gallery, err = getGalleryByRequestGalleryId(r, gs)
+// errGalleryForbidden is returned when the role of a user in a gallery does not allow what they attempted to do
+var errGalleryForbidden = errors.New("you do not have permission to do that in this gallery")
+
+// errGalleryNotFound is returned in place of errGalleryForbidden when the user cannot even view the gallery
+var errGalleryNotFound = models.MapHandledError(sql.ErrNoRows, models.NoGalleryFound.String())
+
+/*
+returns the gallery requested by the "id" URL param along with the role of the user in it, if isAllowed reports true
+for that role. Otherwise errGalleryForbidden is returned, or errGalleryNotFound if the user cannot view the gallery, so
+that the ids of galleries they cannot see are not given away.
+*/
+func getAuthorizedGallery(r *http.Request, gs *models.GalleryService, userId int, isAllowed func(models.GalleryRole) bool) (*models.Gallery, models.GalleryRole, error) {
+	gallery, err := getGalleryByRequestGalleryId(r, gs)
 	if err != nil {
-		return nil, err
+		return nil, models.RoleNone, err
 	}
-	if userId != gallery.UserID {
-		return nil, errors.New("user is not owner of gallery")
+	role, err := gs.GetUserRole(gallery, userId)
+	if err != nil {
+		return nil, models.RoleNone, err
 	}
-	return gallery, nil
+	if !role.CanView() && !gallery.IsViewableById(userId) {
+		return nil, role, errGalleryNotFound
+	}
+	if !isAllowed(role) {
+		return nil, role, errGalleryForbidden
+	}
+	return gallery, role, nil
+}
+
+// writes the response for an error returned by getAuthorizedGallery or getAuthorizedImage
+func writeGalleryAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errGalleryForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errGalleryNotFound) {
+		http.Error(w, "Gallery Not Found", http.StatusNotFound)
+		return
+	}
+	if models.IsImageNotFoundErr(err) {
+		http.Error(w, "file does not exist", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
 }
+
+/*
+returns the gallery requested by the "id" URL param, and the record of the image requested by the "filename" URL param,
+if the user's role in the gallery allows them to manage that image. Otherwise errGalleryForbidden is returned.
+*/
+func getAuthorizedImage(r *http.Request, gs *models.GalleryService, userId int) (*models.Gallery, *models.Image, error) {
+	gallery, role, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanView)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, err := gs.GetImage(gallery.ID, getImageFilenameFromRequest(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !role.CanManageImage(img, userId) {
+		return nil, nil, errGalleryForbidden
+	}
+	return gallery, img, nil
+}
+
+/*
+View renders a gallery, either by its id at /galleries/{id} or by its slug at /galleries/u/{slug}. Galleries that the
+user is not allowed to view are reported as not found, so that their existence is not given away.
+*/
 func (g *Galleries) View(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		csrfToken := GetCSRFTokenFromRequest(r)
-		gallery, err := getGalleryByRequestGalleryId(r, gs)
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, galleryPath, err := getViewableGallery(r, gs, userId)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "Gallery Not Found", http.StatusNotFound)
 			return
 		}
-		userId, _ := GetUserIdFromRequestContext(r)
-		galleryData, err := views.InitViewGalleryData(userId, gallery.ID, gallery.Title, g.GalleryService.GetImageExtensions())
-
+		galleryImages, err := gs.GetImagesByGalleryId(gallery.ID)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		galleryData := views.InitViewGalleryData(userId, gallery, galleryPath, galleryImages)
 		g.Templates.View.ExecTemplateWithCSRF(w, r, csrfToken, "view_gallery.gohtml", galleryData, nil)
 	}
 }
 
 func (g *Galleries) DeleteImage(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filename := chi.URLParam(r, "filename")
-		fmt.Println("filename: ", filename)
 		userId, _ := GetUserIdFromRequestContext(r)
-		gallery, err := getValidatedUserGallery(r, gs, userId)
+		gallery, img, err := getAuthorizedImage(r, gs, userId)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeGalleryAuthError(w, err)
+			return
+		}
+		err = gs.DeleteImage(gallery.ID, img.Filename)
+		if models.IsImageNotFoundErr(err) {
+			http.Error(w, "file does not exist", http.StatusNotFound)
 			return
 		}
-		evalpath := fmt.Sprintf("./images/%d/%s", gallery.ID, filename)
-		err = os.Remove(evalpath)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("error occured when trying to delete: %s", err.Error()), http.StatusInternalServerError)
 			return
@@ -217,30 +361,173 @@ func (g *Galleries) DeleteImage(gs *models.GalleryService) func(w http.ResponseW
 	}
 }
 
-func ServeImage() http.Handler {
+func (g *Galleries) UpdateImageCaption(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, img, err := getAuthorizedImage(r, gs, userId)
+		if err != nil {
+			writeGalleryAuthError(w, err)
+			return
+		}
+		err = gs.UpdateImageCaption(gallery.ID, img.Filename, r.FormValue("caption"))
+		if models.IsImageNotFoundErr(err) {
+			http.Error(w, "file does not exist", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, getEditPath(gallery.ID), http.StatusFound)
+	}
+}
+
+/*
+ServeImage writes the contents of an image held in the GalleryService store to the response. If the store hands back
+a reader that can seek (as the local disk store does), http.ServeContent is used so range and conditional requests work.
+
+The gallery is looked up the same way as in Galleries.View, and images of galleries the user is not allowed to view
+are reported as not found. Images of galleries that are not public are marked as privately cacheable only.
+
+The "size" query parameter selects one of the resized variants (thumbnail, medium or large), defaulting to the original.
+The "download" query parameter sends the image as an attachment.
+*/
+func ServeImage(gs *models.GalleryService) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			galleryIdString := chi.URLParam(r, "id")
-			galleryId, err := strconv.Atoi(galleryIdString)
+			userId, _ := GetUserIdFromRequestContext(r)
+			gallery, _, err := getViewableGallery(r, gs, userId)
 			if err != nil {
-				http.Error(w, "Bad request", http.StatusBadRequest)
-				return
-			}
-			fileName := chi.URLParam(r, "filename")
-
-			filePath := fmt.Sprintf("./images/%d/%s", galleryId, fileName)
-			if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
 				http.Error(w, "file does not exist", http.StatusNotFound)
 				return
-			} else if err != nil {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			} else {
-				http.ServeFile(w, r, filePath)
 			}
+			if gallery.Visibility != models.VisibilityPublic {
+				w.Header().Set("Cache-Control", "private")
+			}
+			fileName := getImageFilenameFromRequest(r)
+			writeImage(w, r, gs, gallery.ID, fileName, r.URL.Query().Get("size"), r.URL.Query().Has("download"))
 		})
 }
 
+/*
+returns the gallery requested by either the "slug" or "id" URL param, along with the path it is being viewed at. An
+error is returned if the gallery cannot be found, or if the user is not allowed to view it by the param used. Members
+of a gallery can view it by either param, whatever its visibility.
+*/
+func getViewableGallery(r *http.Request, gs *models.GalleryService, userId int) (*models.Gallery, string, error) {
+	var gallery *models.Gallery
+	var galleryPath string
+	var isViewable bool
+	if slug := chi.URLParam(r, "slug"); slug != "" {
+		var err error
+		gallery, err = gs.GetBySlug(slug)
+		if err != nil {
+			return nil, "", err
+		}
+		isViewable = gallery.IsViewableBySlug(userId)
+		galleryPath = views.UnlistedGalleryPath(gallery.Slug)
+	} else {
+		var err error
+		gallery, err = getGalleryByRequestGalleryId(r, gs)
+		if err != nil {
+			return nil, "", err
+		}
+		isViewable = gallery.IsViewableById(userId)
+		galleryPath = views.GalleryPath(gallery.ID)
+	}
+	if !isViewable {
+		role, err := gs.GetUserRole(gallery, userId)
+		if err != nil {
+			return nil, "", err
+		}
+		if !role.CanView() {
+			return nil, "", errors.New("user is not allowed to view gallery")
+		}
+	}
+	return gallery, galleryPath, nil
+}
+
+/*
+DownloadGallery streams a ZIP archive of every image in a gallery, along with a manifest of their captions, to anyone
+who is allowed to view the gallery. The "size" query parameter selects one of the resized variants, defaulting to the
+originals.
+*/
+func (g *Galleries) DownloadGallery(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, _, err := getViewableGallery(r, gs, userId)
+		if err != nil {
+			http.Error(w, "Gallery Not Found", http.StatusNotFound)
+			return
+		}
+		writeGalleryArchive(w, r, gs, gallery)
+	}
+}
+
+func writeGalleryArchive(w http.ResponseWriter, r *http.Request, gs *models.GalleryService, gallery *models.Gallery) {
+	size := r.URL.Query().Get("size")
+	if _, isVariant := imaging.VariantByName(size); size != "" && !isVariant {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": getArchiveFilename(gallery),
+	}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	err := gs.WriteGalleryArchive(w, gallery, size)
+	if err != nil {
+		// the archive has already been partly sent, so the status can no longer be changed. The client is left with a
+		// truncated archive, which fails to open rather than silently missing images
+		fmt.Printf("writing archive of gallery-%d: %v\n", gallery.ID, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// names the archive after the gallery title, keeping only characters that are safe in a filename
+func getArchiveFilename(gallery *models.Gallery) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return -1
+	}, strings.TrimSpace(gallery.Title))
+	if name == "" {
+		name = fmt.Sprintf("gallery-%d", gallery.ID)
+	}
+	return name + ".zip"
+}
+
+/*
+writes an image to the response. size is passed on to GalleryService.OpenImage, and when isDownload is true the image
+is sent as an attachment so that browsers save it rather than display it.
+*/
+func writeImage(w http.ResponseWriter, r *http.Request, gs *models.GalleryService, galleryId int, fileName string, size string, isDownload bool) {
+	contents, img, err := gs.OpenImage(galleryId, fileName, size)
+	if models.IsImageNotFoundErr(err) {
+		http.Error(w, "file does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer contents.Close()
+	w.Header().Set("Content-Type", img.ContentType)
+	if isDownload {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": img.Filename}))
+	}
+	if seeker, ok := contents.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, img.Filename, img.UploadedAt, seeker)
+		return
+	}
+	// the length is not known up front, as a resized variant may have been opened rather than the original
+	w.Header().Set("Last-Modified", img.UploadedAt.UTC().Format(http.TimeFormat))
+	io.Copy(w, contents)
+}
+
 func (g *Galleries) HandleEdit(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userId, _ := GetUserIdFromRequestContext(r)
@@ -261,16 +548,34 @@ func (g *Galleries) HandleEdit(gs *models.GalleryService) func(w http.ResponseWr
 			http.Error(w, "Mandatory information not filled", http.StatusBadRequest)
 			return
 		}
-		gallery, err := gs.GetById(galleryId)
+		visibility, err := models.ParseGalleryVisibility(r.Form.Get("visibility"))
 		if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		if gallery.UserID != userId {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+		gallery, err := gs.GetById(galleryId)
+		if err != nil {
+			writeGalleryAuthError(w, errGalleryNotFound)
 			return
 		}
-		err = gs.UpdateTitle(galleryId, title)
+		role, err := gs.GetUserRole(gallery, userId)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		if !role.CanView() && !gallery.IsViewableById(userId) {
+			writeGalleryAuthError(w, errGalleryNotFound)
+			return
+		}
+		if !role.CanEdit() {
+			writeGalleryAuthError(w, errGalleryForbidden)
+			return
+		}
+		err = gs.UpdateSettings(galleryId, models.GallerySettings{
+			Title:             title,
+			KeepPhotoMetadata: r.Form.Get("keep-photo-metadata") == "on",
+			Visibility:        visibility,
+		})
 		if err != nil {
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
@@ -282,13 +587,9 @@ func (g *Galleries) HandleDelete(gs *models.GalleryService) func(w http.Response
 	return func(w http.ResponseWriter, r *http.Request) {
 		userId, _ := GetUserIdFromRequestContext(r)
 
-		gallery, err := getGalleryByRequestGalleryId(r, gs)
+		gallery, _, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanDeleteGallery)
 		if err != nil {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
-			return
-		}
-		if gallery.UserID != userId {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			writeGalleryAuthError(w, err)
 			return
 		}
 		err = gs.DeleteById(gallery.ID)
@@ -330,6 +631,16 @@ func getGalleryById(galleryId int, galleryService *models.GalleryService) (galle
 	return gallery, nil
 }
 
+// chi hands back URL params in their escaped form, so the filename is unescaped before it is used
+func getImageFilenameFromRequest(r *http.Request) string {
+	filename := chi.URLParam(r, "filename")
+	unescaped, err := url.PathUnescape(filename)
+	if err != nil {
+		return filename
+	}
+	return unescaped
+}
+
 func getEditPath(galleryId int) string {
 	editPath := fmt.Sprintf("/galleries/%d/edit", galleryId)
 	return editPath
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+InviteMember records an invitation for the email entered on the edit page to join the gallery with the role selected,
+and emails the invitation link to them. Only the owner of a gallery can invite members.
+*/
+func (g *Galleries) InviteMember(gs *models.GalleryService, baseUrl string, emailer *services.EmailService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, _, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanManageMembers)
+		if err != nil {
+			writeGalleryAuthError(w, err)
+			return
+		}
+		role, err := models.ParseMemberRole(r.FormValue("role"))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		member, token, err := gs.InviteMember(gallery, userId, r.FormValue("email"), role)
+		if err != nil {
+			var handledError *models.HandledError
+			if errors.As(err, &handledError) {
+				http.Error(w, handledError.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		userInfo, _ := GetUserInfoFromContext(r)
+		err = emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      member.Email,
+			Subject: fmt.Sprintf("You have been invited to %s", gallery.Title),
+			Cc:      []string{},
+		}, "gallery_invite_email.gohtml", services.GalleryInviteEmailData{
+			URL:          fmt.Sprintf("%s/galleries/invites/accept?token=%s", baseUrl, url.QueryEscape(token)),
+			GalleryTitle: gallery.Title,
+			InvitedBy:    userInfo.Email,
+			Role:         string(member.Role),
+		})
+		if err != nil {
+			http.Error(w, "There was a problem sending the email. Please try again in a while.", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, getEditPath(gallery.ID), http.StatusFound)
+	}
+}
+
+// RemoveMember removes a member from the gallery, or withdraws their invitation. Only the owner can remove members
+func (g *Galleries) RemoveMember(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, _, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanManageMembers)
+		if err != nil {
+			writeGalleryAuthError(w, err)
+			return
+		}
+		memberId, err := strconv.Atoi(chi.URLParam(r, "memberId"))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		err = gs.RemoveMember(gallery.ID, memberId)
+		if err != nil {
+			http.Error(w, "member does not exist", http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, getEditPath(gallery.ID), http.StatusFound)
+	}
+}
+
+/*
+AcceptInvite accepts the invitation in the "token" query parameter on behalf of the signed in user, then takes them
+to the gallery - the edit page if their role allows them to upload, else the view page.
+*/
+func (g *Galleries) AcceptInvite(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		member, err := gs.AcceptInvite(getTokenFromRequest(r), userId)
+		if err != nil {
+			var handledError *models.HandledError
+			if errors.As(err, &handledError) {
+				http.Error(w, handledError.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		if member.Role.CanUpload() {
+			http.Redirect(w, r, getEditPath(member.GalleryID), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/galleries/%d", member.GalleryID), http.StatusFound)
+	}
+}
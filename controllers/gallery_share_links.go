@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/imaging"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+// shareLinkUnlockCookie holds proof that the password of a share link has been entered. It is scoped to the link's path
+const shareLinkUnlockCookie = "shareLinkUnlock"
+
+// errShareLinkLocked is returned when a share link has a password that has not yet been entered
+var errShareLinkLocked = errors.New("share link is password protected")
+
+/*
+CreateShareLink mints a share link for the gallery using the options entered on the edit page, then renders the edit
+page with the link shown - this is the only time the link can be shown, as only the hash of its token is kept.
+*/
+func (g *Galleries) CreateShareLink(gs *models.GalleryService, baseUrl string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, role, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanEdit)
+		if err != nil {
+			writeGalleryAuthError(w, err)
+			return
+		}
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		options := models.ShareLinkOptions{
+			Label:         r.Form.Get("label"),
+			Password:      r.Form.Get("password"),
+			AllowDownload: r.Form.Get("allow-download") == "on",
+		}
+		if days := strings.TrimSpace(r.Form.Get("expires-in-days")); days != "" {
+			numDays, err := strconv.Atoi(days)
+			if err != nil || numDays < 1 {
+				http.Error(w, "expiry must be a whole number of days", http.StatusBadRequest)
+				return
+			}
+			options.ExpiresAt = time.Now().Add(time.Duration(numDays) * 24 * time.Hour)
+		}
+		link, err := gs.CreateShareLink(gallery.ID, userId, options)
+		if err != nil {
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		g.renderEdit(w, r, gs, userId, gallery, role, baseUrl+views.SharedGalleryPath(link.Token))
+	}
+}
+
+// RevokeShareLink stops a share link of the gallery from working
+func (g *Galleries) RevokeShareLink(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := GetUserIdFromRequestContext(r)
+		gallery, _, err := getAuthorizedGallery(r, gs, userId, models.GalleryRole.CanEdit)
+		if err != nil {
+			writeGalleryAuthError(w, err)
+			return
+		}
+		linkId, err := strconv.Atoi(chi.URLParam(r, "linkId"))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		err = gs.RevokeShareLink(gallery.ID, linkId)
+		if err != nil {
+			http.Error(w, "share link does not exist", http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, getEditPath(gallery.ID), http.StatusFound)
+	}
+}
+
+/*
+SharedView renders the gallery a share link points to, at /s/{token}. No session is needed. If the link has a password
+that has not been entered yet, a password form is rendered in place of the gallery.
+*/
+func (g *Galleries) SharedView(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g.renderSharedView(w, r, gs, nil)
+	}
+}
+
+/*
+UnlockShareLink checks the password entered for a share link, and if it matches sets the unlock cookie for the link.
+Once a few wrong passwords have been entered for a link, further attempts have to wait longer and longer.
+*/
+func (g *Galleries) UnlockShareLink(gs *models.GalleryService, lts *models.LoginThrottleService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := chi.URLParam(r, "token")
+		link, err := gs.GetShareLinkByToken(token)
+		if err != nil {
+			http.Error(w, "Gallery Not Found", http.StatusNotFound)
+			return
+		}
+		// wrong passwords are counted against the link rather than who sent them, as anyone with the link can guess
+		throttleKeys := []models.LoginThrottleKey{models.ShareLinkThrottleKey(link.ID)}
+		if errorMsg, isThrottled := checkLoginThrottle(lts, throttleKeys); isThrottled {
+			w.WriteHeader(http.StatusTooManyRequests)
+			g.renderSharedView(w, r, gs, []string{errorMsg})
+			return
+		}
+		err = link.VerifyPassword(r.FormValue("password"))
+		if err != nil {
+			_, recordErr := lts.RecordFailure(time.Now(), throttleKeys[0])
+			if recordErr != nil {
+				fmt.Println("error recording share link failure: ", recordErr)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			g.renderSharedView(w, r, gs, []string{err.Error()})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     shareLinkUnlockCookie,
+			Value:    link.UnlockValue(token),
+			Path:     views.SharedGalleryPath(token),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, views.SharedGalleryPath(token), http.StatusFound)
+	}
+}
+
+/*
+ServeSharedImage serves an image of the gallery a share link points to. Links without download permission are only
+served resized variants, up to the large variant, and never as an attachment.
+*/
+func ServeSharedImage(gs *models.GalleryService) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			gallery, link, err := getSharedGallery(r, gs)
+			if err != nil {
+				http.Error(w, "file does not exist", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Cache-Control", "private")
+			size := r.URL.Query().Get("size")
+			isDownload := r.URL.Query().Has("download")
+			if !link.AllowDownload {
+				if _, isVariant := imaging.VariantByName(size); !isVariant {
+					size = imaging.Variants[len(imaging.Variants)-1].Name
+				}
+				isDownload = false
+			}
+			writeImage(w, r, gs, gallery.ID, getImageFilenameFromRequest(r), size, isDownload)
+		})
+}
+
+// DownloadSharedGallery streams a ZIP archive of the gallery a share link points to, if the link allows downloads
+func (g *Galleries) DownloadSharedGallery(gs *models.GalleryService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gallery, link, err := getSharedGallery(r, gs)
+		if err != nil || !link.AllowDownload {
+			http.Error(w, "Gallery Not Found", http.StatusNotFound)
+			return
+		}
+		writeGalleryArchive(w, r, gs, gallery)
+	}
+}
+
+func (g *Galleries) renderSharedView(w http.ResponseWriter, r *http.Request, gs *models.GalleryService, errorMsgs []string) {
+	csrfToken := GetCSRFTokenFromRequest(r)
+	userId, _ := GetUserIdFromRequestContext(r)
+	token := chi.URLParam(r, "token")
+	gallery, link, err := getSharedGallery(r, gs)
+	if errors.Is(err, errShareLinkLocked) {
+		galleryData := views.InitLockedSharedGalleryData(userId, gallery, token)
+		g.Templates.View.ExecTemplateWithCSRF(w, r, csrfToken, "view_gallery.gohtml", galleryData, errorMsgs)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gallery Not Found", http.StatusNotFound)
+		return
+	}
+	galleryImages, err := gs.GetImagesByGalleryId(gallery.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	galleryData := views.InitSharedGalleryData(userId, gallery, link, token, galleryImages)
+	g.Templates.View.ExecTemplateWithCSRF(w, r, csrfToken, "view_gallery.gohtml", galleryData, errorMsgs)
+}
+
+/*
+returns the gallery and share link for the "token" URL param. If the link has a password and the unlock cookie for it
+is missing or does not match, the gallery is still returned along with errShareLinkLocked.
+*/
+func getSharedGallery(r *http.Request, gs *models.GalleryService) (*models.Gallery, *models.ShareLink, error) {
+	token := chi.URLParam(r, "token")
+	link, err := gs.GetShareLinkByToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	gallery, err := gs.GetById(link.GalleryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if link.HasPassword() {
+		cookie, err := r.Cookie(shareLinkUnlockCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(link.UnlockValue(token))) != 1 {
+			return gallery, link, errShareLinkLocked
+		}
+	}
+	return gallery, link, nil
+}
@@ -66,6 +66,16 @@ func InitTemplateHandler(template ExecutorTemplateWithCSRF, uc userContext) (
 			pageData.OtherData = resetPasswordFormData
 		}
 
+		if fileName == "magic_link.gohtml" {
+			magicLinkFormData, ok := otherPageData.(views.MagicLinkForm)
+			if !ok {
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			magicLinkFormData.MagicLinkToken = getMagicLinkTokenFromRequest(r)
+			pageData.OtherData = magicLinkFormData
+		}
+
 		csrfToken := GetCSRFTokenFromRequest(r)
 		// here what is happening is the middleware is actually getting the CSRF token from the context
 		w.Header().Set("content-type", "text/html")
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+checks whether attempts for keys have to wait because too many have failed, returning the message to show the user if
+they do. If the check itself fails, the attempt is not allowed either.
+*/
+func checkLoginThrottle(lts *models.LoginThrottleService, keys []models.LoginThrottleKey) (errorMsg string, isThrottled bool) {
+	err := lts.Check(time.Now(), keys...)
+	if err == nil {
+		return "", false
+	}
+	var throttledErr *models.LoginThrottledError
+	if errors.As(err, &throttledErr) {
+		return throttledErr.Error(), true
+	}
+	fmt.Println("error checking login throttle: ", err)
+	return "There was a problem with the request. Please try again.", true
+}
+
+/*
+records a failed attempt against each of keys. If it caused an account to be locked out, the owner of the account is
+emailed so that they know someone may be trying to guess their password.
+*/
+func recordLoginFailure(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
+	keys []models.LoginThrottleKey, ipAddress string) {
+	for _, key := range keys {
+		failure, err := dbc.LoginThrottleService.RecordFailure(time.Now(), key)
+		if err != nil {
+			fmt.Println("error recording login failure: ", err)
+			continue
+		}
+		if failure.IsNewlyLockedOut && key.Kind == models.SignInAccountThrottle {
+			err = sendAccountLockedEmail(dbc, baseUrl, emailer, key.Key, ipAddress, failure.BlockedUntil)
+			if err != nil {
+				fmt.Println("error sending account locked email: ", err)
+			}
+		}
+	}
+}
+
+/*
+forgets the failed attempts against the account key of keys, which comes first, once a sign in has been completed.
+Those against the IP address are kept, so that signing in to an account of their own does not let anyone keep guessing.
+*/
+func resetLoginThrottle(lts *models.LoginThrottleService, keys []models.LoginThrottleKey) {
+	err := lts.Reset(keys[0])
+	if err != nil {
+		fmt.Println("error resetting login throttle: ", err)
+	}
+}
+
+// emails the owner of the account with the email address passed in that it has been locked, if the account exists
+func sendAccountLockedEmail(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
+	email, ipAddress string, lockedUntil time.Time) error {
+	userInfo, err := dbc.UserService.GetUserByEmail(email)
+	if models.IsNoRowsErr(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return emailer.SendTemplateMail(services.Email{
+		From:    emailFromAddress,
+		To:      userInfo.Email,
+		Subject: "Your account has been locked",
+		Cc:      []string{},
+	}, "account_locked_email.gohtml", services.AccountLockedEmailData{
+		URL:         fmt.Sprintf("%s/forgot_password", baseUrl),
+		IPAddress:   ipAddress,
+		LockedUntil: lockedUntil.UTC().Format("Jan 2 15:04 MST"),
+	})
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+/*
+HandleMagicLinkRequestForm emails a link to sign in without a password to the address entered on the sign in page. As
+with reset password requests, every request counts as a failed attempt against the address and the IP address it came
+from, so that inboxes cannot be flooded. The user is sent to check_email whether or not there is an account with the
+address, so that the form cannot be used to find out who has one.
+*/
+func HandleMagicLinkRequestForm(dbc *models.DBConnections, baseUrl string, emailer *services.EmailService,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := r.FormValue("email")
+		if email == "" {
+			render(w, r, "signin.gohtml", []string{"enter your email address to be sent a sign in link"})
+			return
+		}
+		ipAddress := getIPAddressFromRequest(r)
+		throttleKeys := models.MagicLinkThrottleKeys(email, ipAddress)
+		if errorMsg, isThrottled := checkLoginThrottle(dbc.LoginThrottleService, throttleKeys); isThrottled {
+			render(w, r, "signin.gohtml", []string{errorMsg})
+			return
+		}
+		recordLoginFailure(dbc, baseUrl, emailer, throttleKeys, ipAddress)
+		token, userInfo, err := dbc.MagicLinkService.NewToken(email)
+		if models.IsNoRowsErr(err) {
+			http.Redirect(w, r, "/check_email", http.StatusFound)
+			return
+		}
+		if err != nil {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error creating magic link: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		err = emailer.SendTemplateMail(services.Email{
+			From:    emailFromAddress,
+			To:      userInfo.Email,
+			Subject: "Your sign in link",
+			Cc:      []string{},
+		}, "magic_link_email.gohtml", services.EmailData{
+			URL: fmt.Sprintf("%s/signin/magic_link?token=%s", baseUrl, url.QueryEscape(token)),
+		})
+		if err != nil {
+			fmt.Println("error sending magic link email: ", err)
+			render(w, r, "signin.gohtml", []string{"There was a problem sending the email. Please try again in a while."})
+			return
+		}
+		http.Redirect(w, r, "/check_email", http.StatusFound)
+	}
+}
+
+/*
+HandleMagicLinkSignIn signs in the user a sign in link was sent to. Opening the link only shows magic_link.gohtml, which
+posts the token here - some email clients open the links in emails to scan them, which would otherwise use the link up
+before the user could.
+*/
+func HandleMagicLinkSignIn(dbc *models.DBConnections,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isRememberMe := r.PostFormValue("remember_me") != ""
+		user, err := dbc.UserService.LoginWithMagicLink(r.PostFormValue("magic_link_token"))
+		var twoFactorRequiredErr *models.TwoFactorRequiredError
+		if errors.As(err, &twoFactorRequiredErr) {
+			SetTwoFactorCookieToResponseWriter(twoFactorRequiredErr.Token, isRememberMe, w)
+			http.Redirect(w, r, "/signin/two_factor", http.StatusFound)
+			return
+		}
+		if err != nil {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error signing in with magic link: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		SetNewSessionToResponseWriter(dbc.SessionService, user.Session.Token, isRememberMe, w, r)
+		http.Redirect(w, r, "/galleries/list", http.StatusFound)
+	}
+}
+
+func getMagicLinkTokenFromRequest(r *http.Request) string {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.PostFormValue("magic_link_token")
+	}
+	return token
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/oidc"
+	"github.com/sohWenMing/lenslocked/services"
+)
+
+// OIDCProviders are the OpenID Connect providers users can sign in with, by the name used in their URLs
+type OIDCProviders map[string]*oidc.Provider
+
+// NewOIDCProviders returns the providers for configs, which make their requests with client
+func NewOIDCProviders(configs []oidc.Config, client *http.Client) OIDCProviders {
+	providers := OIDCProviders{}
+	for _, config := range configs {
+		providers[config.Name] = oidc.NewProvider(config, client)
+	}
+	return providers
+}
+
+// returns the provider named in the URL of the request, writing a 404 if there is none
+func (p OIDCProviders) fromRequest(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, isFound := p[chi.URLParam(r, "provider")]
+	if !isFound {
+		http.NotFound(w, r)
+	}
+	return provider, isFound
+}
+
+/*
+sends the user to provider to sign in. The state of the request is set in a cookie as well as sent to the provider, so
+that the callback can only be finished in the browser that started it - otherwise someone could sign a victim in to an
+account of theirs by getting them to open a callback URL.
+*/
+func startOIDCAuth(is *models.IdentityService, provider *oidc.Provider, linkUserId int,
+	w http.ResponseWriter, r *http.Request) error {
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return err
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	err = is.SaveAuthRequest(models.OIDCAuthRequest{AuthRequest: req, Provider: provider.Name, LinkUserID: linkUserId})
+	if err != nil {
+		return err
+	}
+	SetOIDCStateCookieToResponseWriter(req.State, w)
+	http.Redirect(w, r, authURL, http.StatusFound)
+	return nil
+}
+
+// StartOIDCSignIn sends the user to the provider named in the URL to sign in
+func StartOIDCSignIn(dbc *models.DBConnections, providers OIDCProviders,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, isFound := providers.fromRequest(w, r)
+		if !isFound {
+			return
+		}
+		err := startOIDCAuth(dbc.IdentityService, provider, 0, w, r)
+		if err != nil {
+			fmt.Println("error starting oidc sign in: ", err)
+			render(w, r, "signin.gohtml", []string{
+				fmt.Sprintf("%s sign in is not available right now - please try again later", provider.DisplayName)})
+		}
+	}
+}
+
+/*
+HandleOIDCCallback finishes a sign in once the provider sends the user back. The same callback finishes linking an
+identity to a signed in user, which u is used to render the account page for.
+*/
+func HandleOIDCCallback(dbc *models.DBConnections, providers OIDCProviders, u *Users, baseUrl string,
+	emailer *services.EmailService,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, isFound := providers.fromRequest(w, r)
+		if !isFound {
+			return
+		}
+		query := r.URL.Query()
+		cookieState, isFound := GetOIDCStateCookieFromRequest(r)
+		SetExpireOIDCStateCookieToResponseWriter(w)
+		if !isFound || subtle.ConstantTimeCompare([]byte(cookieState), []byte(query.Get("state"))) != 1 {
+			render(w, r, "signin.gohtml", []string{models.NoOIDCAuthRequestFound.String()})
+			return
+		}
+		req, err := dbc.IdentityService.TakeAuthRequest(cookieState)
+		if err == nil && req.Provider != provider.Name {
+			err = models.MapHandledError(errors.New("auth request is for another provider"),
+				models.NoOIDCAuthRequestFound.String())
+		}
+		if err != nil {
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		// the provider sends the user back with an error instead of a code if they did not sign in
+		if query.Get("error") != "" {
+			fmt.Println("oidc provider returned error: ", query.Get("error"), query.Get("error_description"))
+			renderOIDCError(w, r, u, req, render,
+				fmt.Sprintf("signing in with %s was cancelled - please try again", provider.DisplayName))
+			return
+		}
+		claims, err := provider.Authenticate(r.Context(), query.Get("code"), req.AuthRequest, time.Now())
+		if err != nil {
+			fmt.Println("error authenticating with oidc provider: ", err)
+			renderOIDCError(w, r, u, req, render,
+				fmt.Sprintf("there was a problem signing in with %s - please try again", provider.DisplayName))
+			return
+		}
+		identity := models.ExternalIdentity{
+			Provider:      provider.Name,
+			Subject:       claims.Subject,
+			Email:         claims.Email,
+			EmailVerified: bool(claims.EmailVerified),
+		}
+		if req.LinkUserID != 0 {
+			finishLinkIdentity(w, r, u, req.LinkUserID, identity)
+			return
+		}
+		user, signIn, err := dbc.UserService.LoginWithIdentity(identity)
+		var twoFactorRequiredErr *models.TwoFactorRequiredError
+		if err != nil && !errors.As(err, &twoFactorRequiredErr) {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error signing in with identity: ", err)
+			}
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		if signIn == models.IdentityLinkedByEmail {
+			// the user may not know the account was linked, so they are told in case it was not them
+			sendIdentityLinkedEmail(baseUrl, emailer, identity.Email, provider.DisplayName)
+		}
+		if twoFactorRequiredErr != nil {
+			SetTwoFactorCookieToResponseWriter(twoFactorRequiredErr.Token, false, w)
+			http.Redirect(w, r, "/signin/two_factor", http.StatusFound)
+			return
+		}
+		SetNewSessionToResponseWriter(dbc.SessionService, user.Session.Token, false, w, r)
+		http.Redirect(w, r, "/galleries/list", http.StatusFound)
+	}
+}
+
+// renders errMsg on the account page when an identity was being linked, or on the sign in page otherwise
+func renderOIDCError(w http.ResponseWriter, r *http.Request, u *Users, req models.OIDCAuthRequest,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string), errMsg string) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	if req.LinkUserID != 0 && req.LinkUserID == userId {
+		u.renderAbout(w, r, nil, []string{errMsg})
+		return
+	}
+	render(w, r, "signin.gohtml", []string{errMsg})
+}
+
+// links identity to the user who started linking it, as long as they are still the one signed in
+func finishLinkIdentity(w http.ResponseWriter, r *http.Request, u *Users, linkUserId int,
+	identity models.ExternalIdentity) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	if userId != linkUserId {
+		http.Redirect(w, r, "/signin", http.StatusFound)
+		return
+	}
+	err := u.IdentityService.Link(userId, identity)
+	if err != nil {
+		if !models.IsUserFacingErr(err) {
+			fmt.Println("error linking identity: ", err)
+			err = models.MapHandledGenericError(err)
+		}
+		u.renderAbout(w, r, nil, []string{err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/about", http.StatusFound)
+}
+
+func sendIdentityLinkedEmail(baseUrl string, emailer *services.EmailService, email string, providerName string) {
+	err := emailer.SendTemplateMail(services.Email{
+		From:    emailFromAddress,
+		To:      email,
+		Subject: fmt.Sprintf("Your %s account has been linked", providerName),
+		Cc:      []string{},
+	}, "identity_linked_email.gohtml", services.IdentityLinkedEmailData{
+		URL:      fmt.Sprintf("%s/user/about", baseUrl),
+		Provider: providerName,
+	})
+	if err != nil {
+		fmt.Println("error sending identity linked email: ", err)
+	}
+}
+
+// LinkIdentity sends the signed in user to the provider named in the URL, to link their account with it
+func (u *Users) LinkIdentity(providers OIDCProviders) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, isFound := providers.fromRequest(w, r)
+		if !isFound {
+			return
+		}
+		userId, _ := GetUserIdFromRequestContext(r)
+		err := startOIDCAuth(u.IdentityService, provider, userId, w, r)
+		if err != nil {
+			fmt.Println("error starting oidc link: ", err)
+			u.renderAbout(w, r, nil, []string{
+				fmt.Sprintf("%s is not available right now - please try again later", provider.DisplayName)})
+		}
+	}
+}
+
+// UnlinkIdentity unlinks an account with a provider from the signed in user
+func (u *Users) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	identityId, err := strconv.Atoi(chi.URLParam(r, "identityId"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	err = u.IdentityService.Unlink(userId, identityId)
+	if err != nil {
+		u.renderAbout(w, r, nil, []string{err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/about", http.StatusFound)
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/oidc"
+)
+
+func TestHandleOIDCCallbackChecksState(t *testing.T) {
+	providers := NewOIDCProviders([]oidc.Config{{Name: "stub", DisplayName: "Stub"}}, nil)
+	var renderedErrors []string
+	render := func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string) {
+		renderedErrors = errorMsgs
+	}
+	// the state is checked before anything else is, so no services are needed
+	router := chi.NewRouter()
+	router.Get("/signin/oidc/{provider}/callback", HandleOIDCCallback(nil, providers, nil, "", nil, render))
+
+	type test struct {
+		name        string
+		path        string
+		cookieState string
+		wantStatus  int
+		wantErrors  bool
+	}
+	tests := []test{
+		{"unknown provider", "/signin/oidc/other/callback?state=abc", "abc", http.StatusNotFound, false},
+		{"no state cookie", "/signin/oidc/stub/callback?state=abc", "", http.StatusOK, true},
+		{"state does not match cookie", "/signin/oidc/stub/callback?state=abc", "xyz", http.StatusOK, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			renderedErrors = nil
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.cookieState != "" {
+				r.AddCookie(&http.Cookie{Name: "oidcState", Value: test.cookieState})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.wantStatus {
+				t.Errorf("expected status %d, got %d", test.wantStatus, w.Code)
+			}
+			if test.wantErrors && (len(renderedErrors) != 1 ||
+				renderedErrors[0] != models.NoOIDCAuthRequestFound.String()) {
+				t.Errorf("expected sign in to be rendered with the expired error, got %q", renderedErrors)
+			}
+		})
+	}
+}
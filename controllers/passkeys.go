@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+/*
+The passkey ceremonies need the browser's navigator.credentials API, so each is started by a script posting to a begin
+route, which answers with the options as JSON. The script then posts the credential the browser returned in the
+"credential" field of an ordinary form, so errors are rendered on the page as with any other form.
+*/
+
+// Passkeys renders the passkeys page, which lists the passkeys the signed in user has registered
+func (u *Users) Passkeys(w http.ResponseWriter, r *http.Request) {
+	u.renderPasskeys(w, r, nil)
+}
+
+// BeginPasskeyRegistration answers with the options for the browser to register a passkey for the signed in user with
+func (u *Users) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	options, err := u.PasskeyService.BeginRegistration(userId)
+	if err != nil {
+		fmt.Println("error beginning passkey registration: ", err)
+		writeAPIError(w, http.StatusInternalServerError, models.MapHandledGenericError(err).Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, options)
+}
+
+/*
+FinishPasskeyRegistration registers the passkey the browser created for the signed in user. If it is not given a name,
+it is named after the browser and operating system it was registered on.
+*/
+func (u *Users) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	name := r.FormValue("name")
+	if name == "" {
+		name = views.DescribeUserAgent(r.UserAgent())
+	}
+	err := u.PasskeyService.FinishRegistration(userId, name, []byte(r.FormValue("credential")))
+	if err != nil {
+		if !models.IsUserFacingErr(err) {
+			fmt.Println("error finishing passkey registration: ", err)
+			err = models.MapHandledGenericError(err)
+		}
+		u.renderPasskeys(w, r, []string{err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/passkeys", http.StatusFound)
+}
+
+// DeletePasskey removes one of the signed in user's passkeys
+func (u *Users) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	passkeyId, err := strconv.Atoi(chi.URLParam(r, "passkeyId"))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	err = u.PasskeyService.Delete(userId, passkeyId)
+	if err != nil {
+		u.renderPasskeys(w, r, []string{err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/passkeys", http.StatusFound)
+}
+
+func (u *Users) renderPasskeys(w http.ResponseWriter, r *http.Request, errorMsgs []string) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	passkeys, err := u.PasskeyService.GetByUserId(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	csrfToken := GetCSRFTokenFromRequest(r)
+	w.Header().Set("content-type", "text/html")
+	u.Template.ExecTemplateWithCSRF(w, r, csrfToken, "passkeys.gohtml",
+		views.InitPageData(userId, views.InitPasskeysData(passkeys)), errorMsgs)
+}
+
+// BeginPasskeySignIn answers with the options for the browser to sign in with a passkey
+func BeginPasskeySignIn(dbc *models.DBConnections) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		options, err := dbc.PasskeyService.BeginLogin()
+		if err != nil {
+			fmt.Println("error beginning passkey sign in: ", err)
+			writeAPIError(w, http.StatusInternalServerError, models.MapHandledGenericError(err).Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, options)
+	}
+}
+
+// HandlePasskeySignIn signs in the user whose passkey the browser signed the sign in with
+func HandlePasskeySignIn(dbc *models.DBConnections,
+	render func(w http.ResponseWriter, r *http.Request, fileName string, errorMsgs []string),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isRememberMe := r.PostFormValue("remember_me") != ""
+		user, err := dbc.UserService.LoginWithPasskey([]byte(r.PostFormValue("credential")))
+		var twoFactorRequiredErr *models.TwoFactorRequiredError
+		if errors.As(err, &twoFactorRequiredErr) {
+			SetTwoFactorCookieToResponseWriter(twoFactorRequiredErr.Token, isRememberMe, w)
+			http.Redirect(w, r, "/signin/two_factor", http.StatusFound)
+			return
+		}
+		if err != nil {
+			if !models.IsUserFacingErr(err) {
+				fmt.Println("error signing in with passkey: ", err)
+				err = models.MapHandledGenericError(err)
+			}
+			render(w, r, "signin.gohtml", []string{err.Error()})
+			return
+		}
+		SetNewSessionToResponseWriter(dbc.SessionService, user.Session.Token, isRememberMe, w, r)
+		http.Redirect(w, r, "/galleries/list", http.StatusFound)
+	}
+}
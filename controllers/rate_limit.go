@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/ratelimit"
+)
+
+/*
+RateLimit limits the requests to the routes it is used on to limit, counting the requests of each key returned by key
+separately. name is added to the front of the key, so that each group of routes has buckets of its own even when they
+share a store.
+
+Requests over the limit are answered with 429 Too Many Requests and a Retry-After header, as a JSON error for the API
+and plain text otherwise. If the store cannot be reached the request is let through, so that the site is not taken down
+with it.
+*/
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key func(r *http.Request) string,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := store.Take(name+":"+key(r), limit, time.Now())
+			if err != nil {
+				fmt.Println("error taking rate limit token: ", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			if !result.IsAllowed {
+				writeTooManyRequests(w, r, result.RetryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitByIP keys rate limits by the IP address requests come from
+func RateLimitByIP(r *http.Request) string {
+	return "ip:" + getIPAddressFromRequest(r)
+}
+
+/*
+RateLimitByUser keys rate limits by the signed in user, so that users sharing an IP address do not share a limit.
+Requests without a signed in user are keyed by IP address. It must come after a middleware that sets the user id, such
+as CookieAuthMiddleWare or APIAuthMiddleWare.
+*/
+func RateLimitByUser(r *http.Request) string {
+	userId, isFound := GetUserIdFromRequestContext(r)
+	if !isFound || userId == 0 {
+		return RateLimitByIP(r)
+	}
+	return fmt.Sprintf("user:%d", userId)
+}
+
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	// Retry-After is in whole seconds, rounded up so that retrying straight after it is allowed
+	retryAfterSeconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	message := fmt.Sprintf("too many requests - please try again in %d seconds", retryAfterSeconds)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, http.StatusTooManyRequests, message)
+		return
+	}
+	http.Error(w, message, http.StatusTooManyRequests)
+}
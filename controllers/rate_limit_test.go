@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Requests: 2, Per: time.Hour}
+	handler := RateLimit(store, "test", limit, RateLimitByUser)(okHandler)
+
+	newRequest := func(path, ipAddress string, userId int) *http.Request {
+		r := httptest.NewRequest("POST", path, nil)
+		r.RemoteAddr = ipAddress + ":52100"
+		return r.WithContext(context.WithValue(r.Context(), userIdKey, userId))
+	}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newRequest("/signin", "203.0.113.7", 0))
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d: expected status %d, got %d", i, http.StatusOK, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest("/signin", "203.0.113.7", 0))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1800" {
+		t.Errorf("expected Retry-After of 1800, got %s", w.Header().Get("Retry-After"))
+	}
+
+	// signed in users are limited by user id rather than by IP address
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest("/api/v1/galleries", "203.0.113.7", 5))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected signed in user to have a limit of their own, got status %d", w.Code)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("/api/v1/galleries", "203.0.113.8", 5))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest("/api/v1/galleries", "203.0.113.9", 5))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("expected API to get a JSON error, got content type %s", w.Header().Get("Content-Type"))
+	}
+}
@@ -7,5 +7,9 @@ import (
 func getTokenFromRequest(r *http.Request) (token string) {
 	queryParams := r.URL.Query()
 	token = queryParams.Get("token")
+	if token == "" {
+		// the reset password form is rendered again with errors after it is posted, when the token is in the form
+		token = r.PostFormValue("forgot_password_token")
+	}
 	return token
 }
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+// user agents longer than this are cut short before they are recorded against a session
+const maxUserAgentLength = 512
+
+// Sessions renders the sessions page, which lists the devices the signed in user is signed in on
+func (u *Users) Sessions(w http.ResponseWriter, r *http.Request) {
+	u.renderSessions(w, r, nil)
+}
+
+/*
+RevokeSession signs out one of the signed in user's sessions. If it is the session the request was sent with, the user
+is sent to sign in again.
+*/
+func (u *Users) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	sessionId, err := strconv.Atoi(chi.URLParam(r, "sessionId"))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	err = u.SessionService.ExpireSessionByIdAndUserId(userId, sessionId)
+	if err != nil {
+		u.renderSessions(w, r, []string{err.Error()})
+		return
+	}
+	// if the session the request was sent with can no longer be found, it was the one just revoked
+	token, _ := GetSessionCookieFromRequest(r)
+	if _, isSessionFound := u.SessionService.CheckSessionExpired(token, time.Now()); !isSessionFound {
+		SetExpireSessionCookieToResponseWriter(token, w)
+		http.Redirect(w, r, "/signin", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/user/sessions", http.StatusFound)
+}
+
+// RevokeOtherSessions signs out every session of the signed in user, except the one the request was sent with
+func (u *Users) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	token, _ := GetSessionCookieFromRequest(r)
+	err := u.SessionService.ExpireOtherSessionsByUserId(userId, token)
+	if err != nil {
+		fmt.Println("error expiring other sessions: ", err)
+		u.renderSessions(w, r, []string{models.MapHandledGenericError(err).Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/sessions", http.StatusFound)
+}
+
+func (u *Users) renderSessions(w http.ResponseWriter, r *http.Request, errorMsgs []string) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	sessions, err := u.SessionService.GetActiveSessionsByUserId(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	token, _ := GetSessionCookieFromRequest(r)
+	csrfToken := GetCSRFTokenFromRequest(r)
+	w.Header().Set("content-type", "text/html")
+	u.Template.ExecTemplateWithCSRF(w, r, csrfToken, "sessions.gohtml",
+		views.InitPageData(userId, views.InitSessionsData(sessions, models.HashSessionToken(token))), errorMsgs)
+}
+
+/*
+SetNewSessionToResponseWriter sets the cookie of a session that has just been created on sign in, and records the device
+the request came from against the session, so the user can recognise it on the sessions page. If isRememberMe is set,
+the session is made into a "remember me" session with a cookie that outlasts the browser.
+
+Failing to record the device or remember the session does not stop the user being signed in.
+*/
+func SetNewSessionToResponseWriter(ss *models.SessionService, token string, isRememberMe bool,
+	w http.ResponseWriter, r *http.Request) {
+	err := ss.SetDevice(token, getSessionDeviceFromRequest(r))
+	if err != nil {
+		fmt.Println("error setting session device: ", err)
+	}
+	if isRememberMe {
+		err = ss.RememberSession(token)
+		if err == nil {
+			http.SetCookie(w, MapRememberMeSessionCookie(token, ss.Lifetimes.RememberMeAbsolute))
+			return
+		}
+		fmt.Println("error remembering session: ", err)
+	}
+	SetSessionCookietoResponseWriter(token, w)
+}
+
+func getSessionDeviceFromRequest(r *http.Request) models.SessionDevice {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return models.SessionDevice{
+		UserAgent: userAgent,
+		IPAddress: getIPAddressFromRequest(r),
+	}
+}
+
+// returns the IP address a request came from, without its port
+func getIPAddressFromRequest(r *http.Request) string {
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ipAddress
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetSessionDeviceFromRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/signin", nil)
+	r.RemoteAddr = "203.0.113.7:52100"
+	r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	device := getSessionDeviceFromRequest(r)
+	if device.IPAddress != "203.0.113.7" {
+		t.Errorf("got ip address %s, want %s", device.IPAddress, "203.0.113.7")
+	}
+	if device.UserAgent != r.UserAgent() {
+		t.Errorf("got user agent %s, want %s", device.UserAgent, r.UserAgent())
+	}
+
+	r.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength+10))
+	device = getSessionDeviceFromRequest(r)
+	if len(device.UserAgent) != maxUserAgentLength {
+		t.Errorf("got user agent of length %d, want %d", len(device.UserAgent), maxUserAgentLength)
+	}
+}
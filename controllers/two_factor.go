@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+/*
+SetupTwoFactor starts setting up two factor authentication for the signed in user, rendering the user_info page with
+the QR code of a new secret for them to scan into their authenticator app.
+*/
+func (u *Users) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	secret, err := u.TwoFactorService.BeginEnrollment(userId)
+	if err != nil {
+		u.renderAbout(w, r, nil, []string{err.Error()})
+		return
+	}
+	u.renderTwoFactorSetup(w, r, secret, nil)
+}
+
+/*
+ConfirmTwoFactor enables two factor authentication once the user enters a code from their authenticator app, and
+renders the page with their recovery codes - this is the only time they can be shown. If the code is wrong the QR code
+is shown again so the user can try again.
+*/
+func (u *Users) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	recoveryCodes, err := u.TwoFactorService.ConfirmEnrollment(userId, r.FormValue("code"))
+	if err != nil {
+		secret, pendingErr := u.TwoFactorService.GetPendingSecret(userId)
+		if pendingErr != nil {
+			u.renderAbout(w, r, nil, []string{err.Error()})
+			return
+		}
+		u.renderTwoFactorSetup(w, r, secret, []string{err.Error()})
+		return
+	}
+	u.renderRecoveryCodes(w, r, recoveryCodes)
+}
+
+// DisableTwoFactor turns off two factor authentication for the signed in user, once they enter their password again
+func (u *Users) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	err := u.TwoFactorService.Disable(userId, r.FormValue("password"))
+	if err != nil {
+		u.renderAbout(w, r, nil, []string{err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/user/about", http.StatusFound)
+}
+
+// RegenerateRecoveryCodes replaces the signed in user's recovery codes, and renders the page with the new ones
+func (u *Users) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	recoveryCodes, err := u.TwoFactorService.RegenerateRecoveryCodes(userId)
+	if err != nil {
+		u.renderAbout(w, r, nil, []string{err.Error()})
+		return
+	}
+	u.renderRecoveryCodes(w, r, recoveryCodes)
+}
+
+func (u *Users) renderTwoFactorSetup(w http.ResponseWriter, r *http.Request, secret string, errorMsgs []string) {
+	userInfo, _ := GetUserInfoFromContext(r)
+	setupData, err := views.InitTwoFactorSetupData(secret, userInfo.Email)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	u.renderAbout(w, r, func(data *views.UserInfoData) {
+		data.TwoFactorSetup = setupData
+	}, errorMsgs)
+}
+
+func (u *Users) renderRecoveryCodes(w http.ResponseWriter, r *http.Request, recoveryCodes []string) {
+	u.renderAbout(w, r, func(data *views.UserInfoData) {
+		data.RecoveryCodes = recoveryCodes
+	}, nil)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/views"
+)
+
+/*
+Users renders the account pages of the signed in user. The pages are part of the main page templates, so Template is
+the same template that InitTemplateHandler renders from.
+*/
+type Users struct {
+	Template               ExecutorTemplateWithCSRF
+	UserService            *models.UserService
+	APITokenService        *models.APITokenService
+	TwoFactorService       *models.TwoFactorService
+	SessionService         *models.SessionService
+	EmailChangeService     *models.EmailChangeService
+	IdentityService        *models.IdentityService
+	PasskeyService         *models.PasskeyService
+	DataExportService      *models.DataExportService
+	AccountDeletionService *models.AccountDeletionService
+}
+
+// About renders the user_info page, which along with the user's details lists their API tokens
+func (u *Users) About(w http.ResponseWriter, r *http.Request) {
+	u.renderAbout(w, r, nil, nil)
+}
+
+/*
+renders the user_info page. setData is used to set what is only shown straight after an action, such as a newly
+created API token or recovery codes, and can be nil.
+*/
+func (u *Users) renderAbout(w http.ResponseWriter, r *http.Request, setData func(*views.UserInfoData), errorMsgs []string) {
+	userId, _ := GetUserIdFromRequestContext(r)
+	userInfo, _ := GetUserInfoFromContext(r)
+	apiTokens, err := u.APITokenService.GetByUserId(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	twoFactorStatus, err := u.TwoFactorService.GetStatus(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	userInfoData := views.InitUserInfoData(userInfo, apiTokens)
+	userInfoData.TwoFactor = twoFactorStatus
+	pendingEmailChange, isFound, err := u.EmailChangeService.GetPending(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if isFound {
+		userInfoData.PendingEmailChange = &pendingEmailChange
+	}
+	userInfoData.Identities, err = u.IdentityService.GetByUserId(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	dataExport, isFound, err := u.DataExportService.GetByUserId(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if isFound {
+		userInfoData.DataExport = views.InitDataExportData(dataExport)
+	}
+	userInfoData.DeletionScheduledFor, _, err = u.AccountDeletionService.GetScheduled(userId)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if setData != nil {
+		setData(&userInfoData)
+	}
+	csrfToken := GetCSRFTokenFromRequest(r)
+	w.Header().Set("content-type", "text/html")
+	u.Template.ExecTemplateWithCSRF(w, r, csrfToken, "user_info.gohtml", views.InitPageData(userId, userInfoData), errorMsgs)
+}
@@ -40,6 +40,9 @@ func (g *GoMailer) PrepEmail(email services.Email, w io.Writer) *gomail.Message
 	m := gomail.NewMessage()
 	m.SetHeader("From", email.From)
 	m.SetHeader("To", email.To)
+	if email.Subject != "" {
+		m.SetHeader("Subject", email.Subject)
+	}
 	if len(email.Cc) > 0 {
 		m.SetHeader("Cc", email.Cc...)
 	}
@@ -0,0 +1,362 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrNoMetadata is returned by ReadMetadata when an image does not carry any EXIF data
+var ErrNoMetadata = errors.New("image does not contain exif metadata")
+
+/*
+Metadata holds the EXIF fields that are worth keeping about a photo. GPS coordinates and serial numbers are never
+copied in to Metadata, HasGPS and HasSerialNumbers only record whether the original carried them.
+*/
+type Metadata struct {
+	CapturedAt       time.Time
+	CameraMake       string
+	CameraModel      string
+	LensModel        string
+	ExposureTime     string
+	FNumber          float64
+	ISO              int
+	FocalLength      float64
+	Orientation      int
+	HasGPS           bool
+	HasSerialNumbers bool
+}
+
+const (
+	tagMake              = 0x010F
+	tagModel             = 0x0110
+	tagOrientation       = 0x0112
+	tagExifIFD           = 0x8769
+	tagGPSIFD            = 0x8825
+	tagExposureTime      = 0x829A
+	tagFNumber           = 0x829D
+	tagISO               = 0x8827
+	tagDateTimeOriginal  = 0x9003
+	tagOffsetTimeOrig    = 0x9011
+	tagFocalLength       = 0x920A
+	tagCameraSerial      = 0xA431
+	tagLensModel         = 0xA434
+	tagLensSerial        = 0xA435
+	tagCanonSerialNumber = 0xC62F
+
+	exifDateTimeLayout = "2006:01:02 15:04:05"
+)
+
+var (
+	jpegExifHeader = []byte("Exif\x00\x00")
+	pngSignature   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+/*
+ReadMetadata extracts the EXIF metadata from a JPEG (APP1 segment) or PNG (eXIf chunk). Images without EXIF data
+return ErrNoMetadata, along with a Metadata that has Orientation set to 1.
+*/
+func ReadMetadata(contents []byte) (Metadata, error) {
+	metadata := Metadata{Orientation: 1}
+	tiff, err := findTIFF(contents)
+	if err != nil {
+		return metadata, err
+	}
+	reader, err := newTIFFReader(tiff)
+	if err != nil {
+		return metadata, err
+	}
+	ifd0, err := reader.readIFD(reader.firstIFDOffset)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.CameraMake = reader.stringValue(ifd0[tagMake])
+	metadata.CameraModel = reader.stringValue(ifd0[tagModel])
+	if orientation := reader.intValue(ifd0[tagOrientation]); orientation >= 1 && orientation <= 8 {
+		metadata.Orientation = orientation
+	}
+	_, metadata.HasGPS = ifd0[tagGPSIFD]
+	_, metadata.HasSerialNumbers = ifd0[tagCanonSerialNumber]
+
+	if exifEntry, ok := ifd0[tagExifIFD]; ok {
+		exifIFD, err := reader.readIFD(uint32(reader.intValue(exifEntry)))
+		if err == nil {
+			metadata.CapturedAt = parseExifTime(
+				reader.stringValue(exifIFD[tagDateTimeOriginal]),
+				reader.stringValue(exifIFD[tagOffsetTimeOrig]),
+			)
+			metadata.ExposureTime = formatExposureTime(reader.rationalValue(exifIFD[tagExposureTime]))
+			metadata.FNumber = roundTo(ratio(reader.rationalValue(exifIFD[tagFNumber])), 1)
+			metadata.ISO = reader.intValue(exifIFD[tagISO])
+			metadata.FocalLength = roundTo(ratio(reader.rationalValue(exifIFD[tagFocalLength])), 1)
+			metadata.LensModel = reader.stringValue(exifIFD[tagLensModel])
+			_, hasCameraSerial := exifIFD[tagCameraSerial]
+			_, hasLensSerial := exifIFD[tagLensSerial]
+			metadata.HasSerialNumbers = metadata.HasSerialNumbers || hasCameraSerial || hasLensSerial
+		}
+	}
+	return metadata, nil
+}
+
+// returns the TIFF structure that holds the EXIF data of a JPEG or PNG
+func findTIFF(contents []byte) ([]byte, error) {
+	if bytes.HasPrefix(contents, pngSignature) {
+		for _, chunk := range pngChunks(contents) {
+			if chunk.chunkType == "eXIf" {
+				return chunk.data, nil
+			}
+		}
+		return nil, ErrNoMetadata
+	}
+	for _, segment := range jpegSegments(contents) {
+		if segment.marker == 0xE1 && bytes.HasPrefix(segment.data, jpegExifHeader) {
+			return segment.data[len(jpegExifHeader):], nil
+		}
+	}
+	return nil, ErrNoMetadata
+}
+
+/*
+StripMetadata returns a copy of a JPEG or PNG with all EXIF and XMP metadata removed, which takes GPS coordinates and
+serial numbers with it. The image data itself is copied as is, so there is no loss in quality. Other formats are
+returned unchanged.
+*/
+func StripMetadata(contents []byte) []byte {
+	if bytes.HasPrefix(contents, pngSignature) {
+		return stripPNG(contents)
+	}
+	if len(contents) < 2 || contents[0] != 0xFF || contents[1] != 0xD8 {
+		return contents
+	}
+	stripped := bytes.Buffer{}
+	stripped.Write(contents[:2])
+	offset := 2
+	for _, segment := range jpegSegments(contents) {
+		// APP1 holds both EXIF and XMP data
+		if segment.marker != 0xE1 {
+			stripped.Write(contents[segment.start:segment.end])
+		}
+		offset = segment.end
+	}
+	stripped.Write(contents[offset:])
+	return stripped.Bytes()
+}
+
+func stripPNG(contents []byte) []byte {
+	removedChunks := map[string]bool{"eXIf": true, "tEXt": true, "iTXt": true, "zTXt": true}
+	stripped := bytes.Buffer{}
+	stripped.Write(pngSignature)
+	offset := len(pngSignature)
+	for _, chunk := range pngChunks(contents) {
+		if !removedChunks[chunk.chunkType] {
+			stripped.Write(contents[chunk.start:chunk.end])
+		}
+		offset = chunk.end
+	}
+	stripped.Write(contents[offset:])
+	return stripped.Bytes()
+}
+
+type jpegSegment struct {
+	marker     byte
+	start, end int
+	data       []byte
+}
+
+// returns the marker segments of a JPEG up to, but not including, the start of scan segment
+func jpegSegments(contents []byte) []jpegSegment {
+	segments := []jpegSegment{}
+	if len(contents) < 2 || contents[0] != 0xFF || contents[1] != 0xD8 {
+		return segments
+	}
+	offset := 2
+	for offset+4 <= len(contents) {
+		if contents[offset] != 0xFF {
+			break
+		}
+		marker := contents[offset+1]
+		// start of scan - everything after this is compressed image data
+		if marker == 0xDA {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(contents[offset+2 : offset+4]))
+		end := offset + 2 + length
+		if length < 2 || end > len(contents) {
+			break
+		}
+		segments = append(segments, jpegSegment{
+			marker: marker,
+			start:  offset,
+			end:    end,
+			data:   contents[offset+4 : end],
+		})
+		offset = end
+	}
+	return segments
+}
+
+type pngChunk struct {
+	chunkType  string
+	start, end int
+	data       []byte
+}
+
+func pngChunks(contents []byte) []pngChunk {
+	chunks := []pngChunk{}
+	offset := len(pngSignature)
+	for offset+12 <= len(contents) {
+		length := int(binary.BigEndian.Uint32(contents[offset : offset+4]))
+		end := offset + 12 + length
+		if length < 0 || end > len(contents) {
+			break
+		}
+		chunkType := string(contents[offset+4 : offset+8])
+		data := contents[offset+8 : offset+8+length]
+		if crc32.ChecksumIEEE(contents[offset+4:offset+8+length]) != binary.BigEndian.Uint32(contents[offset+8+length:end]) {
+			break
+		}
+		chunks = append(chunks, pngChunk{chunkType, offset, end, data})
+		offset = end
+	}
+	return chunks
+}
+
+type tiffEntry struct {
+	dataType uint16
+	count    uint32
+	value    []byte
+}
+
+type tiffReader struct {
+	data           []byte
+	order          binary.ByteOrder
+	firstIFDOffset uint32
+}
+
+func newTIFFReader(data []byte) (*tiffReader, error) {
+	if len(data) < 8 {
+		return nil, errors.New("exif data is too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("exif data has an unknown byte order")
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, errors.New("exif data is not a valid tiff structure")
+	}
+	return &tiffReader{data, order, order.Uint32(data[4:8])}, nil
+}
+
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]tiffEntry, error) {
+	entries := map[uint16]tiffEntry{}
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("ifd offset %d is out of range", offset)
+	}
+	count := uint32(t.order.Uint16(t.data[offset : offset+2]))
+	for i := uint32(0); i < count; i++ {
+		entryOffset := uint64(offset) + 2 + uint64(i)*12
+		if entryOffset+12 > uint64(len(t.data)) {
+			break
+		}
+		entry := t.data[entryOffset : entryOffset+12]
+		tag := t.order.Uint16(entry[0:2])
+		dataType := t.order.Uint16(entry[2:4])
+		valueCount := t.order.Uint32(entry[4:8])
+		typeSize, ok := tiffTypeSizes[dataType]
+		if !ok {
+			continue
+		}
+		size := uint64(typeSize) * uint64(valueCount)
+		var value []byte
+		if size <= 4 {
+			value = entry[8 : 8+size]
+		} else {
+			valueOffset := uint64(t.order.Uint32(entry[8:12]))
+			if valueOffset+size > uint64(len(t.data)) {
+				continue
+			}
+			value = t.data[valueOffset : valueOffset+size]
+		}
+		entries[tag] = tiffEntry{dataType, valueCount, value}
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) stringValue(entry tiffEntry) string {
+	if entry.dataType != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (t *tiffReader) intValue(entry tiffEntry) int {
+	switch {
+	case entry.dataType == 3 && len(entry.value) >= 2:
+		return int(t.order.Uint16(entry.value))
+	case (entry.dataType == 4 || entry.dataType == 9) && len(entry.value) >= 4:
+		return int(t.order.Uint32(entry.value))
+	case entry.dataType == 1 && len(entry.value) >= 1:
+		return int(entry.value[0])
+	}
+	return 0
+}
+
+func (t *tiffReader) rationalValue(entry tiffEntry) (numerator, denominator uint32) {
+	if (entry.dataType != 5 && entry.dataType != 10) || len(entry.value) < 8 {
+		return 0, 0
+	}
+	return t.order.Uint32(entry.value[0:4]), t.order.Uint32(entry.value[4:8])
+}
+
+func ratio(numerator, denominator uint32) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
+
+func roundTo(value float64, places int) float64 {
+	shift := math.Pow(10, float64(places))
+	return math.Round(value*shift) / shift
+}
+
+// formats an exposure time the way photographers expect to read it, e.g. "1/250" or "2"
+func formatExposureTime(numerator, denominator uint32) string {
+	if numerator == 0 || denominator == 0 {
+		return ""
+	}
+	if numerator < denominator {
+		return fmt.Sprintf("1/%d", int(math.Round(float64(denominator)/float64(numerator))))
+	}
+	return fmt.Sprintf("%g", roundTo(ratio(numerator, denominator), 1))
+}
+
+// parses the EXIF capture date, which has no zone unless an OffsetTimeOriginal was also recorded
+func parseExifTime(dateTime, offset string) time.Time {
+	if dateTime == "" {
+		return time.Time{}
+	}
+	if offset != "" {
+		parsed, err := time.Parse(exifDateTimeLayout+"-07:00", dateTime+offset)
+		if err == nil {
+			return parsed
+		}
+	}
+	parsed, err := time.Parse(exifDateTimeLayout, dateTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
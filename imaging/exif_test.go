@@ -0,0 +1,255 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestReadMetadata(t *testing.T) {
+	contents := testJPEGWithExif(t, 40, 20, 6)
+	metadata, err := ReadMetadata(contents)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	type test struct {
+		name string
+		got  any
+		want any
+	}
+	tests := []test{
+		{"camera make", metadata.CameraMake, "Lensmaker"},
+		{"camera model", metadata.CameraModel, "LM-1"},
+		{"lens model", metadata.LensModel, "50mm f/1.8"},
+		{"orientation", metadata.Orientation, 6},
+		{"exposure time", metadata.ExposureTime, "1/250"},
+		{"f number", metadata.FNumber, 1.8},
+		{"iso", metadata.ISO, 400},
+		{"focal length", metadata.FocalLength, 50.0},
+		{"captured at", metadata.CapturedAt, time.Date(2024, 5, 17, 14, 30, 5, 0, time.UTC)},
+		{"has gps", metadata.HasGPS, true},
+		{"has serial numbers", metadata.HasSerialNumbers, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.got != test.want {
+				t.Errorf("got %v, want %v\n", test.got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadMetadataWithoutExif(t *testing.T) {
+	metadata, err := ReadMetadata(encodeTestImage(t, "jpeg", 10, 10))
+	if !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("got err %v, want %v\n", err, ErrNoMetadata)
+	}
+	if metadata.Orientation != 1 {
+		t.Errorf("got orientation %d, want %d\n", metadata.Orientation, 1)
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	contents := testJPEGWithExif(t, 40, 20, 1)
+	stripped := StripMetadata(contents)
+	_, err := ReadMetadata(stripped)
+	if !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("got err %v, want %v\n", err, ErrNoMetadata)
+	}
+	if bytes.Contains(stripped, []byte("SN-123456")) {
+		t.Errorf("serial number was not stripped")
+	}
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Errorf("didn't expect error decoding stripped image, got %v\n", err)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	type test struct {
+		name            string
+		contents        []byte
+		keepMetadata    bool
+		expectedWidth   int
+		expectedHeight  int
+		isExpectExif    bool
+		isExpectOrignal bool
+	}
+	rotated := testJPEGWithExif(t, 40, 20, 6)
+	upright := testJPEGWithExif(t, 40, 20, 1)
+	tests := []test{
+		{"rotated photo is oriented and stripped", rotated, false, 20, 40, false, false},
+		{"upright photo is stripped", upright, false, 40, 20, false, false},
+		{"metadata is kept when opted in", rotated, true, 20, 40, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			processed, err := Process(test.contents, test.keepMetadata)
+			if err != nil {
+				t.Fatalf("didn't expect error, got %v\n", err)
+			}
+			if processed.Width != test.expectedWidth || processed.Height != test.expectedHeight {
+				t.Errorf("got %dx%d, want %dx%d\n", processed.Width, processed.Height, test.expectedWidth, test.expectedHeight)
+			}
+			_, err = ReadMetadata(processed.Contents)
+			if hasExif := err == nil; hasExif != test.isExpectExif {
+				t.Errorf("got exif present %t, want %t\n", hasExif, test.isExpectExif)
+			}
+			if isOriginal := bytes.Equal(processed.Contents, test.contents); isOriginal != test.isExpectOrignal {
+				t.Errorf("got original bytes kept %t, want %t\n", isOriginal, test.isExpectOrignal)
+			}
+			if processed.Metadata.CameraModel != "LM-1" {
+				t.Errorf("got camera model %s, want %s\n", processed.Metadata.CameraModel, "LM-1")
+			}
+		})
+	}
+}
+
+func TestProcessTooManyPixels(t *testing.T) {
+	// a file of a few bytes can claim to be 50000x50000, which would take gigabytes to decode
+	contents := testPNGHeader(50000, 50000)
+	_, err := Process(contents, false)
+	if !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("got %v, want %v\n", err, ErrTooManyPixels)
+	}
+	_, err = GenerateVariants(contents)
+	if !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("got %v, want %v\n", err, ErrTooManyPixels)
+	}
+}
+
+// returns the start of a PNG file with an IHDR chunk claiming the dimensions passed in, but none of the pixels
+func testPNGHeader(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	// 8 bit RGBA, with the default compression, filter and interlace methods
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	contents := []byte("\x89PNG\r\n\x1a\n")
+	contents = binary.BigEndian.AppendUint32(contents, uint32(len(ihdr)-4))
+	contents = append(contents, ihdr...)
+	return binary.BigEndian.AppendUint32(contents, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestApplyOrientation(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	// a 2x1 image, red on the left and blue on the right
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	type test struct {
+		name        string
+		orientation int
+		expected    map[image.Point]color.RGBA
+	}
+	tests := []test{
+		{"normal", 1, map[image.Point]color.RGBA{{0, 0}: red, {1, 0}: blue}},
+		{"mirrored", 2, map[image.Point]color.RGBA{{0, 0}: blue, {1, 0}: red}},
+		{"rotated 180", 3, map[image.Point]color.RGBA{{0, 0}: blue, {1, 0}: red}},
+		{"rotated 90 clockwise", 6, map[image.Point]color.RGBA{{0, 0}: red, {0, 1}: blue}},
+		{"rotated 90 counter clockwise", 8, map[image.Point]color.RGBA{{0, 0}: blue, {0, 1}: red}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oriented := ApplyOrientation(src, test.orientation)
+			for point, want := range test.expected {
+				got := color.RGBAModel.Convert(oriented.At(point.X, point.Y))
+				if got != want {
+					t.Errorf("got %v at %v, want %v\n", got, point, want)
+				}
+			}
+		})
+	}
+}
+
+type testTIFFEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	value    []byte
+}
+
+func asciiEntry(tag uint16, value string) testTIFFEntry {
+	return testTIFFEntry{tag, 2, uint32(len(value) + 1), append([]byte(value), 0)}
+}
+
+func shortEntry(tag uint16, value uint16) testTIFFEntry {
+	return testTIFFEntry{tag, 3, 1, binary.LittleEndian.AppendUint16(nil, value)}
+}
+
+func rationalEntry(tag uint16, numerator, denominator uint32) testTIFFEntry {
+	value := binary.LittleEndian.AppendUint32(nil, numerator)
+	return testTIFFEntry{tag, 5, 1, binary.LittleEndian.AppendUint32(value, denominator)}
+}
+
+// writes an IFD at offset, with values that do not fit in an entry placed straight after it. Returns the bytes written
+func writeTestIFD(offset uint32, entries []testTIFFEntry) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	ifdSize := uint32(2 + len(entries)*12 + 4)
+	ifd := binary.LittleEndian.AppendUint16(nil, uint16(len(entries)))
+	data := []byte{}
+	for _, entry := range entries {
+		ifd = binary.LittleEndian.AppendUint16(ifd, entry.tag)
+		ifd = binary.LittleEndian.AppendUint16(ifd, entry.dataType)
+		ifd = binary.LittleEndian.AppendUint32(ifd, entry.count)
+		if len(entry.value) <= 4 {
+			ifd = append(ifd, entry.value...)
+			ifd = append(ifd, make([]byte, 4-len(entry.value))...)
+			continue
+		}
+		ifd = binary.LittleEndian.AppendUint32(ifd, offset+ifdSize+uint32(len(data)))
+		data = append(data, entry.value...)
+	}
+	ifd = binary.LittleEndian.AppendUint32(ifd, 0)
+	return append(ifd, data...)
+}
+
+// builds a JPEG with an EXIF APP1 segment holding camera details, a GPS IFD and a serial number
+func testJPEGWithExif(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+	exifIFD := []testTIFFEntry{
+		rationalEntry(tagExposureTime, 1, 250),
+		rationalEntry(tagFNumber, 18, 10),
+		shortEntry(tagISO, 400),
+		asciiEntry(tagDateTimeOriginal, "2024:05:17 14:30:05"),
+		rationalEntry(tagFocalLength, 50, 1),
+		asciiEntry(tagLensModel, "50mm f/1.8"),
+		asciiEntry(tagCameraSerial, "SN-123456"),
+	}
+	// the IFD0 pointers are filled in once the size of IFD0 is known, so it is written twice
+	ifd0Entries := func(exifOffset, gpsOffset uint32) []testTIFFEntry {
+		return []testTIFFEntry{
+			asciiEntry(tagMake, "Lensmaker"),
+			asciiEntry(tagModel, "LM-1"),
+			shortEntry(tagOrientation, orientation),
+			{tagExifIFD, 4, 1, binary.LittleEndian.AppendUint32(nil, exifOffset)},
+			{tagGPSIFD, 4, 1, binary.LittleEndian.AppendUint32(nil, gpsOffset)},
+		}
+	}
+	ifd0Size := uint32(len(writeTestIFD(8, ifd0Entries(0, 0))))
+	exifOffset := 8 + ifd0Size
+	exifBytes := writeTestIFD(exifOffset, exifIFD)
+	gpsOffset := exifOffset + uint32(len(exifBytes))
+
+	tiff := []byte("II")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 42)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = append(tiff, writeTestIFD(8, ifd0Entries(exifOffset, gpsOffset))...)
+	tiff = append(tiff, exifBytes...)
+	tiff = append(tiff, writeTestIFD(gpsOffset, []testTIFFEntry{})...)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	encoded := encodeTestImage(t, "jpeg", width, height)
+	contents := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(app1)+2))
+	contents = append(contents, app1...)
+	return append(contents, encoded[2:]...)
+}
@@ -0,0 +1,148 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+/*
+MaxPixels is the most pixels an image can have to be processed. Decoding an image takes memory for every pixel whatever
+the size of its file, so a small file that claims to be huge would otherwise be enough to run the server out of memory.
+*/
+const MaxPixels = 50 * 1000 * 1000
+
+// ErrTooManyPixels is returned for images with more than MaxPixels pixels, before they are decoded
+var ErrTooManyPixels = fmt.Errorf("image has more than %d pixels", MaxPixels)
+
+// returns ErrTooManyPixels if an image with config is too large to decode
+func checkPixels(config image.Config) error {
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return fmt.Errorf("%w: it is %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+	return nil
+}
+
+/*
+ProcessedImage is the result of preparing an upload for storage.
+
+Contents is what should be stored as the original, Width and Height are its dimensions once orientation has been
+applied, and Variants holds the resized versions that should be stored alongside it.
+*/
+type ProcessedImage struct {
+	Contents []byte
+	Format   string
+	Width    int
+	Height   int
+	Metadata Metadata
+	Variants []GeneratedVariant
+}
+
+/*
+Process reads the EXIF metadata of an upload, and prepares the bytes that should be stored for it.
+
+Unless keepMetadata is true, the stored original has its EXIF and XMP data stripped. If the photo was taken rotated
+(an EXIF orientation other than 1) the pixels are rotated and re-encoded, as the orientation tag is stripped along with
+everything else. When keepMetadata is true the original bytes are stored untouched, and browsers apply the orientation.
+
+Resized variants are always generated from the correctly oriented image, and never carry metadata. Images with more than
+MaxPixels pixels are refused with ErrTooManyPixels before anything is decoded.
+*/
+func Process(contents []byte, keepMetadata bool) (*ProcessedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	err = checkPixels(config)
+	if err != nil {
+		return nil, err
+	}
+	processed := &ProcessedImage{
+		Contents: contents,
+		Format:   format,
+		Width:    config.Width,
+		Height:   config.Height,
+	}
+	metadata, err := ReadMetadata(contents)
+	if err != nil && !errors.Is(err, ErrNoMetadata) {
+		// metadata that cannot be parsed is treated the same as no metadata, it will still be stripped
+		fmt.Println("could not read image metadata: ", err)
+	}
+	processed.Metadata = metadata
+
+	// animated GIFs would lose every frame but the first if they were decoded and re-encoded
+	if format == "gif" {
+		return processed, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	oriented := ApplyOrientation(img, metadata.Orientation)
+	processed.Width = oriented.Bounds().Dx()
+	processed.Height = oriented.Bounds().Dy()
+
+	if !keepMetadata {
+		if metadata.Orientation > 1 {
+			processed.Contents, err = Encode(oriented, format)
+			if err != nil {
+				return nil, fmt.Errorf("encoding oriented image: %w", err)
+			}
+		} else {
+			processed.Contents = StripMetadata(contents)
+		}
+	}
+
+	processed.Variants, err = GenerateVariantsFromImage(oriented, format)
+	if err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+/*
+ApplyOrientation returns img transformed so that it displays upright, based on the EXIF orientation passed in.
+Orientations 5 to 8 swap the width and height of the image.
+*/
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for dy := 0; dy < dstHeight; dy++ {
+		for dx := 0; dx < dstWidth; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = width-1-dx, dy
+			case 3:
+				sx, sy = width-1-dx, height-1-dy
+			case 4:
+				sx, sy = dx, height-1-dy
+			case 5:
+				sx, sy = dy, dx
+			case 6:
+				sx, sy = dy, height-1-dx
+			case 7:
+				sx, sy = width-1-dy, height-1-dx
+			case 8:
+				sx, sy = width-1-dy, dx
+			}
+			srcOffset := src.PixOffset(sx, sy)
+			dstOffset := dst.PixOffset(dx, dy)
+			copy(dst.Pix[dstOffset:dstOffset+4], src.Pix[srcOffset:srcOffset+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,129 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+const jpegQuality = 85
+
+// Variant is a resized version of an uploaded image, identified by Name and no wider than MaxWidth
+type Variant struct {
+	Name     string
+	MaxWidth int
+}
+
+// Variants lists every size generated on upload, from smallest to largest
+var Variants = []Variant{
+	{"thumbnail", 320},
+	{"medium", 800},
+	{"large", 1600},
+}
+
+// VariantByName returns the Variant with the name passed in. isFound is false if there is no such variant
+func VariantByName(name string) (variant Variant, isFound bool) {
+	for _, variant := range Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
+// GeneratedVariant is the encoded output of resizing an image to a Variant
+type GeneratedVariant struct {
+	Variant
+	Contents []byte
+	Width    int
+	Height   int
+}
+
+/*
+GenerateVariants decodes the image passed in and returns every Variant that is narrower than the image itself, encoded
+in the same format as the original. Images are never scaled up, so a small image can produce no variants at all.
+
+GIFs are skipped, as resizing would drop every frame but the first of an animated GIF. As with Process, images with more
+than MaxPixels pixels are refused with ErrTooManyPixels.
+*/
+func GenerateVariants(contents []byte) ([]GeneratedVariant, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	err = checkPixels(config)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	return GenerateVariantsFromImage(img, format)
+}
+
+// GenerateVariantsFromImage works as GenerateVariants does, on an image that has already been decoded
+func GenerateVariantsFromImage(img image.Image, format string) ([]GeneratedVariant, error) {
+	generated := []GeneratedVariant{}
+	if format == "gif" {
+		return generated, nil
+	}
+	bounds := img.Bounds()
+	for _, variant := range Variants {
+		if bounds.Dx() <= variant.MaxWidth {
+			continue
+		}
+		resized := Resize(img, variant.MaxWidth)
+		encoded, err := Encode(resized, format)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s variant: %w", variant.Name, err)
+		}
+		generated = append(generated, GeneratedVariant{
+			Variant:  variant,
+			Contents: encoded,
+			Width:    resized.Bounds().Dx(),
+			Height:   resized.Bounds().Dy(),
+		})
+	}
+	return generated, nil
+}
+
+// Resize scales img down so that it is no wider than maxWidth, keeping its aspect ratio
+func Resize(img image.Image, maxWidth int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxWidth {
+		return img
+	}
+	height := bounds.Dy() * maxWidth / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Encode writes img in the format passed in, which is one of the format names returned by image.Decode
+func Encode(img image.Image, format string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("image format %s is not supported", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
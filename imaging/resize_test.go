@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestGenerateVariants(t *testing.T) {
+	type test struct {
+		name          string
+		contents      []byte
+		expectedSizes map[string][2]int
+	}
+	tests := []test{
+		{
+			"large jpeg produces every variant",
+			encodeTestImage(t, "jpeg", 2000, 1000),
+			map[string][2]int{"thumbnail": {320, 160}, "medium": {800, 400}, "large": {1600, 800}},
+		},
+		{
+			"medium png is not scaled up",
+			encodeTestImage(t, "png", 1000, 500),
+			map[string][2]int{"thumbnail": {320, 160}, "medium": {800, 400}},
+		},
+		{
+			"image narrower than thumbnail produces no variants",
+			encodeTestImage(t, "png", 100, 100),
+			map[string][2]int{},
+		},
+		{
+			"gif is skipped",
+			encodeTestImage(t, "gif", 2000, 1000),
+			map[string][2]int{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generated, err := GenerateVariants(test.contents)
+			if err != nil {
+				t.Errorf("didn't expect error, got %v\n", err)
+				return
+			}
+			if len(generated) != len(test.expectedSizes) {
+				t.Errorf("got %d variants, want %d\n", len(generated), len(test.expectedSizes))
+				return
+			}
+			for _, variant := range generated {
+				want := test.expectedSizes[variant.Name]
+				if variant.Width != want[0] || variant.Height != want[1] {
+					t.Errorf("got %s %dx%d, want %dx%d\n", variant.Name, variant.Width, variant.Height, want[0], want[1])
+				}
+				config, _, err := image.DecodeConfig(bytes.NewReader(variant.Contents))
+				if err != nil {
+					t.Errorf("didn't expect error decoding %s variant, got %v\n", variant.Name, err)
+					continue
+				}
+				if config.Width != want[0] {
+					t.Errorf("got encoded width %d, want %d\n", config.Width, want[0])
+				}
+			}
+		})
+	}
+}
+
+func TestVariantByName(t *testing.T) {
+	_, isFound := VariantByName("medium")
+	if !isFound {
+		t.Errorf("expected medium variant to be found")
+	}
+	_, isFound = VariantByName("huge")
+	if isFound {
+		t.Errorf("didn't expect huge variant to be found")
+	}
+}
+
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	buf := bytes.Buffer{}
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	return buf.Bytes()
+}
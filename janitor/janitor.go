@@ -0,0 +1,155 @@
+/*
+Package janitor runs the clean up tasks that keep the database and image store from growing forever - purging expired
+sessions and tokens, deleting the accounts users asked to be deleted, and deleting images left behind by deleted
+galleries.
+
+Each Task runs on its own interval in the background with Run, or every task can be run once with RunOnce.
+*/
+package janitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/models"
+)
+
+const (
+	DefaultInterval      = time.Hour
+	DefaultImageInterval = 24 * time.Hour
+	// OrphanedImageGracePeriod is how old an image must be before it is deleted for not belonging to a gallery
+	OrphanedImageGracePeriod = time.Hour
+)
+
+// Config holds how often the tasks of the janitor run
+type Config struct {
+	// Interval is how often expired sessions and tokens are purged
+	Interval time.Duration
+	// ImageInterval is how often the image store is swept for orphaned images, which means listing the whole store
+	ImageInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:      DefaultInterval,
+		ImageInterval: DefaultImageInterval,
+	}
+}
+
+/*
+Task is a clean up task. Run is passed the time the task is run at, and returns how many rows or objects it removed.
+*/
+type Task struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time) (int64, error)
+}
+
+// Result records what a task did the last time it was run
+type Result struct {
+	Task       string
+	NumRemoved int64
+	Err        error
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("janitor: %s failed after removing %d: %v", r.Task, r.NumRemoved, r.Err)
+	}
+	return fmt.Sprintf("janitor: %s removed %d", r.Task, r.NumRemoved)
+}
+
+type Janitor struct {
+	Tasks []Task
+	// Now is used to get the time tasks are run at. Defaults to time.Now
+	Now func() time.Time
+	// Report is called with the result of every task that is run. Defaults to printing the result
+	Report func(Result)
+}
+
+func New(tasks []Task) *Janitor {
+	return &Janitor{
+		Tasks: tasks,
+		Now:   time.Now,
+		Report: func(result Result) {
+			fmt.Println(result)
+		},
+	}
+}
+
+/*
+Tasks returns the clean up tasks for the services in dbc, run on the intervals in cfg.
+*/
+func Tasks(dbc *models.DBConnections, cfg Config) []Task {
+	return []Task{
+		{"expired sessions", cfg.Interval, dbc.SessionService.DeleteExpiredSessions},
+		{"expired reset password tokens", cfg.Interval, dbc.ForgotPWService.DeleteExpiredTokens},
+		{"expired sign in links", cfg.Interval, dbc.MagicLinkService.DeleteExpiredTokens},
+		{"expired email verification tokens", cfg.Interval, dbc.EmailVerificationService.DeleteExpiredTokens},
+		{"expired email change tokens", cfg.Interval, dbc.EmailChangeService.DeleteExpiredTokens},
+		{"expired two factor sign ins", cfg.Interval, dbc.TwoFactorService.DeleteExpiredChallenges},
+		{"expired social sign ins", cfg.Interval, dbc.IdentityService.DeleteExpiredAuthRequests},
+		{"expired passkey challenges", cfg.Interval, dbc.PasskeyService.DeleteExpiredChallenges},
+		{"expired data exports", cfg.Interval, dbc.DataExportService.DeleteExpired},
+		{"accounts scheduled for deletion", cfg.Interval, dbc.AccountDeletionService.DeleteScheduledAccounts},
+		{"expired failed sign in attempts", cfg.Interval, dbc.LoginThrottleService.DeleteExpired},
+		{"full rate limit buckets", cfg.Interval, dbc.RateLimitService.DeleteFullBuckets},
+		{"orphaned images", cfg.ImageInterval, func(now time.Time) (int64, error) {
+			return dbc.GalleryService.DeleteOrphanedImages(now.Add(-OrphanedImageGracePeriod))
+		}},
+	}
+}
+
+/*
+RunOnce runs every task once, one after another. A task failing does not stop the tasks after it from running - the
+errors of every task that failed are returned joined together.
+*/
+func (j *Janitor) RunOnce() error {
+	errs := []error{}
+	for _, task := range j.Tasks {
+		result := j.runTask(task)
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", task.Name, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+/*
+Run runs every task straight away and then again each time its interval passes, until ctx is done. Tasks with an
+interval of zero or less are not run. Run returns once any task that is running when ctx is done has finished, so it
+can be waited on for a graceful shutdown.
+*/
+func (j *Janitor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, task := range j.Tasks {
+		if task.Interval <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(task Task) {
+			defer wg.Done()
+			ticker := time.NewTicker(task.Interval)
+			defer ticker.Stop()
+			for {
+				j.runTask(task)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(task)
+	}
+	wg.Wait()
+}
+
+func (j *Janitor) runTask(task Task) Result {
+	numRemoved, err := task.Run(j.Now())
+	result := Result{task.Name, numRemoved, err}
+	j.Report(result)
+	return result
+}
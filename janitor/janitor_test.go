@@ -0,0 +1,91 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ranAt := map[string]time.Time{}
+	errFailed := errors.New("failed")
+	tasks := []Task{
+		{"first", time.Hour, func(taskNow time.Time) (int64, error) {
+			ranAt["first"] = taskNow
+			return 0, errFailed
+		}},
+		{"second", time.Hour, func(taskNow time.Time) (int64, error) {
+			ranAt["second"] = taskNow
+			return 3, nil
+		}},
+	}
+	results := []Result{}
+	j := New(tasks)
+	j.Now = func() time.Time { return now }
+	j.Report = func(result Result) { results = append(results, result) }
+
+	err := j.RunOnce()
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected %v, got %v", errFailed, err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if !ranAt[name].Equal(now) {
+			t.Errorf("expected %s to run at %v, got %v", name, now, ranAt[name])
+		}
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[1].NumRemoved != 3 || results[1].Err != nil {
+		t.Errorf("expected second task to remove 3 without error, got %+v", results[1])
+	}
+}
+
+func TestRunStopsWhenContextIsDone(t *testing.T) {
+	var mu sync.Mutex
+	numRuns := map[string]int{}
+	countRun := func(name string) func(time.Time) (int64, error) {
+		return func(time.Time) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			numRuns[name]++
+			return 0, nil
+		}
+	}
+	tasks := []Task{
+		{"frequent", time.Millisecond, countRun("frequent")},
+		{"infrequent", time.Hour, countRun("infrequent")},
+		{"disabled", 0, countRun("disabled")},
+	}
+	j := New(tasks)
+	j.Report = func(Result) {}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once the context was cancelled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if numRuns["frequent"] < 2 {
+		t.Errorf("expected frequent task to run more than once, ran %d times", numRuns["frequent"])
+	}
+	if numRuns["infrequent"] != 1 {
+		t.Errorf("expected infrequent task to run once when started, ran %d times", numRuns["infrequent"])
+	}
+	if numRuns["disabled"] != 0 {
+		t.Errorf("expected disabled task not to run, ran %d times", numRuns["disabled"])
+	}
+}
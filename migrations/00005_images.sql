@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE images (
+    id SERIAL PRIMARY KEY,
+    gallery_id INT NOT NULL,
+    uploaded_by INT,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    width INT NOT NULL DEFAULT 0,
+    height INT NOT NULL DEFAULT 0,
+    position INT NOT NULL DEFAULT 0,
+    caption TEXT NOT NULL DEFAULT '',
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT fk_gallery FOREIGN KEY (gallery_id) REFERENCES galleries(id) ON DELETE CASCADE,
+    CONSTRAINT fk_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT images_gallery_id_filename_key UNIQUE (gallery_id, filename)
+);
+CREATE INDEX images_gallery_id_position_idx ON images (gallery_id, position);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE images;
+-- +goose StatementEnd
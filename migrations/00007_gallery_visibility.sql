@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE galleries
+    ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private',
+    ADD COLUMN slug TEXT,
+    ADD CONSTRAINT galleries_visibility_check CHECK (visibility IN ('public', 'unlisted', 'private')),
+    ADD CONSTRAINT galleries_slug_key UNIQUE (slug);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE galleries
+    DROP CONSTRAINT galleries_slug_key,
+    DROP CONSTRAINT galleries_visibility_check,
+    DROP COLUMN slug,
+    DROP COLUMN visibility;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE gallery_members (
+    id SERIAL PRIMARY KEY,
+    gallery_id INT NOT NULL,
+    email TEXT NOT NULL,
+    user_id INT,
+    role TEXT NOT NULL,
+    invited_by INT,
+    token_hash TEXT UNIQUE,
+    invite_expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    accepted_at TIMESTAMPTZ,
+    CONSTRAINT fk_gallery FOREIGN KEY (gallery_id) REFERENCES galleries(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_invited_by FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT gallery_members_role_check CHECK (role IN ('viewer', 'contributor', 'editor')),
+    CONSTRAINT gallery_members_gallery_id_email_key UNIQUE (gallery_id, email)
+);
+CREATE INDEX gallery_members_user_id_idx ON gallery_members (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE gallery_members;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sessions
+    ADD COLUMN is_remember_me BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN absolute_expires_on TIMESTAMPTZ;
+UPDATE sessions
+    SET absolute_expires_on = expires_on;
+ALTER TABLE sessions
+    ALTER COLUMN absolute_expires_on SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions
+    DROP COLUMN is_remember_me,
+    DROP COLUMN absolute_expires_on;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE login_throttles (
+    kind TEXT NOT NULL,
+    key TEXT NOT NULL,
+    num_failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    blocked_until TIMESTAMPTZ,
+    is_locked_out BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (kind, key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_throttles;
+-- +goose StatementEnd
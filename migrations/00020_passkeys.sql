@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE passkeys (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    credential_id BYTEA UNIQUE NOT NULL,
+    -- the COSE key of the credential, as the authenticator registered it
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE TABLE webauthn_challenges (
+    id SERIAL PRIMARY KEY,
+    challenge_hash TEXT UNIQUE NOT NULL,
+    -- set for the challenges of registering a passkey, and not for those of signing in with one
+    user_id INT,
+    expires_on TIMESTAMPTZ NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webauthn_challenges;
+DROP TABLE passkeys;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_for TIMESTAMPTZ;
+CREATE TABLE data_exports (
+    id SERIAL PRIMARY KEY,
+    user_id INT UNIQUE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ,
+    expires_on TIMESTAMPTZ NOT NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE data_exports;
+ALTER TABLE users
+    DROP COLUMN deletion_scheduled_for;
+-- +goose StatementEnd
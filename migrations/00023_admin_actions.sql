@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE admin_actions (
+    id SERIAL PRIMARY KEY,
+    admin_id INT,
+    user_id INT,
+    action TEXT NOT NULL CHECK (action IN ('disable_user', 'enable_user', 'revoke_sessions', 'force_password_reset')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT fk_admin FOREIGN KEY (admin_id) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX admin_actions_user_id_idx ON admin_actions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE admin_actions;
+-- +goose StatementEnd
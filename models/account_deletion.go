@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AccountDeletionGracePeriod is how long a user has to change their mind after asking for their account to be deleted
+const AccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+/*
+AccountDeletionService deletes the accounts of users who ask for it. Asking only schedules the deletion, which
+DeleteScheduledAccounts carries out once AccountDeletionGracePeriod has passed - until then, the user can sign in and
+cancel it.
+
+Deleting an account deletes the galleries the user owns along with their images, and the user's export of their data.
+Images the user uploaded to the galleries of others are kept, as they belong to those galleries.
+*/
+type AccountDeletionService struct {
+	db                *sql.DB
+	galleryService    *GalleryService
+	dataExportService *DataExportService
+}
+
+/*
+Schedule schedules the user's account to be deleted once the grace period has passed, once their password has been
+checked. Scheduling an account that is already scheduled keeps the time it was first scheduled for, which is returned.
+*/
+func (ads *AccountDeletionService) Schedule(userId int, password string) (time.Time, error) {
+	err := checkUserPassword(ads.db, userId, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var scheduledFor time.Time
+	row := ads.db.QueryRow(`
+		UPDATE users
+		SET deletion_scheduled_for = COALESCE(deletion_scheduled_for, now() + make_interval(secs => $2))
+		WHERE id = ($1)
+		RETURNING deletion_scheduled_for;
+	`, userId, AccountDeletionGracePeriod.Seconds())
+	err = row.Scan(&scheduledFor)
+	if err != nil {
+		return time.Time{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	return scheduledFor, nil
+}
+
+// Cancel cancels the deletion of the user's account, if it is scheduled
+func (ads *AccountDeletionService) Cancel(userId int) error {
+	_, err := ads.db.Exec(`
+		UPDATE users
+		SET deletion_scheduled_for = NULL
+		WHERE id = ($1);
+	`, userId)
+	if err != nil {
+		return fmt.Errorf("cancel account deletion: %w", err)
+	}
+	return nil
+}
+
+// GetScheduled returns when the user's account is scheduled to be deleted, if it is
+func (ads *AccountDeletionService) GetScheduled(userId int) (scheduledFor time.Time, isScheduled bool, err error) {
+	var deletionScheduledFor sql.NullTime
+	row := ads.db.QueryRow(`
+		SELECT deletion_scheduled_for
+		FROM users
+		WHERE id = ($1);
+	`, userId)
+	err = row.Scan(&deletionScheduledFor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("get scheduled account deletion: %w", err)
+	}
+	return deletionScheduledFor.Time, deletionScheduledFor.Valid, nil
+}
+
+/*
+DeleteAccount deletes the user's account straight away, along with everything they have stored. The galleries are
+deleted first, one at a time through the GalleryService so their images are removed from the store, and the user last -
+so if deleting fails part way through, the account is still there to be deleted again.
+*/
+func (ads *AccountDeletionService) DeleteAccount(userId int) error {
+	galleries, err := ads.galleryService.GetGalleryListByUserId(userId)
+	if err != nil {
+		return fmt.Errorf("delete account of user-%d: %w", userId, err)
+	}
+	for _, gallery := range galleries {
+		err = ads.galleryService.DeleteById(gallery.ID)
+		if err != nil {
+			return fmt.Errorf("delete account of user-%d: %w", userId, err)
+		}
+	}
+	err = ads.dataExportService.deleteByUserId(userId)
+	if err != nil {
+		return fmt.Errorf("delete account of user-%d: %w", userId, err)
+	}
+	_, err = ads.db.Exec(`
+		DELETE FROM users
+		WHERE id = ($1);
+	`, userId)
+	if err != nil {
+		return fmt.Errorf("delete account of user-%d: %w", userId, err)
+	}
+	return nil
+}
+
+/*
+DeleteScheduledAccounts deletes the accounts that were scheduled to be deleted before now. An account that cannot be
+deleted does not hold up the ones after it - every account is tried, and the errors of those that failed are returned
+joined together, with the number that were deleted.
+*/
+func (ads *AccountDeletionService) DeleteScheduledAccounts(now time.Time) (int64, error) {
+	rows, err := ads.db.Query(`
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_for < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete scheduled accounts: %w", err)
+	}
+	defer rows.Close()
+	userIds := []int{}
+	for rows.Next() {
+		var userId int
+		err = rows.Scan(&userId)
+		if err != nil {
+			return 0, fmt.Errorf("delete scheduled accounts: %w", err)
+		}
+		userIds = append(userIds, userId)
+	}
+	err = rows.Err()
+	if err != nil {
+		return 0, fmt.Errorf("delete scheduled accounts: %w", err)
+	}
+	rows.Close()
+	var numDeleted int64
+	errs := []error{}
+	for _, userId := range userIds {
+		err = ads.DeleteAccount(userId)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete scheduled accounts: %w", err))
+			continue
+		}
+		numDeleted++
+	}
+	return numDeleted, errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	gallery, err := dbc.GalleryService.Create("deletion_test_gallery", userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = dbc.GalleryService.CreateImage(gallery.ID, userId, "deleted.png", bytes.NewReader(testPNG(t, 4, 3)))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+
+	_, err = dbc.AccountDeletionService.Schedule(userId, "wrong password")
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error scheduling with the wrong password, got %v\n", err)
+	}
+	scheduledFor, err := dbc.AccountDeletionService.Schedule(userId, "Holoq123holoq123")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if scheduledFor.Before(time.Now().Add(AccountDeletionGracePeriod - time.Minute)) {
+		t.Errorf("got deletion scheduled for %v, want it after the grace period\n", scheduledFor)
+	}
+	err = dbc.AccountDeletionService.Cancel(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, isScheduled, err := dbc.AccountDeletionService.GetScheduled(userId)
+	if err != nil || isScheduled {
+		t.Errorf("got %t %v, want the deletion cancelled\n", isScheduled, err)
+	}
+
+	scheduledFor, _ = dbc.AccountDeletionService.Schedule(userId, "Holoq123holoq123")
+	_, err = dbc.AccountDeletionService.DeleteScheduledAccounts(time.Now())
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	count, _ := dbc.UserService.GetUserCountById(userId)
+	if count != 1 {
+		t.Errorf("expected the account to be kept during the grace period")
+	}
+	numDeleted, err := dbc.AccountDeletionService.DeleteScheduledAccounts(scheduledFor.Add(time.Second))
+	if err != nil || numDeleted < 1 {
+		t.Fatalf("got %d %v, want the account deleted\n", numDeleted, err)
+	}
+	count, _ = dbc.UserService.GetUserCountById(userId)
+	if count != 0 {
+		t.Errorf("expected the account to be deleted")
+	}
+	objects, err := dbc.GalleryService.Store.List(dbc.GalleryService.GalleryPrefix(gallery.ID))
+	if err != nil || len(objects) != 0 {
+		t.Errorf("got %v %v, want the images of the gallery deleted\n", objects, err)
+	}
+}
+
+func TestDeleteScheduledAccountsSkipsFailures(t *testing.T) {
+	userIds := []int{}
+	for _, email := range []string{"test_deletion_fails@gmail.com", "test_deletion_succeeds@gmail.com"} {
+		user, err := dbc.UserService.CreateUser(UserEmailToPlainTextPassword{email, "Holoq123holoq123"})
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		defer dbc.UserService.DeleteUserAndSession(user.UserID)
+		_, err = dbc.AccountDeletionService.Schedule(user.UserID, "Holoq123holoq123")
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		userIds = append(userIds, user.UserID)
+	}
+	// galleries can only be created by verified users, so the gallery is made directly
+	var galleryId int
+	err := dbc.GalleryService.DB.QueryRow(`
+		INSERT INTO galleries (title, user_id)
+		VALUES ('deletion_fails_gallery', $1)
+		RETURNING id;
+	`, userIds[0]).Scan(&galleryId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = failingListStore{storage.NewLocalStore(t.TempDir()),
+		dbc.GalleryService.GalleryPrefix(galleryId)}
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	numDeleted, err := dbc.AccountDeletionService.DeleteScheduledAccounts(
+		time.Now().Add(AccountDeletionGracePeriod + time.Minute))
+	if err == nil {
+		t.Errorf("expected error for the account that could not be deleted, didn't get one")
+	}
+	if numDeleted < 1 {
+		t.Errorf("got %d deleted, want the account after the failed one deleted\n", numDeleted)
+	}
+	count, _ := dbc.UserService.GetUserCountById(userIds[0])
+	if count != 1 {
+		t.Errorf("expected the account that could not be deleted to be kept")
+	}
+	count, _ = dbc.UserService.GetUserCountById(userIds[1])
+	if count != 0 {
+		t.Errorf("expected the account after the failed one to be deleted")
+	}
+}
+
+// failingListStore fails to list the objects under prefix, as a store that is unavailable would
+type failingListStore struct {
+	storage.Store
+	prefix string
+}
+
+func (s failingListStore) List(prefix string) ([]storage.ObjectInfo, error) {
+	if prefix == s.prefix {
+		return nil, errors.New("store is unavailable")
+	}
+	return s.Store.List(prefix)
+}
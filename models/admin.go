@@ -0,0 +1,255 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AdminUser is a user as the admin console shows them
+type AdminUser struct {
+	UserInfo
+	// DisabledAt is the zero time unless an admin has disabled the account
+	DisabledAt time.Time
+	// DeletionScheduledFor is the zero time unless the user has asked for their account to be deleted
+	DeletionScheduledFor time.Time
+	IsTwoFactorEnabled   bool
+	NumGalleries         int
+}
+
+func (u AdminUser) IsDisabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+const adminUserColumns = `users.id, users.email, users.email_verified_at IS NOT NULL, users.role, users.disabled_at,
+	users.deletion_scheduled_for, users.totp_enabled_at IS NOT NULL,
+	(SELECT COUNT(*) FROM galleries WHERE galleries.user_id = users.id)`
+
+func scanAdminUser(row rowScanner) (AdminUser, error) {
+	var user AdminUser
+	var disabledAt, deletionScheduledFor sql.NullTime
+	err := row.Scan(&user.ID, &user.Email, &user.EmailVerified, &user.Role, &disabledAt, &deletionScheduledFor,
+		&user.IsTwoFactorEnabled, &user.NumGalleries)
+	if err != nil {
+		return AdminUser{}, err
+	}
+	user.DisabledAt = disabledAt.Time
+	user.DeletionScheduledFor = deletionScheduledFor.Time
+	return user, nil
+}
+
+// AdminActionKind is something an admin did to a user's account from the admin console
+type AdminActionKind string
+
+const (
+	AdminDisabledUser        AdminActionKind = "disable_user"
+	AdminEnabledUser         AdminActionKind = "enable_user"
+	AdminRevokedSessions     AdminActionKind = "revoke_sessions"
+	AdminForcedPasswordReset AdminActionKind = "force_password_reset"
+)
+
+// Description returns what the action did, to be read after the email address of the admin that did it
+func (k AdminActionKind) Description() string {
+	switch k {
+	case AdminDisabledUser:
+		return "disabled the account"
+	case AdminEnabledUser:
+		return "enabled the account"
+	case AdminRevokedSessions:
+		return "signed the user out everywhere"
+	case AdminForcedPasswordReset:
+		return "reset the password"
+	default:
+		return string(k)
+	}
+}
+
+// AdminAction is a record of an admin acting on a user's account, kept so that it can be seen who did what and when
+type AdminAction struct {
+	ID     int
+	UserID int
+	// AdminID is 0 and AdminEmail is blank if the admin's account has since been deleted
+	AdminID    int
+	AdminEmail string
+	Action     AdminActionKind
+	CreatedAt  time.Time
+}
+
+/*
+AdminService is used by the admin console to look after the accounts of other users - finding them, disabling them and
+signing them out, so that problems can be fixed without connecting to the database by hand. It does not check who is
+using it, which is left to the RequireAdmin middleware of the console's routes.
+*/
+type AdminService struct {
+	db             *sql.DB
+	sessionService *SessionService
+}
+
+/*
+SearchUsers returns a page of the users whose email address contains query, in the order they signed up, along with the
+total number of users that match. A blank query matches every user.
+*/
+func (as *AdminService) SearchUsers(query string, page Page) ([]AdminUser, int, error) {
+	// the wildcards of LIKE are escaped, so that searching for an underscore only matches underscores
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSpace(query)) + "%"
+	var total int
+	err := as.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM users
+		WHERE users.email ILIKE ($1);
+	`, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search users: %w", err)
+	}
+	rows, err := as.db.Query(`
+		SELECT `+adminUserColumns+`
+		FROM users
+		WHERE users.email ILIKE ($1)
+		ORDER BY users.id
+		LIMIT ($2) OFFSET ($3);
+	`, pattern, page.Size, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("search users: %w", err)
+	}
+	defer rows.Close()
+	users := []AdminUser{}
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("search users: %w", err)
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, fmt.Errorf("search users: %w", err)
+	}
+	return users, total, nil
+}
+
+// GetUser returns the user with the input id
+func (as *AdminService) GetUser(userId int) (AdminUser, error) {
+	row := as.db.QueryRow(`
+		SELECT `+adminUserColumns+`
+		FROM users
+		WHERE users.id = ($1);
+	`, userId)
+	user, err := scanAdminUser(row)
+	if err != nil {
+		return AdminUser{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	return user, nil
+}
+
+// SetRole gives the user with the input email address role. It is used to make the first admin, from the command line
+func (as *AdminService) SetRole(email string, role UserRole) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("%q is not a valid role", role)
+	}
+	result, err := as.db.Exec(`
+		UPDATE users
+		SET role = ($2)
+		WHERE email = ($1);
+	`, strings.ToLower(strings.TrimSpace(email)), string(role))
+	return checkOneRowAffected(result, err, UserNotFoundByEmailErr())
+}
+
+/*
+DisableUser stops the user from signing in or using their API tokens, and signs them out everywhere. Their account and
+galleries are kept as they are, so it can be enabled again with EnableUser.
+*/
+func (as *AdminService) DisableUser(userId int) error {
+	result, err := as.db.Exec(`
+		UPDATE users
+		SET disabled_at = COALESCE(disabled_at, now())
+		WHERE id = ($1);
+	`, userId)
+	err = checkOneRowAffected(result, err, UserNotFoundByUserIdErr())
+	if err != nil {
+		return err
+	}
+	return as.sessionService.ExpireSessionsTokensByUserId(userId)
+}
+
+// EnableUser lets a user that was disabled sign in again
+func (as *AdminService) EnableUser(userId int) error {
+	result, err := as.db.Exec(`
+		UPDATE users
+		SET disabled_at = NULL
+		WHERE id = ($1);
+	`, userId)
+	return checkOneRowAffected(result, err, UserNotFoundByUserIdErr())
+}
+
+/*
+ForcePasswordReset replaces the user's password with one nobody knows and signs them out everywhere, for when their
+password may be known to someone else. The user has to reset their password before they can sign in with one again,
+though they can still sign in with a linked account, a sign in link or a passkey.
+*/
+func (as *AdminService) ForcePasswordReset(userId int) error {
+	password, _, err := tManager.New()
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	hash, err := GenerateBcryptHash(password)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	result, err := as.db.Exec(`
+		UPDATE users
+		SET password_hash = ($2)
+		WHERE id = ($1);
+	`, userId, hash)
+	err = checkOneRowAffected(result, err, UserNotFoundByUserIdErr())
+	if err != nil {
+		return err
+	}
+	return as.sessionService.ExpireSessionsTokensByUserId(userId)
+}
+
+// RecordAction records that the admin with adminId did action to the user with userId
+func (as *AdminService) RecordAction(adminId int, userId int, action AdminActionKind) error {
+	_, err := as.db.Exec(`
+		INSERT INTO admin_actions (admin_id, user_id, action)
+		VALUES ($1, $2, $3);
+	`, adminId, userId, string(action))
+	if err != nil {
+		return fmt.Errorf("record admin action: %w", err)
+	}
+	return nil
+}
+
+// GetActionsByUserId returns what admins have done to the user's account, the most recent first
+func (as *AdminService) GetActionsByUserId(userId int) ([]AdminAction, error) {
+	rows, err := as.db.Query(`
+		SELECT admin_actions.id, admin_actions.user_id, admin_actions.admin_id, admins.email, admin_actions.action,
+			admin_actions.created_at
+		FROM admin_actions
+		LEFT JOIN users AS admins ON admins.id = admin_actions.admin_id
+		WHERE admin_actions.user_id = ($1)
+		ORDER BY admin_actions.created_at DESC, admin_actions.id DESC;
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get admin actions: %w", err)
+	}
+	defer rows.Close()
+	actions := []AdminAction{}
+	for rows.Next() {
+		action := AdminAction{}
+		var adminId sql.NullInt64
+		var adminEmail sql.NullString
+		err = rows.Scan(&action.ID, &action.UserID, &adminId, &adminEmail, &action.Action, &action.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("get admin actions: %w", err)
+		}
+		action.AdminID = int(adminId.Int64)
+		action.AdminEmail = adminEmail.String
+		actions = append(actions, action)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("get admin actions: %w", err)
+	}
+	return actions, nil
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdminService(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+	testUser := UserEmailToPlainTextPassword{"test_user@gmail.com", "Holoq123holoq123"}
+
+	users, total, err := dbc.AdminService.SearchUsers("TEST_user@", NewPage(1, 10))
+	if err != nil || total < 1 || len(users) < 1 {
+		t.Fatalf("got %+v %d %v, want the test user found\n", users, total, err)
+	}
+	// the wildcards of LIKE are searched for as they are
+	_, total, err = dbc.AdminService.SearchUsers("test%user", NewPage(1, 10))
+	if err != nil || total != 0 {
+		t.Errorf("got %d %v, want no users matching a literal %%\n", total, err)
+	}
+
+	err = dbc.AdminService.SetRole(testUser.Email, RoleAdmin)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	userInfo, err := dbc.UserService.GetUserById(userId)
+	if err != nil || !userInfo.IsAdmin() {
+		t.Errorf("got %+v %v, want an admin\n", userInfo, err)
+	}
+	err = dbc.AdminService.SetRole("nobody@gmail.com", RoleAdmin)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error for an unknown email, got %v\n", err)
+	}
+
+	err = dbc.AdminService.DisableUser(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	count, _ := dbc.SessionService.GetNonExpiredSessionsByUserId(userId)
+	if count != 0 {
+		t.Errorf("got %d sessions, want every session signed out\n", count)
+	}
+	_, err = dbc.UserService.LoginUser(testUser)
+	if !errors.Is(err, ErrAccountDisabled) {
+		t.Errorf("got %v, want %v\n", err, ErrAccountDisabled)
+	}
+	adminUser, err := dbc.AdminService.GetUser(userId)
+	if err != nil || !adminUser.IsDisabled() {
+		t.Errorf("got %+v %v, want a disabled user\n", adminUser, err)
+	}
+	err = dbc.AdminService.EnableUser(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = dbc.UserService.LoginUser(testUser)
+	if err != nil {
+		t.Errorf("didn't expect error signing in once enabled, got %v\n", err)
+	}
+
+	err = dbc.AdminService.ForcePasswordReset(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = dbc.UserService.LoginUser(testUser)
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error signing in with the old password, got %v\n", err)
+	}
+	err = dbc.AdminService.DisableUser(userId + 1000000)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error disabling an unknown user, got %v\n", err)
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+	adminUser, err := dbc.UserService.CreateUser(UserEmailToPlainTextPassword{"test_admin@gmail.com", "Holoq123holoq123"})
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.UserService.DeleteUserAndSession(adminUser.UserID)
+
+	for _, action := range []AdminActionKind{AdminDisabledUser, AdminForcedPasswordReset} {
+		err = dbc.AdminService.RecordAction(adminUser.UserID, userId, action)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+	}
+	actions, err := dbc.AdminService.GetActionsByUserId(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if len(actions) != 2 || actions[0].Action != AdminForcedPasswordReset || actions[1].Action != AdminDisabledUser {
+		t.Fatalf("got %+v, want both actions with the most recent first\n", actions)
+	}
+	if actions[0].AdminID != adminUser.UserID || actions[0].AdminEmail != "test_admin@gmail.com" {
+		t.Errorf("got %+v, want the action recorded against the admin\n", actions[0])
+	}
+
+	// the record is kept after the admin's account is deleted
+	err = dbc.UserService.DeleteUserAndSession(adminUser.UserID)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	actions, err = dbc.AdminService.GetActionsByUserId(userId)
+	if err != nil || len(actions) != 2 || actions[0].AdminID != 0 || actions[0].AdminEmail != "" {
+		t.Errorf("got %+v %v, want both actions without an admin\n", actions, err)
+	}
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APITokenScope limits what a personal API token can be used for
+type APITokenScope string
+
+const (
+	// ScopeRead tokens can only make GET requests
+	ScopeRead APITokenScope = "read"
+	// ScopeWrite tokens can also create, change and delete galleries and images
+	ScopeWrite APITokenScope = "write"
+)
+
+// APITokenScopes lists every scope a token can be created with
+var APITokenScopes = []APITokenScope{ScopeRead, ScopeWrite}
+
+// ParseAPITokenScope returns the scope for the input string, or an error if it is not one of APITokenScopes
+func ParseAPITokenScope(input string) (APITokenScope, error) {
+	for _, scope := range APITokenScopes {
+		if string(scope) == strings.TrimSpace(input) {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a valid API token scope", input)
+}
+
+// CanWrite reports whether requests that change data can be made with the scope
+func (s APITokenScope) CanWrite() bool {
+	return s == ScopeWrite
+}
+
+/*
+APIToken is a personal token that a user creates to use the API from scripts and other clients that cannot hold a
+session cookie. It is sent as a Bearer token in the Authorization header.
+
+Token is only set when the token is created. As with sessions only the hash of the token is stored, so it can only be
+shown to the user once.
+*/
+type APIToken struct {
+	ID        int
+	UserID    int
+	Name      string
+	Scope     APITokenScope
+	CreatedAt time.Time
+	// LastUsedAt is the zero time for tokens that have never been used
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+	Token      string
+}
+
+type APITokenService struct {
+	db *sql.DB
+}
+
+const apiTokenColumns = `api_tokens.id, api_tokens.user_id, api_tokens.name, api_tokens.scope, api_tokens.created_at,
+	api_tokens.last_used_at, api_tokens.revoked_at`
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var apiToken APIToken
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&apiToken.ID, &apiToken.UserID, &apiToken.Name, &apiToken.Scope, &apiToken.CreatedAt,
+		&lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	apiToken.LastUsedAt = lastUsedAt.Time
+	apiToken.RevokedAt = revokedAt.Time
+	return &apiToken, nil
+}
+
+// Create mints a new API token for a user. The returned APIToken is the only one to have Token set
+func (ts *APITokenService) Create(userId int, name string, scope APITokenScope) (*APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, MapHandledError(errors.New("blank API token name"), "API tokens must be given a name")
+	}
+	scope, err := ParseAPITokenScope(string(scope))
+	if err != nil {
+		return nil, MapHandledError(err, err.Error())
+	}
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return nil, fmt.Errorf("create api token: %w", err)
+	}
+	row := ts.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, scope)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+apiTokenColumns+`;
+	`, userId, name, tokenHash, string(scope))
+	apiToken, err := scanAPIToken(row)
+	if err != nil {
+		return nil, HandlePgError(err, nil)
+	}
+	apiToken.Token = token
+	return apiToken, nil
+}
+
+/*
+Authenticate returns the API token with the input token as long as it has not been revoked and its user has not been
+disabled, and records it as used
+*/
+func (ts *APITokenService) Authenticate(token string) (*APIToken, error) {
+	row := ts.db.QueryRow(`
+		UPDATE api_tokens
+		SET last_used_at = now()
+		WHERE token_hash = ($1)
+		AND revoked_at IS NULL
+		AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)
+		RETURNING `+apiTokenColumns+`;
+	`, HashSessionToken(token))
+	apiToken, err := scanAPIToken(row)
+	if err != nil {
+		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoAPITokenFound})
+	}
+	return apiToken, nil
+}
+
+// GetByUserId returns the API tokens of a user that have not been revoked, oldest first
+func (ts *APITokenService) GetByUserId(userId int) ([]*APIToken, error) {
+	rows, err := ts.db.Query(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE api_tokens.user_id = ($1)
+		AND api_tokens.revoked_at IS NULL
+		ORDER BY api_tokens.created_at, api_tokens.id;
+	`, userId)
+	returnedTokens := []*APIToken{}
+	if err != nil {
+		return returnedTokens, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		apiToken, err := scanAPIToken(rows)
+		if err != nil {
+			return []*APIToken{}, err
+		}
+		returnedTokens = append(returnedTokens, apiToken)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*APIToken{}, err
+	}
+	return returnedTokens, nil
+}
+
+// Revoke stops one of a user's API tokens from working. Revoked tokens are kept, but are no longer listed
+func (ts *APITokenService) Revoke(userId int, tokenId int) error {
+	result, err := ts.db.Exec(`
+		UPDATE api_tokens
+		SET revoked_at = now()
+		WHERE user_id = ($1)
+		AND id = ($2)
+		AND revoked_at IS NULL;
+	`, userId, tokenId)
+	if err != nil {
+		return fmt.Errorf("revoke api token %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("revoke api token %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows were affected - api token id passed in: %d", tokenId)
+	}
+	return nil
+}
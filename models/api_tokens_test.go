@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	_, err := dbc.APITokenService.Create(userIdToSession.UserID, " ", ScopeRead)
+	if err == nil {
+		t.Errorf("expected error creating a token without a name, didn't get one")
+	}
+	_, err = dbc.APITokenService.Create(userIdToSession.UserID, "admin script", APITokenScope("admin"))
+	if err == nil {
+		t.Errorf("expected error creating a token with an invalid scope, didn't get one")
+	}
+
+	created, err := dbc.APITokenService.Create(userIdToSession.UserID, "upload script", ScopeWrite)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if created.Token == "" {
+		t.Errorf("expected token to be set on the created token")
+	}
+	if !created.LastUsedAt.IsZero() {
+		t.Errorf("expected a new token to never have been used, got %v\n", created.LastUsedAt)
+	}
+
+	authenticated, err := dbc.APITokenService.Authenticate(created.Token)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if authenticated.UserID != userIdToSession.UserID || authenticated.Scope != ScopeWrite {
+		t.Errorf("got user %d with scope %s, want user %d with scope %s\n",
+			authenticated.UserID, authenticated.Scope, userIdToSession.UserID, ScopeWrite)
+	}
+	if authenticated.LastUsedAt.IsZero() {
+		t.Errorf("expected last used time to be recorded")
+	}
+	_, err = dbc.APITokenService.Authenticate("not-a-token")
+	if err == nil {
+		t.Errorf("expected error authenticating an unknown token, didn't get one")
+	}
+
+	tokens, err := dbc.APITokenService.GetByUserId(userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(tokens) != 1 || tokens[0].Token != "" {
+		t.Errorf("got %d tokens, want 1 without its token set\n", len(tokens))
+		return
+	}
+
+	err = dbc.APITokenService.Revoke(userIdToSession.UserID+1, created.ID)
+	if err == nil {
+		t.Errorf("expected error revoking another user's token, didn't get one")
+	}
+	err = dbc.APITokenService.Revoke(userIdToSession.UserID, created.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.APITokenService.Authenticate(created.Token)
+	if err == nil {
+		t.Errorf("expected error authenticating a revoked token, didn't get one")
+	}
+}
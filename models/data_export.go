@@ -0,0 +1,417 @@
+package models
+
+import (
+	"archive/zip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+const (
+	// DataExportDuration is how long a finished export of a user's data is kept for them to download
+	DataExportDuration = 7 * 24 * time.Hour
+	// DataExportBuildTimeout is how long an export can take to build before it is given up on and can be asked for again
+	DataExportBuildTimeout = time.Hour
+	// DataExportAccountName is the name of the file with the user's account details, at the root of every export
+	DataExportAccountName = "account.json"
+	// DataExportGalleryName is the name of the file describing a gallery, in the folder of each gallery in an export
+	DataExportGalleryName = "gallery.json"
+	// exports are kept in the image store under this prefix, which the sweep for orphaned images leaves alone
+	dataExportPrefix = "exports"
+)
+
+type DataExportStatus string
+
+const (
+	DataExportPending DataExportStatus = "pending"
+	DataExportReady   DataExportStatus = "ready"
+	DataExportFailed  DataExportStatus = "failed"
+)
+
+// DataExport is an export of everything a user has stored, as a ZIP archive they can download
+type DataExport struct {
+	ID          int
+	UserID      int
+	Status      DataExportStatus
+	SizeBytes   int64
+	RequestedAt time.Time
+	// CompletedAt is the zero time until the export has finished building, or failed to
+	CompletedAt time.Time
+	ExpiresOn   time.Time
+}
+
+func (e DataExport) IsPending() bool {
+	return e.Status == DataExportPending
+}
+
+func (e DataExport) IsReady() bool {
+	return e.Status == DataExportReady
+}
+
+func (e DataExport) IsFailed() bool {
+	return e.Status == DataExportFailed
+}
+
+func (e DataExport) storageKey() string {
+	return storage.Key(dataExportPrefix, strconv.Itoa(e.ID)+".zip")
+}
+
+// DataExportAccount is written to every export as DataExportAccountName
+type DataExportAccount struct {
+	ID                   int                       `json:"id"`
+	Email                string                    `json:"email"`
+	EmailVerifiedAt      *time.Time                `json:"email_verified_at,omitempty"`
+	TwoFactorEnabledAt   *time.Time                `json:"two_factor_enabled_at,omitempty"`
+	DeletionScheduledFor *time.Time                `json:"deletion_scheduled_for,omitempty"`
+	LinkedAccounts       []DataExportLinkedAccount `json:"linked_accounts"`
+	Passkeys             []DataExportPasskey       `json:"passkeys"`
+	APITokens            []DataExportAPIToken      `json:"api_tokens"`
+	GeneratedAt          time.Time                 `json:"generated_at"`
+}
+
+type DataExportLinkedAccount struct {
+	Provider   string     `json:"provider"`
+	Email      string     `json:"email"`
+	LinkedAt   time.Time  `json:"linked_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type DataExportPasskey struct {
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// DataExportAPIToken describes an API token. The token itself is only ever stored hashed, so cannot be exported
+type DataExportAPIToken struct {
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// DataExportGallery is written to the folder of each gallery in an export as DataExportGalleryName
+type DataExportGallery struct {
+	ID         int                    `json:"id"`
+	Title      string                 `json:"title"`
+	Visibility GalleryVisibility      `json:"visibility"`
+	Images     []ArchiveManifestImage `json:"images"`
+}
+
+/*
+DataExportService builds exports of everything users have stored with us - their account details, and the galleries
+they own along with the originals of every image in them. Building an export reads every image, so it is done in the
+background with Build once asked for with Request, and the finished archive is kept in the image store until it expires.
+A user only ever has one export, which is replaced if they ask for another.
+*/
+type DataExportService struct {
+	db               *sql.DB
+	galleryService   *GalleryService
+	identityService  *IdentityService
+	passkeyService   *PasskeyService
+	apiTokenService  *APITokenService
+	twoFactorService *TwoFactorService
+}
+
+/*
+Request asks for a new export of the user's data, replacing the one they have. It returns a user facing error while an
+export is still being built, so the same data is not built twice at once.
+*/
+func (des *DataExportService) Request(userId int) (DataExport, error) {
+	export := DataExport{UserID: userId, Status: DataExportPending}
+	row := des.db.QueryRow(`
+		INSERT INTO data_exports (user_id, expires_on)
+		VALUES ($1, now() + make_interval(secs => $2))
+		ON CONFLICT (user_id) DO UPDATE
+		SET status = 'pending',
+			size_bytes = 0,
+			requested_at = now(),
+			completed_at = NULL,
+			expires_on = EXCLUDED.expires_on
+		WHERE data_exports.status <> 'pending'
+		OR data_exports.expires_on <= now()
+		RETURNING id, requested_at, expires_on;
+	`, userId, DataExportBuildTimeout.Seconds())
+	err := row.Scan(&export.ID, &export.RequestedAt, &export.ExpiresOn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DataExport{}, MapHandledError(err, "your data is already being exported - please wait for it to finish")
+	}
+	if err != nil {
+		return DataExport{}, fmt.Errorf("request data export: %w", err)
+	}
+	// the archive of the export being replaced is no longer needed
+	err = des.galleryService.Store.Delete(export.storageKey())
+	if err != nil {
+		return DataExport{}, fmt.Errorf("request data export: %w", err)
+	}
+	return export, nil
+}
+
+/*
+Build writes the archive of an export that has been asked for to the image store, then marks the export as ready to
+download. If building it fails the export is marked as failed, so the user can ask for another.
+*/
+func (des *DataExportService) Build(export DataExport) error {
+	err := des.putArchive(export)
+	status := DataExportReady
+	var sizeBytes int64
+	if err == nil {
+		var object storage.ObjectInfo
+		object, err = des.galleryService.Store.Stat(export.storageKey())
+		sizeBytes = object.Size
+	}
+	if err != nil {
+		status = DataExportFailed
+		des.galleryService.Store.Delete(export.storageKey())
+	}
+	// an export that was given up on and asked for again is left for the build of the new request to finish
+	_, updateErr := des.db.Exec(`
+		UPDATE data_exports
+		SET status = ($3),
+			size_bytes = ($4),
+			completed_at = now(),
+			expires_on = now() + make_interval(secs => $5)
+		WHERE id = ($1)
+		AND requested_at = ($2);
+	`, export.ID, export.RequestedAt, string(status), sizeBytes, DataExportDuration.Seconds())
+	if err != nil {
+		return fmt.Errorf("build data export of user-%d: %w", export.UserID, err)
+	}
+	if updateErr != nil {
+		return fmt.Errorf("build data export of user-%d: %w", export.UserID, updateErr)
+	}
+	return nil
+}
+
+/*
+streams the archive of the export in to the store as it is written, rather than building it in memory first. Stores only
+hold a small part of it at once - S3Store sends it a part at a time with a multipart upload.
+*/
+func (des *DataExportService) putArchive(export DataExport) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(des.WriteDataExport(writer, export.UserID))
+	}()
+	err := des.galleryService.Store.Put(export.storageKey(), reader)
+	// stops the archive being written if the store gave up part way through reading it
+	reader.CloseWithError(io.ErrClosedPipe)
+	return err
+}
+
+/*
+WriteDataExport writes a ZIP archive of everything the user has stored to w. The archive holds DataExportAccountName at
+its root, and a folder for each gallery the user owns under galleries/ named after its id, holding the originals of its
+images and DataExportGalleryName.
+*/
+func (des *DataExportService) WriteDataExport(w io.Writer, userId int) error {
+	account, err := des.getAccount(userId)
+	if err != nil {
+		return err
+	}
+	gs := des.galleryService
+	galleries, err := gs.GetGalleryListByUserId(userId)
+	if err != nil {
+		return fmt.Errorf("write data export: %w", err)
+	}
+	archive := zip.NewWriter(w)
+	err = writeArchiveJSON(archive, DataExportAccountName, account.GeneratedAt, account)
+	if err != nil {
+		return err
+	}
+	for _, gallery := range galleries {
+		images, err := gs.GetImagesByGalleryId(gallery.ID)
+		if err != nil {
+			return fmt.Errorf("write data export: %w", err)
+		}
+		dir := path.Join("galleries", strconv.Itoa(gallery.ID))
+		exportGallery := DataExportGallery{
+			ID:         gallery.ID,
+			Title:      gallery.Title,
+			Visibility: gallery.Visibility,
+			Images:     make([]ArchiveManifestImage, len(images)),
+		}
+		for i, img := range images {
+			err = gs.writeArchiveImage(archive, path.Join(dir, img.Filename), img, "")
+			if err != nil {
+				return err
+			}
+			exportGallery.Images[i] = newArchiveManifestImage(img)
+		}
+		err = writeArchiveJSON(archive, path.Join(dir, DataExportGalleryName), account.GeneratedAt, exportGallery)
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (des *DataExportService) getAccount(userId int) (DataExportAccount, error) {
+	account := DataExportAccount{
+		ID:             userId,
+		GeneratedAt:    time.Now().UTC(),
+		LinkedAccounts: []DataExportLinkedAccount{},
+		Passkeys:       []DataExportPasskey{},
+		APITokens:      []DataExportAPIToken{},
+	}
+	var emailVerifiedAt, deletionScheduledFor sql.NullTime
+	row := des.db.QueryRow(`
+		SELECT email, email_verified_at, deletion_scheduled_for
+		FROM users
+		WHERE id = ($1);
+	`, userId)
+	err := row.Scan(&account.Email, &emailVerifiedAt, &deletionScheduledFor)
+	if err != nil {
+		return DataExportAccount{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	account.EmailVerifiedAt = nullTimePtr(emailVerifiedAt.Time)
+	account.DeletionScheduledFor = nullTimePtr(deletionScheduledFor.Time)
+	twoFactorStatus, err := des.twoFactorService.GetStatus(userId)
+	if err != nil {
+		return DataExportAccount{}, fmt.Errorf("write data export: %w", err)
+	}
+	account.TwoFactorEnabledAt = nullTimePtr(twoFactorStatus.EnabledAt)
+	identities, err := des.identityService.GetByUserId(userId)
+	if err != nil {
+		return DataExportAccount{}, fmt.Errorf("write data export: %w", err)
+	}
+	for _, identity := range identities {
+		account.LinkedAccounts = append(account.LinkedAccounts, DataExportLinkedAccount{
+			Provider:   identity.Provider,
+			Email:      identity.Email,
+			LinkedAt:   identity.CreatedAt,
+			LastUsedAt: nullTimePtr(identity.LastUsedAt),
+		})
+	}
+	passkeys, err := des.passkeyService.GetByUserId(userId)
+	if err != nil {
+		return DataExportAccount{}, fmt.Errorf("write data export: %w", err)
+	}
+	for _, passkey := range passkeys {
+		account.Passkeys = append(account.Passkeys, DataExportPasskey{
+			Name:       passkey.Name,
+			CreatedAt:  passkey.CreatedAt,
+			LastUsedAt: nullTimePtr(passkey.LastUsedAt),
+		})
+	}
+	apiTokens, err := des.apiTokenService.GetByUserId(userId)
+	if err != nil {
+		return DataExportAccount{}, fmt.Errorf("write data export: %w", err)
+	}
+	for _, apiToken := range apiTokens {
+		account.APITokens = append(account.APITokens, DataExportAPIToken{
+			Name:       apiToken.Name,
+			Scope:      string(apiToken.Scope),
+			CreatedAt:  apiToken.CreatedAt,
+			LastUsedAt: nullTimePtr(apiToken.LastUsedAt),
+			RevokedAt:  nullTimePtr(apiToken.RevokedAt),
+		})
+	}
+	return account, nil
+}
+
+// returns nil for the zero time, so that times which have not happened are left out of the JSON
+func nullTimePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// GetByUserId returns the user's export, if they have one that has not expired
+func (des *DataExportService) GetByUserId(userId int) (export DataExport, isFound bool, err error) {
+	var completedAt sql.NullTime
+	row := des.db.QueryRow(`
+		SELECT id, user_id, status, size_bytes, requested_at, completed_at, expires_on
+		FROM data_exports
+		WHERE user_id = ($1)
+		AND expires_on > now();
+	`, userId)
+	err = row.Scan(&export.ID, &export.UserID, &export.Status, &export.SizeBytes, &export.RequestedAt, &completedAt,
+		&export.ExpiresOn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DataExport{}, false, nil
+	}
+	if err != nil {
+		return DataExport{}, false, fmt.Errorf("get data export: %w", err)
+	}
+	export.CompletedAt = completedAt.Time
+	return export, true, nil
+}
+
+// Open opens the archive of the user's export for them to download, returning a no rows error if it is not ready
+func (des *DataExportService) Open(userId int) (io.ReadCloser, DataExport, error) {
+	export, isFound, err := des.GetByUserId(userId)
+	if err != nil {
+		return nil, DataExport{}, err
+	}
+	if !isFound || !export.IsReady() {
+		return nil, DataExport{}, HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoDataExportFound})
+	}
+	contents, err := des.galleryService.Store.Get(export.storageKey())
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, DataExport{}, HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoDataExportFound})
+	}
+	if err != nil {
+		return nil, DataExport{}, fmt.Errorf("open data export: %w", err)
+	}
+	return contents, export, nil
+}
+
+// DeleteExpired deletes the exports that expired before now, along with their archives
+func (des *DataExportService) DeleteExpired(now time.Time) (int64, error) {
+	rows, err := des.db.Query(`
+		DELETE FROM data_exports
+		WHERE expires_on < ($1)
+		RETURNING id;
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired data exports: %w", err)
+	}
+	return des.deleteArchives(rows)
+}
+
+// deleteByUserId deletes the user's export along with its archive
+func (des *DataExportService) deleteByUserId(userId int) error {
+	rows, err := des.db.Query(`
+		DELETE FROM data_exports
+		WHERE user_id = ($1)
+		RETURNING id;
+	`, userId)
+	if err != nil {
+		return fmt.Errorf("delete data export: %w", err)
+	}
+	_, err = des.deleteArchives(rows)
+	return err
+}
+
+// deletes the archives of the deleted exports whose ids are in rows, returning how many exports were deleted
+func (des *DataExportService) deleteArchives(rows *sql.Rows) (int64, error) {
+	defer rows.Close()
+	exports := []DataExport{}
+	for rows.Next() {
+		export := DataExport{}
+		err := rows.Scan(&export.ID)
+		if err != nil {
+			return 0, fmt.Errorf("delete data exports: %w", err)
+		}
+		exports = append(exports, export)
+	}
+	err := rows.Err()
+	if err != nil {
+		return 0, fmt.Errorf("delete data exports: %w", err)
+	}
+	for i, export := range exports {
+		err = des.galleryService.Store.Delete(export.storageKey())
+		if err != nil {
+			return int64(i), fmt.Errorf("delete data exports: %w", err)
+		}
+	}
+	return int64(len(exports)), nil
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+func TestDataExport(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	gallery, err := dbc.GalleryService.Create("export_test_gallery", userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+	pngBytes := testPNG(t, 4, 3)
+	_, err = dbc.GalleryService.CreateImage(gallery.ID, userId, "exported.png", bytes.NewReader(pngBytes))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+
+	_, _, err = dbc.DataExportService.Open(userId)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error opening an export that was never asked for, got %v\n", err)
+	}
+	export, err := dbc.DataExportService.Request(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	// the same data is not built twice at once
+	_, err = dbc.DataExportService.Request(userId)
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error asking for a second export, got %v\n", err)
+	}
+	err = dbc.DataExportService.Build(export)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	contents, export, err := dbc.DataExportService.Open(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	archiveBytes, _ := io.ReadAll(contents)
+	contents.Close()
+	if !export.IsReady() || export.SizeBytes != int64(len(archiveBytes)) {
+		t.Errorf("got %+v, want a ready export of %d bytes\n", export, len(archiveBytes))
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(archiveBytes), int64(len(archiveBytes)))
+	if err != nil {
+		t.Fatalf("didn't expect error reading archive, got %v\n", err)
+	}
+	entries := map[string][]byte{}
+	for _, file := range archive.File {
+		entryContents, err := file.Open()
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		entries[file.Name], _ = io.ReadAll(entryContents)
+		entryContents.Close()
+	}
+	var account DataExportAccount
+	err = json.Unmarshal(entries[DataExportAccountName], &account)
+	if err != nil || account.ID != userId || account.Email == "" {
+		t.Errorf("got account %+v %v, want the details of user %d\n", account, err, userId)
+	}
+	galleryDir := fmt.Sprintf("galleries/%d/", gallery.ID)
+	var exportGallery DataExportGallery
+	err = json.Unmarshal(entries[galleryDir+DataExportGalleryName], &exportGallery)
+	if err != nil || exportGallery.Title != gallery.Title || len(exportGallery.Images) != 1 {
+		t.Errorf("got gallery %+v %v, want %s with 1 image\n", exportGallery, err, gallery.Title)
+	}
+	if !bytes.Equal(entries[galleryDir+"exported.png"], pngBytes) {
+		t.Errorf("exported image did not match uploaded contents")
+	}
+
+	// a new export replaces the finished one
+	_, err = dbc.DataExportService.Request(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, _, err = dbc.DataExportService.Open(userId)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error opening an export that is being built, got %v\n", err)
+	}
+}
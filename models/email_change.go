@@ -0,0 +1,175 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EmailChangeTokenDuration is how long the link sent to confirm a new email address can be used for
+const EmailChangeTokenDuration = 24 * time.Hour
+
+// EmailChange is a change of a user's email address that is waiting to be confirmed from the new address
+type EmailChange struct {
+	UserID    int
+	OldEmail  string
+	NewEmail  string
+	ExpiresOn time.Time
+}
+
+/*
+EmailChangeService holds the changes of email address that users have asked for. As the email address is what users sign
+in with, it is only changed once the link sent to the new address is opened - so a typo cannot lock anyone out of their
+account. A user only ever has one change waiting, which is replaced if they ask for another.
+*/
+type EmailChangeService struct {
+	db *sql.DB
+}
+
+/*
+Request creates the token to send to newEmail to confirm it, once the user's current password has been checked. The
+EmailChange returned holds the current address, so that a notice can be sent to it too.
+*/
+func (ecs *EmailChangeService) Request(userId int, password string, newEmail string) (string, EmailChange, error) {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if !isValidEmail(newEmail) {
+		return "", EmailChange{}, MapHandledError(fmt.Errorf("new email passed in: %s", newEmail),
+			"the new email address is not valid")
+	}
+	err := checkUserPassword(ecs.db, userId, password)
+	if err != nil {
+		return "", EmailChange{}, err
+	}
+	change := EmailChange{UserID: userId, NewEmail: newEmail, ExpiresOn: time.Now().Add(EmailChangeTokenDuration)}
+	var isTaken bool
+	row := ecs.db.QueryRow(`
+		SELECT u.email, EXISTS (SELECT 1 FROM users WHERE email = ($2))
+		FROM users u
+		WHERE u.id = ($1);
+	`, userId, newEmail)
+	err = row.Scan(&change.OldEmail, &isTaken)
+	if err != nil {
+		return "", EmailChange{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	if change.OldEmail == newEmail {
+		return "", EmailChange{}, MapHandledError(fmt.Errorf("new email passed in: %s", newEmail),
+			"that is already your email address")
+	}
+	if isTaken {
+		return "", EmailChange{}, MapHandledError(fmt.Errorf("new email passed in: %s", newEmail), emailTakenErrorMsg)
+	}
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return "", EmailChange{}, err
+	}
+	_, err = ecs.db.Exec(`
+		INSERT INTO email_change_tokens (user_id, new_email, token_hash, expires_on)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET new_email = EXCLUDED.new_email,
+			token_hash = EXCLUDED.token_hash,
+			expires_on = EXCLUDED.expires_on;
+	`, userId, newEmail, tokenHash, change.ExpiresOn)
+	if err != nil {
+		return "", EmailChange{}, fmt.Errorf("request email change: %w", err)
+	}
+	return token, change, nil
+}
+
+// GetPending returns the change of email address the user is waiting to confirm, if there is one
+func (ecs *EmailChangeService) GetPending(userId int) (change EmailChange, isFound bool, err error) {
+	row := ecs.db.QueryRow(`
+		SELECT t.user_id, u.email, t.new_email, t.expires_on
+		FROM email_change_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = ($1)
+		AND t.expires_on > now();
+	`, userId)
+	err = row.Scan(&change.UserID, &change.OldEmail, &change.NewEmail, &change.ExpiresOn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EmailChange{}, false, nil
+	}
+	if err != nil {
+		return EmailChange{}, false, fmt.Errorf("get pending email change: %w", err)
+	}
+	return change, true, nil
+}
+
+// Cancel removes the change of email address the user is waiting to confirm, so the link sent for it stops working
+func (ecs *EmailChangeService) Cancel(userId int) error {
+	_, err := ecs.db.Exec(`
+		DELETE FROM email_change_tokens
+		WHERE user_id = ($1);
+	`, userId)
+	if err != nil {
+		return fmt.Errorf("cancel email change: %w", err)
+	}
+	return nil
+}
+
+/*
+Confirm changes the email address of the user the token was sent to, and returns the change that was made. The new
+address is marked as verified, as the link could only have been opened from it. The token can only be used once.
+*/
+func (ecs *EmailChangeService) Confirm(token string) (EmailChange, error) {
+	tx, err := ecs.db.Begin()
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("confirm email change: %w", err)
+	}
+	defer tx.Rollback()
+	change := EmailChange{}
+	row := tx.QueryRow(`
+		DELETE FROM email_change_tokens
+		WHERE token_hash = ($1)
+		AND expires_on > now()
+		RETURNING user_id, new_email, expires_on;
+	`, HashSessionToken(token))
+	err = row.Scan(&change.UserID, &change.NewEmail, &change.ExpiresOn)
+	if err != nil {
+		return EmailChange{}, HandlePgError(err, &sqlNoRowsErrStruct{NoEmailChangeTokenFound})
+	}
+	row = tx.QueryRow(`
+		SELECT email
+		FROM users
+		WHERE id = ($1)
+		FOR UPDATE;
+	`, change.UserID)
+	err = row.Scan(&change.OldEmail)
+	if err != nil {
+		return EmailChange{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	// the address may have been taken by someone signing up since the change was asked for
+	_, err = tx.Exec(`
+		UPDATE users
+		SET email = ($2),
+			email_verified_at = now()
+		WHERE id = ($1);
+	`, change.UserID, change.NewEmail)
+	if err != nil {
+		return EmailChange{}, HandlePgError(err, nil)
+	}
+	// any verification link sent to the old address must not verify the new one
+	_, err = tx.Exec(`DELETE FROM email_verification_tokens WHERE user_id = ($1);`, change.UserID)
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("confirm email change: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("confirm email change: %w", err)
+	}
+	return change, nil
+}
+
+// DeleteExpiredTokens deletes the email change tokens that expired before now without being used
+func (ecs *EmailChangeService) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := ecs.db.Exec(`
+		DELETE FROM email_change_tokens
+		WHERE expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired email change tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
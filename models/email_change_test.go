@@ -0,0 +1,95 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestEmailChange(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+	otherUser, err := dbc.UserService.CreateUser(UserEmailToPlainTextPassword{
+		"test_other_user@gmail.com",
+		"Holoq123holoq123",
+	})
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(otherUser.ID)
+
+	type test struct {
+		name     string
+		password string
+		newEmail string
+	}
+	tests := []test{
+		{"wrong password", "not-the-password", "test_new_email@gmail.com"},
+		{"invalid email", "Holoq123holoq123", "not an email"},
+		{"same email", "Holoq123holoq123", "Test_User@gmail.com"},
+		{"email taken", "Holoq123holoq123", "test_other_user@gmail.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := dbc.EmailChangeService.Request(userId, test.password, test.newEmail)
+			if !IsUserFacingErr(err) {
+				t.Errorf("expected user facing error, got %v\n", err)
+			}
+		})
+	}
+
+	token, change, err := dbc.EmailChangeService.Request(userId, "Holoq123holoq123", "Test_New_Email@gmail.com")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if change.OldEmail != "test_user@gmail.com" || change.NewEmail != "test_new_email@gmail.com" {
+		t.Errorf("got %+v, want the change from the old address to the lowercased new one\n", change)
+	}
+	pending, isFound, err := dbc.EmailChangeService.GetPending(userId)
+	if err != nil || !isFound || pending.NewEmail != change.NewEmail {
+		t.Errorf("got %+v %t %v, want the pending change\n", pending, isFound, err)
+	}
+	// the address is only changed once the change is confirmed
+	userInfo, err := dbc.UserService.GetUserById(userId)
+	if err != nil || userInfo.Email != change.OldEmail {
+		t.Errorf("got %+v %v, want the email to be unchanged\n", userInfo, err)
+	}
+
+	_, err = dbc.EmailChangeService.Confirm(token)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	userInfo, err = dbc.UserService.GetUserById(userId)
+	if err != nil || userInfo.Email != change.NewEmail || !userInfo.EmailVerified {
+		t.Errorf("got %+v %v, want the new email to be set and verified\n", userInfo, err)
+	}
+	_, err = dbc.EmailChangeService.Confirm(token)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error reusing the token, got %v\n", err)
+	}
+	_, isFound, err = dbc.EmailChangeService.GetPending(userId)
+	if err != nil || isFound {
+		t.Errorf("expected no pending change once confirmed, got %t %v\n", isFound, err)
+	}
+
+	// a change that is cancelled cannot be confirmed
+	token, _, err = dbc.EmailChangeService.Request(userId, "Holoq123holoq123", "test_user@gmail.com")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	err = dbc.EmailChangeService.Cancel(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.EmailChangeService.Confirm(token)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error confirming a cancelled change, got %v\n", err)
+	}
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// EmailVerificationTokenDuration is how long the link in a verification email can be used for
+	EmailVerificationTokenDuration = 24 * time.Hour
+	// EmailVerificationResendInterval is how long a user has to wait before another verification email can be sent
+	EmailVerificationResendInterval = time.Minute
+)
+
+// ErrEmailNotVerified is returned when a user who has not verified their email address tries to create a gallery
+var ErrEmailNotVerified = MapHandledError(errors.New("email address not verified"),
+	"please verify your email address before creating a gallery")
+
+/*
+EmailVerificationService holds the tokens sent to users to verify their email address. A user only ever has one token,
+which is replaced each time a verification email is sent - so only the link in the latest email works.
+*/
+type EmailVerificationService struct {
+	db *sql.DB
+}
+
+/*
+NewToken creates the token to send in a verification email to a user whose email address is not verified yet, replacing
+any token sent before. To stop the address being flooded, a new token is only created once
+EmailVerificationResendInterval has passed since the last one.
+*/
+func (evs *EmailVerificationService) NewToken(userId int) (string, error) {
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return "", err
+	}
+	row := evs.db.QueryRow(`
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_on)
+		SELECT id, ($2), ($3)
+		FROM users
+		WHERE id = ($1)
+		AND email_verified_at IS NULL
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash,
+			expires_on = EXCLUDED.expires_on,
+			sent_at = now()
+		WHERE email_verification_tokens.sent_at <= ($4)
+		RETURNING id;
+	`, userId, tokenHash, time.Now().Add(EmailVerificationTokenDuration), time.Now().Add(-EmailVerificationResendInterval))
+	var id int
+	err = row.Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// either the address is already verified, or the last email was sent too recently
+		isVerified, err := evs.IsVerified(userId)
+		if err != nil {
+			return "", err
+		}
+		if isVerified {
+			return "", MapHandledError(fmt.Errorf("user id passed in: %d", userId), "your email address has already been verified")
+		}
+		return "", MapHandledError(fmt.Errorf("user id passed in: %d", userId),
+			"a verification email was sent recently - please wait a minute before asking for another")
+	}
+	if err != nil {
+		return "", fmt.Errorf("new email verification token: %w", err)
+	}
+	return token, nil
+}
+
+/*
+Verify marks the email address of the user the token was sent to as verified, and returns their id. The token can only
+be used once.
+*/
+func (evs *EmailVerificationService) Verify(token string) (userId int, err error) {
+	tx, err := evs.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("verify email: %w", err)
+	}
+	defer tx.Rollback()
+	row := tx.QueryRow(`
+		DELETE FROM email_verification_tokens
+		WHERE token_hash = ($1)
+		AND expires_on > now()
+		RETURNING user_id;
+	`, HashSessionToken(token))
+	err = row.Scan(&userId)
+	if err != nil {
+		return 0, HandlePgError(err, &sqlNoRowsErrStruct{NoEmailVerificationTokenFound})
+	}
+	_, err = tx.Exec(`
+		UPDATE users
+		SET email_verified_at = now()
+		WHERE id = ($1)
+		AND email_verified_at IS NULL;
+	`, userId)
+	if err != nil {
+		return 0, fmt.Errorf("verify email: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("verify email: %w", err)
+	}
+	return userId, nil
+}
+
+// DeleteExpiredTokens deletes the verification tokens that expired before now without being used
+func (evs *EmailVerificationService) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := evs.db.Exec(`
+		DELETE FROM email_verification_tokens
+		WHERE expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired email verification tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (evs *EmailVerificationService) IsVerified(userId int) (bool, error) {
+	var isVerified bool
+	row := evs.db.QueryRow(`
+		SELECT email_verified_at IS NOT NULL
+		FROM users
+		WHERE id = ($1);
+	`, userId)
+	err := row.Scan(&isVerified)
+	if err != nil {
+		return false, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	return isVerified, nil
+}
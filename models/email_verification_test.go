@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmailVerification(t *testing.T) {
+	createdUser, err := dbc.UserService.CreateUser(UserEmailToPlainTextPassword{
+		"test_unverified_user@gmail.com",
+		"Holoq123holoq123",
+	})
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(createdUser.ID)
+	userId := createdUser.ID
+
+	_, err = dbc.GalleryService.Create("unverified_test_gallery", userId)
+	if !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("got %v, want %v\n", err, ErrEmailNotVerified)
+	}
+
+	token, err := dbc.EmailVerificationService.NewToken(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.EmailVerificationService.NewToken(userId)
+	if err == nil {
+		t.Errorf("expected error asking for another token straight away, didn't get one")
+	}
+	_, err = dbc.EmailVerificationService.Verify("not-a-token")
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error verifying an unknown token, got %v\n", err)
+	}
+
+	verifiedUserId, err := dbc.EmailVerificationService.Verify(token)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if verifiedUserId != userId {
+		t.Errorf("got %d, want %d\n", verifiedUserId, userId)
+	}
+	_, err = dbc.EmailVerificationService.Verify(token)
+	if err == nil {
+		t.Errorf("expected error reusing a verification token, didn't get one")
+	}
+	userInfo, err := dbc.UserService.GetUserById(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if !userInfo.EmailVerified {
+		t.Errorf("expected email to be verified")
+	}
+
+	gallery, err := dbc.GalleryService.Create("verified_test_gallery", userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	dbc.GalleryService.DeleteById(gallery.ID)
+}
@@ -21,6 +21,21 @@ const (
 	NoRowsErrorOnRefreshSession
 	NewSessionNotReturned
 	NoGalleryFound
+	NoImageFound
+	NoGalleryInviteFound
+	NoShareLinkFound
+	NoAPITokenFound
+	NoTwoFactorChallengeFound
+	NoEmailVerificationTokenFound
+	NoSessionFound
+	NoEmailChangeTokenFound
+	NoOIDCAuthRequestFound
+	NoIdentityFound
+	NoMagicLinkFound
+	NoPasskeyChallengeFound
+	NoPasskeyFound
+	NoDataExportFound
+	NoResetPasswordTokenFound
 )
 
 func (e sqlNoRowsErrEnum) String() string {
@@ -35,6 +50,36 @@ func (e sqlNoRowsErrEnum) String() string {
 		return "no session was returned after attempting to create session"
 	case NoGalleryFound:
 		return "no gallery was found with the input gallery Id"
+	case NoImageFound:
+		return "no image was found with the input filename"
+	case NoGalleryInviteFound:
+		return "this invitation is no longer valid - please ask for a new one"
+	case NoShareLinkFound:
+		return "this link has expired or is no longer valid"
+	case NoAPITokenFound:
+		return "the API token is invalid or has been revoked"
+	case NoTwoFactorChallengeFound:
+		return "your sign in has expired - please sign in again"
+	case NoEmailVerificationTokenFound:
+		return "this verification link has expired or has already been used - please ask for a new one"
+	case NoSessionFound:
+		return "no signed in session was found with that id"
+	case NoEmailChangeTokenFound:
+		return "this link has expired or has already been used - please ask for a new one from your account page"
+	case NoOIDCAuthRequestFound:
+		return "your sign in has expired - please try again"
+	case NoIdentityFound:
+		return "no linked account was found with that id"
+	case NoMagicLinkFound:
+		return "this sign in link has expired or has already been used - please ask for a new one"
+	case NoPasskeyChallengeFound:
+		return "the passkey request has expired - please try again"
+	case NoPasskeyFound:
+		return "no passkey was found with that id"
+	case NoDataExportFound:
+		return "there is no export of your data ready to download - please ask for a new one"
+	case NoResetPasswordTokenFound:
+		return "this link has expired - please make a new request."
 	default:
 		return "unrecognized error, please check actual error"
 	}
@@ -85,6 +130,23 @@ func MapHandledGenericError(err error) *HandledError {
 	}
 }
 
+// IsNoRowsErr reports whether err is a HandledError returned because a query did not find the row it was looking for
+func IsNoRowsErr(err error) bool {
+	var handledError *HandledError
+	return errors.As(err, &handledError) && errors.Is(handledError.err, sql.ErrNoRows)
+}
+
+/*
+IsUserFacingErr reports whether err is a HandledError with a message specific to its cause, or a PasswordPolicyError,
+which can be shown to the user as is. HandledErrors mapped by MapHandledGenericError are not, as their cause is not the
+user's to fix.
+*/
+func IsUserFacingErr(err error) bool {
+	var handledError *HandledError
+	var policyError *PasswordPolicyError
+	return (errors.As(err, &handledError) && handledError.errMsg != genericErrorMsg) || errors.As(err, &policyError)
+}
+
 /*
 Handles case where no rows are returned from query, but by design it's not an error.
 Returns true if no rows are found
@@ -114,3 +176,18 @@ func HandlerBcryptErr(err error) error {
 	}
 	return MapHandledGenericError(err)
 }
+
+// checks the result of an update or delete of a single row, returning noRowsErr if the row could not be found
+func checkOneRowAffected(result sql.Result, err error, noRowsErr *sqlNoRowsErrStruct) error {
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	numRowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	if numRowsAffected == 0 {
+		return HandlePgError(sql.ErrNoRows, noRowsErr)
+	}
+	return nil
+}
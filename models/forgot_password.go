@@ -41,6 +41,21 @@ func (fpws *ForgotPWService) DeleteForgetPasswordToken(userId int) error {
 
 }
 
+/*
+DeleteExpiredTokens deletes the reset password tokens that expired before now, returning the number deleted. Tokens
+that are used are deleted as the password is reset, so only tokens that were never used are left to expire.
+*/
+func (fpws *ForgotPWService) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := fpws.db.Exec(`
+		DELETE FROM forgot_password_tokens
+		WHERE expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired reset password tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 func (fpws *ForgotPWService) NewToken(userId int) (newToken uuid.UUID, err error) {
 	newUUID := uuid.New()
 	expires_on := time.Now().Add(time.Duration(15 * time.Minute)).UTC()
@@ -49,7 +64,7 @@ func (fpws *ForgotPWService) NewToken(userId int) (newToken uuid.UUID, err error
 		INSERT INTO forgot_password_tokens(user_id, token, expires_on)
 		VALUES($1, $2, $3)
 		returning token;
-		`, NoUserWithUserId, newUUID, expires_on,
+		`, userId, newUUID, expires_on,
 	)
 	var returnedToken uuid.UUID
 	err = row.Scan(&returnedToken)
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestResetPasswordWithToken(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+
+	token, err := dbc.ForgotPWService.NewToken(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	err = dbc.UserService.ResetPasswordWithToken(token, "short")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Errorf("expected a PasswordPolicyError, got %v\n", err)
+	}
+	// a password the policy refuses can be retried with the same link
+	newPassword := "Newpassword123newpassword"
+	err = dbc.UserService.ResetPasswordWithToken(token, newPassword)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = dbc.UserService.LoginUser(UserEmailToPlainTextPassword{"test_user@gmail.com", newPassword})
+	if err != nil {
+		t.Errorf("didn't expect error signing in with the new password, got %v\n", err)
+	}
+	for name, usedToken := range map[string]uuid.UUID{"used": token, "unknown": uuid.New()} {
+		err = dbc.UserService.ResetPasswordWithToken(usedToken, "Anotherpassword123another")
+		if !IsNoRowsErr(err) {
+			t.Errorf("expected no rows error resetting with an %s link, got %v\n", name, err)
+		}
+	}
+}
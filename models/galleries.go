@@ -6,42 +6,92 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"slices"
 	"strings"
+
+	"github.com/sohWenMing/lenslocked/storage"
 )
 
 // Gallery houses fields that map to database structure that defines a gallery
+// KeepPhotoMetadata is the owner's opt in to storing uploaded photos with their EXIF data (GPS included) left intact
+// Slug is the unguessable identifier used to link to the gallery when it is unlisted. It is blank until the gallery is
+// first made public or unlisted
 type Gallery struct {
-	ID     int
-	UserID int
-	Title  string
+	ID                int
+	UserID            int
+	Title             string
+	KeepPhotoMetadata bool
+	Visibility        GalleryVisibility
+	Slug              string
 }
 
-// Service that allows for gallery to have a connection to sql.DB methods, to be able to run database commands
-type GalleryService struct {
-	DB        *sql.DB
-	ImagesDir string
-}
+const galleryColumns = `galleries.id, galleries.user_id, galleries.title, galleries.keep_photo_metadata,
+	galleries.visibility, galleries.slug`
 
-func (service *GalleryService) CreateImage(galleryId int, filename string, contents io.Reader) error {
-	galleryDir := service.GalleryDir(galleryId)
-	err := os.MkdirAll(galleryDir, 0755)
-	if err != nil {
-		return fmt.Errorf("creating gallery-%d images directory: %w", galleryId, err)
-	}
-	imagePath := filepath.Join(galleryDir, filename)
-	dst, err := os.Create(imagePath)
+// the number of random bytes in a gallery slug, which is base64 encoded in to 16 characters
+const gallerySlugSize = 12
+
+// scans the galleryColumns of a row in to a Gallery. extra is scanned from any columns selected after galleryColumns
+func scanGallery(row rowScanner, extra ...any) (*Gallery, error) {
+	var gallery Gallery
+	var slug sql.NullString
+	dest := []any{&gallery.ID, &gallery.UserID, &gallery.Title, &gallery.KeepPhotoMetadata, &gallery.Visibility, &slug}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
-		return fmt.Errorf("creating image file: %w", err)
+		return nil, err
 	}
-	defer dst.Close()
-	_, err = io.Copy(dst, contents)
-	if err != nil {
-		return fmt.Errorf("copying contents to image: %w", err)
+	gallery.Slug = slug.String
+	return &gallery, nil
+}
+
+/*
+GalleryVisibility controls who is able to view a gallery and its images, other than its owner.
+
+  - public galleries can be viewed by anyone, at both /galleries/{id} and /galleries/u/{slug}
+  - unlisted galleries can only be viewed by those who have been given the /galleries/u/{slug} link
+  - private galleries can only be viewed by their owner
+*/
+type GalleryVisibility string
+
+const (
+	VisibilityPublic   GalleryVisibility = "public"
+	VisibilityUnlisted GalleryVisibility = "unlisted"
+	VisibilityPrivate  GalleryVisibility = "private"
+)
+
+// GalleryVisibilities lists every visibility, in the order they are offered on the edit page
+var GalleryVisibilities = []GalleryVisibility{VisibilityPrivate, VisibilityUnlisted, VisibilityPublic}
+
+// ParseGalleryVisibility returns the GalleryVisibility named by input, or an error if input does not name one
+func ParseGalleryVisibility(input string) (GalleryVisibility, error) {
+	visibility := GalleryVisibility(strings.ToLower(strings.TrimSpace(input)))
+	if !slices.Contains(GalleryVisibilities, visibility) {
+		return "", fmt.Errorf("%q is not a valid gallery visibility", input)
 	}
-	return nil
+	return visibility, nil
+}
+
+// IsViewableById reports whether the user can view the gallery when it is looked up by its id. userId is 0 when no
+// user is signed in. Members can view a gallery whatever this reports, which GetUserRole is used to check
+func (g *Gallery) IsViewableById(userId int) bool {
+	return g.isOwner(userId) || g.Visibility == VisibilityPublic
+}
+
+// IsViewableBySlug reports whether the user can view the gallery when it is looked up by its slug. As with
+// IsViewableById, members are checked for separately
+func (g *Gallery) IsViewableBySlug(userId int) bool {
+	return g.isOwner(userId) || g.Visibility == VisibilityPublic || g.Visibility == VisibilityUnlisted
+}
+
+func (g *Gallery) isOwner(userId int) bool {
+	return userId != 0 && userId == g.UserID
+}
+
+// Service that allows for gallery to have a connection to sql.DB methods, to be able to run database commands
+// Store is where the bytes of every image in a gallery are kept
+type GalleryService struct {
+	DB    *sql.DB
+	Store storage.Store
 }
 
 func ValidateContentType(r io.ReadSeeker, exts []string) error {
@@ -72,14 +122,19 @@ func get512Bytes(r io.ReadSeeker) (bytesToValidate []byte, err error) {
 
 // what i want is to get access to 512 bytes, for every file that I am trying ot read
 // I also need to be able to reset the reading of the file, using seek
-// Creates a new gallery based on input title and userId. Returns pointer to a Gallery struct if successful, else
-// returns nil and error
-func (service *GalleryService) GalleryDir(id int) string {
-	imagesDir := service.ImagesDir
-	if imagesDir == "" {
-		imagesDir = "images"
-	}
-	return filepath.Join(imagesDir, fmt.Sprintf("%d", id))
+// GalleryPrefix returns the storage prefix underneath which all images of a gallery are kept
+func (service *GalleryService) GalleryPrefix(id int) string {
+	return fmt.Sprintf("%d/", id)
+}
+
+// ImageKey returns the storage key of an image. Only the base of filename is used, so it cannot point outside the gallery
+func (service *GalleryService) ImageKey(galleryId int, filename string) string {
+	return storage.Key(fmt.Sprintf("%d", galleryId), cleanImageFilename(filename))
+}
+
+// ImageVariantKey returns the storage key of a resized variant of an image, which sits in a directory named after the variant
+func (service *GalleryService) ImageVariantKey(galleryId int, filename string, variantName string) string {
+	return storage.Key(fmt.Sprintf("%d", galleryId), variantName, cleanImageFilename(filename))
 }
 
 func (service *GalleryService) GetAllowableContentTypes() []string {
@@ -96,17 +151,25 @@ func (service *GalleryService) GetImageExtensions() []string {
 		".png", ".gif", ".jpg", ".jpeg",
 	}
 }
+
+// Creates a new gallery based on input title and userId. Returns pointer to a Gallery struct if successful, else
+// returns nil and error. Only users who have verified their email address can create galleries, else
+// ErrEmailNotVerified is returned
 func (service *GalleryService) Create(title string, userId int) (*Gallery, error) {
 
 	gallery := Gallery{
-		UserID: userId,
-		Title:  title,
+		UserID:     userId,
+		Title:      title,
+		Visibility: VisibilityPrivate,
 	}
 
 	row := service.DB.QueryRow(
 		`
 		INSERT INTO galleries(title, user_id)
-		VALUES ($1, $2)
+		SELECT $1, id
+		FROM users
+		WHERE id = ($2)
+		AND email_verified_at IS NOT NULL
 		RETURNING id;
 		`, title, userId,
 	)
@@ -114,13 +177,19 @@ func (service *GalleryService) Create(title string, userId int) (*Gallery, error
 	err := row.Scan(
 		&gallery.ID,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEmailNotVerified
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &gallery, nil
 }
 
-// Deletes a gallery, based on the input galleryId. will return error if problem occurs else will return nil
+/*
+Deletes a gallery, based on the input galleryId. The records of its images are removed by the database cascade, after
+which the images are removed from the store. will return error if problem occurs else will return nil
+*/
 func (service *GalleryService) DeleteById(galleryId int) error {
 	_, err := service.DB.Exec(`
 	DELETE from galleries
@@ -129,28 +198,47 @@ func (service *GalleryService) DeleteById(galleryId int) error {
 	if err != nil {
 		return err
 	}
+	err = service.deleteStoredGallery(galleryId)
+	if err != nil {
+		return fmt.Errorf("deleting images of gallery-%d: %w", galleryId, err)
+	}
 	return nil
 }
 
 func (service *GalleryService) GetById(galleryId int) (*Gallery, error) {
 	row := service.DB.QueryRow(
-		`SELECT galleries.id, galleries.user_id, galleries.title
+		`SELECT `+galleryColumns+`
 		FROM galleries
 		WHERE galleries.id = ($1)
 		;
 		`, galleryId,
 	)
-	var gallery Gallery
-	err := row.Scan(&gallery.ID, &gallery.UserID, &gallery.Title)
+	gallery, err := scanGallery(row)
 	if err != nil {
 		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoGalleryFound})
 	}
-	return &gallery, nil
+	return gallery, nil
+}
+
+// GetBySlug returns the gallery with the input slug. Blank slugs never match a gallery
+func (service *GalleryService) GetBySlug(slug string) (*Gallery, error) {
+	row := service.DB.QueryRow(
+		`SELECT `+galleryColumns+`
+		FROM galleries
+		WHERE galleries.slug = ($1)
+		;
+		`, strings.TrimSpace(slug),
+	)
+	gallery, err := scanGallery(row)
+	if err != nil {
+		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoGalleryFound})
+	}
+	return gallery, nil
 }
 
 func (service *GalleryService) GetGalleryListByUserId(userId int) ([]*Gallery, error) {
 	rows, err := service.DB.Query(
-		`SELECT galleries.id, galleries.user_id, galleries.title
+		`SELECT `+galleryColumns+`
 		FROM galleries
 		WHERE galleries.user_id = ($1)
 		;
@@ -162,12 +250,11 @@ func (service *GalleryService) GetGalleryListByUserId(userId int) ([]*Gallery, e
 	}
 	defer rows.Close()
 	for rows.Next() {
-		galleryToAppend := Gallery{}
-		err := rows.Scan(&galleryToAppend.ID, &galleryToAppend.UserID, &galleryToAppend.Title)
+		galleryToAppend, err := scanGallery(rows)
 		if err != nil {
 			return []*Gallery{}, err
 		}
-		returnedGalleries = append(returnedGalleries, &galleryToAppend)
+		returnedGalleries = append(returnedGalleries, galleryToAppend)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -175,20 +262,60 @@ func (service *GalleryService) GetGalleryListByUserId(userId int) ([]*Gallery, e
 	}
 	return returnedGalleries, err
 }
+
+// GetGalleryPageByUserId returns a page of the galleries created by a user in the order they were created, along with
+// the total number of galleries the user has
+func (service *GalleryService) GetGalleryPageByUserId(userId int, page Page) ([]*Gallery, int, error) {
+	var total int
+	err := service.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM galleries
+		WHERE galleries.user_id = ($1);
+	`, userId).Scan(&total)
+	if err != nil {
+		return []*Gallery{}, 0, HandlePgError(err, nil)
+	}
+	rows, err := service.DB.Query(
+		`SELECT `+galleryColumns+`
+		FROM galleries
+		WHERE galleries.user_id = ($1)
+		ORDER BY galleries.id
+		LIMIT ($2) OFFSET ($3)
+		;
+		`, userId, page.Size, page.Offset(),
+	)
+	returnedGalleries := []*Gallery{}
+	if err != nil {
+		return returnedGalleries, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		galleryToAppend, err := scanGallery(rows)
+		if err != nil {
+			return []*Gallery{}, 0, err
+		}
+		returnedGalleries = append(returnedGalleries, galleryToAppend)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*Gallery{}, 0, err
+	}
+	return returnedGalleries, total, nil
+}
+
 func (service *GalleryService) GetByUserId(userId int) (*Gallery, error) {
 	row := service.DB.QueryRow(
-		`SELECT galleries.id, galleries.user_id, galleries.title
+		`SELECT `+galleryColumns+`
 		FROM galleries
 		WHERE galleries.user_id = ($1)
 		;
 		`, userId,
 	)
-	var gallery Gallery
-	err := row.Scan(&gallery.ID, &gallery.UserID, &gallery.Title)
+	gallery, err := scanGallery(row)
 	if err != nil {
 		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoGalleryFound})
 	}
-	return &gallery, nil
+	return gallery, nil
 }
 func (service *GalleryService) UpdateTitle(id int, title string) (err error) {
 	result, err := service.DB.Exec(
@@ -211,3 +338,80 @@ func (service *GalleryService) UpdateTitle(id int, title string) (err error) {
 	}
 	return nil
 }
+
+// GallerySettings are the settings of a gallery that are changed together from the edit gallery form
+type GallerySettings struct {
+	Title string
+	// KeepPhotoMetadata sets whether photos uploaded to the gallery from now on keep their EXIF data
+	KeepPhotoMetadata bool
+	Visibility        GalleryVisibility
+}
+
+/*
+UpdateSettings sets the title, visibility and whether photos keep their metadata of a gallery in a single statement, so
+that an edit is either saved in full or not at all. A slug is generated the same way as with UpdateVisibility.
+*/
+func (service *GalleryService) UpdateSettings(id int, settings GallerySettings) error {
+	if !slices.Contains(GalleryVisibilities, settings.Visibility) {
+		return fmt.Errorf("%q is not a valid gallery visibility", settings.Visibility)
+	}
+	slug, err := bytestring(gallerySlugSize)
+	if err != nil {
+		return fmt.Errorf("update gallery settings %w", err)
+	}
+	result, err := service.DB.Exec(
+		`
+		UPDATE galleries
+		SET title = ($1),
+			keep_photo_metadata = ($2),
+			visibility = ($3),
+			slug = CASE WHEN ($3) = 'private' THEN slug ELSE COALESCE(slug, $4) END
+		WHERE id = ($5);
+		`, settings.Title, settings.KeepPhotoMetadata, string(settings.Visibility), slug, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update gallery settings %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update gallery settings %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows were affected - gallery id passed in: %d", id)
+	}
+	return nil
+}
+
+/*
+UpdateVisibility sets the visibility of a gallery. The first time a gallery is made public or unlisted, a random slug is
+generated for it - the slug is kept from then on, so links that have already been shared keep working if the gallery
+is made private and later unlisted again.
+*/
+func (service *GalleryService) UpdateVisibility(id int, visibility GalleryVisibility) error {
+	if !slices.Contains(GalleryVisibilities, visibility) {
+		return fmt.Errorf("%q is not a valid gallery visibility", visibility)
+	}
+	slug, err := bytestring(gallerySlugSize)
+	if err != nil {
+		return fmt.Errorf("update gallery visibility %w", err)
+	}
+	result, err := service.DB.Exec(
+		`
+		UPDATE galleries
+		SET visibility = ($1),
+			slug = CASE WHEN ($1) = 'private' THEN slug ELSE COALESCE(slug, $2) END
+		WHERE id = ($3);
+		`, string(visibility), slug, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update gallery visibility %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update gallery visibility %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows were affected - gallery id passed in: %d", id)
+	}
+	return nil
+}
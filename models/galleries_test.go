@@ -300,6 +300,82 @@ func TestUpdateGalleryTitle(t *testing.T) {
 	}
 }
 
+func TestGalleryVisibility(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	ownerId := userIdToSession.UserID
+
+	gallery, err := dbc.GalleryService.Create("visibility_test_gallery", ownerId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	type test struct {
+		name                   string
+		visibility             GalleryVisibility
+		userId                 int
+		isExpectViewableById   bool
+		isExpectViewableBySlug bool
+	}
+	tests := []test{
+		{"owner can view private gallery", VisibilityPrivate, ownerId, true, true},
+		{"others cannot view private gallery", VisibilityPrivate, 0, false, false},
+		{"others can only view unlisted gallery by slug", VisibilityUnlisted, 0, false, true},
+		{"others can view public gallery", VisibilityPublic, ownerId + 1, true, true},
+	}
+	slug := ""
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := dbc.GalleryService.UpdateVisibility(gallery.ID, test.visibility)
+			if err != nil {
+				t.Errorf("didn't expect error, got %v\n", err)
+				return
+			}
+			retrievedGallery, err := dbc.GalleryService.GetById(gallery.ID)
+			if err != nil {
+				t.Errorf("didn't expect error, got %v\n", err)
+				return
+			}
+			if retrievedGallery.Visibility != test.visibility {
+				t.Errorf("got %s, want %s\n", retrievedGallery.Visibility, test.visibility)
+			}
+			if test.visibility != VisibilityPrivate {
+				if retrievedGallery.Slug == "" {
+					t.Errorf("expected slug to be generated")
+				}
+				if slug != "" && retrievedGallery.Slug != slug {
+					t.Errorf("got slug %s, want slug to stay %s\n", retrievedGallery.Slug, slug)
+				}
+				slug = retrievedGallery.Slug
+			}
+			if got := retrievedGallery.IsViewableById(test.userId); got != test.isExpectViewableById {
+				t.Errorf("got viewable by id %t, want %t\n", got, test.isExpectViewableById)
+			}
+			if got := retrievedGallery.IsViewableBySlug(test.userId); got != test.isExpectViewableBySlug {
+				t.Errorf("got viewable by slug %t, want %t\n", got, test.isExpectViewableBySlug)
+			}
+		})
+	}
+
+	bySlug, err := dbc.GalleryService.GetBySlug(slug)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if bySlug.ID != gallery.ID {
+		t.Errorf("got %d, want %d\n", bySlug.ID, gallery.ID)
+	}
+	_, err = ParseGalleryVisibility("secret")
+	if err == nil {
+		t.Errorf("expected error, didn't get one")
+	}
+}
+
 func CreateTestUser(t *testing.T) (*UserIdToSession, bool) {
 	testUserEmailToPlainTextPassword := UserEmailToPlainTextPassword{
 		"test_user@gmail.com",
@@ -310,5 +386,57 @@ func CreateTestUser(t *testing.T) (*UserIdToSession, bool) {
 		t.Errorf("didn't expect error, got %v", err)
 		return nil, true
 	}
+	// galleries can only be created by users who have verified their email address
+	token, err := dbc.EmailVerificationService.NewToken(userIdToSession.UserID)
+	if err == nil {
+		_, err = dbc.EmailVerificationService.Verify(token)
+	}
+	if err != nil {
+		dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+		t.Errorf("didn't expect error, got %v", err)
+		return nil, true
+	}
 	return userIdToSession, false
 }
+
+func TestUpdateGallerySettings(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	gallery, err := dbc.GalleryService.Create("settings_test_gallery", userIdToSession.UserID)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	settings := GallerySettings{"settings_test_renamed", true, VisibilityUnlisted}
+	err = dbc.GalleryService.UpdateSettings(gallery.ID, settings)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	retrievedGallery, err := dbc.GalleryService.GetById(gallery.ID)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if retrievedGallery.Title != settings.Title || !retrievedGallery.KeepPhotoMetadata ||
+		retrievedGallery.Visibility != settings.Visibility || retrievedGallery.Slug == "" {
+		t.Errorf("got %+v, want the settings %+v saved with a slug\n", retrievedGallery, settings)
+	}
+
+	// an edit that cannot be saved in full changes nothing
+	err = dbc.GalleryService.UpdateSettings(gallery.ID, GallerySettings{"settings_test_not_saved", false, "secret"})
+	if err == nil {
+		t.Errorf("expected error, didn't get one")
+	}
+	retrievedGallery, err = dbc.GalleryService.GetById(gallery.ID)
+	if err != nil || retrievedGallery.Title != settings.Title || !retrievedGallery.KeepPhotoMetadata {
+		t.Errorf("got %+v %v, want the settings left as they were\n", retrievedGallery, err)
+	}
+	err = dbc.GalleryService.UpdateSettings(gallery.ID+1000000, settings)
+	if err == nil {
+		t.Errorf("expected error updating a gallery that does not exist, didn't get one")
+	}
+}
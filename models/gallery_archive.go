@@ -0,0 +1,134 @@
+package models
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/imaging"
+)
+
+// ArchiveManifestName is the name of the manifest written at the root of every gallery archive
+const ArchiveManifestName = "manifest.json"
+
+// ArchiveManifest describes the contents of a gallery archive, and is written to it as ArchiveManifestName
+type ArchiveManifest struct {
+	GalleryID   int                    `json:"gallery_id"`
+	Title       string                 `json:"title"`
+	Size        string                 `json:"size"`
+	GeneratedAt time.Time              `json:"generated_at"`
+	Images      []ArchiveManifestImage `json:"images"`
+}
+
+// ArchiveManifestImage describes a single image in a gallery archive. Width and Height are those of the original
+type ArchiveManifestImage struct {
+	Filename   string     `json:"filename"`
+	Caption    string     `json:"caption"`
+	Position   int        `json:"position"`
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	TakenAt    *time.Time `json:"taken_at,omitempty"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+}
+
+/*
+WriteGalleryArchive writes a ZIP archive of every image in a gallery to w, followed by a manifest listing their
+captions. size is the name of one of imaging.Variants, or blank for the originals - images without that variant are
+written as their original.
+
+Each image is copied from the store straight in to the archive, so the archive is never held in memory and can be
+streamed to a response as it is written. Images are stored without compression, as JPEG, PNG and GIF are already
+compressed.
+*/
+func (service *GalleryService) WriteGalleryArchive(w io.Writer, gallery *Gallery, size string) error {
+	if _, isVariant := imaging.VariantByName(size); size != "" && !isVariant {
+		return fmt.Errorf("%q is not a valid image size", size)
+	}
+	images, err := service.GetImagesByGalleryId(gallery.ID)
+	if err != nil {
+		return err
+	}
+	manifest := ArchiveManifest{
+		GalleryID:   gallery.ID,
+		Title:       gallery.Title,
+		Size:        size,
+		GeneratedAt: time.Now().UTC(),
+		Images:      make([]ArchiveManifestImage, len(images)),
+	}
+	if manifest.Size == "" {
+		manifest.Size = "original"
+	}
+
+	archive := zip.NewWriter(w)
+	for i, img := range images {
+		err = service.writeArchiveImage(archive, img.Filename, img, size)
+		if err != nil {
+			return err
+		}
+		manifest.Images[i] = newArchiveManifestImage(img)
+	}
+
+	err = writeArchiveJSON(archive, ArchiveManifestName, manifest.GeneratedAt, manifest)
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writes value in to the archive as indented JSON under name
+func writeArchiveJSON(archive *zip.Writer, name string, modified time.Time, value any) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("writing %s to archive: %w", name, err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "    ")
+	err = encoder.Encode(value)
+	if err != nil {
+		return fmt.Errorf("writing %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+func newArchiveManifestImage(img *Image) ArchiveManifestImage {
+	manifestImage := ArchiveManifestImage{
+		Filename:   img.Filename,
+		Caption:    img.Caption,
+		Position:   img.Position,
+		Width:      img.Width,
+		Height:     img.Height,
+		UploadedAt: img.UploadedAt,
+	}
+	if !img.TakenAt.IsZero() {
+		manifestImage.TakenAt = &img.TakenAt
+	}
+	return manifestImage
+}
+
+// copies the image in to the archive under name
+func (service *GalleryService) writeArchiveImage(archive *zip.Writer, name string, img *Image, size string) error {
+	contents, _, err := service.OpenImage(img.GalleryID, img.Filename, size)
+	if err != nil {
+		return fmt.Errorf("opening %s for archive: %w", img.Filename, err)
+	}
+	defer contents.Close()
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: img.UploadedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("adding %s to archive: %w", img.Filename, err)
+	}
+	_, err = io.Copy(entry, contents)
+	if err != nil {
+		return fmt.Errorf("adding %s to archive: %w", img.Filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+func TestWriteGalleryArchive(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	gallery, err := dbc.GalleryService.Create("archive_test_gallery", userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	pngBytes := testPNG(t, 4, 3)
+	for _, filename := range []string{"first.png", "second.png"} {
+		_, err := dbc.GalleryService.CreateImage(gallery.ID, userIdToSession.UserID, filename, bytes.NewReader(pngBytes))
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+			return
+		}
+	}
+	err = dbc.GalleryService.UpdateImageCaption(gallery.ID, "second.png", "the second image")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+
+	buf := bytes.Buffer{}
+	err = dbc.GalleryService.WriteGalleryArchive(&buf, gallery, "")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Errorf("didn't expect error reading archive, got %v\n", err)
+		return
+	}
+	entries := map[string][]byte{}
+	for _, file := range archive.File {
+		contents, err := file.Open()
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+			return
+		}
+		entries[file.Name], _ = io.ReadAll(contents)
+		contents.Close()
+	}
+	for _, filename := range []string{"first.png", "second.png"} {
+		if !bytes.Equal(entries[filename], pngBytes) {
+			t.Errorf("archived %s did not match uploaded contents", filename)
+		}
+	}
+
+	var manifest ArchiveManifest
+	err = json.Unmarshal(entries[ArchiveManifestName], &manifest)
+	if err != nil {
+		t.Errorf("didn't expect error reading manifest, got %v\n", err)
+		return
+	}
+	if manifest.Title != gallery.Title || manifest.Size != "original" || len(manifest.Images) != 2 {
+		t.Errorf("got manifest %+v, want title %s, size original and 2 images\n", manifest, gallery.Title)
+		return
+	}
+	if manifest.Images[1].Caption != "the second image" {
+		t.Errorf("got %s, want %s\n", manifest.Images[1].Caption, "the second image")
+	}
+
+	err = dbc.GalleryService.WriteGalleryArchive(io.Discard, gallery, "huge")
+	if err == nil {
+		t.Errorf("expected error for invalid size, didn't get one")
+	}
+}
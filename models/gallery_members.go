@@ -0,0 +1,288 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// how long a gallery invitation link can be used for, after it is sent
+const GalleryInviteDuration = 7 * 24 * time.Hour
+
+/*
+GalleryRole is the level of access a user has to a gallery. The owner of a gallery always has RoleOwner, and members
+are given one of MemberRoles when they are invited. RoleNone is returned for users with no access beyond what the
+gallery's visibility allows.
+
+  - viewers can view the gallery, even when it is private
+  - contributors can also upload images, and manage the images they uploaded
+  - editors can also edit the gallery's settings, and manage every image
+  - owners can also delete the gallery, and invite and remove members
+*/
+type GalleryRole string
+
+const (
+	RoleNone        GalleryRole = ""
+	RoleViewer      GalleryRole = "viewer"
+	RoleContributor GalleryRole = "contributor"
+	RoleEditor      GalleryRole = "editor"
+	RoleOwner       GalleryRole = "owner"
+)
+
+// MemberRoles lists the roles a member can be invited with, in the order they are offered on the edit page
+var MemberRoles = []GalleryRole{RoleViewer, RoleContributor, RoleEditor}
+
+// ParseMemberRole returns the member role named by input, or an error if input does not name one
+func ParseMemberRole(input string) (GalleryRole, error) {
+	role := GalleryRole(strings.ToLower(strings.TrimSpace(input)))
+	if !slices.Contains(MemberRoles, role) {
+		return RoleNone, fmt.Errorf("%q is not a valid gallery role", input)
+	}
+	return role, nil
+}
+
+func (r GalleryRole) CanView() bool {
+	return r != RoleNone
+}
+
+func (r GalleryRole) CanUpload() bool {
+	return r == RoleContributor || r == RoleEditor || r == RoleOwner
+}
+
+func (r GalleryRole) CanEdit() bool {
+	return r == RoleEditor || r == RoleOwner
+}
+
+// CanManageImage reports whether the user can delete or caption img. Contributors can only manage their own uploads
+func (r GalleryRole) CanManageImage(img *Image, userId int) bool {
+	if r.CanEdit() {
+		return true
+	}
+	return r == RoleContributor && userId != 0 && img.UploadedBy == userId
+}
+
+func (r GalleryRole) CanDeleteGallery() bool {
+	return r == RoleOwner
+}
+
+func (r GalleryRole) CanManageMembers() bool {
+	return r == RoleOwner
+}
+
+/*
+GalleryMember is a user who has been invited to a gallery. Until the invitation is accepted UserID is 0 and
+AcceptedAt is the zero time - the invitation is tied to Email, and can only be accepted by the user with that email.
+*/
+type GalleryMember struct {
+	ID         int
+	GalleryID  int
+	Email      string
+	UserID     int
+	Role       GalleryRole
+	InvitedBy  int
+	CreatedAt  time.Time
+	AcceptedAt time.Time
+}
+
+func (m *GalleryMember) IsPending() bool {
+	return m.AcceptedAt.IsZero()
+}
+
+// MemberGallery is a gallery that a user has been given access to as a member, along with the role they were given
+type MemberGallery struct {
+	Gallery
+	Role GalleryRole
+}
+
+const galleryMemberColumns = `gallery_members.id, gallery_members.gallery_id, gallery_members.email,
+	gallery_members.user_id, gallery_members.role, gallery_members.invited_by, gallery_members.created_at,
+	gallery_members.accepted_at`
+
+func scanGalleryMember(row rowScanner) (*GalleryMember, error) {
+	var member GalleryMember
+	var userId, invitedBy sql.NullInt64
+	var acceptedAt sql.NullTime
+	err := row.Scan(&member.ID, &member.GalleryID, &member.Email, &userId, &member.Role, &invitedBy,
+		&member.CreatedAt, &acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	member.UserID = int(userId.Int64)
+	member.InvitedBy = int(invitedBy.Int64)
+	member.AcceptedAt = acceptedAt.Time
+	return &member, nil
+}
+
+// GetUserRole returns the role userId has in gallery, which is RoleNone if the user is neither its owner or a member
+func (service *GalleryService) GetUserRole(gallery *Gallery, userId int) (GalleryRole, error) {
+	if userId == 0 {
+		return RoleNone, nil
+	}
+	if gallery.UserID == userId {
+		return RoleOwner, nil
+	}
+	row := service.DB.QueryRow(`
+		SELECT gallery_members.role
+		FROM gallery_members
+		WHERE gallery_members.gallery_id = ($1)
+		AND gallery_members.user_id = ($2)
+		AND gallery_members.accepted_at IS NOT NULL;
+	`, gallery.ID, userId)
+	var role GalleryRole
+	err := row.Scan(&role)
+	if CheckIsNoRowsErr(err) {
+		return RoleNone, nil
+	}
+	if err != nil {
+		return RoleNone, fmt.Errorf("get user role: %w", err)
+	}
+	return role, nil
+}
+
+/*
+InviteMember records an invitation for email to join a gallery with role, returning the member along with the raw
+token that must be sent to them. Inviting an email that has already been invited replaces the role and token of the
+earlier invitation - if that invitation was already accepted, the new role takes effect straight away.
+*/
+func (service *GalleryService) InviteMember(gallery *Gallery, invitedBy int, email string, role GalleryRole) (*GalleryMember, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !isValidEmail(email) {
+		return nil, "", MapHandledError(errors.New("invalid email"), "please enter a valid email address")
+	}
+	if !slices.Contains(MemberRoles, role) {
+		return nil, "", fmt.Errorf("%q is not a valid gallery role", role)
+	}
+	var ownerEmail string
+	err := service.DB.QueryRow(`SELECT email FROM users WHERE id = ($1);`, gallery.UserID).Scan(&ownerEmail)
+	if err != nil {
+		return nil, "", HandlePgError(err, nil)
+	}
+	if ownerEmail == email {
+		return nil, "", MapHandledError(errors.New("invited owner"), "the owner of a gallery cannot be invited to it")
+	}
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return nil, "", fmt.Errorf("invite member: %w", err)
+	}
+	row := service.DB.QueryRow(`
+		INSERT INTO gallery_members (gallery_id, email, role, invited_by, token_hash, invite_expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6)
+		ON CONFLICT (gallery_id, email) DO UPDATE
+		SET role = EXCLUDED.role,
+			invited_by = EXCLUDED.invited_by,
+			token_hash = EXCLUDED.token_hash,
+			invite_expires_at = EXCLUDED.invite_expires_at
+		RETURNING `+galleryMemberColumns+`;
+	`, gallery.ID, email, string(role), invitedBy, tokenHash, time.Now().Add(GalleryInviteDuration))
+	member, err := scanGalleryMember(row)
+	if err != nil {
+		return nil, "", HandlePgError(err, nil)
+	}
+	return member, token, nil
+}
+
+/*
+AcceptInvite ties the invitation with the input token to the signed in user. The invitation can only be accepted by
+the user whose email it was sent to, and only before it expires. Once accepted, the token cannot be used again.
+*/
+func (service *GalleryService) AcceptInvite(token string, userId int) (*GalleryMember, error) {
+	row := service.DB.QueryRow(`
+		UPDATE gallery_members
+		SET user_id = users.id,
+			accepted_at = COALESCE(gallery_members.accepted_at, now()),
+			token_hash = NULL,
+			invite_expires_at = NULL
+		FROM users
+		WHERE gallery_members.token_hash = ($1)
+		AND gallery_members.invite_expires_at > now()
+		AND users.id = ($2)
+		AND users.email = gallery_members.email
+		RETURNING `+galleryMemberColumns+`;
+	`, HashSessionToken(token), userId)
+	member, err := scanGalleryMember(row)
+	if err != nil {
+		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoGalleryInviteFound})
+	}
+	return member, nil
+}
+
+// GetMembersByGalleryId returns every member of a gallery, including those who have yet to accept their invitation
+func (service *GalleryService) GetMembersByGalleryId(galleryId int) ([]*GalleryMember, error) {
+	rows, err := service.DB.Query(`
+		SELECT `+galleryMemberColumns+`
+		FROM gallery_members
+		WHERE gallery_members.gallery_id = ($1)
+		ORDER BY gallery_members.created_at, gallery_members.id;
+	`, galleryId)
+	returnedMembers := []*GalleryMember{}
+	if err != nil {
+		return returnedMembers, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		member, err := scanGalleryMember(rows)
+		if err != nil {
+			return []*GalleryMember{}, err
+		}
+		returnedMembers = append(returnedMembers, member)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*GalleryMember{}, err
+	}
+	return returnedMembers, nil
+}
+
+// RemoveMember removes a member from a gallery, or withdraws their invitation if it has not yet been accepted
+func (service *GalleryService) RemoveMember(galleryId int, memberId int) error {
+	result, err := service.DB.Exec(`
+		DELETE FROM gallery_members
+		WHERE gallery_id = ($1)
+		AND id = ($2);
+	`, galleryId, memberId)
+	if err != nil {
+		return fmt.Errorf("remove gallery member %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("remove gallery member %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows were affected - gallery member id passed in: %d", memberId)
+	}
+	return nil
+}
+
+// GetMemberGalleryListByUserId returns the galleries a user has accepted an invitation to, along with their role in each
+func (service *GalleryService) GetMemberGalleryListByUserId(userId int) ([]*MemberGallery, error) {
+	rows, err := service.DB.Query(
+		`SELECT `+galleryColumns+`, gallery_members.role
+		FROM galleries
+		JOIN gallery_members ON gallery_members.gallery_id = galleries.id
+		WHERE gallery_members.user_id = ($1)
+		AND gallery_members.accepted_at IS NOT NULL
+		ORDER BY galleries.id;
+		`, userId,
+	)
+	returnedGalleries := []*MemberGallery{}
+	if err != nil {
+		return returnedGalleries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role GalleryRole
+		gallery, err := scanGallery(rows, &role)
+		if err != nil {
+			return []*MemberGallery{}, err
+		}
+		returnedGalleries = append(returnedGalleries, &MemberGallery{*gallery, role})
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*MemberGallery{}, err
+	}
+	return returnedGalleries, nil
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+func TestGalleryRolePermissions(t *testing.T) {
+	const uploaderId = 10
+	img := &Image{UploadedBy: uploaderId}
+	type test struct {
+		name                 string
+		role                 GalleryRole
+		userId               int
+		isExpectView         bool
+		isExpectUpload       bool
+		isExpectEdit         bool
+		isExpectManageImage  bool
+		isExpectDeleteAndAdd bool
+	}
+	tests := []test{
+		{"no role", RoleNone, uploaderId, false, false, false, false, false},
+		{"viewer", RoleViewer, uploaderId, true, false, false, false, false},
+		{"contributor managing own upload", RoleContributor, uploaderId, true, true, false, true, false},
+		{"contributor managing other upload", RoleContributor, uploaderId + 1, true, true, false, false, false},
+		{"editor", RoleEditor, uploaderId + 1, true, true, true, true, false},
+		{"owner", RoleOwner, uploaderId + 1, true, true, true, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.role.CanView(); got != test.isExpectView {
+				t.Errorf("CanView: got %t, want %t\n", got, test.isExpectView)
+			}
+			if got := test.role.CanUpload(); got != test.isExpectUpload {
+				t.Errorf("CanUpload: got %t, want %t\n", got, test.isExpectUpload)
+			}
+			if got := test.role.CanEdit(); got != test.isExpectEdit {
+				t.Errorf("CanEdit: got %t, want %t\n", got, test.isExpectEdit)
+			}
+			if got := test.role.CanManageImage(img, test.userId); got != test.isExpectManageImage {
+				t.Errorf("CanManageImage: got %t, want %t\n", got, test.isExpectManageImage)
+			}
+			if got := test.role.CanDeleteGallery(); got != test.isExpectDeleteAndAdd {
+				t.Errorf("CanDeleteGallery: got %t, want %t\n", got, test.isExpectDeleteAndAdd)
+			}
+			if got := test.role.CanManageMembers(); got != test.isExpectDeleteAndAdd {
+				t.Errorf("CanManageMembers: got %t, want %t\n", got, test.isExpectDeleteAndAdd)
+			}
+		})
+	}
+}
+
+func TestInviteAndAcceptGalleryMember(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	ownerId := userIdToSession.UserID
+
+	invitedUser, err := dbc.UserService.CreateUser(UserEmailToPlainTextPassword{
+		"test_invited_user@gmail.com",
+		"Holoq123holoq123",
+	})
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(invitedUser.ID)
+
+	gallery, err := dbc.GalleryService.Create("member_test_gallery", ownerId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	_, _, err = dbc.GalleryService.InviteMember(gallery, ownerId, "test_user@gmail.com", RoleEditor)
+	if err == nil {
+		t.Errorf("expected error inviting the owner, didn't get one")
+	}
+	member, token, err := dbc.GalleryService.InviteMember(gallery, ownerId, " Test_Invited_User@gmail.com", RoleContributor)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if !member.IsPending() || member.Email != "test_invited_user@gmail.com" {
+		t.Errorf("got pending %t email %s, want pending invite for %s\n", member.IsPending(), member.Email, "test_invited_user@gmail.com")
+	}
+
+	role, err := dbc.GalleryService.GetUserRole(gallery, invitedUser.ID)
+	if err != nil || role != RoleNone {
+		t.Errorf("got role %q err %v, want no role before the invite is accepted\n", role, err)
+	}
+	_, err = dbc.GalleryService.AcceptInvite(token, ownerId)
+	if err == nil {
+		t.Errorf("expected error accepting invite as another user, didn't get one")
+	}
+	_, err = dbc.GalleryService.AcceptInvite(token, invitedUser.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.GalleryService.AcceptInvite(token, invitedUser.ID)
+	if err == nil {
+		t.Errorf("expected error accepting invite a second time, didn't get one")
+	}
+
+	role, err = dbc.GalleryService.GetUserRole(gallery, invitedUser.ID)
+	if err != nil || role != RoleContributor {
+		t.Errorf("got role %q err %v, want %q\n", role, err, RoleContributor)
+	}
+	memberGalleries, err := dbc.GalleryService.GetMemberGalleryListByUserId(invitedUser.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(memberGalleries) != 1 || memberGalleries[0].ID != gallery.ID || memberGalleries[0].Role != RoleContributor {
+		t.Errorf("got %v, want gallery %d with role %q\n", memberGalleries, gallery.ID, RoleContributor)
+	}
+
+	err = dbc.GalleryService.RemoveMember(gallery.ID, member.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	role, _ = dbc.GalleryService.GetUserRole(gallery, invitedUser.ID)
+	if role != RoleNone {
+		t.Errorf("got role %q, want no role after removal\n", role)
+	}
+}
+
+func TestContributorCannotReplaceImages(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	ownerId := userIdToSession.UserID
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	contributor, err := dbc.UserService.CreateUser(UserEmailToPlainTextPassword{
+		"test_contributor@gmail.com",
+		"Holoq123holoq123",
+	})
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.UserService.DeleteUserAndSession(contributor.ID)
+
+	gallery, err := dbc.GalleryService.Create("contributor_test_gallery", ownerId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+	_, token, err := dbc.GalleryService.InviteMember(gallery, ownerId, "test_contributor@gmail.com", RoleContributor)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = dbc.GalleryService.AcceptInvite(token, contributor.ID)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+
+	_, err = dbc.GalleryService.CreateImage(gallery.ID, ownerId, "owners.png", bytes.NewReader(testPNG(t, 4, 3)))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = dbc.GalleryService.CreateImage(gallery.ID, contributor.ID, "owners.png", bytes.NewReader(testPNG(t, 8, 6)))
+	if !errors.Is(err, ErrImageExists) {
+		t.Errorf("expected ErrImageExists replacing the owner's image, got %v\n", err)
+	}
+	img, err := dbc.GalleryService.GetImage(gallery.ID, "owners.png")
+	if err != nil || img.UploadedBy != ownerId || img.Width != 4 {
+		t.Errorf("got %+v %v, want the owner's image untouched\n", img, err)
+	}
+
+	// contributors can still replace their own uploads, and the owner can replace anything
+	for _, uploaderId := range []int{contributor.ID, contributor.ID, ownerId} {
+		_, err = dbc.GalleryService.CreateImage(gallery.ID, uploaderId, "contributors.png", bytes.NewReader(testPNG(t, 4, 3)))
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+		}
+	}
+}
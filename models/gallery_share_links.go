@@ -0,0 +1,187 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+ShareLink gives anyone holding its token access to view a gallery, without needing an account. A link can be limited
+by an expiry, a password and whether the full sized originals can be downloaded.
+
+Token is only set when the link is created. As with sessions only the hash of the token is stored, so the link can
+only be shown to its creator once.
+*/
+type ShareLink struct {
+	ID        int
+	GalleryID int
+	Label     string
+	CreatedBy int
+	CreatedAt time.Time
+	// ExpiresAt is the zero time for links that never expire
+	ExpiresAt     time.Time
+	AllowDownload bool
+	RevokedAt     time.Time
+	Token         string
+	passwordHash  string
+}
+
+// ShareLinkOptions are the settings a share link is created with. A blank Password and zero ExpiresAt mean no limit
+type ShareLinkOptions struct {
+	Label         string
+	ExpiresAt     time.Time
+	Password      string
+	AllowDownload bool
+}
+
+func (l *ShareLink) HasPassword() bool {
+	return l.passwordHash != ""
+}
+
+// IsActive reports whether the link can still be used at the input time
+func (l *ShareLink) IsActive(now time.Time) bool {
+	if !l.RevokedAt.IsZero() {
+		return false
+	}
+	return l.ExpiresAt.IsZero() || now.Before(l.ExpiresAt)
+}
+
+// VerifyPassword returns nil if password matches the password of the link, or if the link does not have one
+func (l *ShareLink) VerifyPassword(password string) error {
+	if !l.HasPassword() {
+		return nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(l.passwordHash), []byte(password))
+	if err != nil {
+		return MapHandledError(err, "the password entered is incorrect")
+	}
+	return nil
+}
+
+/*
+UnlockValue returns the value kept in a cookie once the password of a link has been entered. It is derived from the
+token and the password hash, so it cannot be produced by anyone who does not know both.
+*/
+func (l *ShareLink) UnlockValue(token string) string {
+	return HashSessionToken(token + ":" + l.passwordHash)
+}
+
+const shareLinkColumns = `gallery_share_links.id, gallery_share_links.gallery_id, gallery_share_links.label,
+	gallery_share_links.created_by, gallery_share_links.created_at, gallery_share_links.expires_at,
+	gallery_share_links.password_hash, gallery_share_links.allow_download, gallery_share_links.revoked_at`
+
+func scanShareLink(row rowScanner) (*ShareLink, error) {
+	var link ShareLink
+	var createdBy sql.NullInt64
+	var expiresAt, revokedAt sql.NullTime
+	var passwordHash sql.NullString
+	err := row.Scan(&link.ID, &link.GalleryID, &link.Label, &createdBy, &link.CreatedAt, &expiresAt,
+		&passwordHash, &link.AllowDownload, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	link.CreatedBy = int(createdBy.Int64)
+	link.ExpiresAt = expiresAt.Time
+	link.passwordHash = passwordHash.String
+	link.RevokedAt = revokedAt.Time
+	return &link, nil
+}
+
+// CreateShareLink mints a new share link for a gallery. The returned ShareLink is the only one to have Token set
+func (service *GalleryService) CreateShareLink(galleryId int, createdBy int, options ShareLinkOptions) (*ShareLink, error) {
+	passwordHash := sql.NullString{}
+	if options.Password != "" {
+		hash, err := GenerateBcryptHash(options.Password)
+		if err != nil {
+			return nil, fmt.Errorf("create share link: %w", err)
+		}
+		passwordHash = sql.NullString{String: hash, Valid: true}
+	}
+	expiresAt := sql.NullTime{Time: options.ExpiresAt, Valid: !options.ExpiresAt.IsZero()}
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return nil, fmt.Errorf("create share link: %w", err)
+	}
+	row := service.DB.QueryRow(`
+		INSERT INTO gallery_share_links (gallery_id, token_hash, label, created_by, expires_at, password_hash, allow_download)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7)
+		RETURNING `+shareLinkColumns+`;
+	`, galleryId, tokenHash, strings.TrimSpace(options.Label), createdBy, expiresAt, passwordHash, options.AllowDownload)
+	link, err := scanShareLink(row)
+	if err != nil {
+		return nil, HandlePgError(err, nil)
+	}
+	link.Token = token
+	return link, nil
+}
+
+// GetShareLinkByToken returns the share link with the input token, as long as it has not expired or been revoked
+func (service *GalleryService) GetShareLinkByToken(token string) (*ShareLink, error) {
+	row := service.DB.QueryRow(`
+		SELECT `+shareLinkColumns+`
+		FROM gallery_share_links
+		WHERE gallery_share_links.token_hash = ($1)
+		AND gallery_share_links.revoked_at IS NULL
+		AND (gallery_share_links.expires_at IS NULL OR gallery_share_links.expires_at > now());
+	`, HashSessionToken(token))
+	link, err := scanShareLink(row)
+	if err != nil {
+		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoShareLinkFound})
+	}
+	return link, nil
+}
+
+// GetActiveShareLinksByGalleryId returns the share links of a gallery that have not expired or been revoked
+func (service *GalleryService) GetActiveShareLinksByGalleryId(galleryId int) ([]*ShareLink, error) {
+	rows, err := service.DB.Query(`
+		SELECT `+shareLinkColumns+`
+		FROM gallery_share_links
+		WHERE gallery_share_links.gallery_id = ($1)
+		AND gallery_share_links.revoked_at IS NULL
+		AND (gallery_share_links.expires_at IS NULL OR gallery_share_links.expires_at > now())
+		ORDER BY gallery_share_links.created_at, gallery_share_links.id;
+	`, galleryId)
+	returnedLinks := []*ShareLink{}
+	if err != nil {
+		return returnedLinks, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return []*ShareLink{}, err
+		}
+		returnedLinks = append(returnedLinks, link)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*ShareLink{}, err
+	}
+	return returnedLinks, nil
+}
+
+// RevokeShareLink stops a share link from working. Revoked links are kept, but are no longer listed
+func (service *GalleryService) RevokeShareLink(galleryId int, linkId int) error {
+	result, err := service.DB.Exec(`
+		UPDATE gallery_share_links
+		SET revoked_at = now()
+		WHERE gallery_id = ($1)
+		AND id = ($2)
+		AND revoked_at IS NULL;
+	`, galleryId, linkId)
+	if err != nil {
+		return fmt.Errorf("revoke share link %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("revoke share link %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows were affected - share link id passed in: %d", linkId)
+	}
+	return nil
+}
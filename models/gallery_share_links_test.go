@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShareLinks(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	gallery, err := dbc.GalleryService.Create("share_link_test_gallery", userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	type test struct {
+		name            string
+		options         ShareLinkOptions
+		password        string
+		isExpectActive  bool
+		isExpectUnlocks bool
+	}
+	tests := []test{
+		{"open link", ShareLinkOptions{Label: "open"}, "", true, true},
+		{"password link with correct password", ShareLinkOptions{Password: "proofs"}, "proofs", true, true},
+		{"password link with wrong password", ShareLinkOptions{Password: "proofs"}, "guess", true, false},
+		{"expired link", ShareLinkOptions{ExpiresAt: time.Now().Add(-time.Hour)}, "", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			created, err := dbc.GalleryService.CreateShareLink(gallery.ID, userIdToSession.UserID, test.options)
+			if err != nil {
+				t.Errorf("didn't expect error, got %v\n", err)
+				return
+			}
+			if created.Token == "" {
+				t.Errorf("expected token to be set on the created link")
+			}
+			link, err := dbc.GalleryService.GetShareLinkByToken(created.Token)
+			if !test.isExpectActive {
+				if err == nil {
+					t.Errorf("expected error getting inactive link, didn't get one")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("didn't expect error, got %v\n", err)
+				return
+			}
+			if link.GalleryID != gallery.ID {
+				t.Errorf("got %d, want %d\n", link.GalleryID, gallery.ID)
+			}
+			err = link.VerifyPassword(test.password)
+			if isUnlocked := err == nil; isUnlocked != test.isExpectUnlocks {
+				t.Errorf("got unlocked %t, want %t\n", isUnlocked, test.isExpectUnlocks)
+			}
+		})
+	}
+
+	activeLinks, err := dbc.GalleryService.GetActiveShareLinksByGalleryId(gallery.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(activeLinks) != 3 {
+		t.Errorf("got %d active links, want %d\n", len(activeLinks), 3)
+		return
+	}
+	err = dbc.GalleryService.RevokeShareLink(gallery.ID, activeLinks[0].ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	err = dbc.GalleryService.RevokeShareLink(gallery.ID, activeLinks[0].ID)
+	if err == nil {
+		t.Errorf("expected error revoking a link twice, didn't get one")
+	}
+	activeLinks, _ = dbc.GalleryService.GetActiveShareLinksByGalleryId(gallery.ID)
+	if len(activeLinks) != 2 {
+		t.Errorf("got %d active links, want %d\n", len(activeLinks), 2)
+	}
+}
@@ -0,0 +1,340 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/oidc"
+)
+
+// OIDCAuthRequestDuration is how long a user has to sign in with a provider once they are sent to it
+const OIDCAuthRequestDuration = 10 * time.Minute
+
+// ExternalIdentity is a user's account with an OpenID Connect provider, as described by the ID token it signed in with
+type ExternalIdentity struct {
+	Provider string
+	// Subject is the provider's id for the account, which unlike the email address never changes
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Identity is an account with a provider that is linked to a user, so that the user can sign in with it
+type Identity struct {
+	ID       int
+	UserID   int
+	Provider string
+	// Email is the email address of the account with the provider when it was last used, which can differ from the user's
+	Email     string
+	CreatedAt time.Time
+	// LastUsedAt is the zero time for identities that have never been signed in with
+	LastUsedAt time.Time
+}
+
+// IdentitySignIn describes how LoginWithIdentity found the user it signed in
+type IdentitySignIn int
+
+const (
+	// IdentityAlreadyLinked is a sign in with an identity that was already linked to the user
+	IdentityAlreadyLinked IdentitySignIn = iota
+	// IdentityLinkedByEmail is a sign in that linked the identity to the user with the same email address
+	IdentityLinkedByEmail
+	// IdentityCreatedUser is a sign in that created a new user for the identity
+	IdentityCreatedUser
+)
+
+/*
+OIDCAuthRequest is a sign in with a provider that the user has been sent to the provider for, held until the provider
+sends them back. LinkUserID is set when a signed in user is linking an identity to their account instead.
+*/
+type OIDCAuthRequest struct {
+	oidc.AuthRequest
+	Provider   string
+	LinkUserID int
+}
+
+/*
+IdentityService holds the accounts with OpenID Connect providers that are linked to users, and the sign ins with
+providers that are waiting for the provider to send the user back. Only the hash of each sign in's state is stored, as
+the state is what the callback is looked up with.
+*/
+type IdentityService struct {
+	db *sql.DB
+}
+
+// SaveAuthRequest holds req until the provider sends the user back with its state
+func (is *IdentityService) SaveAuthRequest(req OIDCAuthRequest) error {
+	linkUserId := sql.NullInt64{Int64: int64(req.LinkUserID), Valid: req.LinkUserID != 0}
+	_, err := is.db.Exec(`
+		INSERT INTO oidc_auth_requests (state_hash, provider, nonce, code_verifier, link_user_id, expires_on)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`, HashSessionToken(req.State), req.Provider, req.Nonce, req.CodeVerifier, linkUserId,
+		time.Now().Add(OIDCAuthRequestDuration))
+	if err != nil {
+		return fmt.Errorf("save oidc auth request: %w", err)
+	}
+	return nil
+}
+
+// TakeAuthRequest returns the auth request with state and removes it, so that each can only be finished once
+func (is *IdentityService) TakeAuthRequest(state string) (OIDCAuthRequest, error) {
+	req := OIDCAuthRequest{}
+	var linkUserId sql.NullInt64
+	row := is.db.QueryRow(`
+		DELETE FROM oidc_auth_requests
+		WHERE state_hash = ($1)
+		AND expires_on > now()
+		RETURNING provider, nonce, code_verifier, link_user_id;
+	`, HashSessionToken(state))
+	err := row.Scan(&req.Provider, &req.Nonce, &req.CodeVerifier, &linkUserId)
+	if err != nil {
+		return OIDCAuthRequest{}, HandlePgError(err, &sqlNoRowsErrStruct{NoOIDCAuthRequestFound})
+	}
+	req.State = state
+	req.LinkUserID = int(linkUserId.Int64)
+	return req, nil
+}
+
+// DeleteExpiredAuthRequests deletes the auth requests that expired before now without the user being sent back
+func (is *IdentityService) DeleteExpiredAuthRequests(now time.Time) (int64, error) {
+	result, err := is.db.Exec(`
+		DELETE FROM oidc_auth_requests
+		WHERE expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired oidc auth requests: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetByUserId returns the identities linked to the user, in the order they were linked
+func (is *IdentityService) GetByUserId(userId int) ([]Identity, error) {
+	rows, err := is.db.Query(`
+		SELECT id, user_id, provider, email, created_at, last_used_at
+		FROM user_identities
+		WHERE user_id = ($1)
+		ORDER BY created_at, id;
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get identities: %w", err)
+	}
+	defer rows.Close()
+	identities := []Identity{}
+	for rows.Next() {
+		identity := Identity{}
+		var lastUsedAt sql.NullTime
+		err = rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Email, &identity.CreatedAt,
+			&lastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("get identities: %w", err)
+		}
+		identity.LastUsedAt = lastUsedAt.Time
+		identities = append(identities, identity)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("get identities: %w", err)
+	}
+	return identities, nil
+}
+
+/*
+Link links identity to a signed in user. It does not matter whether the email address of the identity is verified, or
+the same as the user's, as the user has just signed in to both. A user can only link one account of each provider.
+*/
+func (is *IdentityService) Link(userId int, identity ExternalIdentity) error {
+	tx, err := is.db.Begin()
+	if err != nil {
+		return fmt.Errorf("link identity: %w", err)
+	}
+	defer tx.Rollback()
+	linkedUserId, isLinked, err := updateLinkedIdentity(tx, identity)
+	if err != nil {
+		return err
+	}
+	if isLinked && linkedUserId != userId {
+		return MapHandledError(errors.New("identity is linked to another user"),
+			"that account is already linked to another user - sign in with it to unlink it first")
+	}
+	if !isLinked {
+		err = insertIdentity(tx, userId, identity)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("link identity: %w", err)
+	}
+	return nil
+}
+
+/*
+Unlink removes an identity from the signed in user, so it can no longer be used to sign in to their account. Users who
+signed up with a provider still have a password, which they can set with the forgot password link.
+*/
+func (is *IdentityService) Unlink(userId int, identityId int) error {
+	result, err := is.db.Exec(`
+		DELETE FROM user_identities
+		WHERE id = ($1)
+		AND user_id = ($2);
+	`, identityId, userId)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	numRowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	if numRowsAffected == 0 {
+		return HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoIdentityFound})
+	}
+	return nil
+}
+
+/*
+LoginWithIdentity signs in the user that identity is linked to. An identity that is not linked yet is linked to the user
+with the same email address, or a new user is created for it if there is none - but only if the provider has verified
+the email address, as otherwise anyone could sign up with a provider using someone else's address to take over their
+account. For the same reason, a user whose email address was never verified may have been signed up by someone else
+before its owner arrived, so every way of signing in to it is taken away with takeOverUnverifiedUser before the identity
+is linked. Users with two factor authentication enabled still have to enter a code, in which case a TwoFactorRequiredError
+is returned as with LoginUser.
+*/
+func (us *UserService) LoginWithIdentity(identity ExternalIdentity) (*UserIdToSession, IdentitySignIn, error) {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return nil, 0, MapHandledGenericError(err)
+	}
+	defer tx.Rollback()
+	signIn := IdentityAlreadyLinked
+	userId, isLinked, err := updateLinkedIdentity(tx, identity)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isLinked {
+		email := strings.ToLower(strings.TrimSpace(identity.Email))
+		if !identity.EmailVerified || !isValidEmail(email) {
+			return nil, 0, MapHandledError(errors.New("identity email is not verified"),
+				"the email address of the account you signed in with has not been verified, so it cannot be used to sign in")
+		}
+		var isEmailVerified bool
+		row := tx.QueryRow(`
+			SELECT id, email_verified_at IS NOT NULL
+			FROM users
+			WHERE email = ($1)
+			FOR UPDATE;
+		`, email)
+		err = row.Scan(&userId, &isEmailVerified)
+		signIn = IdentityLinkedByEmail
+		if errors.Is(err, sql.ErrNoRows) {
+			userId, err = insertIdentityUser(tx, email)
+			signIn = IdentityCreatedUser
+		} else if err == nil && !isEmailVerified {
+			err = takeOverUnverifiedUser(tx, userId)
+		}
+		if err != nil {
+			return nil, 0, HandlePgError(err, nil)
+		}
+		err = insertIdentity(tx, userId, identity)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	var isTwoFactorEnabled bool
+	row := tx.QueryRow(`
+		SELECT totp_enabled_at IS NOT NULL
+		FROM users
+		WHERE id = ($1);
+	`, userId)
+	err = row.Scan(&isTwoFactorEnabled)
+	if err != nil {
+		return nil, 0, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, MapHandledGenericError(err)
+	}
+	if isTwoFactorEnabled {
+		token, err := us.twoFactorService.createChallenge(userId)
+		if err != nil {
+			return nil, 0, MapHandledGenericError(err)
+		}
+		return nil, signIn, &TwoFactorRequiredError{userId, token}
+	}
+	user, err := us.startSession(internalUserStruct{ID: userId})
+	return user, signIn, err
+}
+
+/*
+returns the user identity is linked to, if it is linked, and records that it was used. The email address is updated, as
+the user may have changed it with the provider since the identity was linked.
+*/
+func updateLinkedIdentity(tx *sql.Tx, identity ExternalIdentity) (userId int, isLinked bool, err error) {
+	row := tx.QueryRow(`
+		UPDATE user_identities
+		SET email = ($3),
+			last_used_at = now()
+		WHERE provider = ($1)
+		AND subject = ($2)
+		RETURNING user_id;
+	`, identity.Provider, identity.Subject, identity.Email)
+	err = row.Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, MapHandledGenericError(err)
+	}
+	return userId, true, nil
+}
+
+func insertIdentity(tx *sql.Tx, userId int, identity ExternalIdentity) error {
+	var isProviderLinked bool
+	row := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = ($1) AND provider = ($2));
+	`, userId, identity.Provider)
+	err := row.Scan(&isProviderLinked)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	if isProviderLinked {
+		return MapHandledError(errors.New("user has an identity of the provider linked"),
+			"another account with this provider is already linked to your account - unlink it first")
+	}
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email, last_used_at)
+		VALUES ($1, $2, $3, $4, now());
+	`, userId, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	return nil
+}
+
+/*
+creates the user for an identity that is signing in for the first time. Users must have a password, so they are given a
+random one that nobody knows - they can set one of their own with the forgot password link if they want to sign in
+without the provider.
+*/
+func insertIdentityUser(tx *sql.Tx, email string) (int, error) {
+	password, _, err := tManager.New()
+	if err != nil {
+		return 0, err
+	}
+	hash, err := GenerateBcryptHash(password)
+	if err != nil {
+		return 0, err
+	}
+	var userId int
+	row := tx.QueryRow(`
+		INSERT INTO users (email, password_hash, email_verified_at)
+		VALUES ($1, $2, now())
+		RETURNING id;
+	`, email, hash)
+	err = row.Scan(&userId)
+	return userId, err
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/oidc"
+	"github.com/sohWenMing/lenslocked/totp"
+	"github.com/sohWenMing/lenslocked/webauthn/webauthntest"
+)
+
+func TestLoginWithIdentity(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+
+	unverified := ExternalIdentity{"stub", "unverified-subject", "test_user@gmail.com", false}
+	_, _, err := dbc.UserService.LoginWithIdentity(unverified)
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error signing in with an unverified email, got %v\n", err)
+	}
+
+	identity := ExternalIdentity{"stub", "linked-subject", "Test_User@gmail.com", true}
+	user, signIn, err := dbc.UserService.LoginWithIdentity(identity)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if user.ID != userId || signIn != IdentityLinkedByEmail {
+		t.Errorf("got user %d %v, want user %d linked by email\n", user.ID, signIn, userId)
+	}
+	// the user had verified their email address, so they can still sign in with their password
+	_, err = dbc.UserService.LoginUser(UserEmailToPlainTextPassword{"test_user@gmail.com", "Holoq123holoq123"})
+	if err != nil {
+		t.Errorf("didn't expect error signing in with the password of a verified user, got %v\n", err)
+	}
+	// once linked the identity signs in to the same user, even after its email address changes
+	identity.Email = "someone_else@gmail.com"
+	identity.EmailVerified = false
+	user, signIn, err = dbc.UserService.LoginWithIdentity(identity)
+	if err != nil || user.ID != userId || signIn != IdentityAlreadyLinked {
+		t.Errorf("got user %+v %v %v, want user %d already linked\n", user, signIn, err, userId)
+	}
+	identities, err := dbc.IdentityService.GetByUserId(userId)
+	if err != nil || len(identities) != 1 || identities[0].Email != "someone_else@gmail.com" {
+		t.Errorf("got %+v %v, want the identity with its new email\n", identities, err)
+	}
+
+	// a user can only link one account of each provider
+	err = dbc.IdentityService.Link(userId, ExternalIdentity{"stub", "other-subject", "test_user@gmail.com", true})
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error linking a second account of a provider, got %v\n", err)
+	}
+
+	newIdentity := ExternalIdentity{"stub", "new-subject", "test_identity_user@gmail.com", true}
+	newUser, signIn, err := dbc.UserService.LoginWithIdentity(newIdentity)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.UserService.DeleteUserAndSession(newUser.ID)
+	if signIn != IdentityCreatedUser {
+		t.Errorf("got %v, want a new user to be created\n", signIn)
+	}
+	newUserInfo, err := dbc.UserService.GetUserById(newUser.ID)
+	if err != nil || !newUserInfo.EmailVerified {
+		t.Errorf("got %+v %v, want the new user's email to be verified\n", newUserInfo, err)
+	}
+	err = dbc.IdentityService.Link(userId, newIdentity)
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error linking an identity of another user, got %v\n", err)
+	}
+
+	err = dbc.IdentityService.Unlink(newUser.ID, identities[0].ID)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error unlinking the identity of another user, got %v\n", err)
+	}
+	err = dbc.IdentityService.Unlink(userId, identities[0].ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+}
+
+func TestLoginWithIdentityUnverifiedUser(t *testing.T) {
+	// someone signs up with an address they do not own, which is never verified
+	squatter := UserEmailToPlainTextPassword{"test_unverified_user@gmail.com", "Holoq123holoq123"}
+	squatterUser, err := dbc.UserService.CreateUser(squatter)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.UserService.DeleteUserAndSession(squatterUser.UserID)
+	credentials := setUpSquatterCredentials(t, squatterUser.UserID, squatter)
+
+	identity := ExternalIdentity{"stub", "owner-subject", "test_unverified_user@gmail.com", true}
+	user, signIn, err := dbc.UserService.LoginWithIdentity(identity)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if user.ID != squatterUser.UserID || signIn != IdentityLinkedByEmail {
+		t.Errorf("got user %d %v, want user %d linked by email\n", user.ID, signIn, squatterUser.UserID)
+	}
+	checkSquatterCredentialsGone(t, user.ID, squatter, credentials)
+	identities, err := dbc.IdentityService.GetByUserId(user.ID)
+	if err != nil || len(identities) != 1 || identities[0].Provider != "stub" {
+		t.Errorf("got %+v %v, want only the identity just linked\n", identities, err)
+	}
+}
+
+// the ways of signing in that someone who signed up with an address they do not own could have set up
+type squatterCredentials struct {
+	apiToken       string
+	magicLinkToken string
+	twoFactorToken string
+	pendingPasskey []byte
+	linkedIdentity ExternalIdentity
+}
+
+func setUpSquatterCredentials(t *testing.T, userId int, squatter UserEmailToPlainTextPassword) squatterCredentials {
+	t.Helper()
+	credentials := squatterCredentials{
+		linkedIdentity: ExternalIdentity{"other", "squatter-subject", "squatter@gmail.com", true},
+	}
+	apiToken, err := dbc.APITokenService.Create(userId, "squatter", ScopeWrite)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	credentials.apiToken = apiToken.Token
+
+	authenticator := webauthntest.New(dbc.PasskeyService.RelyingParty)
+	options, err := dbc.PasskeyService.BeginRegistration(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	response, _, err := authenticator.Register(options)
+	if err == nil {
+		err = dbc.PasskeyService.FinishRegistration(userId, "squatter passkey", response)
+	}
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	// a registration that is started but not finished leaves a challenge behind
+	options, err = dbc.PasskeyService.BeginRegistration(userId)
+	if err == nil {
+		credentials.pendingPasskey, _, err = authenticator.Register(options)
+	}
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+
+	secret, err := dbc.TwoFactorService.BeginEnrollment(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	code, _ := totp.Code(secret, time.Now())
+	_, err = dbc.TwoFactorService.ConfirmEnrollment(userId, code)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	credentials.twoFactorToken, err = dbc.TwoFactorService.createChallenge(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+
+	err = dbc.IdentityService.Link(userId, credentials.linkedIdentity)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, _, err = dbc.EmailChangeService.Request(userId, squatter.PlainTextPassword, "test_squatter_new@gmail.com")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	credentials.magicLinkToken, _, err = dbc.MagicLinkService.NewToken(squatter.Email)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	return credentials
+}
+
+// checks that none of the credentials set up by setUpSquatterCredentials can be used any more
+func checkSquatterCredentialsGone(t *testing.T, userId int, squatter UserEmailToPlainTextPassword,
+	credentials squatterCredentials) {
+	t.Helper()
+	_, err := dbc.UserService.LoginUser(squatter)
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error signing in with the password set before the takeover, got %v\n", err)
+	}
+	// only the session that has just signed in is left
+	count, _ := dbc.SessionService.GetNonExpiredSessionsByUserId(userId)
+	if count != 1 {
+		t.Errorf("got %d sessions, want the sessions from before the takeover signed out\n", count)
+	}
+	_, err = dbc.APITokenService.Authenticate(credentials.apiToken)
+	if err == nil {
+		t.Errorf("expected error using an API token made before the takeover")
+	}
+	passkeys, err := dbc.PasskeyService.GetByUserId(userId)
+	if err != nil || len(passkeys) != 0 {
+		t.Errorf("got %+v %v, want the passkeys made before the takeover deleted\n", passkeys, err)
+	}
+	err = dbc.PasskeyService.FinishRegistration(userId, "squatter passkey", credentials.pendingPasskey)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error finishing a passkey registration begun before the takeover, got %v\n", err)
+	}
+	status, err := dbc.TwoFactorService.GetStatus(userId)
+	if err != nil || status.IsEnabled || status.RecoveryCodesLeft != 0 {
+		t.Errorf("got %+v %v, want two factor authentication turned off without recovery codes\n", status, err)
+	}
+	_, err = dbc.TwoFactorService.GetChallengeEmail(credentials.twoFactorToken)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error for a two factor challenge made before the takeover, got %v\n", err)
+	}
+	_, isFound, err := dbc.EmailChangeService.GetPending(userId)
+	if err != nil || isFound {
+		t.Errorf("got %t %v, want the pending email change cancelled\n", isFound, err)
+	}
+	_, err = dbc.UserService.LoginWithMagicLink(credentials.magicLinkToken)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error signing in with a link sent before the takeover, got %v\n", err)
+	}
+	identities, err := dbc.IdentityService.GetByUserId(userId)
+	for _, identity := range identities {
+		if identity.Provider == credentials.linkedIdentity.Provider {
+			t.Errorf("got %+v, want the identity linked before the takeover unlinked\n", identity)
+		}
+	}
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	userInfo, err := dbc.UserService.GetUserById(userId)
+	if err != nil || !userInfo.EmailVerified {
+		t.Errorf("got %+v %v, want the user's email to be verified\n", userInfo, err)
+	}
+}
+
+func TestTakeAuthRequest(t *testing.T) {
+	authRequest, err := oidc.NewAuthRequest()
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	err = dbc.IdentityService.SaveAuthRequest(OIDCAuthRequest{AuthRequest: authRequest, Provider: "stub"})
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	req, err := dbc.IdentityService.TakeAuthRequest(authRequest.State)
+	if err != nil || req.AuthRequest != authRequest || req.Provider != "stub" || req.LinkUserID != 0 {
+		t.Errorf("got %+v %v, want the saved auth request\n", req, err)
+	}
+	_, err = dbc.IdentityService.TakeAuthRequest(authRequest.State)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error taking an auth request twice, got %v\n", err)
+	}
+}
@@ -0,0 +1,593 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/imaging"
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+/*
+Image houses the fields that map to the database record kept for every image uploaded to a gallery. The camera fields
+are read from the EXIF data of the upload, and are left at their zero values for images that did not carry any. Width
+and Height are the dimensions after the EXIF orientation has been applied.
+*/
+type Image struct {
+	ID           int
+	GalleryID    int
+	UploadedBy   int
+	Filename     string
+	ContentType  string
+	SizeBytes    int64
+	Width        int
+	Height       int
+	Position     int
+	Caption      string
+	UploadedAt   time.Time
+	TakenAt      time.Time
+	CameraMake   string
+	CameraModel  string
+	LensModel    string
+	ExposureTime string
+	FNumber      float64
+	ISO          int
+	FocalLength  float64
+	Orientation  int
+}
+
+const imageColumns = `images.id, images.gallery_id, images.uploaded_by, images.filename, images.content_type,
+	images.size_bytes, images.width, images.height, images.position, images.caption, images.uploaded_at,
+	images.taken_at, images.camera_make, images.camera_model, images.lens_model, images.exposure_time,
+	images.f_number, images.iso, images.focal_length, images.orientation`
+
+// ErrImageExists is returned when an upload would replace an image that the uploader is not allowed to manage
+var ErrImageExists = MapHandledError(errors.New("image already exists"),
+	"an image with this name has already been uploaded to this gallery - please rename the file and try again")
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanImage(row rowScanner) (*Image, error) {
+	var img Image
+	var uploadedBy sql.NullInt64
+	var takenAt sql.NullTime
+	err := row.Scan(&img.ID, &img.GalleryID, &uploadedBy, &img.Filename, &img.ContentType,
+		&img.SizeBytes, &img.Width, &img.Height, &img.Position, &img.Caption, &img.UploadedAt,
+		&takenAt, &img.CameraMake, &img.CameraModel, &img.LensModel, &img.ExposureTime,
+		&img.FNumber, &img.ISO, &img.FocalLength, &img.Orientation)
+	if err != nil {
+		return nil, err
+	}
+	img.UploadedBy = int(uploadedBy.Int64)
+	img.TakenAt = takenAt.Time
+	return &img, nil
+}
+
+/*
+CreateImage records an image in the images table and writes its contents to the store, along with the resized variants
+generated by imaging.Process. Both happen in a single transaction - if the bytes cannot be stored, the record is rolled
+back. Uploading a file with the same name as an existing image in the gallery replaces that image, if the uploader's
+role allows them to manage it - otherwise ErrImageExists is returned, so contributors cannot replace the images of others.
+
+The EXIF data of the upload is recorded on the image, and unless the gallery has KeepPhotoMetadata set, the stored
+copy has its metadata (GPS coordinates and serial numbers included) stripped and is rotated to display upright.
+*/
+func (service *GalleryService) CreateImage(galleryId int, uploaderId int, filename string, contents io.Reader) (*Image, error) {
+	filename = cleanImageFilename(filename)
+	if filename == "" {
+		return nil, errors.New("image filename cannot be blank")
+	}
+	imageBytes, err := io.ReadAll(contents)
+	if err != nil {
+		return nil, fmt.Errorf("reading image contents: %w", err)
+	}
+	gallery, err := service.GetById(galleryId)
+	if err != nil {
+		return nil, err
+	}
+	processed, err := imaging.Process(imageBytes, gallery.KeepPhotoMetadata)
+	if errors.Is(err, imaging.ErrTooManyPixels) {
+		return nil, MapHandledError(err, fmt.Sprintf("%s is too large - images can have at most %d megapixels",
+			filename, imaging.MaxPixels/1000000))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("processing image %s: %w", filename, err)
+	}
+	contentType := http.DetectContentType(processed.Contents)
+	metadata := processed.Metadata
+	takenAt := sql.NullTime{Time: metadata.CapturedAt, Valid: !metadata.CapturedAt.IsZero()}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("create image: %w", err)
+	}
+	defer tx.Rollback()
+
+	// the image being replaced is locked, so it cannot change hands before the replacement is committed
+	existing, err := scanImage(tx.QueryRow(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE images.gallery_id = ($1)
+		AND images.filename = ($2)
+		FOR UPDATE;
+	`, galleryId, filename))
+	if err == nil {
+		role, err := service.GetUserRole(gallery, uploaderId)
+		if err != nil {
+			return nil, err
+		}
+		if !role.CanManageImage(existing, uploaderId) {
+			return nil, ErrImageExists
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("create image: %w", err)
+	}
+
+	row := tx.QueryRow(`
+		INSERT INTO images (gallery_id, uploaded_by, filename, content_type, size_bytes, width, height, position,
+			taken_at, camera_make, camera_model, lens_model, exposure_time, f_number, iso, focal_length, orientation)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7,
+			(SELECT COALESCE(MAX(position) + 1, 0) FROM images WHERE gallery_id = $1),
+			$8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (gallery_id, filename) DO UPDATE
+		SET uploaded_by = EXCLUDED.uploaded_by,
+			content_type = EXCLUDED.content_type,
+			size_bytes = EXCLUDED.size_bytes,
+			width = EXCLUDED.width,
+			height = EXCLUDED.height,
+			uploaded_at = now(),
+			taken_at = EXCLUDED.taken_at,
+			camera_make = EXCLUDED.camera_make,
+			camera_model = EXCLUDED.camera_model,
+			lens_model = EXCLUDED.lens_model,
+			exposure_time = EXCLUDED.exposure_time,
+			f_number = EXCLUDED.f_number,
+			iso = EXCLUDED.iso,
+			focal_length = EXCLUDED.focal_length,
+			orientation = EXCLUDED.orientation
+		RETURNING `+imageColumns+`;
+	`, galleryId, uploaderId, filename, contentType, len(processed.Contents), processed.Width, processed.Height,
+		takenAt, metadata.CameraMake, metadata.CameraModel, metadata.LensModel, metadata.ExposureTime,
+		metadata.FNumber, metadata.ISO, metadata.FocalLength, metadata.Orientation)
+	img, err := scanImage(row)
+	if err != nil {
+		return nil, HandlePgError(err, nil)
+	}
+
+	err = service.Store.Put(service.ImageKey(galleryId, filename), bytes.NewReader(processed.Contents))
+	if err != nil {
+		return nil, fmt.Errorf("storing image for gallery-%d: %w", galleryId, err)
+	}
+	err = service.storeImageVariants(galleryId, filename, processed.Variants)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("create image: %w", err)
+	}
+	return img, nil
+}
+
+/*
+stores every resized variant of an image. Variants left over from a previous upload with the same name are removed
+first, as a smaller replacement image may not produce them all.
+*/
+func (service *GalleryService) storeImageVariants(galleryId int, filename string, generated []imaging.GeneratedVariant) error {
+	for _, variant := range imaging.Variants {
+		err := service.Store.Delete(service.ImageVariantKey(galleryId, filename, variant.Name))
+		if err != nil {
+			return fmt.Errorf("removing old %s variant: %w", variant.Name, err)
+		}
+	}
+	for _, variant := range generated {
+		err := service.Store.Put(service.ImageVariantKey(galleryId, filename, variant.Name), bytes.NewReader(variant.Contents))
+		if err != nil {
+			return fmt.Errorf("storing %s variant for gallery-%d: %w", variant.Name, galleryId, err)
+		}
+	}
+	return nil
+}
+
+// GetImagesByGalleryId returns the records of every image in a gallery, in display order
+func (service *GalleryService) GetImagesByGalleryId(galleryId int) ([]*Image, error) {
+	rows, err := service.DB.Query(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE images.gallery_id = ($1)
+		ORDER BY images.position, images.id;
+	`, galleryId)
+	returnedImages := []*Image{}
+	if err != nil {
+		return returnedImages, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return []*Image{}, err
+		}
+		returnedImages = append(returnedImages, img)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*Image{}, err
+	}
+	return returnedImages, nil
+}
+
+// GetImagePageByGalleryId returns a page of the images in a gallery in display order, along with the total number of
+// images in the gallery
+func (service *GalleryService) GetImagePageByGalleryId(galleryId int, page Page) ([]*Image, int, error) {
+	var total int
+	err := service.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM images
+		WHERE images.gallery_id = ($1);
+	`, galleryId).Scan(&total)
+	if err != nil {
+		return []*Image{}, 0, HandlePgError(err, nil)
+	}
+	rows, err := service.DB.Query(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE images.gallery_id = ($1)
+		ORDER BY images.position, images.id
+		LIMIT ($2) OFFSET ($3);
+	`, galleryId, page.Size, page.Offset())
+	returnedImages := []*Image{}
+	if err != nil {
+		return returnedImages, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return []*Image{}, 0, err
+		}
+		returnedImages = append(returnedImages, img)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []*Image{}, 0, err
+	}
+	return returnedImages, total, nil
+}
+
+/*
+ReorderImages sets the display order of the images in a gallery to the order of the input filenames. Every image in the
+gallery must be listed exactly once, so that a client working from a stale list cannot leave images out of order.
+*/
+func (service *GalleryService) ReorderImages(galleryId int, filenames []string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("reorder images: %w", err)
+	}
+	defer tx.Rollback()
+	var numImages int
+	err = tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM images
+		WHERE gallery_id = ($1);
+	`, galleryId).Scan(&numImages)
+	if err != nil {
+		return fmt.Errorf("reorder images: %w", err)
+	}
+	if numImages != len(filenames) {
+		return MapHandledError(fmt.Errorf("gallery-%d has %d images, %d were ordered", galleryId, numImages, len(filenames)),
+			"every image in the gallery must be listed exactly once")
+	}
+	seen := make(map[string]bool, len(filenames))
+	for position, filename := range filenames {
+		filename = cleanImageFilename(filename)
+		if seen[filename] {
+			return MapHandledError(fmt.Errorf("%s was ordered twice", filename),
+				"every image in the gallery must be listed exactly once")
+		}
+		seen[filename] = true
+		result, err := tx.Exec(`
+			UPDATE images
+			SET position = ($1)
+			WHERE gallery_id = ($2)
+			AND filename = ($3);
+		`, position, galleryId, filename)
+		if err != nil {
+			return fmt.Errorf("reorder images: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("reorder images: %w", err)
+		}
+		if rowsAffected == 0 {
+			return MapHandledError(sql.ErrNoRows, NoImageFound.String())
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("reorder images: %w", err)
+	}
+	return nil
+}
+
+func (service *GalleryService) GetImage(galleryId int, filename string) (*Image, error) {
+	row := service.DB.QueryRow(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE images.gallery_id = ($1)
+		AND images.filename = ($2);
+	`, galleryId, cleanImageFilename(filename))
+	img, err := scanImage(row)
+	if err != nil {
+		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoImageFound})
+	}
+	return img, nil
+}
+
+/*
+OpenImage returns a reader for the contents of an image along with its record. The reader must be closed by the
+caller. If either the record or the stored bytes cannot be found, IsImageNotFoundErr will report true for the error.
+
+size is the name of one of imaging.Variants, or blank for the original. If the variant has not been stored (the
+original is smaller than the variant, or was uploaded before variants existed) the original is returned instead.
+*/
+func (service *GalleryService) OpenImage(galleryId int, filename string, size string) (io.ReadCloser, *Image, error) {
+	img, err := service.GetImage(galleryId, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, isVariant := imaging.VariantByName(size); isVariant {
+		contents, err := service.Store.Get(service.ImageVariantKey(galleryId, img.Filename, size))
+		if err == nil {
+			return contents, img, nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, nil, fmt.Errorf("opening %s variant of image %s: %w", size, img.Filename, err)
+		}
+	}
+	contents, err := service.Store.Get(service.ImageKey(galleryId, img.Filename))
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening image %s: %w", img.Filename, err)
+	}
+	return contents, img, nil
+}
+
+// DeleteImage removes the record of an image and its stored contents, in a single transaction
+func (service *GalleryService) DeleteImage(galleryId int, filename string) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("delete image: %w", err)
+	}
+	defer tx.Rollback()
+	row := tx.QueryRow(`
+		DELETE FROM images
+		WHERE gallery_id = ($1)
+		AND filename = ($2)
+		RETURNING filename;
+	`, galleryId, cleanImageFilename(filename))
+	var deletedFilename string
+	err = row.Scan(&deletedFilename)
+	if err != nil {
+		return HandlePgError(err, &sqlNoRowsErrStruct{NoImageFound})
+	}
+	err = service.Store.Delete(service.ImageKey(galleryId, deletedFilename))
+	if err != nil {
+		return fmt.Errorf("deleting image %s: %w", deletedFilename, err)
+	}
+	for _, variant := range imaging.Variants {
+		err = service.Store.Delete(service.ImageVariantKey(galleryId, deletedFilename, variant.Name))
+		if err != nil {
+			return fmt.Errorf("deleting %s variant of image %s: %w", variant.Name, deletedFilename, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("delete image: %w", err)
+	}
+	return nil
+}
+
+func (service *GalleryService) UpdateImageCaption(galleryId int, filename string, caption string) error {
+	result, err := service.DB.Exec(`
+		UPDATE images
+		SET caption = ($1)
+		WHERE gallery_id = ($2)
+		AND filename = ($3);
+	`, strings.TrimSpace(caption), galleryId, cleanImageFilename(filename))
+	if err != nil {
+		return fmt.Errorf("update image caption %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update image caption %w", err)
+	}
+	if rowsAffected == 0 {
+		return MapHandledError(sql.ErrNoRows, NoImageFound.String())
+	}
+	return nil
+}
+
+// deletes every object that is kept in the store for a gallery. Used once the gallery's records have been deleted
+func (service *GalleryService) deleteStoredGallery(galleryId int) error {
+	objects, err := service.Store.List(service.GalleryPrefix(galleryId))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		err = service.Store.Delete(object.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+DeleteOrphanedImages deletes the images in the store that belong to galleries that no longer exist, which are left
+behind when deleting the images of a gallery fails part way through. Images modified since olderThan are kept, in case
+they belong to a gallery being created. If the store keeps directories, the empty ones are pruned as well.
+
+The number of images deleted is returned.
+*/
+func (service *GalleryService) DeleteOrphanedImages(olderThan time.Time) (int64, error) {
+	// the store is listed before the galleries are read, so any gallery that has images in the listing is read too
+	objects, err := service.Store.List("")
+	if err != nil {
+		return 0, fmt.Errorf("delete orphaned images: %w", err)
+	}
+	galleryIds, err := service.getAllGalleryIds()
+	if err != nil {
+		return 0, fmt.Errorf("delete orphaned images: %w", err)
+	}
+	var numDeleted int64
+	for _, object := range objects {
+		prefix, _, _ := strings.Cut(object.Key, "/")
+		galleryId, err := strconv.Atoi(prefix)
+		// objects that are not under a gallery prefix were not put there by the GalleryService, so are left alone
+		if err != nil || galleryIds[galleryId] || object.LastModified.After(olderThan) {
+			continue
+		}
+		err = service.Store.Delete(object.Key)
+		if err != nil {
+			return numDeleted, fmt.Errorf("delete orphaned images: %w", err)
+		}
+		numDeleted++
+	}
+	if pruner, ok := service.Store.(storage.DirPruner); ok {
+		_, err = pruner.PruneEmptyDirs(olderThan)
+		if err != nil {
+			return numDeleted, fmt.Errorf("delete orphaned images: %w", err)
+		}
+	}
+	return numDeleted, nil
+}
+
+/*
+BackfillImages records the images that were put in the store before the images table existed, when the images of a
+gallery were found by listing its directory. Without a record, those images are not shown and cannot be deleted.
+
+Every original under a gallery that still exists and has no record is recorded as uploaded by the gallery's owner,
+after the gallery's recorded images in filename order. Resized variants, files that are not images and files under
+galleries that no longer exist are skipped. It is safe to run more than once. The number of images recorded is returned.
+*/
+func (service *GalleryService) BackfillImages() (int64, error) {
+	objects, err := service.Store.List("")
+	if err != nil {
+		return 0, fmt.Errorf("backfill images: %w", err)
+	}
+	galleryIds, err := service.getAllGalleryIds()
+	if err != nil {
+		return 0, fmt.Errorf("backfill images: %w", err)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	var numRecorded int64
+	for _, object := range objects {
+		prefix, filename, _ := strings.Cut(object.Key, "/")
+		galleryId, err := strconv.Atoi(prefix)
+		// variants sit in a directory named after the variant, so they still have a slash in their filename
+		if err != nil || !galleryIds[galleryId] || strings.Contains(filename, "/") ||
+			!slices.Contains(service.GetImageExtensions(), strings.ToLower(path.Ext(filename))) {
+			continue
+		}
+		isRecorded, err := service.backfillImage(galleryId, filename, object)
+		if err != nil {
+			return numRecorded, fmt.Errorf("backfill images: %w", err)
+		}
+		if isRecorded {
+			numRecorded++
+		}
+	}
+	return numRecorded, nil
+}
+
+// records a single image found in the store by BackfillImages. isRecorded is false if it already had a record
+func (service *GalleryService) backfillImage(galleryId int, filename string, object storage.ObjectInfo) (isRecorded bool, err error) {
+	contents, err := service.Store.Get(object.Key)
+	if err != nil {
+		return false, err
+	}
+	imageBytes, err := io.ReadAll(contents)
+	contents.Close()
+	if err != nil {
+		return false, fmt.Errorf("reading image %s: %w", object.Key, err)
+	}
+	contentType := http.DetectContentType(imageBytes)
+	if !slices.Contains(service.GetAllowableContentTypes(), contentType) {
+		return false, nil
+	}
+	// images that cannot be decoded are still recorded, so that they can be deleted, but with unknown dimensions
+	config, _, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+	if err != nil {
+		config = image.Config{}
+	}
+	result, err := service.DB.Exec(`
+		INSERT INTO images (gallery_id, uploaded_by, filename, content_type, size_bytes, width, height, position,
+			uploaded_at)
+		SELECT galleries.id, galleries.user_id, $2, $3, $4, $5, $6,
+			(SELECT COALESCE(MAX(position) + 1, 0) FROM images WHERE gallery_id = $1), $7
+		FROM galleries
+		WHERE galleries.id = ($1)
+		ON CONFLICT (gallery_id, filename) DO NOTHING;
+	`, galleryId, filename, contentType, len(imageBytes), config.Width, config.Height, object.LastModified)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (service *GalleryService) getAllGalleryIds() (map[int]bool, error) {
+	rows, err := service.DB.Query(`SELECT id FROM galleries;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	galleryIds := map[int]bool{}
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		galleryIds[id] = true
+	}
+	return galleryIds, rows.Err()
+}
+
+/*
+IsImageNotFoundErr reports whether err was caused by an image that could not be found, either because there is no
+record of it or because its contents are missing from the store
+*/
+func IsImageNotFoundErr(err error) bool {
+	return errors.Is(err, storage.ErrObjectNotFound) || IsNoRowsErr(err)
+}
+
+// only the base of the filename is kept, so that a filename can never point outside of its gallery
+func cleanImageFilename(filename string) string {
+	base := path.Base(filepath.ToSlash(strings.TrimSpace(filename)))
+	if base == "." || base == "/" || base == ".." {
+		return ""
+	}
+	return base
+}
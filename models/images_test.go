@@ -0,0 +1,251 @@
+package models
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/storage"
+)
+
+func TestCreateAndDeleteImage(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	gallery, err := dbc.GalleryService.Create("image_test_gallery", userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	pngBytes := testPNG(t, 4, 3)
+	for _, filename := range []string{"first.png", "../second.png"} {
+		_, err := dbc.GalleryService.CreateImage(gallery.ID, userIdToSession.UserID, filename, bytes.NewReader(pngBytes))
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+			return
+		}
+	}
+
+	images, err := dbc.GalleryService.GetImagesByGalleryId(gallery.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(images) != 2 {
+		t.Errorf("got %d images, want %d\n", len(images), 2)
+		return
+	}
+	type test struct {
+		name             string
+		got              *Image
+		expectedFilename string
+		expectedPosition int
+	}
+	tests := []test{
+		{"first image is recorded", images[0], "first.png", 0},
+		{"second image has path stripped", images[1], "second.png", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.got.Filename != test.expectedFilename {
+				t.Errorf("got %s, want %s\n", test.got.Filename, test.expectedFilename)
+			}
+			if test.got.Position != test.expectedPosition {
+				t.Errorf("got %d, want %d\n", test.got.Position, test.expectedPosition)
+			}
+			if test.got.Width != 4 || test.got.Height != 3 {
+				t.Errorf("got %dx%d, want %dx%d\n", test.got.Width, test.got.Height, 4, 3)
+			}
+			if test.got.ContentType != "image/png" {
+				t.Errorf("got %s, want %s\n", test.got.ContentType, "image/png")
+			}
+			if test.got.UploadedBy != userIdToSession.UserID {
+				t.Errorf("got %d, want %d\n", test.got.UploadedBy, userIdToSession.UserID)
+			}
+		})
+	}
+
+	contents, _, err := dbc.GalleryService.OpenImage(gallery.ID, "first.png", "")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	readBytes, _ := io.ReadAll(contents)
+	contents.Close()
+	if !bytes.Equal(readBytes, pngBytes) {
+		t.Errorf("stored contents did not match uploaded contents")
+	}
+
+	err = dbc.GalleryService.DeleteImage(gallery.ID, "first.png")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, _, err = dbc.GalleryService.OpenImage(gallery.ID, "first.png", "")
+	if !IsImageNotFoundErr(err) {
+		t.Errorf("expected image not found error, got %v\n", err)
+	}
+	err = dbc.GalleryService.DeleteImage(gallery.ID, "first.png")
+	if !IsImageNotFoundErr(err) {
+		t.Errorf("expected image not found error, got %v\n", err)
+	}
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImagePagesAndReorder(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	gallery, err := dbc.GalleryService.Create("reorder_test_gallery", userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	pngBytes := testPNG(t, 4, 3)
+	for _, filename := range []string{"a.png", "b.png", "c.png"} {
+		_, err := dbc.GalleryService.CreateImage(gallery.ID, userIdToSession.UserID, filename, bytes.NewReader(pngBytes))
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+			return
+		}
+	}
+
+	err = dbc.GalleryService.ReorderImages(gallery.ID, []string{"c.png", "a.png"})
+	if err == nil {
+		t.Errorf("expected error when an image is left out, didn't get one")
+	}
+	err = dbc.GalleryService.ReorderImages(gallery.ID, []string{"c.png", "a.png", "a.png"})
+	if err == nil {
+		t.Errorf("expected error when an image is listed twice, didn't get one")
+	}
+	err = dbc.GalleryService.ReorderImages(gallery.ID, []string{"c.png", "a.png", "b.png"})
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+
+	type test struct {
+		name              string
+		page              Page
+		expectedFilenames []string
+	}
+	tests := []test{
+		{"first page", NewPage(1, 2), []string{"c.png", "a.png"}},
+		{"last page", NewPage(2, 2), []string{"b.png"}},
+		{"page past the end", NewPage(3, 2), []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			images, total, err := dbc.GalleryService.GetImagePageByGalleryId(gallery.ID, test.page)
+			if err != nil {
+				t.Errorf("didn't expect error, got %v\n", err)
+				return
+			}
+			if total != 3 {
+				t.Errorf("got total %d, want %d\n", total, 3)
+			}
+			if len(images) != len(test.expectedFilenames) {
+				t.Errorf("got %d images, want %d\n", len(images), len(test.expectedFilenames))
+				return
+			}
+			for i, img := range images {
+				if img.Filename != test.expectedFilenames[i] {
+					t.Errorf("got %s, want %s\n", img.Filename, test.expectedFilenames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBackfillImages(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+
+	originalStore := dbc.GalleryService.Store
+	dbc.GalleryService.Store = storage.NewLocalStore(t.TempDir())
+	defer func() {
+		dbc.GalleryService.Store = originalStore
+	}()
+
+	gallery, err := dbc.GalleryService.Create("backfill_test_gallery", userIdToSession.UserID)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.GalleryService.DeleteById(gallery.ID)
+
+	pngBytes := testPNG(t, 4, 3)
+	_, err = dbc.GalleryService.CreateImage(gallery.ID, userIdToSession.UserID, "recorded.png", bytes.NewReader(pngBytes))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	// only the first of these is an original that was stored without a record
+	for key, contents := range map[string][]byte{
+		dbc.GalleryService.ImageKey(gallery.ID, "old.png"):                     pngBytes,
+		dbc.GalleryService.ImageVariantKey(gallery.ID, "old.png", "thumbnail"): pngBytes,
+		dbc.GalleryService.ImageKey(gallery.ID, "notes.txt"):                   []byte("not an image"),
+		dbc.GalleryService.ImageKey(gallery.ID+1000000, "deleted_gallery.png"): pngBytes,
+	} {
+		err = dbc.GalleryService.Store.Put(key, bytes.NewReader(contents))
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+	}
+
+	numRecorded, err := dbc.GalleryService.BackfillImages()
+	if err != nil || numRecorded != 1 {
+		t.Fatalf("got %d %v, want 1 image recorded\n", numRecorded, err)
+	}
+	numRecorded, err = dbc.GalleryService.BackfillImages()
+	if err != nil || numRecorded != 0 {
+		t.Errorf("got %d %v, want no images recorded a second time\n", numRecorded, err)
+	}
+	images, err := dbc.GalleryService.GetImagesByGalleryId(gallery.ID)
+	if err != nil || len(images) != 2 {
+		t.Fatalf("got %d images %v, want 2\n", len(images), err)
+	}
+	backfilled := images[1]
+	if backfilled.Filename != "old.png" || backfilled.Position != 1 || backfilled.UploadedBy != userIdToSession.UserID ||
+		backfilled.Width != 4 || backfilled.Height != 3 || backfilled.ContentType != "image/png" {
+		t.Errorf("got %+v, want old.png recorded after recorded.png as uploaded by the owner\n", backfilled)
+	}
+	err = dbc.GalleryService.DeleteImage(gallery.ID, "old.png")
+	if err != nil {
+		t.Errorf("didn't expect error deleting a backfilled image, got %v\n", err)
+	}
+}
@@ -5,9 +5,15 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sohWenMing/lenslocked/helpers"
+	"github.com/sohWenMing/lenslocked/oidc"
+	"github.com/sohWenMing/lenslocked/ratelimit"
+	"github.com/sohWenMing/lenslocked/storage"
+	"github.com/sohWenMing/lenslocked/webauthn"
 )
 
 type Envs struct{}
@@ -75,6 +81,207 @@ func (e *Envs) LoadEmailEnvs() (emailEnvs *EmailEnvs, err error) {
 	}, nil
 }
 
+/*
+LoadImageStore returns the storage.Store that gallery images should be kept in, selected by IMAGESTORE.
+
+"local" (the default when IMAGESTORE is not set) keeps images on disk under IMAGESDIR, which defaults to "images".
+"s3" keeps images in an S3 compatible bucket and requires S3ENDPOINT, S3BUCKET, S3ACCESSKEYID and S3SECRETACCESSKEY,
+with S3REGION being optional.
+*/
+func (e *Envs) LoadImageStore() (storage.Store, error) {
+	storeType := getOptionalEnvVar("IMAGESTORE", "local")
+	switch strings.ToLower(storeType) {
+	case "local":
+		return storage.NewLocalStore(getOptionalEnvVar("IMAGESDIR", "images")), nil
+	case "s3":
+		endpoint, err := getEnvVar("S3ENDPOINT")
+		if err != nil {
+			return nil, err
+		}
+		bucket, err := getEnvVar("S3BUCKET")
+		if err != nil {
+			return nil, err
+		}
+		accessKeyID, err := getEnvVar("S3ACCESSKEYID")
+		if err != nil {
+			return nil, err
+		}
+		secretAccessKey, err := getEnvVar("S3SECRETACCESSKEY")
+		if err != nil {
+			return nil, err
+		}
+		region := getOptionalEnvVar("S3REGION", "us-east-1")
+		return storage.NewS3Store(endpoint, bucket, region, accessKeyID, secretAccessKey), nil
+	default:
+		return nil, fmt.Errorf("IMAGESTORE %s is not supported, please use local or s3", storeType)
+	}
+}
+
+/*
+LoadSessionLifetimes returns how long sessions last, starting from DefaultSessionLifetimes. Each lifetime can be set with
+a duration such as "30m" or "720h" in SESSIONIDLE, SESSIONABSOLUTE, REMEMBERMEIDLE, REMEMBERMEABSOLUTE and
+SESSIONREFRESHINTERVAL.
+*/
+func (e *Envs) LoadSessionLifetimes() (SessionLifetimes, error) {
+	lifetimes := DefaultSessionLifetimes()
+	for _, lifetime := range []struct {
+		envVar   string
+		duration *time.Duration
+	}{
+		{"SESSIONIDLE", &lifetimes.Idle},
+		{"SESSIONABSOLUTE", &lifetimes.Absolute},
+		{"REMEMBERMEIDLE", &lifetimes.RememberMeIdle},
+		{"REMEMBERMEABSOLUTE", &lifetimes.RememberMeAbsolute},
+		{"SESSIONREFRESHINTERVAL", &lifetimes.RefreshInterval},
+	} {
+		duration, err := getOptionalDurationEnvVar(lifetime.envVar, *lifetime.duration)
+		if err != nil {
+			return SessionLifetimes{}, err
+		}
+		*lifetime.duration = duration
+	}
+	err := lifetimes.Validate()
+	if err != nil {
+		return SessionLifetimes{}, err
+	}
+	return lifetimes, nil
+}
+
+/*
+LoadPasswordPolicy returns the password policy, starting from DefaultPasswordPolicy. PASSWORDMINLENGTH sets the minimum
+length, PASSWORDREQUIRE is a comma separated list of the kinds of character each password must contain - lower, upper,
+digit and symbol - and BREACHEDPASSWORDS is the path of a breached password list to use instead of the bundled one,
+either a file of hashes or a directory of hash ranges.
+*/
+func (e *Envs) LoadPasswordPolicy() (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+	minLength, err := strconv.Atoi(getOptionalEnvVar("PASSWORDMINLENGTH", strconv.Itoa(policy.MinLength)))
+	if err != nil || minLength < 1 || minLength > maxPasswordBytes {
+		return PasswordPolicy{}, fmt.Errorf("PASSWORDMINLENGTH must be a whole number from 1 to %d", maxPasswordBytes)
+	}
+	policy.MinLength = minLength
+	for _, classString := range strings.Split(getOptionalEnvVar("PASSWORDREQUIRE", ""), ",") {
+		if strings.TrimSpace(classString) == "" {
+			continue
+		}
+		class, err := ParsePasswordCharacterClass(classString)
+		if err != nil {
+			return PasswordPolicy{}, fmt.Errorf("PASSWORDREQUIRE: %w", err)
+		}
+		policy.RequiredClasses = append(policy.RequiredClasses, class)
+	}
+	breachedPath := getOptionalEnvVar("BREACHEDPASSWORDS", "")
+	if breachedPath != "" {
+		policy.Breached, err = LoadBreachedPasswords(breachedPath)
+		if err != nil {
+			return PasswordPolicy{}, err
+		}
+	}
+	return policy, nil
+}
+
+/*
+LoadOIDCProviders returns the OpenID Connect providers users can sign in with, of which there are none unless
+OIDCPROVIDERS is set to a comma separated list of provider names such as "google,gitlab". Each provider named is then
+configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENTID and OIDC_<NAME>_CLIENTSECRET, and optionally
+OIDC_<NAME>_DISPLAYNAME and OIDC_<NAME>_SCOPES, a space separated list. The redirect URL to register with each provider
+is baseUrl/signin/oidc/<name>/callback.
+*/
+func (e *Envs) LoadOIDCProviders(baseUrl string) ([]oidc.Config, error) {
+	configs := []oidc.Config{}
+	for _, name := range strings.Split(getOptionalEnvVar("OIDCPROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return nil, fmt.Errorf("OIDCPROVIDERS: %s must only have letters, numbers and dashes", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := oidc.Config{
+			Name:        name,
+			DisplayName: getOptionalEnvVar(prefix+"DISPLAYNAME", name),
+			RedirectURL: fmt.Sprintf("%s/signin/oidc/%s/callback", strings.TrimSuffix(baseUrl, "/"), name),
+			Scopes:      strings.Fields(getOptionalEnvVar(prefix+"SCOPES", "")),
+		}
+		var err error
+		for _, required := range []struct {
+			envVar string
+			value  *string
+		}{
+			{prefix + "ISSUER", &config.Issuer},
+			{prefix + "CLIENTID", &config.ClientID},
+			{prefix + "CLIENTSECRET", &config.ClientSecret},
+		} {
+			*required.value, err = getEnvVar(required.envVar)
+			if err != nil {
+				return nil, err
+			}
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+/*
+LoadRelyingParty returns the site passkeys are registered with, which is the site at baseUrl. WEBAUTHNRPID can be set to
+a domain baseUrl is a subdomain of, so that passkeys also work on the domain's other subdomains - once passkeys have been
+registered it cannot be changed without them all stopping working.
+*/
+func (e *Envs) LoadRelyingParty(baseUrl string) (webauthn.RelyingParty, error) {
+	rp, err := webauthn.NewRelyingParty(TwoFactorIssuer, baseUrl)
+	if err != nil {
+		return webauthn.RelyingParty{}, err
+	}
+	rpId := strings.ToLower(getOptionalEnvVar("WEBAUTHNRPID", rp.ID))
+	if rpId != rp.ID && !strings.HasSuffix(rp.ID, "."+rpId) {
+		return webauthn.RelyingParty{}, fmt.Errorf("WEBAUTHNRPID: %s is not the domain of BASEURL or one it is under", rpId)
+	}
+	rp.ID = rpId
+	return rp, nil
+}
+
+// GetOptionalDuration returns the duration such as "30m" or "24h" set in envVar, or defaultValue if it is not set
+func (e *Envs) GetOptionalDuration(envVar string, defaultValue time.Duration) (time.Duration, error) {
+	return getOptionalDurationEnvVar(envVar, defaultValue)
+}
+
+/*
+GetRateLimitStoreType returns RATELIMITSTORE, which is "memory" (the default) to keep rate limits in the memory of the
+server, or "postgres" to keep them in the database so that they are shared between every instance of the server.
+*/
+func (e *Envs) GetRateLimitStoreType() (string, error) {
+	storeType := strings.ToLower(getOptionalEnvVar("RATELIMITSTORE", "memory"))
+	if storeType != "memory" && storeType != "postgres" {
+		return "", fmt.Errorf("RATELIMITSTORE %s is not supported, please use memory or postgres", storeType)
+	}
+	return storeType, nil
+}
+
+/*
+GetOptionalRateLimit returns the rate limit set in envVar as requests/duration, such as "10/1m" for 10 requests a
+minute, or defaultLimit if it is not set.
+*/
+func (e *Envs) GetOptionalRateLimit(envVar string, defaultLimit ratelimit.Limit) (ratelimit.Limit, error) {
+	envVarString, err := getEnvVar(envVar)
+	if err != nil {
+		return defaultLimit, nil
+	}
+	requestsString, perString, isCut := strings.Cut(envVarString, "/")
+	if !isCut {
+		return ratelimit.Limit{}, fmt.Errorf("%s must be written as requests/duration, such as 10/1m", envVar)
+	}
+	requests, err := strconv.Atoi(requestsString)
+	if err != nil || requests <= 0 {
+		return ratelimit.Limit{}, fmt.Errorf("%s must have a whole number of requests above 0", envVar)
+	}
+	per, err := time.ParseDuration(perString)
+	if err != nil || per <= 0 {
+		return ratelimit.Limit{}, fmt.Errorf("%s must have a duration above 0, such as 1m", envVar)
+	}
+	return ratelimit.Limit{Requests: requests, Per: per}, nil
+}
+
 func (e *Envs) GetIsDev() (bool, error) {
 	isDevVal, err := getIsDevVal()
 	if err != nil {
@@ -83,6 +290,19 @@ func (e *Envs) GetIsDev() (bool, error) {
 	return isDevVal, nil
 }
 
+/*
+GetTrustProxyHeaders returns TRUSTPROXYHEADERS, which should only be set to true when the server is behind a reverse proxy
+such as Caddy that sets X-Forwarded-For. Defaults to false, as otherwise clients could set the header to pick any IP
+address they liked.
+*/
+func (e *Envs) GetTrustProxyHeaders() (bool, error) {
+	trustProxyHeaders, err := strconv.ParseBool(getOptionalEnvVar("TRUSTPROXYHEADERS", "false"))
+	if err != nil {
+		return false, errors.New("TRUSTPROXYHEADERS in .env file could not be parsed to a boolean")
+	}
+	return trustProxyHeaders, nil
+}
+
 func (e *Envs) GetCSRFSecretKey() (string, error) {
 	csrfKey, err := getEnvVar("CSRFSECRETKEY")
 	if err != nil {
@@ -186,6 +406,28 @@ func getEnvVar(input string) (envVarString string, err error) {
 	return envVarString, nil
 }
 
+// returns the env var with the name passed in, or defaultValue if the env var is not set
+func getOptionalEnvVar(input string, defaultValue string) string {
+	envVarString, err := getEnvVar(input)
+	if err != nil {
+		return defaultValue
+	}
+	return envVarString
+}
+
+// returns the env var with the name passed in parsed to a duration, or defaultValue if the env var is not set
+func getOptionalDurationEnvVar(input string, defaultValue time.Duration) (time.Duration, error) {
+	envVarString, err := getEnvVar(input)
+	if err != nil {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(envVarString)
+	if err != nil {
+		return 0, fmt.Errorf("%s could not be parsed to a duration: %w", input, err)
+	}
+	return duration, nil
+}
+
 func getIsDevVal() (bool, error) {
 	isDevString, err := getEnvVar("ISDEV")
 	if err != nil {
@@ -0,0 +1,298 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginFailureWindow is how long a failed attempt is remembered for, after which the count of failures starts again
+const LoginFailureWindow = 24 * time.Hour
+
+// LoginThrottleKind is what a LoginThrottleKey counts the failed attempts of
+type LoginThrottleKind string
+
+const (
+	SignInAccountThrottle        LoginThrottleKind = "sign_in_account"
+	SignInIPThrottle             LoginThrottleKind = "sign_in_ip"
+	ResetPasswordAccountThrottle LoginThrottleKind = "reset_password_account"
+	ResetPasswordIPThrottle      LoginThrottleKind = "reset_password_ip"
+	MagicLinkAccountThrottle     LoginThrottleKind = "magic_link_account"
+	MagicLinkIPThrottle          LoginThrottleKind = "magic_link_ip"
+	ShareLinkThrottle            LoginThrottleKind = "share_link"
+)
+
+/*
+LoginThrottleKey identifies what failed attempts are counted against - for the account kinds Key is the email address
+that was entered, for the IP kinds it is the IP address the attempt came from, and for ShareLinkThrottle it is the id of
+the share link whose password was entered.
+*/
+type LoginThrottleKey struct {
+	Kind LoginThrottleKind
+	Key  string
+}
+
+// SignInThrottleKeys returns the keys a sign in attempt is counted against, with the key of the account first
+func SignInThrottleKeys(email, ipAddress string) []LoginThrottleKey {
+	return []LoginThrottleKey{
+		{SignInAccountThrottle, strings.ToLower(email)},
+		{SignInIPThrottle, ipAddress},
+	}
+}
+
+// ResetPasswordThrottleKeys returns the keys a reset password request is counted against, with the key of the account first
+func ResetPasswordThrottleKeys(email, ipAddress string) []LoginThrottleKey {
+	return []LoginThrottleKey{
+		{ResetPasswordAccountThrottle, strings.ToLower(email)},
+		{ResetPasswordIPThrottle, ipAddress},
+	}
+}
+
+// MagicLinkThrottleKeys returns the keys a request for a sign in link is counted against, with the key of the account first
+func MagicLinkThrottleKeys(email, ipAddress string) []LoginThrottleKey {
+	return []LoginThrottleKey{
+		{MagicLinkAccountThrottle, strings.ToLower(email)},
+		{MagicLinkIPThrottle, ipAddress},
+	}
+}
+
+// ShareLinkThrottleKey returns the key a wrong password for a share link is counted against, wherever it came from
+func ShareLinkThrottleKey(linkId int) LoginThrottleKey {
+	return LoginThrottleKey{ShareLinkThrottle, strconv.Itoa(linkId)}
+}
+
+/*
+LoginThrottlePolicy sets how failed attempts are slowed down. Once FreeAttempts failures have been made, each further
+attempt has to wait BaseDelay, doubling with every failure up to MaxDelay. Every LockoutAfter failures, attempts are
+locked out for LockoutDuration instead - a LockoutAfter of 0 means attempts are never locked out.
+*/
+type LoginThrottlePolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+/*
+DefaultLoginThrottlePolicies returns the policies LoginThrottleService starts with. An IP address is allowed more
+failures than an account, as many people can share one. Every reset password and sign in link request counts as a
+failed attempt, so that the emails of an account cannot be flooded. Share links are never locked out, as that would
+lock out everyone the link was shared with.
+*/
+func DefaultLoginThrottlePolicies() map[LoginThrottleKind]LoginThrottlePolicy {
+	return map[LoginThrottleKind]LoginThrottlePolicy{
+		SignInAccountThrottle: {
+			FreeAttempts:    3,
+			BaseDelay:       time.Second,
+			MaxDelay:        5 * time.Minute,
+			LockoutAfter:    10,
+			LockoutDuration: 30 * time.Minute,
+		},
+		SignInIPThrottle: {
+			FreeAttempts: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+		},
+		ResetPasswordAccountThrottle: {
+			FreeAttempts: 3,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+		},
+		ResetPasswordIPThrottle: {
+			FreeAttempts: 10,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+		},
+		MagicLinkAccountThrottle: {
+			FreeAttempts: 3,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+		},
+		MagicLinkIPThrottle: {
+			FreeAttempts: 10,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+		},
+		ShareLinkThrottle: {
+			FreeAttempts: 5,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+		},
+	}
+}
+
+// delay returns how long attempts have to wait after numFailures failures, and whether they are locked out
+func (p LoginThrottlePolicy) delay(numFailures int) (time.Duration, bool) {
+	if p.LockoutAfter > 0 && numFailures%p.LockoutAfter == 0 {
+		return p.LockoutDuration, true
+	}
+	if numFailures < p.FreeAttempts {
+		return 0, false
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < numFailures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay), false
+}
+
+/*
+LoginThrottledError is returned by LoginThrottleService.Check when too many attempts have failed. Its message is shown to
+the user.
+*/
+type LoginThrottledError struct {
+	RetryAt     time.Time
+	IsLockedOut bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.IsLockedOut {
+		return fmt.Sprintf("this account has been locked after too many failed attempts - please try again in %s",
+			describeWait(time.Until(e.RetryAt)))
+	}
+	return fmt.Sprintf("too many failed attempts - please try again in %s", describeWait(time.Until(e.RetryAt)))
+}
+
+// describes how long a user has to wait, rounded up to the second or minute
+func describeWait(wait time.Duration) string {
+	if wait <= time.Minute {
+		seconds := max(int((wait+time.Second-1)/time.Second), 1)
+		if seconds == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	minutes := int((wait + time.Minute - 1) / time.Minute)
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// LoginFailure describes the state of a LoginThrottleKey after a failed attempt was recorded against it
+type LoginFailure struct {
+	NumFailures  int
+	BlockedUntil time.Time
+	// IsNewlyLockedOut is only true for the failure that caused the lockout, so a notification is only sent once
+	IsNewlyLockedOut bool
+}
+
+/*
+LoginThrottleService counts failed sign in attempts, and requests for reset password and sign in links. The counts are
+kept in the database, so that they survive restarts and are shared between every instance of the server.
+*/
+type LoginThrottleService struct {
+	db       *sql.DB
+	Policies map[LoginThrottleKind]LoginThrottlePolicy
+}
+
+/*
+Check returns a *LoginThrottledError if attempts for any of keys have to wait until later. It should be called before
+the password is checked, so that attempts that are blocked learn nothing.
+*/
+func (lts *LoginThrottleService) Check(now time.Time, keys ...LoginThrottleKey) error {
+	var throttledErr *LoginThrottledError
+	for _, key := range keys {
+		var blockedUntil time.Time
+		var isLockedOut bool
+		row := lts.db.QueryRow(`
+			SELECT blocked_until, is_locked_out
+			FROM login_throttles
+			WHERE kind = ($1)
+			AND key = ($2)
+			AND blocked_until > ($3);
+		`, string(key.Kind), key.Key, now)
+		err := row.Scan(&blockedUntil, &isLockedOut)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("check login throttle: %w", err)
+		}
+		if throttledErr == nil {
+			throttledErr = &LoginThrottledError{}
+		}
+		if blockedUntil.After(throttledErr.RetryAt) {
+			throttledErr.RetryAt = blockedUntil
+		}
+		throttledErr.IsLockedOut = throttledErr.IsLockedOut || isLockedOut
+	}
+	if throttledErr != nil {
+		return throttledErr
+	}
+	return nil
+}
+
+/*
+RecordFailure counts a failed attempt against key, and blocks further attempts for as long as the policy of its kind
+says to. Failures made more than LoginFailureWindow after the last one start the count again.
+*/
+func (lts *LoginThrottleService) RecordFailure(now time.Time, key LoginThrottleKey) (LoginFailure, error) {
+	tx, err := lts.db.Begin()
+	if err != nil {
+		return LoginFailure{}, fmt.Errorf("record login failure: %w", err)
+	}
+	defer tx.Rollback()
+	// the row stays locked until the transaction is committed, so concurrent failures are counted one after another
+	row := tx.QueryRow(`
+		INSERT INTO login_throttles (kind, key, num_failures, last_failure_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (kind, key) DO UPDATE
+		SET num_failures = CASE
+				WHEN login_throttles.last_failure_at < ($4) THEN 1
+				ELSE login_throttles.num_failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING num_failures;
+	`, string(key.Kind), key.Key, now, now.Add(-LoginFailureWindow))
+	failure := LoginFailure{}
+	err = row.Scan(&failure.NumFailures)
+	if err != nil {
+		return LoginFailure{}, fmt.Errorf("record login failure: %w", err)
+	}
+	delay, isLockedOut := lts.Policies[key.Kind].delay(failure.NumFailures)
+	failure.BlockedUntil = now.Add(delay)
+	failure.IsNewlyLockedOut = isLockedOut
+	_, err = tx.Exec(`
+		UPDATE login_throttles
+		SET blocked_until = ($3),
+			is_locked_out = ($4)
+		WHERE kind = ($1)
+		AND key = ($2);
+	`, string(key.Kind), key.Key, failure.BlockedUntil, isLockedOut)
+	if err != nil {
+		return LoginFailure{}, fmt.Errorf("record login failure: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return LoginFailure{}, fmt.Errorf("record login failure: %w", err)
+	}
+	return failure, nil
+}
+
+// Reset forgets the failed attempts counted against key, such as once the right password has been entered
+func (lts *LoginThrottleService) Reset(key LoginThrottleKey) error {
+	_, err := lts.db.Exec(`
+		DELETE FROM login_throttles
+		WHERE kind = ($1)
+		AND key = ($2);
+	`, string(key.Kind), key.Key)
+	if err != nil {
+		return fmt.Errorf("reset login throttle: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the failed attempts that are no longer remembered or blocking anything at now
+func (lts *LoginThrottleService) DeleteExpired(now time.Time) (int64, error) {
+	result, err := lts.db.Exec(`
+		DELETE FROM login_throttles
+		WHERE last_failure_at < ($1)
+		AND (blocked_until IS NULL OR blocked_until < ($2));
+	`, now.Add(-LoginFailureWindow), now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired login throttles: %w", err)
+	}
+	return result.RowsAffected()
+}
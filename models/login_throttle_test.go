@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottlePolicyDelay(t *testing.T) {
+	policy := LoginThrottlePolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: time.Hour,
+	}
+	type test struct {
+		numFailures   int
+		expectedDelay time.Duration
+		isLockedOut   bool
+	}
+	tests := []test{
+		{1, 0, false},
+		{2, 0, false},
+		{3, time.Second, false},
+		{4, 2 * time.Second, false},
+		{5, 4 * time.Second, false},
+		{6, 5 * time.Second, false},
+		{9, 5 * time.Second, false},
+		{10, time.Hour, true},
+		{11, 5 * time.Second, false},
+		{20, time.Hour, true},
+	}
+	for _, test := range tests {
+		delay, isLockedOut := policy.delay(test.numFailures)
+		if delay != test.expectedDelay || isLockedOut != test.isLockedOut {
+			t.Errorf("%d failures: expected %v locked out %t, got %v locked out %t",
+				test.numFailures, test.expectedDelay, test.isLockedOut, delay, isLockedOut)
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	lts := &LoginThrottleService{dbc.DB, map[LoginThrottleKind]LoginThrottlePolicy{
+		SignInAccountThrottle: {
+			FreeAttempts:    2,
+			BaseDelay:       time.Minute,
+			MaxDelay:        time.Hour,
+			LockoutAfter:    4,
+			LockoutDuration: 2 * time.Hour,
+		},
+	}}
+	keys := SignInThrottleKeys("Throttled_User@gmail.com", "203.0.113.7")
+	defer func() {
+		for _, key := range keys {
+			lts.Reset(key)
+		}
+	}()
+	// timestamps are stored to the microsecond, so now is truncated to compare with what is read back
+	now := time.Now().Truncate(time.Second)
+
+	for i := 1; i <= 4; i++ {
+		failure, err := lts.RecordFailure(now, keys[0])
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+			return
+		}
+		if failure.NumFailures != i {
+			t.Errorf("expected %d failures, got %d", i, failure.NumFailures)
+		}
+		if failure.IsNewlyLockedOut != (i == 4) {
+			t.Errorf("failure %d: expected newly locked out to be %t", i, i == 4)
+		}
+	}
+	err := lts.Check(now, keys...)
+	var throttledErr *LoginThrottledError
+	if !errors.As(err, &throttledErr) {
+		t.Errorf("expected LoginThrottledError, got %v", err)
+		return
+	}
+	if !throttledErr.IsLockedOut || !throttledErr.RetryAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("expected to be locked out until %v, got %+v", now.Add(2*time.Hour), throttledErr)
+	}
+	err = lts.Check(now.Add(3*time.Hour), keys...)
+	if err != nil {
+		t.Errorf("expected lockout to have passed, got %v", err)
+	}
+
+	// failures older than LoginFailureWindow are forgotten
+	failure, err := lts.RecordFailure(now.Add(LoginFailureWindow+time.Hour), keys[0])
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if failure.NumFailures != 1 {
+		t.Errorf("expected count of failures to start again, got %d", failure.NumFailures)
+	}
+
+	err = lts.Reset(keys[0])
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	err = lts.Check(now, keys...)
+	if err != nil {
+		t.Errorf("expected no throttle after reset, got %v", err)
+	}
+}
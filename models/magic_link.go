@@ -0,0 +1,124 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MagicLinkTokenDuration is how long a sign in link sent by email can be used for
+const MagicLinkTokenDuration = 15 * time.Minute
+
+/*
+MagicLinkService holds the sign in links that have been emailed to users, so they can sign in without their password.
+Only the hash of each token is stored, and a user only ever has one link that works - asking for another replaces it.
+*/
+type MagicLinkService struct {
+	db *sql.DB
+}
+
+/*
+NewToken creates the token for a sign in link to send to the user with email, returning the user so the link can be
+sent to the address they signed up with. If there is no such user, the error is a no rows error.
+*/
+func (mls *MagicLinkService) NewToken(email string) (string, UserInfo, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !isValidEmail(email) {
+		return "", UserInfo{}, MapHandledError(fmt.Errorf("email passed in: %s", email), "the email address is not valid")
+	}
+	userInfo := UserInfo{}
+	row := mls.db.QueryRow(`
+		SELECT id, email
+		FROM users
+		WHERE email = ($1);
+	`, email)
+	err := row.Scan(&userInfo.ID, &userInfo.Email)
+	if err != nil {
+		return "", UserInfo{}, HandlePgError(err, UserNotFoundByEmailErr())
+	}
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return "", UserInfo{}, err
+	}
+	_, err = mls.db.Exec(`
+		INSERT INTO magic_link_tokens (user_id, token_hash, expires_on)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash,
+			expires_on = EXCLUDED.expires_on;
+	`, userInfo.ID, tokenHash, time.Now().Add(MagicLinkTokenDuration))
+	if err != nil {
+		return "", UserInfo{}, fmt.Errorf("new magic link token: %w", err)
+	}
+	return token, userInfo, nil
+}
+
+// DeleteExpiredTokens deletes the sign in link tokens that expired before now without being used
+func (mls *MagicLinkService) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := mls.db.Exec(`
+		DELETE FROM magic_link_tokens
+		WHERE expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired magic link tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+/*
+LoginWithMagicLink signs in the user a sign in link was sent to. The token is deleted as it is used, so a link can only
+sign in once, even if it is opened from a copy of the email. The user's email address is marked as verified, as the
+link could only have been opened from it - if it was not verified already, the account may have been signed up by
+someone else, so it is taken over with takeOverUnverifiedUser first. Users with two factor authentication enabled still
+have to enter a code, in which case a TwoFactorRequiredError is returned as with LoginUser.
+*/
+func (us *UserService) LoginWithMagicLink(token string) (*UserIdToSession, error) {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return nil, MapHandledGenericError(err)
+	}
+	defer tx.Rollback()
+	var userId int
+	row := tx.QueryRow(`
+		DELETE FROM magic_link_tokens
+		WHERE token_hash = ($1)
+		AND expires_on > now()
+		RETURNING user_id;
+	`, HashSessionToken(token))
+	err = row.Scan(&userId)
+	if err != nil {
+		return nil, HandlePgError(err, &sqlNoRowsErrStruct{NoMagicLinkFound})
+	}
+	var isEmailVerified, isTwoFactorEnabled bool
+	row = tx.QueryRow(`
+		SELECT email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL
+		FROM users
+		WHERE id = ($1)
+		FOR UPDATE;
+	`, userId)
+	err = row.Scan(&isEmailVerified, &isTwoFactorEnabled)
+	if err != nil {
+		return nil, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	if !isEmailVerified {
+		err = takeOverUnverifiedUser(tx, userId)
+		if err != nil {
+			return nil, MapHandledGenericError(err)
+		}
+		// anything set up before the address was verified is gone, including two factor authentication
+		isTwoFactorEnabled = false
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, MapHandledGenericError(err)
+	}
+	if isTwoFactorEnabled {
+		token, err := us.twoFactorService.createChallenge(userId)
+		if err != nil {
+			return nil, MapHandledGenericError(err)
+		}
+		return nil, &TwoFactorRequiredError{userId, token}
+	}
+	return us.startSession(internalUserStruct{ID: userId})
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestLoginWithMagicLink(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+
+	_, _, err := dbc.MagicLinkService.NewToken("no_such_user@gmail.com")
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error for an email without a user, got %v\n", err)
+	}
+
+	oldToken, _, err := dbc.MagicLinkService.NewToken("Test_User@gmail.com")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	token, userInfo, err := dbc.MagicLinkService.NewToken(" test_user@gmail.com ")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if userInfo.ID != userId || userInfo.Email != "test_user@gmail.com" {
+		t.Errorf("got %+v, want the test user\n", userInfo)
+	}
+
+	// asking for another link stops the one sent before from working
+	_, err = dbc.UserService.LoginWithMagicLink(oldToken)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error signing in with a replaced link, got %v\n", err)
+	}
+	user, err := dbc.UserService.LoginWithMagicLink(token)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if user.ID != userId || user.Session.Token == "" {
+		t.Errorf("got %+v, want a session for user %d\n", user, userId)
+	}
+	_, err = dbc.UserService.LoginWithMagicLink(token)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error signing in with a link twice, got %v\n", err)
+	}
+}
+
+func TestLoginWithMagicLinkUnverifiedUser(t *testing.T) {
+	// someone signs up with an address they do not own, which is never verified
+	squatter := UserEmailToPlainTextPassword{"test_unverified_user@gmail.com", "Holoq123holoq123"}
+	squatterUser, err := dbc.UserService.CreateUser(squatter)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	defer dbc.UserService.DeleteUserAndSession(squatterUser.UserID)
+	credentials := setUpSquatterCredentials(t, squatterUser.UserID, squatter)
+
+	// the owner of the address asks for a sign in link, which replaces the one the squatter asked for
+	token, _, err := dbc.MagicLinkService.NewToken(squatter.Email)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	user, err := dbc.UserService.LoginWithMagicLink(token)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if user.ID != squatterUser.UserID || user.Session.Token == "" {
+		t.Errorf("got %+v, want a session for user %d\n", user, squatterUser.UserID)
+	}
+	checkSquatterCredentialsGone(t, user.ID, squatter, credentials)
+}
@@ -0,0 +1,34 @@
+package models
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+/*
+Page selects a window of a list that is too long to return in one go. Number counts from 1. Pages out of range are
+clamped by NewPage, so a Page built from user input can be passed straight to a query.
+*/
+type Page struct {
+	Number int
+	Size   int
+}
+
+// NewPage returns the page with the input number and size, falling back to the first page and DefaultPageSize
+func NewPage(number int, size int) Page {
+	if number < 1 {
+		number = 1
+	}
+	if size < 1 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+	return Page{number, size}
+}
+
+// Offset returns the number of rows that come before the page
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/webauthn"
+)
+
+const (
+	// PasskeyChallengeDuration is how long a user has to use their authenticator once a ceremony has started
+	PasskeyChallengeDuration = webauthn.Timeout
+	// MaxPasskeyNameLength is the longest name a passkey can be given
+	MaxPasskeyNameLength = 100
+)
+
+// DefaultRelyingParty is the site passkeys are registered with until PasskeyService is configured with the real one
+var DefaultRelyingParty = webauthn.RelyingParty{ID: "localhost", Name: TwoFactorIssuer, Origin: "http://localhost:3000"}
+
+// Passkey is a passkey a user has registered to sign in with
+type Passkey struct {
+	ID        int
+	UserID    int
+	Name      string
+	CreatedAt time.Time
+	// LastUsedAt is the zero time for passkeys that have never been signed in with
+	LastUsedAt time.Time
+}
+
+/*
+PasskeyService holds the passkeys users have registered, and the challenges of the ceremonies that register and sign in
+with them. Challenges are only stored hashed, and each can only be used once.
+*/
+type PasskeyService struct {
+	db           *sql.DB
+	RelyingParty webauthn.RelyingParty
+}
+
+// the user handle of a user's passkeys, which authenticators return when signing in
+func passkeyUserHandle(userId int) []byte {
+	return []byte(strconv.Itoa(userId))
+}
+
+/*
+BeginRegistration starts registering a passkey for the user, returning the options to pass to
+navigator.credentials.create(). The user's passkeys are excluded, so the same authenticator is not registered twice.
+*/
+func (ps *PasskeyService) BeginRegistration(userId int) (webauthn.CreationOptions, error) {
+	var email string
+	row := ps.db.QueryRow(`SELECT email FROM users WHERE id = ($1);`, userId)
+	err := row.Scan(&email)
+	if err != nil {
+		return webauthn.CreationOptions{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	rows, err := ps.db.Query(`
+		SELECT credential_id, transports
+		FROM passkeys
+		WHERE user_id = ($1);
+	`, userId)
+	if err != nil {
+		return webauthn.CreationOptions{}, fmt.Errorf("begin passkey registration: %w", err)
+	}
+	defer rows.Close()
+	exclude := []webauthn.CredentialDescriptor{}
+	for rows.Next() {
+		var credentialId []byte
+		var transports string
+		err = rows.Scan(&credentialId, &transports)
+		if err != nil {
+			return webauthn.CreationOptions{}, fmt.Errorf("begin passkey registration: %w", err)
+		}
+		exclude = append(exclude, webauthn.NewCredentialDescriptor(credentialId, strings.Fields(transports)))
+	}
+	err = rows.Err()
+	if err != nil {
+		return webauthn.CreationOptions{}, fmt.Errorf("begin passkey registration: %w", err)
+	}
+	challenge, err := ps.newChallenge(userId)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+	user := webauthn.User{ID: passkeyUserHandle(userId), Name: email, DisplayName: email}
+	return ps.RelyingParty.CreationOptions(challenge, user, exclude), nil
+}
+
+/*
+FinishRegistration registers the passkey in response, the JSON of the credential navigator.credentials.create()
+returned, for the user under name.
+*/
+func (ps *PasskeyService) FinishRegistration(userId int, name string, response []byte) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxPasskeyNameLength {
+		return MapHandledError(fmt.Errorf("passkey name passed in: %s", name),
+			fmt.Sprintf("the passkey must have a name of at most %d characters", MaxPasskeyNameLength))
+	}
+	resp, err := webauthn.ParseRegistrationResponse(response)
+	if err != nil {
+		return MapHandledError(err, "the passkey could not be read - please try again")
+	}
+	err = ps.takeChallenge(resp.ClientData.Challenge, userId)
+	if err != nil {
+		return err
+	}
+	credential, err := ps.RelyingParty.VerifyRegistration(resp, resp.ClientData.Challenge)
+	if err != nil {
+		return MapHandledError(err, "the passkey could not be verified - please try again")
+	}
+	_, err = ps.db.Exec(`
+		INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, transports, name)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`, userId, credential.ID, credential.PublicKey, int64(credential.SignCount),
+		strings.Join(credential.Transports, " "), name)
+	if err != nil && strings.Contains(err.Error(), "passkeys_credential_id_key") {
+		return MapHandledError(err, "this passkey has already been registered")
+	}
+	if err != nil {
+		return fmt.Errorf("finish passkey registration: %w", err)
+	}
+	return nil
+}
+
+// BeginLogin starts a sign in with a passkey, returning the options to pass to navigator.credentials.get()
+func (ps *PasskeyService) BeginLogin() (webauthn.RequestOptions, error) {
+	challenge, err := ps.newChallenge(0)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+	return ps.RelyingParty.RequestOptions(challenge), nil
+}
+
+// creates and stores a challenge, for registering a passkey for the user or for signing in if userId is 0
+func (ps *PasskeyService) newChallenge(userId int) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	_, err = ps.db.Exec(`
+		INSERT INTO webauthn_challenges (challenge_hash, user_id, expires_on)
+		VALUES ($1, $2, $3);
+	`, HashSessionToken(challenge), sql.NullInt64{Int64: int64(userId), Valid: userId != 0},
+		time.Now().Add(PasskeyChallengeDuration))
+	if err != nil {
+		return "", fmt.Errorf("new webauthn challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+/*
+removes the challenge so it cannot be used again, returning a no rows error if it has expired or was not made for the
+user - or for signing in, if userId is 0
+*/
+func (ps *PasskeyService) takeChallenge(challenge string, userId int) error {
+	result, err := ps.db.Exec(`
+		DELETE FROM webauthn_challenges
+		WHERE challenge_hash = ($1)
+		AND user_id IS NOT DISTINCT FROM ($2)
+		AND expires_on > now();
+	`, HashSessionToken(challenge), sql.NullInt64{Int64: int64(userId), Valid: userId != 0})
+	if err != nil {
+		return fmt.Errorf("take webauthn challenge: %w", err)
+	}
+	numRowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("take webauthn challenge: %w", err)
+	}
+	if numRowsAffected == 0 {
+		return HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoPasskeyChallengeFound})
+	}
+	return nil
+}
+
+// DeleteExpiredChallenges deletes the challenges that expired before now without being used
+func (ps *PasskeyService) DeleteExpiredChallenges(now time.Time) (int64, error) {
+	result, err := ps.db.Exec(`
+		DELETE FROM webauthn_challenges
+		WHERE expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired webauthn challenges: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetByUserId returns the passkeys the user has registered, in the order they were registered
+func (ps *PasskeyService) GetByUserId(userId int) ([]Passkey, error) {
+	rows, err := ps.db.Query(`
+		SELECT id, user_id, name, created_at, last_used_at
+		FROM passkeys
+		WHERE user_id = ($1)
+		ORDER BY created_at, id;
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("get passkeys: %w", err)
+	}
+	defer rows.Close()
+	passkeys := []Passkey{}
+	for rows.Next() {
+		passkey := Passkey{}
+		var lastUsedAt sql.NullTime
+		err = rows.Scan(&passkey.ID, &passkey.UserID, &passkey.Name, &passkey.CreatedAt, &lastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("get passkeys: %w", err)
+		}
+		passkey.LastUsedAt = lastUsedAt.Time
+		passkeys = append(passkeys, passkey)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("get passkeys: %w", err)
+	}
+	return passkeys, nil
+}
+
+// Delete removes one of the user's passkeys, so it can no longer be used to sign in
+func (ps *PasskeyService) Delete(userId int, passkeyId int) error {
+	result, err := ps.db.Exec(`
+		DELETE FROM passkeys
+		WHERE id = ($1)
+		AND user_id = ($2);
+	`, passkeyId, userId)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	numRowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	if numRowsAffected == 0 {
+		return HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoPasskeyFound})
+	}
+	return nil
+}
+
+/*
+LoginWithPasskey signs in the user whose passkey signed response, the JSON of the credential navigator.credentials.get()
+returned. A passkey that verified the user - with a fingerprint, face or PIN - is two factors on its own. Otherwise users
+with two factor authentication enabled still have to enter a code, in which case a TwoFactorRequiredError is returned as
+with LoginUser.
+*/
+func (us *UserService) LoginWithPasskey(response []byte) (*UserIdToSession, error) {
+	ps := us.passkeyService
+	resp, err := webauthn.ParseAssertionResponse(response)
+	if err != nil {
+		return nil, MapHandledError(err, "the passkey could not be read - please try again")
+	}
+	err = ps.takeChallenge(resp.ClientData.Challenge, 0)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := us.db.Begin()
+	if err != nil {
+		return nil, MapHandledGenericError(err)
+	}
+	defer tx.Rollback()
+	var passkeyId, userId int
+	var publicKey []byte
+	var signCount int64
+	var isTwoFactorEnabled bool
+	// the passkey is locked until the transaction is committed, so that concurrent sign ins check the counter in turn
+	row := tx.QueryRow(`
+		SELECT p.id, p.user_id, p.public_key, p.sign_count, u.totp_enabled_at IS NOT NULL
+		FROM passkeys p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.credential_id = ($1)
+		FOR UPDATE OF p;
+	`, resp.CredentialID)
+	err = row.Scan(&passkeyId, &userId, &publicKey, &signCount, &isTwoFactorEnabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, MapHandledError(err, "this passkey is not registered with any account - it may have been removed")
+	}
+	if err != nil {
+		return nil, MapHandledGenericError(err)
+	}
+	if resp.UserHandle != nil && string(resp.UserHandle) != string(passkeyUserHandle(userId)) {
+		return nil, MapHandledError(errors.New("user handle does not match the passkey's user"),
+			"the passkey could not be verified - please try again")
+	}
+	assertion, err := ps.RelyingParty.VerifyAssertion(resp, resp.ClientData.Challenge, publicKey, uint32(signCount))
+	if errors.Is(err, webauthn.ErrSignCount) {
+		return nil, MapHandledError(err,
+			"this passkey may have been copied, so it cannot be used to sign in - please sign in another way and remove it")
+	}
+	if err != nil {
+		return nil, MapHandledError(err, "the passkey could not be verified - please try again")
+	}
+	_, err = tx.Exec(`
+		UPDATE passkeys
+		SET sign_count = ($2),
+			last_used_at = now()
+		WHERE id = ($1);
+	`, passkeyId, int64(assertion.SignCount))
+	if err != nil {
+		return nil, MapHandledGenericError(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, MapHandledGenericError(err)
+	}
+	if isTwoFactorEnabled && !assertion.UserVerified {
+		token, err := us.twoFactorService.createChallenge(userId)
+		if err != nil {
+			return nil, MapHandledGenericError(err)
+		}
+		return nil, &TwoFactorRequiredError{userId, token}
+	}
+	return us.startSession(internalUserStruct{ID: userId})
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/webauthn/webauthntest"
+)
+
+func TestPasskeys(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+	authenticator := webauthntest.New(dbc.PasskeyService.RelyingParty)
+
+	options, err := dbc.PasskeyService.BeginRegistration(userId)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	response, credential, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	err = dbc.PasskeyService.FinishRegistration(userId, "test passkey", response)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	// each challenge can only be used once
+	err = dbc.PasskeyService.FinishRegistration(userId, "test passkey", response)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error registering with a used challenge, got %v\n", err)
+	}
+	options, err = dbc.PasskeyService.BeginRegistration(userId)
+	if err != nil || len(options.ExcludeCredentials) != 1 {
+		t.Errorf("got %+v %v, want the registered passkey excluded\n", options.ExcludeCredentials, err)
+	}
+
+	loginOptions, err := dbc.PasskeyService.BeginLogin()
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	response, err = authenticator.Assert(credential, loginOptions)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	user, err := dbc.UserService.LoginWithPasskey(response)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if user.ID != userId || user.Session.Token == "" {
+		t.Errorf("got %+v, want a session for user %d\n", user, userId)
+	}
+	_, err = dbc.UserService.LoginWithPasskey(response)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error signing in with a used challenge, got %v\n", err)
+	}
+
+	// a counter that does not go up means the passkey may have been cloned
+	authenticator.SkipSignCount = true
+	loginOptions, _ = dbc.PasskeyService.BeginLogin()
+	response, _ = authenticator.Assert(credential, loginOptions)
+	_, err = dbc.UserService.LoginWithPasskey(response)
+	if !IsUserFacingErr(err) {
+		t.Errorf("expected user facing error signing in with a cloned passkey, got %v\n", err)
+	}
+
+	passkeys, err := dbc.PasskeyService.GetByUserId(userId)
+	if err != nil || len(passkeys) != 1 || passkeys[0].Name != "test passkey" || passkeys[0].LastUsedAt.IsZero() {
+		t.Fatalf("got %+v %v, want the used passkey\n", passkeys, err)
+	}
+	err = dbc.PasskeyService.Delete(userId+1, passkeys[0].ID)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error deleting the passkey of another user, got %v\n", err)
+	}
+	err = dbc.PasskeyService.Delete(userId, passkeys[0].ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	authenticator.SkipSignCount = false
+	loginOptions, _ = dbc.PasskeyService.BeginLogin()
+	response, _ = authenticator.Assert(credential, loginOptions)
+	_, err = dbc.UserService.LoginWithPasskey(response)
+	var twoFactorRequiredErr *TwoFactorRequiredError
+	if !IsUserFacingErr(err) || errors.As(err, &twoFactorRequiredErr) {
+		t.Errorf("expected user facing error signing in with a removed passkey, got %v\n", err)
+	}
+}
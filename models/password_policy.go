@@ -0,0 +1,297 @@
+package models
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// bcrypt only hashes the first 72 bytes of a password, so anything longer is refused rather than silently cut short
+const maxPasswordBytes = 72
+
+// PasswordCharacterClass is a kind of character a PasswordPolicy can require a password to contain
+type PasswordCharacterClass string
+
+const (
+	LowerCaseClass PasswordCharacterClass = "lower"
+	UpperCaseClass PasswordCharacterClass = "upper"
+	DigitClass     PasswordCharacterClass = "digit"
+	SymbolClass    PasswordCharacterClass = "symbol"
+)
+
+func (c PasswordCharacterClass) matches(r rune) bool {
+	switch c {
+	case LowerCaseClass:
+		return unicode.IsLower(r)
+	case UpperCaseClass:
+		return unicode.IsUpper(r)
+	case DigitClass:
+		return unicode.IsDigit(r)
+	case SymbolClass:
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	default:
+		return false
+	}
+}
+
+func (c PasswordCharacterClass) description() string {
+	switch c {
+	case LowerCaseClass:
+		return "a lower case letter"
+	case UpperCaseClass:
+		return "an upper case letter"
+	case DigitClass:
+		return "a number"
+	case SymbolClass:
+		return "a symbol"
+	default:
+		return string(c)
+	}
+}
+
+func ParsePasswordCharacterClass(input string) (PasswordCharacterClass, error) {
+	class := PasswordCharacterClass(strings.ToLower(strings.TrimSpace(input)))
+	switch class {
+	case LowerCaseClass, UpperCaseClass, DigitClass, SymbolClass:
+		return class, nil
+	default:
+		return "", fmt.Errorf("password character class %s is not supported, please use lower, upper, digit or symbol", input)
+	}
+}
+
+/*
+PasswordPolicy is what a new password has to meet, whether it is set when signing up, resetting a password or changing
+it. Passwords are not checked against the policy when signing in, so that changing the policy does not lock anyone out.
+*/
+type PasswordPolicy struct {
+	MinLength int
+	// RequiredClasses are the kinds of character every password must contain at least one of
+	RequiredClasses []PasswordCharacterClass
+	// RejectEmail refuses passwords that contain the user's email address, or the part of it before the @
+	RejectEmail bool
+	// Breached is checked for passwords that are known to have been leaked, and can be nil to skip the check
+	Breached BreachedPasswordChecker
+}
+
+// DefaultPasswordPolicy returns the policy used unless it is configured otherwise, checked against the bundled list
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:   8,
+		RejectEmail: true,
+		Breached:    BundledBreachedPasswords(),
+	}
+}
+
+/*
+PasswordPolicyError is returned when a password does not meet a PasswordPolicy. Problems holds a message for each rule
+that was not met, so that they can all be shown on the form at once.
+*/
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Problems, ", ")
+}
+
+/*
+Validate returns a *PasswordPolicyError if password does not meet the policy. email is the address of the user the
+password is for. Any other error means the breached password list could not be checked, and the password should not be
+used until it can be.
+*/
+func (p PasswordPolicy) Validate(password string, email string) error {
+	problems := []string{}
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("password must be at most %d characters long", maxPasswordBytes))
+	}
+	for _, class := range p.RequiredClasses {
+		if !strings.ContainsFunc(password, class.matches) {
+			problems = append(problems, "password must contain "+class.description())
+		}
+	}
+	if p.RejectEmail && containsEmail(password, email) {
+		problems = append(problems, "password must not contain your email address")
+	}
+	// the breached check is only worth doing once everything else is met
+	if len(problems) == 0 && p.Breached != nil {
+		isBreached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("validate password: %w", err)
+		}
+		if isBreached {
+			problems = append(problems,
+				"this password has appeared in a data breach and is not safe to use - please choose another")
+		}
+	}
+	if len(problems) > 0 {
+		return &PasswordPolicyError{problems}
+	}
+	return nil
+}
+
+// reports whether password contains email, or the part of it before the @ if that is long enough to matter
+func containsEmail(password, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	password = strings.ToLower(password)
+	localPart, _, _ := strings.Cut(email, "@")
+	return strings.Contains(password, email) || (len(localPart) >= 3 && strings.Contains(password, localPart))
+}
+
+// BreachedPasswordChecker reports whether a password is known to have been leaked in a data breach
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+/*
+returns the upper case hex SHA-1 hash of password split the way k-anonymity hash lists are - the first 5 characters
+name the range the hash is in, and the rest is looked up within it.
+*/
+func breachedPasswordHash(password string) (prefix string, suffix string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:5], hash[5:]
+}
+
+/*
+BreachedPasswordList is a list of SHA-1 hashes of breached passwords held in memory, grouped into ranges by the first 5
+characters of each hash. It is meant for lists small enough to load at once, such as the one bundled with the
+application.
+*/
+type BreachedPasswordList struct {
+	ranges map[string]map[string]struct{}
+}
+
+/*
+LoadBreachedPasswordList reads a list with one upper or lower case hex SHA-1 hash on each line, optionally followed by a
+colon and the number of times it was seen - the format Have I Been Pwned publishes its full list in.
+*/
+func LoadBreachedPasswordList(r io.Reader) (*BreachedPasswordList, error) {
+	list := &BreachedPasswordList{map[string]map[string]struct{}{}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("load breached password list: %s is not a SHA-1 hash", hash)
+		}
+		hash = strings.ToUpper(hash)
+		if list.ranges[hash[:5]] == nil {
+			list.ranges[hash[:5]] = map[string]struct{}{}
+		}
+		list.ranges[hash[:5]][hash[5:]] = struct{}{}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("load breached password list: %w", err)
+	}
+	return list, nil
+}
+
+func (l *BreachedPasswordList) IsBreached(password string) (bool, error) {
+	prefix, suffix := breachedPasswordHash(password)
+	_, isFound := l.ranges[prefix][suffix]
+	return isFound, nil
+}
+
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords string
+
+/*
+BundledBreachedPasswords returns the list of common breached passwords bundled with the application. It is only a small
+list - BREACHEDPASSWORDS can point to a full one.
+*/
+func BundledBreachedPasswords() *BreachedPasswordList {
+	list, err := LoadBreachedPasswordList(strings.NewReader(bundledBreachedPasswords))
+	if err != nil {
+		// the list is embedded at build time, so it can only fail to load if it was edited badly
+		panic(err)
+	}
+	return list
+}
+
+/*
+BreachedPasswordRanges is a k-anonymity hash list kept in a directory, such as one downloaded from the Have I Been Pwned
+range API. Each file is named after the first 5 characters of the SHA-1 hashes in it, with or without a .txt extension,
+and holds the rest of each hash on its own line, optionally followed by a colon and a count. Only the file of the range
+a password's hash is in is read, so lists far too large to hold in memory can be used.
+*/
+type BreachedPasswordRanges struct {
+	fsys fs.FS
+}
+
+func NewBreachedPasswordRanges(fsys fs.FS) *BreachedPasswordRanges {
+	return &BreachedPasswordRanges{fsys}
+}
+
+func (br *BreachedPasswordRanges) IsBreached(password string) (bool, error) {
+	prefix, suffix := breachedPasswordHash(password)
+	file, err := br.fsys.Open(prefix + ".txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = br.fsys.Open(prefix)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		// no password with a hash in this range has been breached
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check breached password ranges: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rangeSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(rangeSuffix, suffix) {
+			return true, nil
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return false, fmt.Errorf("check breached password ranges: %w", err)
+	}
+	return false, nil
+}
+
+/*
+LoadBreachedPasswords returns the checker for the breached password list at path - a BreachedPasswordRanges if path is a
+directory, or a BreachedPasswordList loaded into memory if it is a file. A directory without any ranges in it is refused,
+as it is far more likely to be the wrong path than a list of nothing.
+*/
+func LoadBreachedPasswords(path string) (BreachedPasswordChecker, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("load breached passwords: %w", err)
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("load breached passwords: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("load breached passwords: %s has no hash ranges in it", path)
+		}
+		return NewBreachedPasswordRanges(os.DirFS(filepath.Clean(path))), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("load breached passwords: %w", err)
+	}
+	defer file.Close()
+	return LoadBreachedPasswordList(file)
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:       10,
+		RequiredClasses: []PasswordCharacterClass{UpperCaseClass, DigitClass, SymbolClass},
+		RejectEmail:     true,
+		Breached:        BundledBreachedPasswords(),
+	}
+	type test struct {
+		name             string
+		password         string
+		expectedProblems []string
+	}
+	tests := []test{
+		{"meets the policy", "Lantern-Harbour-42", nil},
+		{"too short", "Ab1!", []string{"password must be at least 10 characters long"}},
+		{"too long", "Ab1!" + strings.Repeat("a", 70), []string{"password must be at most 72 characters long"}},
+		{"missing classes", "lanternharbour", []string{
+			"password must contain an upper case letter",
+			"password must contain a number",
+			"password must contain a symbol",
+		}},
+		{"contains email", "Photographer-Jane1", []string{"password must not contain your email address"}},
+		{"contains email in another case", "x1!JANE@EXAMPLE.COMx", []string{"password must not contain your email address"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Validate(test.password, "Jane@example.com")
+			if test.expectedProblems == nil {
+				if err != nil {
+					t.Errorf("didn't expect error, got %v", err)
+				}
+				return
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected PasswordPolicyError, got %v", err)
+			}
+			if strings.Join(policyErr.Problems, "|") != strings.Join(test.expectedProblems, "|") {
+				t.Errorf("expected problems %q, got %q", test.expectedProblems, policyErr.Problems)
+			}
+			if !IsUserFacingErr(err) {
+				t.Errorf("expected PasswordPolicyError to be user facing")
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyBreached(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	err := policy.Validate("password123", "")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Problems) != 1 || !strings.Contains(policyErr.Problems[0], "breach") {
+		t.Errorf("expected password123 to be rejected as breached, got %v", err)
+	}
+	err = policy.Validate("Lantern-Harbour-42", "")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v", err)
+	}
+}
+
+type failingBreachedPasswordChecker struct{}
+
+func (failingBreachedPasswordChecker) IsBreached(password string) (bool, error) {
+	return false, errors.New("breached password list could not be read")
+}
+
+func TestPasswordPolicyBreachedCheckFails(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, Breached: failingBreachedPasswordChecker{}}
+	err := policy.Validate("Lantern-Harbour-42", "")
+	if err == nil {
+		t.Fatalf("expected error when the breached password list cannot be checked")
+	}
+	if IsUserFacingErr(err) {
+		t.Errorf("didn't expect an error checking the breached password list to be user facing, got %v", err)
+	}
+}
+
+func TestLoadBreachedPasswordList(t *testing.T) {
+	prefix, suffix := breachedPasswordHash("correct horse battery staple")
+	list, err := LoadBreachedPasswordList(strings.NewReader(
+		"\n" + strings.ToLower(prefix+suffix) + ":3730471\n",
+	))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v", err)
+	}
+	isBreached, _ := list.IsBreached("correct horse battery staple")
+	if !isBreached {
+		t.Errorf("expected password in list to be breached")
+	}
+	isBreached, _ = list.IsBreached("Lantern-Harbour-42")
+	if isBreached {
+		t.Errorf("didn't expect password not in list to be breached")
+	}
+	_, err = LoadBreachedPasswordList(strings.NewReader("not-a-hash\n"))
+	if err == nil {
+		t.Errorf("expected error loading a list that is not of hashes")
+	}
+}
+
+func TestBreachedPasswordRanges(t *testing.T) {
+	prefix, suffix := breachedPasswordHash("correct horse battery staple")
+	otherPrefix, otherSuffix := breachedPasswordHash("tr0ub4dor&3")
+	ranges := NewBreachedPasswordRanges(fstest.MapFS{
+		prefix + ".txt": {Data: []byte("0000000000000000000000000000000000A:1\r\n" + strings.ToLower(suffix) + ":12\r\n")},
+		otherPrefix:     {Data: []byte(otherSuffix + "\n")},
+	})
+	for _, password := range []string{"correct horse battery staple", "tr0ub4dor&3"} {
+		isBreached, err := ranges.IsBreached(password)
+		if err != nil || !isBreached {
+			t.Errorf("expected %s to be breached, got %t %v", password, isBreached, err)
+		}
+	}
+	isBreached, err := ranges.IsBreached("Lantern-Harbour-42")
+	if err != nil || isBreached {
+		t.Errorf("didn't expect password without a range to be breached, got %t %v", isBreached, err)
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadBreachedPasswords(dir)
+	if err == nil {
+		t.Errorf("expected error loading an empty directory")
+	}
+	_, err = LoadBreachedPasswords(filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Errorf("expected error loading a path that does not exist")
+	}
+	prefix, suffix := breachedPasswordHash("correct horse battery staple")
+	err = os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(suffix+":1\n"), 0o644)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v", err)
+	}
+	checker, err := LoadBreachedPasswords(dir)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v", err)
+	}
+	isBreached, err := checker.IsBreached("correct horse battery staple")
+	if err != nil || !isBreached {
+		t.Errorf("expected password in range to be breached, got %t %v", isBreached, err)
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/ratelimit"
+)
+
+/*
+RateLimitService is a ratelimit.Store that keeps its buckets in Postgres, so that rate limits survive restarts and are
+shared between every instance of the server.
+*/
+type RateLimitService struct {
+	db *sql.DB
+}
+
+func (rls *RateLimitService) Take(key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	tx, err := rls.db.Begin()
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("take rate limit token: %w", err)
+	}
+	defer tx.Rollback()
+	newBucket := ratelimit.NewBucket(limit, now)
+	_, err = tx.Exec(`
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (key) DO NOTHING;
+	`, key, newBucket.Tokens, now)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("take rate limit token: %w", err)
+	}
+	// the bucket stays locked until the transaction is committed, so concurrent requests take tokens one after another
+	bucket := ratelimit.Bucket{}
+	row := tx.QueryRow(`
+		SELECT tokens, updated_at
+		FROM rate_limit_buckets
+		WHERE key = ($1)
+		FOR UPDATE;
+	`, key)
+	err = row.Scan(&bucket.Tokens, &bucket.UpdatedAt)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("take rate limit token: %w", err)
+	}
+	result := bucket.Take(limit, now)
+	_, err = tx.Exec(`
+		UPDATE rate_limit_buckets
+		SET tokens = ($2),
+			updated_at = ($3),
+			full_at = ($4)
+		WHERE key = ($1);
+	`, key, bucket.Tokens, bucket.UpdatedAt, bucket.FullAt(limit))
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("take rate limit token: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("take rate limit token: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteFullBuckets deletes the buckets that are full again by now, as a new bucket would be created the same
+func (rls *RateLimitService) DeleteFullBuckets(now time.Time) (int64, error) {
+	result, err := rls.db.Exec(`
+		DELETE FROM rate_limit_buckets
+		WHERE full_at <= ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete full rate limit buckets: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/ratelimit"
+)
+
+func TestRateLimitService(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 2, Per: time.Minute}
+	key := "test:ip:203.0.113.7"
+	now := time.Now().Truncate(time.Second)
+	defer dbc.RateLimitService.DeleteFullBuckets(now.Add(time.Hour))
+
+	for i := 0; i < 2; i++ {
+		result, err := dbc.RateLimitService.Take(key, limit, now)
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+			return
+		}
+		if !result.IsAllowed {
+			t.Errorf("request %d: expected to be allowed", i)
+		}
+	}
+	result, err := dbc.RateLimitService.Take(key, limit, now)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if result.IsAllowed || result.RetryAfter != 30*time.Second {
+		t.Errorf("expected to be turned away for 30s, got %+v", result)
+	}
+
+	numDeleted, err := dbc.RateLimitService.DeleteFullBuckets(now.Add(30 * time.Second))
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if numDeleted != 0 {
+		t.Errorf("expected bucket not to be deleted before it is full, %d were deleted", numDeleted)
+	}
+	result, err = dbc.RateLimitService.Take(key, limit, now.Add(30*time.Second))
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if !result.IsAllowed {
+		t.Errorf("expected a refilled token to be taken, got %+v", result)
+	}
+}
+
+func TestGetOptionalRateLimit(t *testing.T) {
+	defaultLimit := ratelimit.Limit{Requests: 10, Per: time.Minute}
+	limit, err := (&Envs{}).GetOptionalRateLimit("RATELIMITTEST", defaultLimit)
+	if err != nil || limit != defaultLimit {
+		t.Errorf("got %+v %v, want the default limit when not set\n", limit, err)
+	}
+	t.Setenv("RATELIMITTEST", "5/30s")
+	limit, err = (&Envs{}).GetOptionalRateLimit("RATELIMITTEST", defaultLimit)
+	if err != nil || limit != (ratelimit.Limit{Requests: 5, Per: 30 * time.Second}) {
+		t.Errorf("got %+v %v, want the limit set in the environment\n", limit, err)
+	}
+	for _, invalid := range []string{"5", "five/30s", "0/30s", "5/thirty seconds"} {
+		t.Setenv("RATELIMITTEST", invalid)
+		_, err = (&Envs{}).GetOptionalRateLimit("RATELIMITTEST", defaultLimit)
+		if err == nil {
+			t.Errorf("expected error with %s, didn't get one", invalid)
+		}
+	}
+}
@@ -7,14 +7,27 @@ import (
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
+	"github.com/sohWenMing/lenslocked/storage"
 )
 
 type DBConnections struct {
-	UserService     *UserService
-	SessionService  *SessionService
-	ForgotPWService *ForgotPWService
-	GalleryService  *GalleryService
-	DB              *sql.DB
+	UserService              *UserService
+	SessionService           *SessionService
+	ForgotPWService          *ForgotPWService
+	GalleryService           *GalleryService
+	APITokenService          *APITokenService
+	TwoFactorService         *TwoFactorService
+	EmailVerificationService *EmailVerificationService
+	LoginThrottleService     *LoginThrottleService
+	RateLimitService         *RateLimitService
+	EmailChangeService       *EmailChangeService
+	IdentityService          *IdentityService
+	MagicLinkService         *MagicLinkService
+	PasskeyService           *PasskeyService
+	DataExportService        *DataExportService
+	AccountDeletionService   *AccountDeletionService
+	AdminService             *AdminService
+	DB                       *sql.DB
 }
 
 type PgConfig struct {
@@ -59,17 +72,64 @@ func InitDBConnections(config DBConfig) (dbc *DBConnections, err error) {
 		return nil, err
 	}
 	sessionServicePtr := &SessionService{
+		db, DefaultSessionLifetimes(),
+	}
+	twoFactorServicePtr := &TwoFactorService{
 		db,
 	}
+	passkeyServicePtr := &PasskeyService{
+		db, DefaultRelyingParty,
+	}
 	userServicePtr := &UserService{
 		db,
 		sessionServicePtr,
+		twoFactorServicePtr,
+		passkeyServicePtr,
+		DefaultPasswordPolicy(),
 	}
 	forgotEmailServicePtr := &ForgotPWService{
 		db,
 	}
 	galleryServicePtr := &GalleryService{
-		db, "",
+		db, storage.NewLocalStore("images"),
+	}
+	apiTokenServicePtr := &APITokenService{
+		db,
+	}
+	emailVerificationServicePtr := &EmailVerificationService{
+		db,
+	}
+	loginThrottleServicePtr := &LoginThrottleService{
+		db, DefaultLoginThrottlePolicies(),
+	}
+	rateLimitServicePtr := &RateLimitService{
+		db,
+	}
+	emailChangeServicePtr := &EmailChangeService{
+		db,
+	}
+	identityServicePtr := &IdentityService{
+		db,
+	}
+	magicLinkServicePtr := &MagicLinkService{
+		db,
+	}
+	dataExportServicePtr := &DataExportService{
+		db,
+		galleryServicePtr,
+		identityServicePtr,
+		passkeyServicePtr,
+		apiTokenServicePtr,
+		twoFactorServicePtr,
+	}
+	accountDeletionServicePtr := &AccountDeletionService{
+		db,
+		galleryServicePtr,
+		dataExportServicePtr,
+	}
+	adminServicePtr := &AdminService{
+		db,
+		sessionServicePtr,
 	}
 	fmt.Println("DB Connection has been initialised")
 	dbc = &DBConnections{
@@ -77,6 +137,18 @@ func InitDBConnections(config DBConfig) (dbc *DBConnections, err error) {
 		sessionServicePtr,
 		forgotEmailServicePtr,
 		galleryServicePtr,
+		apiTokenServicePtr,
+		twoFactorServicePtr,
+		emailVerificationServicePtr,
+		loginThrottleServicePtr,
+		rateLimitServicePtr,
+		emailChangeServicePtr,
+		identityServicePtr,
+		magicLinkServicePtr,
+		passkeyServicePtr,
+		dataExportServicePtr,
+		accountDeletionServicePtr,
+		adminServicePtr,
 		db,
 	}
 	return dbc, nil
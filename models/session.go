@@ -22,10 +22,59 @@ type Session struct {
 	*/
 	Token     string
 	TokenHash string
+	// the fields below are only set when listing the sessions of a user
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// SessionDevice describes the device a session was signed in from, so the user can recognise it on the sessions page
+type SessionDevice struct {
+	UserAgent string
+	IPAddress string
+}
+
+/*
+SessionLifetimes are how long sessions last. A session expires once it has not been used for its idle lifetime, and
+however much it is used, once its absolute lifetime has passed since it was created. Sessions signed in with
+"remember me" use the longer RememberMe lifetimes.
+
+So that every request does not have to write to the database, a session's expiry is only pushed back once it would move
+by more than RefreshInterval - the idle lifetime of a session can be short by up to RefreshInterval.
+*/
+type SessionLifetimes struct {
+	Idle               time.Duration
+	Absolute           time.Duration
+	RememberMeIdle     time.Duration
+	RememberMeAbsolute time.Duration
+	RefreshInterval    time.Duration
+}
+
+func DefaultSessionLifetimes() SessionLifetimes {
+	return SessionLifetimes{
+		Idle:               15 * time.Minute,
+		Absolute:           12 * time.Hour,
+		RememberMeIdle:     14 * 24 * time.Hour,
+		RememberMeAbsolute: 30 * 24 * time.Hour,
+		RefreshInterval:    time.Minute,
+	}
+}
+
+// Validate checks that the lifetimes are positive, and that no idle lifetime is longer than its absolute lifetime
+func (sl SessionLifetimes) Validate() error {
+	if sl.Idle <= 0 || sl.Absolute <= 0 || sl.RememberMeIdle <= 0 || sl.RememberMeAbsolute <= 0 || sl.RefreshInterval < 0 {
+		return errors.New("session lifetimes must be more than zero")
+	}
+	if sl.Idle > sl.Absolute || sl.RememberMeIdle > sl.RememberMeAbsolute {
+		return errors.New("the idle lifetime of a session cannot be longer than its absolute lifetime")
+	}
+	return nil
 }
 
 type SessionService struct {
-	db *sql.DB
+	db        *sql.DB
+	Lifetimes SessionLifetimes
 }
 
 /*
@@ -73,13 +122,15 @@ func (ss *SessionService) CreateSession(userID int) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	expiresOn := time.Now().Add(15 * time.Minute).UTC()
+	now := time.Now().UTC()
+	absoluteExpiresOn := now.Add(ss.Lifetimes.Absolute)
+	expiresOn := minTime(now.Add(ss.Lifetimes.Idle), absoluteExpiresOn)
 
 	row := ss.db.QueryRow(`
-	INSERT into sessions(user_id, token_hash, expires_on)
-	VALUES($1, $2, $3)
+	INSERT into sessions(user_id, token_hash, expires_on, absolute_expires_on)
+	VALUES($1, $2, $3, $4)
 	returning id, user_id, token_hash, expires_on;
-	`, userID, tokenHash, expiresOn)
+	`, userID, tokenHash, expiresOn, absoluteExpiresOn)
 
 	returnedSession := &Session{}
 	returnedSession.Token = token
@@ -94,19 +145,113 @@ func (ss *SessionService) CreateSession(userID int) (*Session, error) {
 }
 
 /*
-Will expire all sessions related to the userId that is passed on - and then create a new session and return.
-If error occurs, session returned will be nil
+RememberSession turns a session that has just been created into a "remember me" session, which lasts for the longer
+RememberMe lifetimes.
 */
-func (ss *SessionService) ExpirePreviousSessionsAndCreateNewSessionByUserId(userID int) (session *Session, err error) {
-	err = ss.ExpireSessionsTokensByUserId(userID)
+func (ss *SessionService) RememberSession(token string) error {
+	now := time.Now().UTC()
+	result, err := ss.db.Exec(`
+		UPDATE sessions
+		SET is_remember_me = TRUE,
+			absolute_expires_on = created_at + make_interval(secs => $2),
+			expires_on = LEAST($3, created_at + make_interval(secs => $2))
+		WHERE token_hash = ($1)
+		AND is_expired = FALSE;
+	`, HashSessionToken(token), ss.Lifetimes.RememberMeAbsolute.Seconds(), now.Add(ss.Lifetimes.RememberMeIdle))
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("remember session: %w", err)
 	}
-	session, err = ss.CreateSession(userID)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("remember session: %w", err)
+	}
+	if rowsAffected == 0 {
+		return HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoSessionFound})
+	}
+	return nil
+}
+
+// SetDevice records the device a session was signed in from, against the session of the token
+func (ss *SessionService) SetDevice(token string, device SessionDevice) error {
+	_, err := ss.db.Exec(`
+		UPDATE sessions
+		SET user_agent = ($1),
+			ip_address = ($2)
+		WHERE token_hash = ($3);
+	`, device.UserAgent, device.IPAddress, HashSessionToken(token))
+	if err != nil {
+		return fmt.Errorf("set session device: %w", err)
+	}
+	return nil
+}
+
+/*
+GetActiveSessionsByUserId returns the sessions of a user that have not been signed out or expired, most recently seen
+first.
+*/
+func (ss *SessionService) GetActiveSessionsByUserId(userID int) ([]*Session, error) {
+	rows, err := ss.db.Query(`
+		SELECT id, user_id, token_hash, user_agent, ip_address, created_at, last_seen_at
+		FROM sessions
+		WHERE user_id = ($1)
+		AND is_expired = FALSE
+		AND expires_on > now()
+		ORDER BY last_seen_at DESC;
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get active sessions: %w", err)
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(&session.ID, &session.UserID, &session.TokenHash, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return nil, fmt.Errorf("get active sessions: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get active sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// ExpireSessionByIdAndUserId signs out one session of a user. The session must belong to the user
+func (ss *SessionService) ExpireSessionByIdAndUserId(userID int, sessionID int) error {
+	result, err := ss.db.Exec(`
+		UPDATE sessions
+		SET is_expired = TRUE
+		WHERE id = ($1)
+		AND user_id = ($2)
+		AND is_expired = FALSE;
+	`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("expire session: %w", err)
 	}
-	return session, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("expire session: %w", err)
+	}
+	if rowsAffected == 0 {
+		return HandlePgError(sql.ErrNoRows, &sqlNoRowsErrStruct{NoSessionFound})
+	}
+	return nil
+}
+
+// ExpireOtherSessionsByUserId signs out every session of a user, except the session of the token passed in
+func (ss *SessionService) ExpireOtherSessionsByUserId(userID int, token string) error {
+	_, err := ss.db.Exec(`
+		UPDATE sessions
+		SET is_expired = TRUE
+		WHERE user_id = ($1)
+		AND token_hash != ($2);
+	`, userID, HashSessionToken(token))
+	if err != nil {
+		return fmt.Errorf("expire other sessions: %w", err)
+	}
+	return nil
 }
 
 func (ss *SessionService) ExpireSessionsTokensByUserId(userID int) error {
@@ -133,15 +278,27 @@ func (ss *SessionService) ExpireSessionByToken(token string) error {
 	return nil
 }
 
+/*
+RefreshSession pushes back the idle expiry of the session of the token, without going past its absolute expiry. The
+session is only written to once its expiry would move by more than Lifetimes.RefreshInterval, so last_seen_at is only
+as accurate as RefreshInterval.
+*/
 func (ss *SessionService) RefreshSession(token string, requestTime time.Time) (returnedSession *Session, err error) {
 	tokenHash := HashSessionToken(token)
-	newExpiry := requestTime.Add(15 * time.Minute)
+	newExpiry := requestTime.Add(ss.Lifetimes.Idle)
+	newRememberMeExpiry := requestTime.Add(ss.Lifetimes.RememberMeIdle)
 	row := ss.db.QueryRow(`
-	UPDATE sessions
-	Set expires_on=($1)
-	WHERE token_hash=($2)
-	returning id, user_id, token_hash
-	`, newExpiry, tokenHash)
+	WITH refreshed AS (
+		UPDATE sessions
+		SET expires_on = LEAST(CASE WHEN is_remember_me THEN $3 ELSE $2 END, absolute_expires_on),
+			last_seen_at = ($4)
+		WHERE token_hash = ($1)
+		AND expires_on < LEAST(CASE WHEN is_remember_me THEN $3 ELSE $2 END, absolute_expires_on) - make_interval(secs => $5)
+	)
+	SELECT id, user_id, token_hash
+	FROM sessions
+	WHERE token_hash = ($1);
+	`, tokenHash, newExpiry, newRememberMeExpiry, requestTime, ss.Lifetimes.RefreshInterval.Seconds())
 	var session Session
 	err = row.Scan(&session.ID, &session.UserID, &session.TokenHash)
 	if err != nil {
@@ -168,6 +325,22 @@ func (ss *SessionService) GetNonExpiredSessionsByUserId(userID int) (numSessions
 	return count, nil
 }
 
+/*
+DeleteExpiredSessions deletes the sessions that have been signed out, or that expired before now, returning the number
+deleted.
+*/
+func (ss *SessionService) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := ss.db.Exec(`
+		DELETE FROM sessions
+		WHERE is_expired = TRUE
+		OR expires_on < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 func (ss *SessionService) DeleteAllSessionsTokensByUserId(userID int) (err error) {
 	_, err = ss.db.Exec(`
 	DELETE from sessions
@@ -225,6 +398,13 @@ func VerifySessionToken(token string, hash string) (isVerified bool, err error)
 	return true, nil
 }
 
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
 func randBytes(numBytes int) ([]byte, error) {
 	bytes := make([]byte, numBytes)
 	nRead, nErr := rand.Read(bytes)
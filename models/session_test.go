@@ -1,6 +1,9 @@
 package models
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestHashSessionToken(t *testing.T) {
 	type test struct {
@@ -75,3 +78,221 @@ func TestVerifySessionToken(t *testing.T) {
 	}
 
 }
+
+func TestMultipleSessions(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+	credentials := UserEmailToPlainTextPassword{"test_user@gmail.com", "Holoq123holoq123"}
+
+	laptop, err := dbc.UserService.LoginUser(credentials)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	phone, err := dbc.UserService.LoginUser(credentials)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	err = dbc.SessionService.SetDevice(phone.Token, SessionDevice{"Mozilla/5.0 (iPhone)", "10.0.0.2"})
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+
+	sessions, err := dbc.SessionService.GetActiveSessionsByUserId(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	// the session created on sign up, and both sign ins
+	if len(sessions) != 3 {
+		t.Errorf("got %d active sessions, want 3\n", len(sessions))
+		return
+	}
+	for _, session := range sessions {
+		if session.ID == phone.Session.ID && (session.UserAgent != "Mozilla/5.0 (iPhone)" || session.IPAddress != "10.0.0.2") {
+			t.Errorf("got device %s %s, want the device set on the session\n", session.UserAgent, session.IPAddress)
+		}
+	}
+
+	err = dbc.SessionService.ExpireSessionByIdAndUserId(userId+1, phone.Session.ID)
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error expiring another user's session, got %v\n", err)
+	}
+	err = dbc.SessionService.ExpireSessionByIdAndUserId(userId, phone.Session.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	err = dbc.SessionService.ExpireOtherSessionsByUserId(userId, laptop.Token)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	sessions, err = dbc.SessionService.GetActiveSessionsByUserId(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(sessions) != 1 || sessions[0].ID != laptop.Session.ID {
+		t.Errorf("expected only the laptop session to be left, got %d sessions\n", len(sessions))
+	}
+}
+
+func TestLoadSessionLifetimes(t *testing.T) {
+	t.Setenv("SESSIONIDLE", "30m")
+	t.Setenv("REMEMBERMEABSOLUTE", "1000h")
+	lifetimes, err := (&Envs{}).LoadSessionLifetimes()
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	defaults := DefaultSessionLifetimes()
+	if lifetimes.Idle != 30*time.Minute || lifetimes.RememberMeAbsolute != 1000*time.Hour {
+		t.Errorf("got %+v, want the lifetimes set in the environment\n", lifetimes)
+	}
+	if lifetimes.Absolute != defaults.Absolute || lifetimes.RememberMeIdle != defaults.RememberMeIdle {
+		t.Errorf("got %+v, want the defaults for lifetimes not set in the environment\n", lifetimes)
+	}
+
+	t.Setenv("SESSIONIDLE", "24h")
+	_, err = (&Envs{}).LoadSessionLifetimes()
+	if err == nil {
+		t.Errorf("expected error with an idle lifetime longer than the absolute lifetime, didn't get one")
+	}
+	t.Setenv("SESSIONIDLE", "fifteen minutes")
+	_, err = (&Envs{}).LoadSessionLifetimes()
+	if err == nil {
+		t.Errorf("expected error with a lifetime that is not a duration, didn't get one")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	ss := &SessionService{dbc.DB, SessionLifetimes{
+		Idle:               15 * time.Minute,
+		Absolute:           20 * time.Minute,
+		RememberMeIdle:     24 * time.Hour,
+		RememberMeAbsolute: 48 * time.Hour,
+		RefreshInterval:    time.Minute,
+	}}
+	now := time.Now()
+
+	session, err := ss.CreateSession(userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	lastSeenAt := func() time.Time {
+		sessions, err := ss.GetActiveSessionsByUserId(userIdToSession.UserID)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		for _, activeSession := range sessions {
+			if activeSession.ID == session.ID {
+				return activeSession.LastSeenAt
+			}
+		}
+		t.Fatalf("session %d is not active\n", session.ID)
+		return time.Time{}
+	}
+	createdLastSeenAt := lastSeenAt()
+
+	// the expiry would move by less than RefreshInterval, so the session is not written to
+	_, err = ss.RefreshSession(session.Token, now.Add(30*time.Second))
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if !lastSeenAt().Equal(createdLastSeenAt) {
+		t.Errorf("expected session not to be written to within the refresh interval")
+	}
+	_, err = ss.RefreshSession(session.Token, now.Add(10*time.Minute))
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if lastSeenAt().Equal(createdLastSeenAt) {
+		t.Errorf("expected session to be refreshed")
+	}
+	// refreshing pushed the idle expiry past 15 minutes, but it cannot go past the absolute expiry
+	if isExpired, _ := ss.CheckSessionExpired(session.Token, now.Add(19*time.Minute)); isExpired {
+		t.Errorf("expected session to still be valid before its absolute expiry")
+	}
+	if isExpired, _ := ss.CheckSessionExpired(session.Token, now.Add(21*time.Minute)); !isExpired {
+		t.Errorf("expected session to expire at its absolute expiry")
+	}
+
+	rememberedSession, err := ss.CreateSession(userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	err = ss.RememberSession(rememberedSession.Token)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if isExpired, _ := ss.CheckSessionExpired(rememberedSession.Token, now.Add(23*time.Hour)); isExpired {
+		t.Errorf("expected remembered session to last for the remember me idle lifetime")
+	}
+	if isExpired, _ := ss.CheckSessionExpired(rememberedSession.Token, now.Add(25*time.Hour)); !isExpired {
+		t.Errorf("expected remembered session to expire after the remember me idle lifetime")
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	ss := dbc.SessionService
+
+	expiredSession, err := ss.CreateSession(userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	err = ss.ExpireSessionByIdAndUserId(userIdToSession.UserID, expiredSession.ID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+
+	numDeleted, err := ss.DeleteExpiredSessions(time.Now())
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if numDeleted < 1 {
+		t.Errorf("expected expired session to be deleted, %d sessions were deleted", numDeleted)
+	}
+	sessions, err := ss.GetActiveSessionsByUserId(userIdToSession.UserID)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(sessions) != 1 || sessions[0].ID != userIdToSession.Session.ID {
+		t.Errorf("expected only the session created on sign up to be left, got %v", sessions)
+	}
+
+	// once the session created on sign up is past its expiry, it is deleted too
+	numDeleted, err = ss.DeleteExpiredSessions(time.Now().Add(ss.Lifetimes.Absolute + time.Minute))
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if numDeleted < 1 {
+		t.Errorf("expected session past its expiry to be deleted, %d sessions were deleted", numDeleted)
+	}
+}
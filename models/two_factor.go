@@ -0,0 +1,417 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/totp"
+)
+
+const (
+	// TwoFactorIssuer is the name authenticator apps show next to the codes for the application
+	TwoFactorIssuer = "Lenslocked"
+	// NumRecoveryCodes is the number of recovery codes generated at a time
+	NumRecoveryCodes = 10
+	// TwoFactorChallengeDuration is how long a user has to enter their code after entering their password
+	TwoFactorChallengeDuration = 5 * time.Minute
+	// MaxTwoFactorAttempts is the number of wrong codes that can be entered before the user must sign in again
+	MaxTwoFactorAttempts = 5
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+/*
+TwoFactorRequiredError is returned by UserService.LoginUser in place of a session, when the password entered matches
+for a user with two factor authentication enabled. The sign in is completed by passing Token to
+UserService.CompleteTwoFactorLogin along with a code from the user's authenticator app.
+
+As it is an error, anything that calls LoginUser without knowing about two factor authentication fails to sign in
+rather than skipping the second factor.
+*/
+type TwoFactorRequiredError struct {
+	UserID int
+	Token  string
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "a two factor authentication code is needed to finish signing in"
+}
+
+// TwoFactorStatus describes the two factor authentication set up of a user, for showing on their account page
+type TwoFactorStatus struct {
+	IsEnabled         bool
+	EnabledAt         time.Time
+	RecoveryCodesLeft int
+}
+
+/*
+TwoFactorService holds the TOTP secrets and recovery codes of users, and the challenges that sign ins are held in
+between the password and the code being entered.
+
+The TOTP secret has to be kept as is to generate codes from, so unlike passwords and tokens it is not hashed. Recovery
+codes are only kept hashed.
+*/
+type TwoFactorService struct {
+	db *sql.DB
+}
+
+func (ts *TwoFactorService) GetStatus(userId int) (TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	var enabledAt sql.NullTime
+	row := ts.db.QueryRow(`
+		SELECT users.totp_enabled_at,
+			(SELECT COUNT(*) FROM recovery_codes WHERE recovery_codes.user_id = users.id AND recovery_codes.used_at IS NULL)
+		FROM users
+		WHERE users.id = ($1);
+	`, userId)
+	err := row.Scan(&enabledAt, &status.RecoveryCodesLeft)
+	if err != nil {
+		return TwoFactorStatus{}, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	status.IsEnabled = enabledAt.Valid
+	status.EnabledAt = enabledAt.Time
+	return status, nil
+}
+
+/*
+BeginEnrollment generates a new TOTP secret for a user who does not have two factor authentication enabled. The secret
+is not used to sign in until the user proves their authenticator app has it, by passing a code to ConfirmEnrollment.
+*/
+func (ts *TwoFactorService) BeginEnrollment(userId int) (secret string, err error) {
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	result, err := ts.db.Exec(`
+		UPDATE users
+		SET totp_secret = ($1)
+		WHERE id = ($2)
+		AND totp_enabled_at IS NULL;
+	`, secret, userId)
+	if err != nil {
+		return "", fmt.Errorf("begin two factor enrollment %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("begin two factor enrollment %w", err)
+	}
+	if rowsAffected == 0 {
+		return "", MapHandledError(fmt.Errorf("user id passed in: %d", userId), "two factor authentication is already enabled")
+	}
+	return secret, nil
+}
+
+// GetPendingSecret returns the secret generated by BeginEnrollment, for showing again when a wrong code is entered
+func (ts *TwoFactorService) GetPendingSecret(userId int) (string, error) {
+	var secret sql.NullString
+	row := ts.db.QueryRow(`
+		SELECT totp_secret
+		FROM users
+		WHERE id = ($1)
+		AND totp_enabled_at IS NULL;
+	`, userId)
+	err := row.Scan(&secret)
+	if err != nil {
+		return "", HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	if !secret.Valid {
+		return "", MapHandledError(errors.New("no pending totp secret"), "two factor set up has not been started")
+	}
+	return secret.String, nil
+}
+
+/*
+ConfirmEnrollment enables two factor authentication for a user, if code is the current code for the secret generated
+by BeginEnrollment. The recovery codes generated for the user are returned - they are only kept hashed, so this is the
+only time they can be shown.
+*/
+func (ts *TwoFactorService) ConfirmEnrollment(userId int, code string) (recoveryCodes []string, err error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("confirm two factor enrollment: %w", err)
+	}
+	defer tx.Rollback()
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	row := tx.QueryRow(`
+		SELECT totp_secret, totp_enabled_at
+		FROM users
+		WHERE id = ($1)
+		FOR UPDATE;
+	`, userId)
+	err = row.Scan(&secret, &enabledAt)
+	if err != nil {
+		return nil, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	if enabledAt.Valid {
+		return nil, MapHandledError(fmt.Errorf("user id passed in: %d", userId), "two factor authentication is already enabled")
+	}
+	if !secret.Valid {
+		return nil, MapHandledError(errors.New("no pending totp secret"), "two factor set up has not been started")
+	}
+	step, isValid := totp.Validate(secret.String, code, time.Now(), 0)
+	if !isValid {
+		return nil, MapHandledError(errors.New("invalid totp code"), "the code entered is incorrect - check the time on your device and try again")
+	}
+	_, err = tx.Exec(`
+		UPDATE users
+		SET totp_enabled_at = now(),
+			totp_last_step = ($1)
+		WHERE id = ($2);
+	`, step, userId)
+	if err != nil {
+		return nil, fmt.Errorf("confirm two factor enrollment: %w", err)
+	}
+	recoveryCodes, err = replaceRecoveryCodes(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("confirm two factor enrollment: %w", err)
+	}
+	return recoveryCodes, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with two factor authentication enabled
+func (ts *TwoFactorService) RegenerateRecoveryCodes(userId int) ([]string, error) {
+	status, err := ts.GetStatus(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !status.IsEnabled {
+		return nil, MapHandledError(fmt.Errorf("user id passed in: %d", userId), "two factor authentication is not enabled")
+	}
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("regenerate recovery codes: %w", err)
+	}
+	defer tx.Rollback()
+	recoveryCodes, err := replaceRecoveryCodes(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("regenerate recovery codes: %w", err)
+	}
+	return recoveryCodes, nil
+}
+
+/*
+Disable turns off two factor authentication for a user, removing their secret and recovery codes. The user's password
+must be entered again, so that a session left signed in cannot be used to remove the second factor.
+*/
+func (ts *TwoFactorService) Disable(userId int, password string) error {
+	err := checkUserPassword(ts.db, userId, password)
+	if err != nil {
+		return err
+	}
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return fmt.Errorf("disable two factor: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE users
+		SET totp_secret = NULL,
+			totp_enabled_at = NULL,
+			totp_last_step = 0
+		WHERE id = ($1);
+	`, userId)
+	if err != nil {
+		return fmt.Errorf("disable two factor: %w", err)
+	}
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ($1);`, userId)
+	if err != nil {
+		return fmt.Errorf("disable two factor: %w", err)
+	}
+	_, err = tx.Exec(`DELETE FROM two_factor_challenges WHERE user_id = ($1);`, userId)
+	if err != nil {
+		return fmt.Errorf("disable two factor: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("disable two factor: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredChallenges deletes the sign ins that expired before now without a code being entered
+func (ts *TwoFactorService) DeleteExpiredChallenges(now time.Time) (int64, error) {
+	result, err := ts.db.Exec(`
+		DELETE FROM two_factor_challenges
+		WHERE expires_at < ($1);
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired two factor challenges: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// starts the challenge a sign in is held in until a code is entered. The returned token identifies the challenge
+func (ts *TwoFactorService) createChallenge(userId int) (string, error) {
+	token, tokenHash, err := tManager.New()
+	if err != nil {
+		return "", fmt.Errorf("create two factor challenge: %w", err)
+	}
+	_, err = ts.db.Exec(`
+		INSERT INTO two_factor_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3);
+	`, userId, tokenHash, time.Now().Add(TwoFactorChallengeDuration).UTC())
+	if err != nil {
+		return "", fmt.Errorf("create two factor challenge: %w", err)
+	}
+	return token, nil
+}
+
+/*
+GetChallengeEmail returns the email address of the user whose sign in is held by the challenge identified by token, so
+that wrong codes can be counted against their account as wrong passwords are.
+*/
+func (ts *TwoFactorService) GetChallengeEmail(token string) (string, error) {
+	var email string
+	row := ts.db.QueryRow(`
+		SELECT users.email
+		FROM two_factor_challenges
+		JOIN users ON users.id = two_factor_challenges.user_id
+		WHERE two_factor_challenges.token_hash = ($1)
+		AND two_factor_challenges.expires_at > now();
+	`, HashSessionToken(token))
+	err := row.Scan(&email)
+	if err != nil {
+		return "", HandlePgError(err, &sqlNoRowsErrStruct{NoTwoFactorChallengeFound})
+	}
+	return email, nil
+}
+
+/*
+completes the challenge identified by token if code is either the current TOTP code of the user, or one of their
+unused recovery codes, returning the id of the user. TOTP codes can only be used once, and recovery codes are marked
+as used. After MaxTwoFactorAttempts wrong codes the challenge is removed, and the user has to sign in again.
+*/
+func (ts *TwoFactorService) verifyChallenge(token string, code string) (int, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("verify two factor challenge: %w", err)
+	}
+	defer tx.Rollback()
+	var challengeId, userId, attempts int
+	var lastStep int64
+	var secret sql.NullString
+	row := tx.QueryRow(`
+		SELECT two_factor_challenges.id, two_factor_challenges.user_id, two_factor_challenges.attempts,
+			users.totp_secret, users.totp_last_step
+		FROM two_factor_challenges
+		JOIN users ON users.id = two_factor_challenges.user_id
+		WHERE two_factor_challenges.token_hash = ($1)
+		AND two_factor_challenges.expires_at > now()
+		AND users.totp_enabled_at IS NOT NULL
+		FOR UPDATE OF two_factor_challenges, users;
+	`, HashSessionToken(token))
+	err = row.Scan(&challengeId, &userId, &attempts, &secret, &lastStep)
+	if err != nil {
+		return 0, HandlePgError(err, &sqlNoRowsErrStruct{NoTwoFactorChallengeFound})
+	}
+	if attempts >= MaxTwoFactorAttempts {
+		_, err = tx.Exec(`DELETE FROM two_factor_challenges WHERE id = ($1);`, challengeId)
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		return 0, MapHandledError(sql.ErrNoRows, NoTwoFactorChallengeFound.String())
+	}
+
+	isVerified := false
+	if step, isValid := totp.Validate(secret.String, code, time.Now(), lastStep); isValid {
+		_, err = tx.Exec(`UPDATE users SET totp_last_step = ($1) WHERE id = ($2);`, step, userId)
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		isVerified = true
+	} else {
+		result, err := tx.Exec(`
+			UPDATE recovery_codes
+			SET used_at = now()
+			WHERE user_id = ($1)
+			AND code_hash = ($2)
+			AND used_at IS NULL;
+		`, userId, hashRecoveryCode(code))
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		isVerified = rowsAffected == 1
+	}
+
+	if !isVerified {
+		_, err = tx.Exec(`UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE id = ($1);`, challengeId)
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return 0, fmt.Errorf("verify two factor challenge: %w", err)
+		}
+		return 0, MapHandledError(errors.New("invalid two factor code"), "the code entered is incorrect")
+	}
+	_, err = tx.Exec(`DELETE FROM two_factor_challenges WHERE id = ($1);`, challengeId)
+	if err != nil {
+		return 0, fmt.Errorf("verify two factor challenge: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("verify two factor challenge: %w", err)
+	}
+	return userId, nil
+}
+
+// replaces every recovery code of a user with NumRecoveryCodes new ones, returning the new codes
+func replaceRecoveryCodes(tx *sql.Tx, userId int) ([]string, error) {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ($1);`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("replace recovery codes: %w", err)
+	}
+	recoveryCodes := make([]string, NumRecoveryCodes)
+	for i := range recoveryCodes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO recovery_codes (user_id, code_hash)
+			VALUES ($1, $2);
+		`, userId, hashRecoveryCode(code))
+		if err != nil {
+			return nil, fmt.Errorf("replace recovery codes: %w", err)
+		}
+		recoveryCodes[i] = code
+	}
+	return recoveryCodes, nil
+}
+
+// recovery codes are 8 lower case characters, split in two by a dash to make them easier to copy down
+func generateRecoveryCode() (string, error) {
+	bytes, err := randBytes(5)
+	if err != nil {
+		return "", fmt.Errorf("generate recovery code: %w", err)
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(bytes))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// recovery codes are hashed without their dash, spaces or case, so they can be entered however they were copied down
+func hashRecoveryCode(code string) string {
+	normalised := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	return HashSessionToken(normalised)
+}
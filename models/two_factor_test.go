@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/totp"
+)
+
+func TestTwoFactorSignIn(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+	credentials := UserEmailToPlainTextPassword{"test_user@gmail.com", "Holoq123holoq123"}
+
+	secret, err := dbc.TwoFactorService.BeginEnrollment(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.TwoFactorService.ConfirmEnrollment(userId, "000000")
+	if err == nil {
+		t.Errorf("expected error confirming with a wrong code, didn't get one")
+	}
+	code, _ := totp.Code(secret, time.Now())
+	recoveryCodes, err := dbc.TwoFactorService.ConfirmEnrollment(userId, code)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if len(recoveryCodes) != NumRecoveryCodes {
+		t.Errorf("got %d recovery codes, want %d\n", len(recoveryCodes), NumRecoveryCodes)
+		return
+	}
+
+	login := func() string {
+		_, err := dbc.UserService.LoginUser(credentials)
+		var twoFactorRequiredErr *TwoFactorRequiredError
+		if !errors.As(err, &twoFactorRequiredErr) {
+			t.Fatalf("expected a TwoFactorRequiredError, got %v\n", err)
+		}
+		return twoFactorRequiredErr.Token
+	}
+
+	token := login()
+	email, err := dbc.TwoFactorService.GetChallengeEmail(token)
+	if err != nil || email != credentials.Email {
+		t.Errorf("got %q %v, want %q\n", email, err, credentials.Email)
+	}
+	_, err = dbc.TwoFactorService.GetChallengeEmail("not a challenge")
+	if !IsNoRowsErr(err) {
+		t.Errorf("expected no rows error for an unknown challenge, got %v\n", err)
+	}
+	_, err = dbc.UserService.CompleteTwoFactorLogin(token, code)
+	if err == nil {
+		t.Errorf("expected error reusing the code used to confirm, didn't get one")
+	}
+	nextCode, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	loggedInUser, err := dbc.UserService.CompleteTwoFactorLogin(token, nextCode)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if loggedInUser.UserID != userId || loggedInUser.Session.Token == "" {
+		t.Errorf("expected a session for user %d, got %v\n", userId, loggedInUser)
+	}
+	_, err = dbc.UserService.CompleteTwoFactorLogin(token, nextCode)
+	if err == nil {
+		t.Errorf("expected error reusing a completed challenge, didn't get one")
+	}
+
+	token = login()
+	_, err = dbc.UserService.CompleteTwoFactorLogin(token, recoveryCodes[0])
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	token = login()
+	_, err = dbc.UserService.CompleteTwoFactorLogin(token, recoveryCodes[0])
+	if err == nil {
+		t.Errorf("expected error reusing a recovery code, didn't get one")
+	}
+
+	status, err := dbc.TwoFactorService.GetStatus(userId)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	if !status.IsEnabled || status.RecoveryCodesLeft != NumRecoveryCodes-1 {
+		t.Errorf("got %+v, want enabled with %d recovery codes left\n", status, NumRecoveryCodes-1)
+	}
+
+	err = dbc.TwoFactorService.Disable(userId, "wrong password")
+	if err == nil {
+		t.Errorf("expected error disabling with the wrong password, didn't get one")
+	}
+	err = dbc.TwoFactorService.Disable(userId, credentials.PlainTextPassword)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.UserService.LoginUser(credentials)
+	if err != nil {
+		t.Errorf("expected to sign in without a code once disabled, got %v\n", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,10 +23,29 @@ type UserIdToSession struct {
 }
 
 type UserInfo struct {
-	ID    int
-	Email string
+	ID            int
+	Email         string
+	EmailVerified bool
+	Role          UserRole
 }
 
+// UserRole decides what a user is allowed to do beyond looking after their own account and galleries
+type UserRole string
+
+const (
+	RoleUser UserRole = "user"
+	// RoleAdmin users can use the admin console to look after the accounts of other users
+	RoleAdmin UserRole = "admin"
+)
+
+func (userInfo UserInfo) IsAdmin() bool {
+	return userInfo.Role == RoleAdmin
+}
+
+// ErrAccountDisabled is returned when a user whose account has been disabled by an admin tries to sign in
+var ErrAccountDisabled = MapHandledError(errors.New("account disabled"),
+	"this account has been disabled - please contact us if you think this is a mistake")
+
 func (userInfo *UserInfo) String() string {
 	return fmt.Sprintf("UserId: %d Email: %s", userInfo.ID, userInfo.Email)
 }
@@ -40,6 +60,10 @@ type internalUserStruct struct {
 type UserService struct {
 	db *sql.DB
 	*SessionService
+	twoFactorService *TwoFactorService
+	passkeyService   *PasskeyService
+	// PasswordPolicy is what new passwords are checked against when signing up, resetting or changing a password
+	PasswordPolicy PasswordPolicy
 }
 
 func (us *UserService) UpdatePasswordHash(userId int, hash string) error {
@@ -61,12 +85,127 @@ func (us *UserService) UpdatePasswordHash(userId int, hash string) error {
 	return nil
 }
 
+/*
+ChangePassword changes the password of a signed in user, once their current password has been checked. Signing out their
+other sessions is left to the caller, which knows which session the change was made from.
+*/
+func (us *UserService) ChangePassword(userId int, currentPassword, newPassword string) error {
+	err := checkUserPassword(us.db, userId, currentPassword)
+	if err != nil {
+		return err
+	}
+	if newPassword == currentPassword {
+		return MapHandledError(errors.New("new password is the same as the current one"),
+			"the new password must be different from the current one")
+	}
+	return us.ResetPassword(userId, newPassword)
+}
+
+/*
+ResetPassword sets a new password for the user without asking for their current one, once the password policy has been
+checked - it is for when the user has already proven who they are some other way, such as with a reset password link.
+A *PasswordPolicyError is returned if the new password does not meet the policy.
+*/
+func (us *UserService) ResetPassword(userId int, newPassword string) error {
+	user, err := us.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	err = us.PasswordPolicy.Validate(newPassword, user.Email)
+	if err != nil {
+		return err
+	}
+	hash, err := GenerateBcryptHash(newPassword)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	err = us.UpdatePasswordHash(userId, hash)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	return nil
+}
+
+/*
+ResetPasswordWithToken sets a new password for the user a reset password link was made for. The password policy is
+checked before the link is used up, so a password it refuses can be retried with the same link. The link, along with any
+others made for the user, is then deleted in the same transaction that sets the password, so a link can never be used
+to set the password twice. If the link has expired or has already been used, an error for NoResetPasswordTokenFound is
+returned.
+*/
+func (us *UserService) ResetPasswordWithToken(token uuid.UUID, newPassword string) error {
+	noTokenErr := &sqlNoRowsErrStruct{NoResetPasswordTokenFound}
+	var userId int
+	var email string
+	row := us.db.QueryRow(`
+		SELECT users.id, users.email
+		FROM forgot_password_tokens
+		JOIN users ON users.id = forgot_password_tokens.user_id
+		WHERE forgot_password_tokens.token = ($1)
+		AND forgot_password_tokens.expires_on > now();
+	`, token)
+	err := row.Scan(&userId, &email)
+	if err != nil {
+		return HandlePgError(err, noTokenErr)
+	}
+	err = us.PasswordPolicy.Validate(newPassword, email)
+	if err != nil {
+		return err
+	}
+	hash, err := GenerateBcryptHash(newPassword)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+
+	tx, err := us.db.Begin()
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	defer tx.Rollback()
+	// the link is deleted first, so that if it was used up since it was looked up above, nothing is changed
+	result, err := tx.Exec(`
+		DELETE FROM forgot_password_tokens
+		WHERE token = ($1)
+		AND user_id = ($2)
+		AND expires_on > now();
+	`, token, userId)
+	err = checkOneRowAffected(result, err, noTokenErr)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM forgot_password_tokens
+		WHERE user_id = ($1);
+	`, userId)
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	result, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = ($2)
+		WHERE id = ($1);
+	`, userId, hash)
+	err = checkOneRowAffected(result, err, UserNotFoundByUserIdErr())
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return MapHandledGenericError(err)
+	}
+	return nil
+}
+
+// CreateUser signs up a new user. A *PasswordPolicyError is returned if their password does not meet the password policy
 func (us *UserService) CreateUser(newUserToCreate UserEmailToPlainTextPassword) (*UserIdToSession, error) {
-	err := validateEmailAndPassword(newUserToCreate.Email, newUserToCreate.PlainTextPassword)
+	if !isValidEmail(newUserToCreate.Email) {
+		return nil, MapHandledError(errors.New("email is not valid"), "email is not valid")
+	}
+	preppedInfo := setEmailLowerCaseInUserToPlainTextPassword(newUserToCreate)
+	err := us.PasswordPolicy.Validate(preppedInfo.PlainTextPassword, preppedInfo.Email)
 	if err != nil {
 		return nil, err
 	}
-	preppedInfo := setEmailLowerCaseInUserToPlainTextPassword(newUserToCreate)
 	hash, err := GenerateBcryptHash(preppedInfo.PlainTextPassword)
 	if err != nil {
 		return nil, err
@@ -95,12 +234,12 @@ func (us *UserService) CreateUser(newUserToCreate UserEmailToPlainTextPassword)
 
 func (us *UserService) GetUserByEmail(email string) (userIdToEmail UserInfo, err error) {
 	row := us.db.QueryRow(`
-		SELECT id, email 
+		SELECT id, email, email_verified_at IS NOT NULL, role
 		  FROM users
 		 WHERE users.email = ($1);
 	`, email)
 	var uIdToEmail UserInfo
-	err = row.Scan(&uIdToEmail.ID, &uIdToEmail.Email)
+	err = row.Scan(&uIdToEmail.ID, &uIdToEmail.Email, &uIdToEmail.EmailVerified, &uIdToEmail.Role)
 	if err != nil {
 		return UserInfo{}, HandlePgError(err, UserNotFoundByUserIdErr())
 	}
@@ -110,12 +249,12 @@ func (us *UserService) GetUserByEmail(email string) (userIdToEmail UserInfo, err
 
 func (us *UserService) GetUserById(userId int) (userIdToEmail UserInfo, err error) {
 	row := us.db.QueryRow(`
-		SELECT id, email 
+		SELECT id, email, email_verified_at IS NOT NULL, role
 		  FROM users
 		 WHERE users.id = ($1);
 	`, userId)
 	var uIdToEmail UserInfo
-	err = row.Scan(&uIdToEmail.ID, &uIdToEmail.Email)
+	err = row.Scan(&uIdToEmail.ID, &uIdToEmail.Email, &uIdToEmail.EmailVerified, &uIdToEmail.Role)
 	if err != nil {
 		return UserInfo{}, HandlePgError(err, UserNotFoundByUserIdErr())
 	}
@@ -123,18 +262,22 @@ func (us *UserService) GetUserById(userId int) (userIdToEmail UserInfo, err erro
 }
 
 func (us *UserService) LoginUser(userToPassword UserEmailToPlainTextPassword) (user *UserIdToSession, err error) {
-	err = validateEmailAndPassword(userToPassword.Email, userToPassword.PlainTextPassword)
-	if err != nil {
-		return nil, err
+	// the password policy is not checked here, as passwords set before it was changed must still be able to sign in
+	if !isValidEmail(userToPassword.Email) {
+		return nil, errors.New("email is not valid")
+	}
+	if userToPassword.PlainTextPassword == "" {
+		return nil, errors.New("password is not valid")
 	}
 	preppedInfo := setEmailLowerCaseInUserToPlainTextPassword(userToPassword)
 	row := us.db.QueryRow(`
-		SELECT id, email, password_hash 
+		SELECT id, email, password_hash, totp_enabled_at IS NOT NULL
 		FROM  users
 		WHERE email=($1);
 	`, preppedInfo.Email)
 	var internalUser internalUserStruct
-	err = row.Scan(&internalUser.ID, &internalUser.Email, &internalUser.PasswordHash)
+	var isTwoFactorEnabled bool
+	err = row.Scan(&internalUser.ID, &internalUser.Email, &internalUser.PasswordHash, &isTwoFactorEnabled)
 	if err != nil {
 		return nil, HandlePgError(err, UserNotFoundByEmailErr())
 	}
@@ -142,7 +285,43 @@ func (us *UserService) LoginUser(userToPassword UserEmailToPlainTextPassword) (u
 	if err != nil {
 		return nil, HandlerBcryptErr(err)
 	}
-	session, err := us.SessionService.ExpirePreviousSessionsAndCreateNewSessionByUserId(internalUser.ID)
+	if isTwoFactorEnabled {
+		token, err := us.twoFactorService.createChallenge(internalUser.ID)
+		if err != nil {
+			return nil, MapHandledGenericError(err)
+		}
+		return nil, &TwoFactorRequiredError{internalUser.ID, token}
+	}
+	return us.startSession(internalUser)
+}
+
+/*
+CompleteTwoFactorLogin finishes a sign in that LoginUser returned a TwoFactorRequiredError for. code can be either the
+current code from the user's authenticator app, or one of their recovery codes.
+*/
+func (us *UserService) CompleteTwoFactorLogin(token string, code string) (user *UserIdToSession, err error) {
+	userId, err := us.twoFactorService.verifyChallenge(token, code)
+	if err != nil {
+		return nil, err
+	}
+	return us.startSession(internalUserStruct{ID: userId})
+}
+
+/*
+creates a new session for a user who has just signed in. Sessions on their other devices are left signed in. Every way
+of signing in ends here, so this is where users whose account has been disabled are turned away.
+*/
+func (us *UserService) startSession(internalUser internalUserStruct) (user *UserIdToSession, err error) {
+	var isDisabled bool
+	row := us.db.QueryRow(`SELECT disabled_at IS NOT NULL FROM users WHERE id = ($1);`, internalUser.ID)
+	err = row.Scan(&isDisabled)
+	if err != nil {
+		return nil, HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	if isDisabled {
+		return nil, ErrAccountDisabled
+	}
+	session, err := us.SessionService.CreateSession(internalUser.ID)
 	if err != nil {
 		handlerError := HandlePgError(err, NewSessionNotReturnedErr())
 		//TODO change Print to log function
@@ -187,37 +366,90 @@ func (us *UserService) DeleteUserAndSession(userId int) (err error) {
 	return err
 }
 
-// preps the UserToPlainTextPassword struct by lowercasing the email to ensure consistency
-func setEmailLowerCaseInUserToPlainTextPassword(u UserEmailToPlainTextPassword) UserEmailToPlainTextPassword {
-	u.Email = strings.ToLower(u.Email)
-	return u
+/*
+checks the password entered by a signed in user who is asked for it again before changing something important, so that
+a session left signed in cannot be used to take over the account.
+*/
+func checkUserPassword(db *sql.DB, userId int, password string) error {
+	var passwordHash string
+	row := db.QueryRow(`
+		SELECT password_hash
+		FROM users
+		WHERE id = ($1);
+	`, userId)
+	err := row.Scan(&passwordHash)
+	if err != nil {
+		return HandlePgError(err, UserNotFoundByUserIdErr())
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return MapHandledError(err, "the password entered is incorrect")
+		}
+		return MapHandledGenericError(err)
+	}
+	return nil
 }
 
-func validateEmailAndPassword(email, password string) error {
-	if !isValidEmail(email) {
-		return errors.New("email is not valid")
+/*
+readies a user whose email address was never verified to be signed in to by whoever has just proven they own it, with a
+provider or a sign in link. The user may have been signed up by someone else before the owner arrived, so every way that
+someone could have set up to sign in without the email address is taken away - the password is replaced with one nobody
+knows, and the sessions, API tokens, two factor authentication, passkeys and linked identities are all removed, along
+with any sign in or email change link that is waiting to be used. The address is then marked as verified. It must be
+run in the same transaction as the sign in, so that it cannot be raced.
+*/
+func takeOverUnverifiedUser(tx *sql.Tx, userId int) error {
+	password, _, err := tManager.New()
+	if err != nil {
+		return err
 	}
-	if !isValidPassword(password) {
-		return errors.New("password is not valid")
+	hash, err := GenerateBcryptHash(password)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = ($2),
+			email_verified_at = now(),
+			totp_secret = NULL,
+			totp_enabled_at = NULL,
+			totp_last_step = 0
+		WHERE id = ($1);
+	`, userId, hash)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		`UPDATE sessions SET is_expired = true WHERE user_id = ($1);`,
+		`UPDATE api_tokens SET revoked_at = now() WHERE user_id = ($1) AND revoked_at IS NULL;`,
+		`DELETE FROM recovery_codes WHERE user_id = ($1);`,
+		`DELETE FROM two_factor_challenges WHERE user_id = ($1);`,
+		`DELETE FROM passkeys WHERE user_id = ($1);`,
+		`DELETE FROM webauthn_challenges WHERE user_id = ($1);`,
+		`DELETE FROM user_identities WHERE user_id = ($1);`,
+		`DELETE FROM email_change_tokens WHERE user_id = ($1);`,
+		`DELETE FROM magic_link_tokens WHERE user_id = ($1);`,
+	} {
+		_, err = tx.Exec(query, userId)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// preps the UserToPlainTextPassword struct by lowercasing the email to ensure consistency
+func setEmailLowerCaseInUserToPlainTextPassword(u UserEmailToPlainTextPassword) UserEmailToPlainTextPassword {
+	u.Email = strings.ToLower(u.Email)
+	return u
+}
+
 func isValidEmail(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
 }
 
-func isValidPassword(password string) bool {
-	if password == "" {
-		return false
-	}
-	if len(password) < 6 {
-		return false
-	}
-	return true
-}
-
 func mapInternalUserToReturnedUser(internalUser internalUserStruct) *UserIdToSession {
 	returnedUser := &UserIdToSession{
 		internalUser.ID, internalUser.Session,
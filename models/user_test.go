@@ -213,8 +213,9 @@ func TestDeleteUser(t *testing.T) {
 				t.Errorf("didn't expect error, got %v\n", err)
 				return
 			}
-			if nonExpiredCount != 1 {
-				t.Errorf("expected nonExpiredCount %d, got %d", 1, nonExpiredCount)
+			// signing in leaves the session created on sign up signed in
+			if nonExpiredCount != 2 {
+				t.Errorf("expected nonExpiredCount %d, got %d", 2, nonExpiredCount)
 			}
 			err = dbc.UserService.DeleteUserAndSession(loggedInUser.ID)
 			if err != nil {
@@ -367,7 +368,7 @@ func TestGetUserById(t *testing.T) {
 			"",
 			baseUserEmailToPlainTextPassword,
 			false,
-			UserInfo{0, strings.ToLower(baseUserEmailToPlainTextPassword.Email)},
+			UserInfo{0, strings.ToLower(baseUserEmailToPlainTextPassword.Email), false, RoleUser},
 		},
 		{
 			"testing userId that does not exist",
@@ -375,7 +376,7 @@ func TestGetUserById(t *testing.T) {
 			"No user could be found with that user id",
 			baseUserEmailToPlainTextPassword,
 			true,
-			UserInfo{0, strings.ToLower(baseUserEmailToPlainTextPassword.Email)},
+			UserInfo{0, strings.ToLower(baseUserEmailToPlainTextPassword.Email), false, RoleUser},
 		},
 	}
 	for _, test := range tests {
@@ -428,3 +429,45 @@ func TestGetUserById(t *testing.T) {
 		})
 	}
 }
+
+func TestChangePassword(t *testing.T) {
+	userIdToSession, shouldReturn := CreateTestUser(t)
+	if shouldReturn {
+		return
+	}
+	defer dbc.UserService.DeleteUserAndSession(userIdToSession.UserID)
+	userId := userIdToSession.UserID
+
+	type test struct {
+		name            string
+		currentPassword string
+		newPassword     string
+	}
+	tests := []test{
+		{"wrong current password", "not-the-password", "NewPassword123"},
+		{"invalid new password", "Holoq123holoq123", "short"},
+		{"same password", "Holoq123holoq123", "Holoq123holoq123"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := dbc.UserService.ChangePassword(userId, test.currentPassword, test.newPassword)
+			if !IsUserFacingErr(err) {
+				t.Errorf("expected user facing error, got %v\n", err)
+			}
+		})
+	}
+
+	err := dbc.UserService.ChangePassword(userId, "Holoq123holoq123", "NewPassword123")
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+		return
+	}
+	_, err = dbc.UserService.LoginUser(UserEmailToPlainTextPassword{"test_user@gmail.com", "Holoq123holoq123"})
+	if err == nil {
+		t.Errorf("expected error signing in with the old password, didn't get one")
+	}
+	_, err = dbc.UserService.LoginUser(UserEmailToPlainTextPassword{"test_user@gmail.com", "NewPassword123"})
+	if err != nil {
+		t.Errorf("didn't expect error signing in with the new password, got %v\n", err)
+	}
+}
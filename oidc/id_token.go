@@ -0,0 +1,341 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ClockSkew is how far the clocks of the provider and relying party can differ before ID tokens are refused
+	ClockSkew = time.Minute
+	// how long after fetching the signing keys they can be fetched again for a token signed with a key not in them
+	keyRefetchInterval = time.Minute
+)
+
+/*
+Claims are the claims of a verified ID token. EmailVerified is only true if the provider says it has checked that the
+user owns Email - an email address that has not been verified must not be trusted to be the user's.
+*/
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   boolish  `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// audience is the aud claim, which can be either a single string or an array of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	err := json.Unmarshal(b, &multiple)
+	if err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// boolish is a boolean claim that some providers send as the string "true" or "false"
+type boolish bool
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("%s is not a boolean", data)
+	}
+	return nil
+}
+
+/*
+VerifyIDToken verifies the signature of rawIDToken against the provider's signing keys, checks that it was issued by the
+provider for this client and has not expired, and that its nonce is nonce. The claims of the token are returned once it
+has been verified.
+*/
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string, now time.Time) (*Claims, error) {
+	_, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: it is not a signed JWT", ErrInvalidIDToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidIDToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidIDToken, err)
+	}
+	key, err := p.keys.get(ctx, p, header.Kid, header.Alg, now)
+	if err != nil {
+		return nil, err
+	}
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims := &Claims{}
+	err = decodeSegment(parts[1], claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidIDToken, err)
+	}
+	err = p.checkClaims(claims, nonce, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	return claims, nil
+}
+
+// checks the claims of an ID token as section 3.1.3.7 of OpenID Connect Core asks
+func (p *Provider) checkClaims(claims *Claims, nonce string, now time.Time) error {
+	if claims.Issuer != p.Issuer {
+		return fmt.Errorf("issued by %s", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("it has no subject")
+	}
+	if !slices.Contains(claims.Audience, p.ClientID) {
+		return fmt.Errorf("it is not for this client")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return fmt.Errorf("it was not issued to this client")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(ClockSkew)) {
+		return fmt.Errorf("it expired at %s", time.Unix(claims.ExpiresAt, 0).UTC())
+	}
+	if time.Unix(claims.IssuedAt, 0).After(now.Add(ClockSkew)) {
+		return fmt.Errorf("it was issued in the future")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return fmt.Errorf("its nonce does not match")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// the signing algorithms that are supported, and the hash each uses. "none" and the HMAC algorithms are never accepted
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	hashFunc, isSupported := signingHashes[alg]
+	if !isSupported {
+		return fmt.Errorf("signing algorithm %q is not supported", alg)
+	}
+	var h hash.Hash
+	switch hashFunc {
+	case crypto.SHA256:
+		h = sha256.New()
+	case crypto.SHA384:
+		h = sha512.New384()
+	default:
+		h = sha512.New()
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("key is not for %s", alg)
+		}
+		err := rsa.VerifyPKCS1v15(key, hashFunc, digest, signature)
+		if err != nil {
+			return fmt.Errorf("signature does not match")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("key is not for %s", alg)
+		}
+		// JWS ECDSA signatures are r and s, each padded to the size of the curve
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("signature does not match")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("signature does not match")
+		}
+		return nil
+	default:
+		return fmt.Errorf("key type %T is not supported", key)
+	}
+}
+
+/*
+keySet holds a provider's signing keys from its JWKS document. The keys are fetched again when a token is signed with
+a key that is not in them, as providers rotate their keys, but no more often than keyRefetchInterval so that tokens
+with made up key ids cannot be used to flood the provider with requests.
+*/
+type keySet struct {
+	uri string
+
+	mu        sync.Mutex
+	keys      []jsonWebKey
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	publicKey crypto.PublicKey
+}
+
+func (ks *keySet) get(ctx context.Context, p *Provider, kid string, alg string, now time.Time) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, isFound := ks.find(kid, alg)
+	if isFound {
+		return key, nil
+	}
+	if !ks.fetchedAt.IsZero() && now.Sub(ks.fetchedAt) < keyRefetchInterval {
+		return nil, fmt.Errorf("%w: signing key %q was not found", ErrInvalidIDToken, kid)
+	}
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := p.getJSON(ctx, ks.uri, &document)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetch signing keys: %w", err)
+	}
+	ks.keys = ks.keys[:0]
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		jwk.publicKey, err = jwk.parse()
+		if err != nil {
+			// a key of a type that is not supported should not stop the others from being used
+			continue
+		}
+		ks.keys = append(ks.keys, jwk)
+	}
+	ks.fetchedAt = now
+	key, isFound = ks.find(kid, alg)
+	if !isFound {
+		return nil, fmt.Errorf("%w: signing key %q was not found", ErrInvalidIDToken, kid)
+	}
+	return key, nil
+}
+
+// returns the key with kid, or the only key if kid is empty and there is just one that can be used for alg
+func (ks *keySet) find(kid string, alg string) (crypto.PublicKey, bool) {
+	var matches []crypto.PublicKey
+	for _, jwk := range ks.keys {
+		if jwk.Alg != "" && jwk.Alg != alg {
+			continue
+		}
+		if kid != "" && jwk.Kid == kid {
+			return jwk.publicKey, true
+		}
+		if kid == "" {
+			matches = append(matches, jwk.publicKey)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], true
+	}
+	return nil, false
+}
+
+func (jwk jsonWebKey) parse() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("rsa exponent is not valid")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("curve %s is not supported", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("ec point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key type %s is not supported", jwk.Kty)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Package oidc implements the relying party side of OpenID Connect sign in - the authorization code flow with PKCE, and
+verifying the ID token that is returned. Providers are configured with their issuer URL, and the rest of what is needed
+is read from the issuer's discovery document the first time the provider is used.
+*/
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScopes are the scopes asked for when a provider is not configured with any
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// ErrInvalidIDToken is wrapped by every error returned because an ID token could not be verified
+var ErrInvalidIDToken = errors.New("oidc: id token is not valid")
+
+// Config is what a relying party needs to know about a provider, most of which comes from registering with it
+type Config struct {
+	// Name identifies the provider in URLs and in the identities linked to users, and should not be changed once used
+	Name string
+	// DisplayName is shown on the buttons to sign in with the provider
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to once they have signed in, and must be registered with it
+	RedirectURL string
+	Scopes      []string
+}
+
+// Metadata is the part of a provider's discovery document that is used
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+/*
+Provider is an OpenID Connect provider that users can sign in with. It is safe for concurrent use. The discovery
+document and signing keys are fetched when first needed rather than when the provider is created, so that a provider
+that cannot be reached does not stop the server from starting.
+*/
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+// NewProvider returns a Provider for cfg, which makes its requests with client, or http.DefaultClient if it is nil
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultScopes
+	}
+	return &Provider{Config: cfg, client: client}
+}
+
+/*
+AuthRequest holds the values that tie an authorization request to the callback that finishes it. State is sent back
+with the callback, Nonce is put in the ID token, and CodeVerifier is the PKCE secret that the authorization code can
+only be exchanged with. All three must be kept by the relying party until the callback, and none reused.
+*/
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewAuthRequest returns an AuthRequest of newly generated random values
+func NewAuthRequest() (AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value, err := randomString()
+		if err != nil {
+			return AuthRequest{}, fmt.Errorf("oidc: new auth request: %w", err)
+		}
+		values[i] = value
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// returns 32 random bytes encoded as base64url, which is also a valid PKCE code verifier of 43 characters
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE code challenge of verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider to send the user to, to sign in for req
+func (p *Provider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: parse authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("code_challenge", CodeChallenge(req.CodeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Tokens is the response of the token endpoint
+type Tokens struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+/*
+Exchange exchanges the authorization code sent to the callback for the user's tokens. codeVerifier must be the
+CodeVerifier of the AuthRequest the code was issued for.
+*/
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string) (*Tokens, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic is the method providers must support when none is registered
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		var tokenErr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		json.Unmarshal(body, &tokenErr)
+		return nil, fmt.Errorf("oidc: exchange code: %s %s %s", res.Status, tokenErr.Error, tokenErr.ErrorDescription)
+	}
+	tokens := &Tokens{}
+	err = json.Unmarshal(body, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("oidc: exchange code: no id token was returned")
+	}
+	return tokens, nil
+}
+
+/*
+Authenticate finishes the sign in of req once the provider has sent the user back with code, exchanging the code and
+returning the claims of the verified ID token.
+*/
+func (p *Provider) Authenticate(ctx context.Context, code string, req AuthRequest, now time.Time) (*Claims, error) {
+	tokens, err := p.Exchange(ctx, code, req.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.VerifyIDToken(ctx, tokens.IDToken, req.Nonce, now)
+}
+
+// discover returns the provider's metadata, fetching its discovery document if it has not been fetched yet
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	wellKnown := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	metadata := &Metadata{}
+	err := p.getJSON(ctx, wellKnown, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discover %s: %w", p.Issuer, err)
+	}
+	// the issuer in the document must be the one configured, or ID tokens from another issuer could be accepted
+	if metadata.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: discover %s: document is for issuer %s", p.Issuer, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discover %s: document is missing endpoints", p.Issuer)
+	}
+	p.metadata = metadata
+	p.keys = &keySet{uri: metadata.JWKSURI}
+	return metadata, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,160 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sohWenMing/lenslocked/oidc"
+	"github.com/sohWenMing/lenslocked/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:3000/signin/oidc/stub/callback"
+
+func newStub(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	stub, server, err := oidctest.NewServer("lenslocked", "client-secret")
+	if err != nil {
+		t.Fatalf("didn't expect error starting stub provider, got %v", err)
+	}
+	t.Cleanup(server.Close)
+	return stub, oidc.NewProvider(stub.Config("stub", redirectURL), server.Client())
+}
+
+// follows the redirect to the stub's authorize endpoint, returning the query of the redirect back to the callback
+func authorize(t *testing.T, provider *oidc.Provider, req oidc.AuthRequest) url.Values {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("didn't expect error getting auth code url, got %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("didn't expect error authorizing, got %v", err)
+	}
+	defer res.Body.Close()
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect to callback, got %s %q", res.Status, res.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+func TestAuthenticate(t *testing.T) {
+	stub, provider := newStub(t)
+	stub.SetUser(oidctest.User{Subject: "1234", Email: "jane@example.com", EmailVerified: true, Name: "Jane"})
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v", err)
+	}
+	callback := authorize(t, provider, req)
+	if callback.Get("state") != req.State {
+		t.Errorf("expected state %q, got %q", req.State, callback.Get("state"))
+	}
+	claims, err := provider.Authenticate(context.Background(), callback.Get("code"), req, time.Now())
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v", err)
+	}
+	if claims.Subject != "1234" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+		t.Errorf("expected claims of the stub user, got %+v", claims)
+	}
+	_, err = provider.Authenticate(context.Background(), callback.Get("code"), req, time.Now())
+	if err == nil {
+		t.Errorf("expected error using a code twice")
+	}
+}
+
+func TestAuthenticateWrongCodeVerifier(t *testing.T) {
+	_, provider := newStub(t)
+	req, _ := oidc.NewAuthRequest()
+	callback := authorize(t, provider, req)
+	otherReq, _ := oidc.NewAuthRequest()
+	req.CodeVerifier = otherReq.CodeVerifier
+	_, err := provider.Authenticate(context.Background(), callback.Get("code"), req, time.Now())
+	if err == nil {
+		t.Errorf("expected error exchanging a code with the wrong code verifier")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	stub, provider := newStub(t)
+	now := time.Now()
+	user := oidctest.User{Subject: "1234", Email: "jane@example.com"}
+	type test struct {
+		name      string
+		modify    func(claims map[string]any)
+		isErrWant bool
+	}
+	tests := []test{
+		{"valid", func(map[string]any) {}, false},
+		{"email verified as a string", func(c map[string]any) { c["email_verified"] = "true" }, false},
+		{"wrong nonce", func(c map[string]any) { c["nonce"] = "other" }, true},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }, true},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "other-client" }, true},
+		{"audiences without azp", func(c map[string]any) { c["aud"] = []string{"lenslocked", "other"} }, true},
+		{"audiences with azp", func(c map[string]any) {
+			c["aud"] = []string{"lenslocked", "other"}
+			c["azp"] = "lenslocked"
+		}, false},
+		{"expired", func(c map[string]any) { c["exp"] = now.Add(-2 * oidc.ClockSkew).Unix() }, true},
+		{"issued in the future", func(c map[string]any) { c["iat"] = now.Add(2 * oidc.ClockSkew).Unix() }, true},
+		{"no subject", func(c map[string]any) { c["sub"] = "" }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := stub.Claims(user, "nonce")
+			test.modify(claims)
+			idToken, err := stub.SignIDToken(claims)
+			if err != nil {
+				t.Fatalf("didn't expect error signing token, got %v", err)
+			}
+			_, err = provider.VerifyIDToken(context.Background(), idToken, "nonce", now)
+			switch test.isErrWant {
+			case true:
+				if !errors.Is(err, oidc.ErrInvalidIDToken) {
+					t.Errorf("expected ErrInvalidIDToken, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Errorf("didn't expect error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenTampered(t *testing.T) {
+	stub, provider := newStub(t)
+	idToken, _ := stub.SignIDToken(stub.Claims(oidctest.User{Subject: "1234"}, "nonce"))
+	otherToken, _ := stub.SignIDToken(stub.Claims(oidctest.User{Subject: "5678"}, "nonce"))
+	// the claims of one token with the signature of another
+	tampered := idToken[:len(idToken)-len(signatureOf(idToken))] + signatureOf(otherToken)
+	_, err := provider.VerifyIDToken(context.Background(), tampered, "nonce", time.Now())
+	if !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("expected ErrInvalidIDToken for a tampered token, got %v", err)
+	}
+	unsigned := idToken[:len(idToken)-len(signatureOf(idToken))]
+	_, err = provider.VerifyIDToken(context.Background(), unsigned, "nonce", time.Now())
+	if !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("expected ErrInvalidIDToken for a token without a signature, got %v", err)
+	}
+}
+
+func signatureOf(token string) string {
+	return token[strings.LastIndex(token, ".")+1:]
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// the example of appendix B of RFC 7636
+	challenge := oidc.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("expected challenge of RFC 7636, got %s", challenge)
+	}
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// how often MemoryStore deletes the buckets that have filled back up
+const memorySweepInterval = time.Minute
+
+/*
+MemoryStore keeps buckets in memory. It is only suitable when a single instance of the server is run, as each instance
+would otherwise have buckets of its own.
+*/
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSwept time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	fullAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*memoryBucket{},
+	}
+}
+
+func (ms *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if now.Sub(ms.lastSwept) >= memorySweepInterval {
+		ms.sweep(now)
+	}
+	bucket, isFound := ms.buckets[key]
+	if !isFound {
+		bucket = &memoryBucket{Bucket: NewBucket(limit, now)}
+		ms.buckets[key] = bucket
+	}
+	result := bucket.Take(limit, now)
+	bucket.fullAt = bucket.FullAt(limit)
+	return result, nil
+}
+
+// Len returns how many buckets are being kept
+func (ms *MemoryStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.buckets)
+}
+
+// deletes the buckets that are full again, as a new bucket would be created the same. ms.mu must be held
+func (ms *MemoryStore) sweep(now time.Time) {
+	for key, bucket := range ms.buckets {
+		if !bucket.fullAt.After(now) {
+			delete(ms.buckets, key)
+		}
+	}
+	ms.lastSwept = now
+}
@@ -0,0 +1,77 @@
+/*
+Package ratelimit limits how often something can be done with token buckets. Each key has a bucket that holds up to
+Limit.Requests tokens and refills at Limit.Requests every Limit.Per - every request takes a token, and is turned away
+when the bucket is empty.
+
+The buckets are kept in a Store. MemoryStore keeps them in the memory of the process, and models.RateLimitService keeps
+them in Postgres so that they are shared between every instance of the server.
+*/
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit allows bursts of up to Requests requests, and Requests requests every Per after that
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// refillInterval is how long it takes for one token to be added back to a bucket
+func (l Limit) refillInterval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+// Result is what happened when a token was taken from a bucket
+type Result struct {
+	IsAllowed bool
+	// Remaining is how many whole tokens are left in the bucket
+	Remaining int
+	// RetryAfter is how long until the next request will be allowed, if this one was not
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	// Take takes a token from the bucket of key, which is created full if it does not exist
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Bucket is the state of the bucket of one key, for stores to keep
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// NewBucket returns a full bucket
+func NewBucket(limit Limit, now time.Time) Bucket {
+	return Bucket{float64(limit.Requests), now}
+}
+
+// Take refills the bucket for the time that has passed since it was last updated, and takes a token if there is one
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return Result{IsAllowed: false, RetryAfter: limit.Per}
+	}
+	elapsed := now.Sub(b.UpdatedAt)
+	if elapsed > 0 {
+		b.Tokens = math.Min(float64(limit.Requests), b.Tokens+float64(elapsed)/float64(limit.refillInterval()))
+		b.UpdatedAt = now
+	}
+	if b.Tokens < 1 {
+		retryAfter := time.Duration(math.Ceil((1 - b.Tokens) * float64(limit.refillInterval())))
+		return Result{IsAllowed: false, Remaining: 0, RetryAfter: retryAfter}
+	}
+	b.Tokens--
+	return Result{IsAllowed: true, Remaining: int(b.Tokens)}
+}
+
+// FullAt returns when the bucket will be full again, after which it is no different from a new bucket
+func (b *Bucket) FullAt(limit Limit) time.Time {
+	if limit.Requests <= 0 {
+		return b.UpdatedAt
+	}
+	missing := float64(limit.Requests) - b.Tokens
+	return b.UpdatedAt.Add(time.Duration(math.Ceil(missing * float64(limit.refillInterval()))))
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 3, Per: 3 * time.Second}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take("ip:203.0.113.7", limit, now)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v", err)
+		}
+		if !result.IsAllowed || result.Remaining != 2-i {
+			t.Errorf("request %d: expected to be allowed with %d remaining, got %+v", i, 2-i, result)
+		}
+	}
+	result, _ := store.Take("ip:203.0.113.7", limit, now.Add(500*time.Millisecond))
+	if result.IsAllowed {
+		t.Errorf("expected request to be turned away once the bucket is empty")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected to retry after 500ms, got %v", result.RetryAfter)
+	}
+	// other keys have buckets of their own
+	result, _ = store.Take("ip:203.0.113.8", limit, now)
+	if !result.IsAllowed {
+		t.Errorf("expected request for another key to be allowed")
+	}
+	// a token is added back every second
+	result, _ = store.Take("ip:203.0.113.7", limit, now.Add(time.Second))
+	if !result.IsAllowed || result.Remaining != 0 {
+		t.Errorf("expected a refilled token to be taken, got %+v", result)
+	}
+	result, _ = store.Take("ip:203.0.113.7", limit, now.Add(time.Second))
+	if result.IsAllowed {
+		t.Errorf("expected request to be turned away once the refilled token was taken")
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Per: time.Minute}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Take("first", limit, now)
+	store.Take("second", limit, now)
+	if store.Len() != 2 {
+		t.Fatalf("expected 2 buckets, got %d", store.Len())
+	}
+	// first and second have refilled by the time the next sweep happens, and the bucket of third is new
+	store.Take("third", limit, now.Add(memorySweepInterval))
+	if store.Len() != 1 {
+		t.Errorf("expected full buckets to be swept, %d buckets are left", store.Len())
+	}
+}
+
+func TestBucketFullAt(t *testing.T) {
+	limit := Limit{Requests: 4, Per: 4 * time.Second}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket := NewBucket(limit, now)
+	if !bucket.FullAt(limit).Equal(now) {
+		t.Errorf("expected new bucket to be full now, got %v", bucket.FullAt(limit))
+	}
+	bucket.Take(limit, now)
+	bucket.Take(limit, now)
+	if expected := now.Add(2 * time.Second); !bucket.FullAt(limit).Equal(expected) {
+		t.Errorf("expected bucket to be full at %v, got %v", expected, bucket.FullAt(limit))
+	}
+}
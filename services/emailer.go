@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"html/template"
@@ -10,6 +11,7 @@ import (
 type Email struct {
 	From        string
 	To          string
+	Subject     string
 	Content     string
 	ContentType string
 	Cc          []string
@@ -19,6 +21,46 @@ type EmailData struct {
 	URL string
 }
 
+// GalleryInviteEmailData is used to render gallery_invite_email.gohtml
+type GalleryInviteEmailData struct {
+	URL          string
+	GalleryTitle string
+	InvitedBy    string
+	Role         string
+}
+
+// AccountLockedEmailData is used to render account_locked_email.gohtml
+type AccountLockedEmailData struct {
+	// URL is the link to reset the password of the account, in case it is being guessed
+	URL         string
+	IPAddress   string
+	LockedUntil string
+}
+
+/*
+EmailChangeEmailData is used to render confirm_email_change_email.gohtml, sent to the new address, and
+email_change_notice_email.gohtml, sent to the old one
+*/
+type EmailChangeEmailData struct {
+	URL      string
+	OldEmail string
+	NewEmail string
+}
+
+// IdentityLinkedEmailData is used to render identity_linked_email.gohtml
+type IdentityLinkedEmailData struct {
+	// URL is the account page, where the linked account can be unlinked
+	URL      string
+	Provider string
+}
+
+// AccountDeletionEmailData is used to render account_deletion_email.gohtml
+type AccountDeletionEmailData struct {
+	// URL is the account page, where the deletion can be cancelled
+	URL          string
+	ScheduledFor string
+}
+
 type EmailService struct {
 	Emailer
 	*EmailTemplate
@@ -32,6 +74,21 @@ func (e *EmailService) SendMail(email Email, writer io.Writer) error {
 	return nil
 }
 
+/*
+SendTemplateMail renders the email template named by templateName with data, and sends it as the HTML content of email.
+Any Content already set on email is replaced.
+*/
+func (e *EmailService) SendTemplateMail(email Email, templateName string, data any) error {
+	contentBuf := bytes.Buffer{}
+	err := e.EmailHTMLTpl.ExecuteTemplate(&contentBuf, templateName, data)
+	if err != nil {
+		return fmt.Errorf("rendering email template %s: %w", templateName, err)
+	}
+	email.Content = contentBuf.String()
+	email.ContentType = "text/html"
+	return e.SendMail(email, nil)
+}
+
 func InitEmailService(emailer Emailer, emailTemplate *EmailTemplate) *EmailService {
 	return &EmailService{
 		emailer, emailTemplate,
@@ -48,6 +105,17 @@ type EmailTemplate struct {
 
 var emailTplStrings = []string{
 	"reset_password_email.gohtml",
+	"gallery_invite_email.gohtml",
+	"verify_email.gohtml",
+	"account_locked_email.gohtml",
+	"confirm_email_change_email.gohtml",
+	"email_change_notice_email.gohtml",
+	"password_changed_email.gohtml",
+	"identity_linked_email.gohtml",
+	"magic_link_email.gohtml",
+	"account_deletion_email.gohtml",
+	"data_export_email.gohtml",
+	"password_reset_required_email.gohtml",
 }
 
 //go:embed email_templates
@@ -3,6 +3,7 @@ package services
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +22,174 @@ func TestResetPasswordTemplate(t *testing.T) {
 	}
 	fmt.Println("returned string:", buf.String())
 }
+
+func TestGalleryInviteTemplate(t *testing.T) {
+	testData := GalleryInviteEmailData{
+		URL:          "https://www.google.com/galleries/invites/accept?token=abc",
+		GalleryTitle: "Client Shoot",
+		InvitedBy:    "owner@gmail.com",
+		Role:         "editor",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "gallery_invite_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	for _, expected := range []string{testData.URL, testData.GalleryTitle, testData.InvitedBy, testData.Role} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected email to contain %s, got %s\n", expected, buf.String())
+		}
+	}
+}
+
+func TestVerifyEmailTemplate(t *testing.T) {
+	testData := EmailData{
+		URL: "https://www.google.com/verify_email?token=abc",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "verify_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	if !strings.Contains(buf.String(), testData.URL) {
+		t.Errorf("expected email to contain %s, got %s\n", testData.URL, buf.String())
+	}
+}
+
+func TestAccountLockedTemplate(t *testing.T) {
+	testData := AccountLockedEmailData{
+		URL:         "https://www.google.com/forgot_password",
+		IPAddress:   "203.0.113.7",
+		LockedUntil: "3:04PM UTC",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "account_locked_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	for _, expected := range []string{testData.URL, testData.IPAddress, testData.LockedUntil} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected email to contain %s, got %s\n", expected, buf.String())
+		}
+	}
+}
+
+func TestEmailChangeTemplates(t *testing.T) {
+	testData := EmailChangeEmailData{
+		URL:      "https://www.google.com/change_email?token=abc",
+		OldEmail: "old@gmail.com",
+		NewEmail: "new@gmail.com",
+	}
+	emailTemplate := LoadEmailTemplates()
+	for _, templateName := range []string{"confirm_email_change_email.gohtml", "email_change_notice_email.gohtml"} {
+		buf := bytes.Buffer{}
+		err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, templateName, testData)
+		if err != nil {
+			t.Errorf("didn't expect error, got %v\n", err)
+		}
+		for _, expected := range []string{testData.URL, testData.NewEmail} {
+			if !strings.Contains(buf.String(), expected) {
+				t.Errorf("expected %s to contain %s, got %s\n", templateName, expected, buf.String())
+			}
+		}
+	}
+}
+
+func TestPasswordChangedTemplate(t *testing.T) {
+	testData := EmailData{
+		URL: "https://www.google.com/forgot_password",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "password_changed_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	if !strings.Contains(buf.String(), testData.URL) {
+		t.Errorf("expected email to contain %s, got %s\n", testData.URL, buf.String())
+	}
+}
+
+func TestIdentityLinkedTemplate(t *testing.T) {
+	testData := IdentityLinkedEmailData{
+		URL:      "https://www.google.com/user/about",
+		Provider: "Google",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "identity_linked_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	for _, expected := range []string{testData.URL, testData.Provider} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected email to contain %s, got %s\n", expected, buf.String())
+		}
+	}
+}
+
+func TestMagicLinkTemplate(t *testing.T) {
+	testData := EmailData{
+		URL: "https://www.google.com/signin/magic_link?token=abc",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "magic_link_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	if !strings.Contains(buf.String(), testData.URL) {
+		t.Errorf("expected email to contain %s, got %s\n", testData.URL, buf.String())
+	}
+}
+
+func TestAccountDeletionTemplate(t *testing.T) {
+	testData := AccountDeletionEmailData{
+		URL:          "https://www.google.com/user/about",
+		ScheduledFor: "1 Feb 2026 10:00 UTC",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "account_deletion_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	for _, expected := range []string{testData.URL, testData.ScheduledFor} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected email to contain %s, got %s\n", expected, buf.String())
+		}
+	}
+}
+
+func TestDataExportTemplate(t *testing.T) {
+	testData := EmailData{
+		URL: "https://www.google.com/user/about",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "data_export_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	if !strings.Contains(buf.String(), testData.URL) {
+		t.Errorf("expected email to contain %s, got %s\n", testData.URL, buf.String())
+	}
+}
+
+func TestPasswordResetRequiredTemplate(t *testing.T) {
+	testData := EmailData{
+		URL: "https://www.google.com/forgot_password",
+	}
+	buf := bytes.Buffer{}
+	emailTemplate := LoadEmailTemplates()
+	err := emailTemplate.EmailHTMLTpl.ExecuteTemplate(&buf, "password_reset_required_email.gohtml", testData)
+	if err != nil {
+		t.Errorf("didn't expect error, got %v\n", err)
+	}
+	if !strings.Contains(buf.String(), testData.URL) {
+		t.Errorf("expected email to contain %s, got %s\n", testData.URL, buf.String())
+	}
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps objects as files on the local disk, underneath BaseDir
+type LocalStore struct {
+	BaseDir string
+}
+
+// NewLocalStore returns a pointer to a LocalStore rooted at baseDir. If baseDir is blank, "images" is used
+func NewLocalStore(baseDir string) *LocalStore {
+	if baseDir == "" {
+		baseDir = "images"
+	}
+	return &LocalStore{
+		BaseDir: baseDir,
+	}
+}
+
+func (ls *LocalStore) filePath(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(ls.BaseDir, filepath.FromSlash(cleaned)), nil
+}
+
+/*
+Put writes the contents to the file for key. The contents are first written to a temporary file in the same
+directory which is then renamed, so readers never see a partially written file.
+*/
+func (ls *LocalStore) Put(key string, contents io.Reader) error {
+	filePath, err := ls.filePath(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filePath)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("creating directory for %s: %w", key, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, contents)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("copying contents to %s: %w", key, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("closing temp file for %s: %w", key, err)
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return fmt.Errorf("setting permissions for %s: %w", key, err)
+	}
+	err = os.Rename(tmp.Name(), filePath)
+	if err != nil {
+		return fmt.Errorf("moving contents to %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens the file for key. The returned value is an *os.File, so callers may type assert to io.ReadSeeker
+func (ls *LocalStore) Get(key string) (io.ReadCloser, error) {
+	filePath, err := ls.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", key, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening %s: %w", key, err)
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrObjectNotFound
+	}
+	return file, nil
+}
+
+// List walks the directory tree under BaseDir and returns every file whose key starts with prefix, sorted by key
+func (ls *LocalStore) List(prefix string) ([]ObjectInfo, error) {
+	cleanedPrefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	objects := []ObjectInfo{}
+	err = filepath.WalkDir(ls.BaseDir, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		relPath, err := filepath.Rel(ls.BaseDir, walkPath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if !strings.HasPrefix(key, cleanedPrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", prefix, err)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// Delete removes the file for key. Deleting a key that does not exist is not an error
+func (ls *LocalStore) Delete(key string) error {
+	filePath, err := ls.filePath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+/*
+PruneEmptyDirs removes the directories underneath BaseDir that are empty and have not been modified since olderThan,
+returning the number removed. Directories are removed from the deepest up, so a directory left empty by removing the
+directories in it is removed as well. BaseDir itself is never removed.
+*/
+func (ls *LocalStore) PruneEmptyDirs(olderThan time.Time) (int, error) {
+	dirs := []string{}
+	err := filepath.WalkDir(ls.BaseDir, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && walkPath != ls.BaseDir {
+			dirs = append(dirs, walkPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("pruning empty directories: %w", err)
+	}
+	numPruned := 0
+	// WalkDir visits parents before their children, so going backwards removes the deepest directories first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil || len(entries) != 0 {
+			continue
+		}
+		info, err := os.Stat(dirs[i])
+		if err != nil || info.ModTime().After(olderThan) {
+			continue
+		}
+		// Remove fails if an object was put in the directory since it was read, which leaves it in place
+		if os.Remove(dirs[i]) == nil {
+			numPruned++
+		}
+	}
+	return numPruned, nil
+}
+
+func (ls *LocalStore) Stat(key string) (ObjectInfo, error) {
+	filePath, err := ls.filePath(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("stat %s: %w", key, err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	cleaned, _ := cleanKey(key)
+	return ObjectInfo{
+		Key:          cleaned,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}, nil
+}
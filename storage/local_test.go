@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	runStoreRoundTrip(t, store)
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	type test struct {
+		name string
+		key  string
+	}
+	tests := []test{
+		{"parent directory", "../secret.txt"},
+		{"nested parent directory", "1/../../secret.txt"},
+		{"backslash parent directory", "..\\secret.txt"},
+		{"empty key", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := store.Put(test.key, strings.NewReader("nope"))
+			if err == nil {
+				t.Errorf("expected error, didn't get one")
+			}
+		})
+	}
+}
+
+// runStoreRoundTrip exercises every method of the Store interface, and is shared by the tests of each implementation
+func runStoreRoundTrip(t *testing.T, store Store) {
+	t.Helper()
+	objects := map[string]string{
+		"1/first.jpg":        "first image",
+		"1/second image.png": "second image",
+		"1/thumbnail/a.jpg":  "thumbnail",
+		"2/other.gif":        "other gallery",
+	}
+	for key, contents := range objects {
+		err := store.Put(key, strings.NewReader(contents))
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+	}
+
+	for key, contents := range objects {
+		reader, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		if string(got) != contents {
+			t.Errorf("got %s, want %s\n", got, contents)
+		}
+		info, err := store.Stat(key)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		if info.Size != int64(len(contents)) {
+			t.Errorf("got size %d, want %d\n", info.Size, len(contents))
+		}
+	}
+
+	listed, err := store.List("1/")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	wantKeys := []string{"1/first.jpg", "1/second image.png", "1/thumbnail/a.jpg"}
+	if len(listed) != len(wantKeys) {
+		t.Fatalf("got %d objects, want %d: %v\n", len(listed), len(wantKeys), listed)
+	}
+	for i, object := range listed {
+		if object.Key != wantKeys[i] {
+			t.Errorf("got key %s, want %s\n", object.Key, wantKeys[i])
+		}
+	}
+
+	err = store.Delete("1/first.jpg")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = store.Get("1/first.jpg")
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("got err %v, want %v\n", err, ErrObjectNotFound)
+	}
+	_, err = store.Stat("1/first.jpg")
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("got err %v, want %v\n", err, ErrObjectNotFound)
+	}
+	err = store.Delete("1/first.jpg")
+	if err != nil {
+		t.Errorf("didn't expect error deleting missing key, got %v\n", err)
+	}
+}
+
+func TestLocalStorePruneEmptyDirs(t *testing.T) {
+	baseDir := t.TempDir()
+	store := NewLocalStore(baseDir)
+	for _, key := range []string{"1/a.jpg", "1/thumbnail/a.jpg", "2/thumbnail/b.jpg", "3/c.jpg"} {
+		err := store.Put(key, strings.NewReader("x"))
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+	}
+	for _, key := range []string{"1/thumbnail/a.jpg", "2/thumbnail/b.jpg"} {
+		err := store.Delete(key)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+	}
+
+	numPruned, err := store.PruneEmptyDirs(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if numPruned != 0 {
+		t.Errorf("got %d directories pruned, want none modified before the cut off", numPruned)
+	}
+
+	numPruned, err = store.PruneEmptyDirs(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	// 1/thumbnail, 2/thumbnail and then 2, which is left empty
+	if numPruned != 3 {
+		t.Errorf("got %d directories pruned, want %d", numPruned, 3)
+	}
+	for _, dir := range []string{"1/thumbnail", "2"} {
+		if _, err := os.Stat(filepath.Join(baseDir, dir)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s to be removed, got %v", dir, err)
+		}
+	}
+	for _, key := range []string{"1/a.jpg", "3/c.jpg"} {
+		if _, err := store.Stat(key); err != nil {
+			t.Errorf("expected %s to be kept, got %v", key, err)
+		}
+	}
+	if _, err := os.Stat(baseDir); err != nil {
+		t.Errorf("expected the base directory to be kept, got %v", err)
+	}
+}
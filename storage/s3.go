@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3Service        = "s3"
+	s3AmzDateFormat  = "20060102T150405Z"
+	s3DateOnlyFormat = "20060102"
+	// S3 requires every part of a multipart upload but the last to be at least 5 MiB
+	s3DefaultPartSize = 8 << 20
+)
+
+/*
+S3Store keeps objects in a bucket of an S3 compatible object store (AWS S3, MinIO, etc.).
+
+Requests are made with path style addressing (<Endpoint>/<Bucket>/<key>) and are signed with AWS Signature
+Version 4, so no SDK is required.
+*/
+type S3Store struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+	// Now is used to get the time that requests are signed with. Defaults to time.Now
+	Now func() time.Time
+	/*
+		PartSize is how much of an object is held in memory at once while it is put. Objects larger than it are sent with a
+		multipart upload, a part at a time. Defaults to 8 MiB, and must not be set below the 5 MiB S3 requires of a part.
+	*/
+	PartSize int64
+}
+
+// NewS3Store returns a pointer to an S3Store. If region is blank, "us-east-1" is used
+func NewS3Store(endpoint, bucket, region, accessKeyID, secretAccessKey string) *S3Store {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Store{
+		Endpoint:        strings.TrimRight(endpoint, "/"),
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Client:          &http.Client{Timeout: 60 * time.Second},
+		Now:             time.Now,
+	}
+}
+
+/*
+Put sends contents to key. S3 requires the length of each request up front, so contents are read a part at a time -
+objects that fit in one part are sent with a single PUT, and larger ones with a multipart upload, so that however large
+the object only one part is held in memory.
+*/
+func (s *S3Store) Put(key string, contents io.Reader) error {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = s3DefaultPartSize
+	}
+	body, err := io.ReadAll(io.LimitReader(contents, partSize))
+	if err != nil {
+		return fmt.Errorf("reading contents for %s: %w", key, err)
+	}
+	if int64(len(body)) == partSize {
+		return s.putMultipart(cleaned, key, body, contents)
+	}
+	res, err := s.do(http.MethodPut, cleaned, nil, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3ResponseError("put", key, res)
+	}
+	return nil
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+/*
+sends firstPart and then the rest of contents as a multipart upload, reading each part as the one before it is sent. The
+upload is aborted if anything fails, so that the parts already sent are not kept (and charged for) by the store.
+*/
+func (s *S3Store) putMultipart(cleaned, key string, firstPart []byte, contents io.Reader) error {
+	res, err := s.do(http.MethodPost, cleaned, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return s3ResponseError("start multipart upload", key, res)
+	}
+	var initiated s3InitiateMultipartUploadResult
+	err = xml.NewDecoder(res.Body).Decode(&initiated)
+	res.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("decoding start multipart upload response for %s: %w", key, err)
+	}
+
+	err = s.putParts(cleaned, key, initiated.UploadID, firstPart, contents)
+	if err != nil {
+		return errors.Join(err, s.abortMultipart(cleaned, key, initiated.UploadID))
+	}
+	return nil
+}
+
+// uploads the parts of a multipart upload that has been started with uploadId, then completes it
+func (s *S3Store) putParts(cleaned, key, uploadId string, part []byte, contents io.Reader) error {
+	completed := s3CompleteMultipartUpload{}
+	buffer := make([]byte, len(part))
+	for partNumber := 1; len(part) > 0; partNumber++ {
+		query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadId}}
+		res, err := s.do(http.MethodPut, cleaned, query, part)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return s3ResponseError(fmt.Sprintf("put part %d of", partNumber), key, res)
+		}
+		completed.Parts = append(completed.Parts, s3CompletedPart{partNumber, res.Header.Get("ETag")})
+
+		n, err := io.ReadFull(contents, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("reading contents for %s: %w", key, err)
+		}
+		part = buffer[:n]
+	}
+
+	body, err := xml.Marshal(completed)
+	if err != nil {
+		return fmt.Errorf("encoding complete multipart upload for %s: %w", key, err)
+	}
+	res, err := s.do(http.MethodPost, cleaned, url.Values{"uploadId": {uploadId}}, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3ResponseError("complete multipart upload", key, res)
+	}
+	// completing can fail after the 200 has been sent, in which case the body is an Error rather than the result
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("decoding complete multipart upload response for %s: %w", key, err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 complete multipart upload %s: %s: %s", key, result.Code, result.Message)
+	}
+	return nil
+}
+
+// abandons a multipart upload, so that the parts sent for it are deleted
+func (s *S3Store) abortMultipart(cleaned, key, uploadId string) error {
+	res, err := s.do(http.MethodDelete, cleaned, url.Values{"uploadId": {uploadId}}, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return s3ResponseError("abort multipart upload", key, res)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(http.MethodGet, cleaned, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, s3ResponseError("get", key, res)
+	}
+	return res.Body, nil
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List uses ListObjectsV2, following continuation tokens until every object under prefix has been returned
+func (s *S3Store) List(prefix string) ([]ObjectInfo, error) {
+	cleanedPrefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	objects := []ObjectInfo{}
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if cleanedPrefix != "" {
+			query.Set("prefix", cleanedPrefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		res, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			err = s3ResponseError("list", prefix, res)
+			res.Body.Close()
+			return nil, err
+		}
+		var result s3ListBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding list response for %s: %w", prefix, err)
+		}
+		for _, content := range result.Contents {
+			lastModified, _ := time.Parse(time.RFC3339, content.LastModified)
+			objects = append(objects, ObjectInfo{
+				Key:          content.Key,
+				Size:         content.Size,
+				LastModified: lastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// Delete removes the object for key. S3 does not treat deleting a missing key as an error, and neither does this
+func (s *S3Store) Delete(key string) error {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(http.MethodDelete, cleaned, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return s3ResponseError("delete", key, res)
+	}
+	return nil
+}
+
+func (s *S3Store) Stat(key string) (ObjectInfo, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	res, err := s.do(http.MethodHead, cleaned, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return ObjectInfo{}, s3ResponseError("stat", key, res)
+	}
+	size, _ := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+	lastModified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return ObjectInfo{
+		Key:          cleaned,
+		Size:         size,
+		LastModified: lastModified,
+	}, nil
+}
+
+// builds, signs and sends a request for key (or for the bucket itself if key is blank)
+func (s *S3Store) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing s3 endpoint: %w", err)
+	}
+	objectPath := "/" + s.Bucket
+	if key != "" {
+		objectPath += "/" + key
+	}
+	endpoint.Path = objectPath
+	endpoint.RawPath = s3EscapePath(objectPath)
+	endpoint.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating s3 request: %w", err)
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	s.sign(req, body)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, key, err)
+	}
+	return res, nil
+}
+
+// sign adds the x-amz-* and Authorization headers required by AWS Signature Version 4
+func (s *S3Store) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	signedAt := now().UTC()
+	amzDate := signedAt.Format(s3AmzDateFormat)
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", signedAt.Format(s3DateOnlyFormat), s.Region, s3Service)
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	signingKey := s3SigningKey(s.SecretAccessKey, signedAt.Format(s3DateOnlyFormat), s.Region, s3Service)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func s3SigningKey(secret, date, region, service string) []byte {
+	dateKey := hmacSHA256([]byte("AWS4"+secret), []byte(date))
+	regionKey := hmacSHA256(dateKey, []byte(region))
+	serviceKey := hmacSHA256(regionKey, []byte(service))
+	return hmacSHA256(serviceKey, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// escapes every path segment the way SigV4 expects, leaving the "/" separators in place
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// builds a query string with the keys sorted and both keys and values escaped, as required for the canonical request
+func s3CanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// percent encodes everything apart from the unreserved characters defined in RFC 3986
+func s3Escape(input string) string {
+	var builder strings.Builder
+	for _, b := range []byte(input) {
+		isUnreserved := (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~'
+		if isUnreserved {
+			builder.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&builder, "%%%02X", b)
+	}
+	return builder.String()
+}
+
+func s3ResponseError(operation, key string, res *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("s3 %s %s: unexpected status %d: %s", operation, key, res.StatusCode, strings.TrimSpace(string(message)))
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testBucket          = "lenslocked-test"
+)
+
+func TestS3SigningKey(t *testing.T) {
+	// example taken from the AWS Signature Version 4 documentation
+	got := hex.EncodeToString(s3SigningKey(testSecretAccessKey, "20120215", "us-east-1", "iam"))
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got != want {
+		t.Errorf("got %s, want %s\n", got, want)
+	}
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	fake := newFakeS3Server(t)
+	defer fake.Close()
+	store := NewS3Store(fake.URL, testBucket, "", testAccessKeyID, testSecretAccessKey)
+	runStoreRoundTrip(t, store)
+}
+
+func TestS3StoreListFollowsContinuationTokens(t *testing.T) {
+	fake := newFakeS3Server(t)
+	fake.pageSize = 2
+	defer fake.Close()
+	store := NewS3Store(fake.URL, testBucket, "", testAccessKeyID, testSecretAccessKey)
+	for i := 0; i < 5; i++ {
+		err := store.Put(fmt.Sprintf("7/%d.jpg", i), strings.NewReader("x"))
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+	}
+	listed, err := store.List("7/")
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	if len(listed) != 5 {
+		t.Errorf("got %d objects, want %d\n", len(listed), 5)
+	}
+}
+
+func TestS3StorePutsLargeObjectsInParts(t *testing.T) {
+	type test struct {
+		name         string
+		size         int
+		failPartOver int
+		isExpectErr  bool
+	}
+	tests := []test{
+		{"object smaller than a part is put at once", 7, 0, false},
+		{"object of exactly one part", 10, 0, false},
+		{"object of several parts", 35, 0, false},
+		{"failed part aborts the upload", 35, 2, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeS3Server(t)
+			fake.failPartOver = test.failPartOver
+			defer fake.Close()
+			store := NewS3Store(fake.URL, testBucket, "", testAccessKeyID, testSecretAccessKey)
+			store.PartSize = 10
+			contents := "0123456789abcdefghijklmnopqrstuvwxyz"[:test.size]
+			err := store.Put("1/export.zip", strings.NewReader(contents))
+			if test.isExpectErr {
+				if err == nil {
+					t.Errorf("expected error, didn't get one")
+				}
+				if _, err := store.Stat("1/export.zip"); !errors.Is(err, ErrObjectNotFound) {
+					t.Errorf("got %v, want no object after a failed upload\n", err)
+				}
+				if len(fake.uploads) != 0 {
+					t.Errorf("got %d multipart uploads left, want the failed upload aborted\n", len(fake.uploads))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("didn't expect error, got %v\n", err)
+			}
+			if fake.largestPut > int(store.PartSize) {
+				t.Errorf("got a put of %d bytes, want none larger than a part of %d\n", fake.largestPut, store.PartSize)
+			}
+			reader, err := store.Get("1/export.zip")
+			if err != nil {
+				t.Fatalf("didn't expect error, got %v\n", err)
+			}
+			defer reader.Close()
+			got, _ := io.ReadAll(reader)
+			if string(got) != contents {
+				t.Errorf("got %q, want %q\n", got, contents)
+			}
+		})
+	}
+}
+
+func TestS3StoreRejectsBadSignature(t *testing.T) {
+	fake := newFakeS3Server(t)
+	defer fake.Close()
+	store := NewS3Store(fake.URL, testBucket, "", testAccessKeyID, "not-the-secret")
+	err := store.Put("1/a.jpg", strings.NewReader("x"))
+	if err == nil {
+		t.Errorf("expected error, didn't get one")
+	}
+}
+
+/*
+fakeS3Server is a small MinIO-style stand in that keeps objects in memory. It verifies the SigV4 signature of every
+request, so that requests built by S3Store are checked the same way a real server would check them.
+*/
+type fakeS3Server struct {
+	*httptest.Server
+	t        *testing.T
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modified map[string]time.Time
+	pageSize int
+	// uploads holds the parts of the multipart uploads that have been started but not completed or aborted
+	uploads      map[string]map[int][]byte
+	largestPut   int
+	numUploads   int
+	failPartOver int
+}
+
+func newFakeS3Server(t *testing.T) *fakeS3Server {
+	fake := &fakeS3Server{
+		t:        t,
+		objects:  map[string][]byte{},
+		modified: map[string]time.Time{},
+		pageSize: 1000,
+		uploads:  map[string]map[int][]byte{},
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	return fake
+}
+
+func (f *fakeS3Server) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if !f.isSignatureValid(r, body) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+	bucketPrefix := "/" + testBucket
+	if !strings.HasPrefix(r.URL.Path, bucketPrefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, bucketPrefix), "/")
+
+	if r.Method == http.MethodPut && len(body) > f.largestPut {
+		f.largestPut = len(body)
+	}
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case query.Has("uploads") || query.Has("uploadId"):
+		f.multipart(w, r, key, body)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.modified[key] = time.Now().UTC()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		contents, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(contents)))
+		w.Header().Set("Last-Modified", f.modified[key].Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(contents)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		delete(f.modified, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handles the requests of a multipart upload - starting it, putting a part, and completing or aborting it
+func (f *fakeS3Server) multipart(w http.ResponseWriter, r *http.Request, key string, body []byte) {
+	query := r.URL.Query()
+	uploadId := query.Get("uploadId")
+	parts, ok := f.uploads[uploadId]
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.numUploads++
+		uploadId = fmt.Sprintf("upload-%d", f.numUploads)
+		f.uploads[uploadId] = map[int][]byte{}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadId)
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchUpload</Code></Error>")
+	case r.Method == http.MethodPut:
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		if f.failPartOver != 0 && partNumber > f.failPartOver {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost:
+		var completed s3CompleteMultipartUpload
+		err := xml.Unmarshal(body, &completed)
+		if err != nil || len(completed.Parts) != len(parts) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		contents := []byte{}
+		for i, part := range completed.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			contents = append(contents, parts[part.PartNumber]...)
+		}
+		delete(f.uploads, uploadId)
+		f.objects[key] = contents
+		f.modified[key] = time.Now().UTC()
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete:
+		delete(f.uploads, uploadId)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3Server) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		fmt.Sscanf(token, "%d", &start)
+	}
+	end := start + f.pageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+	type content struct {
+		Key          string
+		Size         int
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, content{key, len(f.objects[key]), f.modified[key].Format(time.RFC3339)})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = fmt.Sprintf("%d", end)
+	}
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// recomputes the signature from the request as received by the server, and compares it against the Authorization header
+func (f *fakeS3Server) isSignatureValid(r *http.Request, body []byte) bool {
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if payloadHash != sha256Hex(body) {
+		return false
+	}
+	amzDate := r.Header.Get("x-amz-date")
+	signedAt, err := time.Parse(s3AmzDateFormat, amzDate)
+	if err != nil {
+		return false
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", r.Host, payloadHash, amzDate),
+		"host;x-amz-content-sha256;x-amz-date",
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/us-east-1/s3/aws4_request", signedAt.Format(s3DateOnlyFormat))
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signingKey := s3SigningKey(testSecretAccessKey, signedAt.Format(s3DateOnlyFormat), "us-east-1", "s3")
+	want := fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		s3Algorithm, testAccessKeyID, scope, hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign))))
+	return r.Header.Get("Authorization") == want
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound is returned by a Store when no object exists for the requested key
+var ErrObjectNotFound = errors.New("object could not be found in storage")
+
+// ObjectInfo describes an object that is held in a Store
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+/*
+Store is the interface that any backend used to hold image bytes has to satisfy.
+
+Keys are always forward slash separated paths relative to the root of the store, for example
+"12/holiday.jpg". Implementations are expected to reject keys that attempt to escape the root.
+*/
+type Store interface {
+	Put(key string, contents io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	List(prefix string) ([]ObjectInfo, error)
+	Delete(key string) error
+	Stat(key string) (ObjectInfo, error)
+}
+
+/*
+DirPruner is implemented by stores that keep objects in directories, which are left behind empty when the objects in
+them are deleted. PruneEmptyDirs removes the empty directories that have not been modified since olderThan, so a
+directory that an object is about to be put in is not removed from under it.
+*/
+type DirPruner interface {
+	PruneEmptyDirs(olderThan time.Time) (int, error)
+}
+
+// Key joins the parts passed in to form a key that can be used with any Store
+func Key(parts ...string) string {
+	return path.Join(parts...)
+}
+
+// cleans the key that is passed in, returning an error if the key is empty or tries to escape the root of the store
+func cleanKey(key string) (string, error) {
+	slashed := strings.ReplaceAll(key, "\\", "/")
+	cleaned := strings.TrimPrefix(path.Clean("/"+slashed), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return cleaned, nil
+}
+
+// cleans a prefix used for listing - unlike keys, an empty prefix is allowed and lists the whole store
+func cleanPrefix(prefix string) (string, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	cleaned, err := cleanKey(prefix)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(prefix, "/") {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,128 @@
+/*
+Package totp implements the time-based one-time passwords of RFC 6238, as generated by authenticator apps. Only the
+parameters every authenticator app supports are used - HMAC-SHA1, 6 digit codes and a 30 second period.
+*/
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits in a code
+	Digits = 6
+	// Period is how long each code is valid for
+	Period = 30 * time.Second
+	// Skew is the number of periods either side of the current one that a code is still accepted for, to allow for
+	// clocks that have drifted and codes entered just as they change
+	Skew = 1
+	// secretSize is the size of generated secrets in bytes, the length of an HMAC-SHA1 key recommended by RFC 4226
+	secretSize = 20
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32 encoded as authenticator apps expect it to be entered
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", fmt.Errorf("generating totp secret: %w", err)
+	}
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+// Step returns the number of the period that t falls in, counted from the Unix epoch
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the input secret at time t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return codeAtStep(key, Step(t)), nil
+}
+
+/*
+Validate reports whether code is the code for the input secret at time t, allowing for Skew. The step the code matched
+is returned, so that callers can refuse a code that has already been used - pass the last step used as afterStep, or 0
+if no code has been used yet, and only codes for later steps are accepted.
+*/
+func Validate(secret string, code string, t time.Time, afterStep int64) (step int64, isValid bool) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= afterStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(codeAtStep(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+/*
+URI returns the otpauth URI for a secret, which authenticator apps read from a QR code. issuer names the application
+and accountName the account the secret belongs to, and both are shown in the app.
+*/
+func URI(secret string, issuer string, accountName string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+	otpURL := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: query.Encode(),
+	}
+	return otpURL.String()
+}
+
+// computes the HOTP value of RFC 4226 for the step, truncated to Digits
+func codeAtStep(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for range Digits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulus)
+}
+
+// secrets are accepted in lower case and with spaces, as they are often copied out of authenticator apps that way
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := secretEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("decoding totp secret: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA1 secret used by the test vectors in appendix B of RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	type test struct {
+		name         string
+		unixTime     int64
+		expectedCode string
+	}
+	// the RFC lists 8 digit codes, of which these are the last 6 digits
+	tests := []test{
+		{"59", 59, "287082"},
+		{"1111111109", 1111111109, "081804"},
+		{"1111111111", 1111111111, "050471"},
+		{"1234567890", 1234567890, "005924"},
+		{"2000000000", 2000000000, "279037"},
+		{"20000000000", 20000000000, "353130"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Code(rfcSecret, time.Unix(test.unixTime, 0))
+			if err != nil {
+				t.Errorf("didn't expect error, got %v", err)
+				return
+			}
+			if got != test.expectedCode {
+				t.Errorf("got %s, want %s", got, test.expectedCode)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfcSecret, now)
+	previousCode, _ := Code(rfcSecret, now.Add(-Period))
+	oldCode, _ := Code(rfcSecret, now.Add(-3*Period))
+
+	type test struct {
+		name      string
+		secret    string
+		code      string
+		afterStep int64
+		isValid   bool
+	}
+	tests := []test{
+		{"current code", rfcSecret, code, 0, true},
+		{"code with spaces", rfcSecret, code[:3] + " " + code[3:], 0, true},
+		{"lower case secret", strings.ToLower(rfcSecret), code, 0, true},
+		{"previous code within skew", rfcSecret, previousCode, 0, true},
+		{"code outside of skew", rfcSecret, oldCode, 0, false},
+		{"code already used", rfcSecret, code, Step(now), false},
+		{"wrong length", rfcSecret, code[:5], 0, false},
+		{"invalid secret", "not base32!", code, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, isValid := Validate(test.secret, test.code, now, test.afterStep)
+			if isValid != test.isValid {
+				t.Errorf("got valid %t, want %t", isValid, test.isValid)
+			}
+			if isValid && step <= test.afterStep {
+				t.Errorf("got step %d, want a step after %d", step, test.afterStep)
+			}
+		})
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Errorf("didn't expect error, got %v", err)
+		return
+	}
+	if _, err := Code(secret, time.Now()); err != nil {
+		t.Errorf("generated secret could not be used: %v", err)
+	}
+	uri := URI(secret, "Lenslocked", "user@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Lenslocked:user@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("got unexpected uri %s", uri)
+	}
+}
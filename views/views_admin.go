@@ -0,0 +1,110 @@
+package views
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/sohWenMing/lenslocked/models"
+)
+
+// AdminUsersData is the data the admin_users page is rendered with
+type AdminUsersData struct {
+	Query string
+	Users []models.AdminUser
+	Total int
+	// PrevPath and NextPath are blank when there is no such page
+	PrevPath string
+	NextPath string
+}
+
+// AdminUserData is the data the admin_user page is rendered with
+type AdminUserData struct {
+	User      models.AdminUser
+	Galleries []AdminGalleryData
+	Sessions  []SessionData
+	// Actions are what admins have done to the user's account, the most recent first
+	Actions []models.AdminAction
+}
+
+// AdminGalleryData holds what is needed to list a gallery on the admin_user page, and to show it on admin_gallery
+type AdminGalleryData struct {
+	ID         int
+	UserID     int
+	Title      string
+	Visibility models.GalleryVisibility
+	Path       string
+	Images     []GalleryImageData
+}
+
+// InitAdminUsersData maps a page of the users matching query to the data the admin_users page needs
+func InitAdminUsersData(query string, users []models.AdminUser, total int, page models.Page) AdminUsersData {
+	data := AdminUsersData{
+		Query: query,
+		Users: users,
+		Total: total,
+	}
+	if page.Number > 1 {
+		data.PrevPath = adminUsersPagePath(query, page.Number-1)
+	}
+	if page.Offset()+len(users) < total {
+		data.NextPath = adminUsersPagePath(query, page.Number+1)
+	}
+	return data
+}
+
+func adminUsersPagePath(query string, pageNumber int) string {
+	values := url.Values{}
+	if query != "" {
+		values.Set("q", query)
+	}
+	values.Set("page", fmt.Sprint(pageNumber))
+	return "/admin/users?" + values.Encode()
+}
+
+/*
+InitAdminUserData maps a user, along with their galleries, active sessions and what admins have done to their account,
+to the data the admin_user page needs.
+*/
+func InitAdminUserData(user models.AdminUser, galleries []*models.Gallery, sessions []*models.Session,
+	actions []models.AdminAction) AdminUserData {
+	galleryData := make([]AdminGalleryData, len(galleries))
+	for i, gallery := range galleries {
+		galleryData[i] = AdminGalleryData{
+			ID:         gallery.ID,
+			UserID:     gallery.UserID,
+			Title:      gallery.Title,
+			Visibility: gallery.Visibility,
+			Path:       AdminGalleryPath(gallery.ID),
+		}
+	}
+	return AdminUserData{
+		User:      user,
+		Galleries: galleryData,
+		// the sessions are signed out all at once from the admin console, so none is marked as current
+		Sessions: InitSessionsData(sessions, "").Sessions,
+		Actions:  actions,
+	}
+}
+
+// InitAdminGalleryData loads the data the admin_gallery page needs, serving the gallery's images under AdminGalleryPath
+func InitAdminGalleryData(gallery *models.Gallery, galleryImages []*models.Image) AdminGalleryData {
+	galleryPath := AdminGalleryPath(gallery.ID)
+	return AdminGalleryData{
+		ID:         gallery.ID,
+		UserID:     gallery.UserID,
+		Title:      gallery.Title,
+		Visibility: gallery.Visibility,
+		Path:       galleryPath,
+		Images:     getGalleryImageData(galleryPath, galleryImages),
+	}
+}
+
+// AdminUserPath returns the path a user is looked after at in the admin console
+func AdminUserPath(userId int) string {
+	return fmt.Sprintf("/admin/users/%d", userId)
+}
+
+// AdminGalleryPath returns the path a gallery is looked at in the admin console, whatever its visibility
+func AdminGalleryPath(galleryId int) string {
+	return fmt.Sprintf("/admin/galleries/%d", galleryId)
+}
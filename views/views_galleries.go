@@ -3,8 +3,13 @@ package views
 import (
 	"embed"
 	"encoding/json"
+	"fmt"
 	"html/template"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/sohWenMing/lenslocked/imaging"
 	"github.com/sohWenMing/lenslocked/models"
 )
 
@@ -42,9 +47,68 @@ type GalleryData struct {
 	UserId    int
 	GalleryId int
 	Title     string
-	ImageUrls []string
+	Images    []GalleryImageData
 	IsEdit    bool
 	InputData GalleryFunctionToInputData
+	// KeepPhotoMetadata is only loaded on the edit page, where the owner can opt in to keeping EXIF data on upload
+	KeepPhotoMetadata bool
+	// Visibility and UnlistedPath are only loaded on the edit page. UnlistedPath is blank until a slug is generated
+	Visibility   string
+	Visibilities []string
+	UnlistedPath string
+	// the rest are only loaded on the edit page, and decide which parts of it are shown to the user's role
+	Role             string
+	CanEdit          bool
+	CanDeleteGallery bool
+	CanManageMembers bool
+	Members          []GalleryMemberData
+	MemberRoles      []string
+	ShareLinks       []ShareLinkData
+	// NewShareLinkURL is only set straight after a share link is created, as the link cannot be shown again
+	NewShareLinkURL string
+	// the rest are only set when viewing through a share link. IsLocked is set when its password has not been entered
+	IsLocked      bool
+	UnlockPath    string
+	AllowDownload bool
+	// DownloadPath is where a ZIP archive of the gallery can be downloaded from, blank when downloads are not allowed
+	DownloadPath string
+}
+
+// ShareLinkData holds what is needed to list an active share link on the edit page of its gallery
+type ShareLinkData struct {
+	ID            int
+	Label         string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	HasPassword   bool
+	AllowDownload bool
+}
+
+// GalleryMemberData holds what is needed to list a member of a gallery on its edit page
+type GalleryMemberData struct {
+	ID        int
+	Email     string
+	Role      string
+	IsPending bool
+}
+
+// GalleryImageData holds what is needed to render a single image of a gallery
+type GalleryImageData struct {
+	URL string
+	// SrcSet lists the URL of every resized variant that is smaller than the original, for use in an img srcset
+	SrcSet     string
+	Filename   string
+	Caption    string
+	Width      int
+	Height     int
+	UploadedAt time.Time
+	TakenAt    time.Time
+	// CameraDetails summarises the camera settings read from the EXIF data, e.g. "Canon EOS R5 · 50mm · f/1.8"
+	CameraDetails string
+	// CanManage is set on the edit page when the user's role allows them to delete and caption the image
+	CanManage bool
+	// DownloadURL is only set when viewing through a share link that allows downloads
+	DownloadURL string
 }
 
 func (g *GalleryData) String() string {
@@ -61,50 +125,183 @@ func InitNewGalleryData(userId int, loadValue string) GalleryData {
 	return galleryData
 }
 
-func InitViewGalleryData(userId int, galleryId int, galleryTitle string, exts []string) (GalleryData, error) {
-	filePaths, err := getImageFilePaths(galleryId, exts)
-	if err != nil {
-		return GalleryData{}, err
-	}
+/*
+InitViewGalleryData loads the data needed to view a gallery. galleryPath is the path the gallery is being viewed at,
+either GalleryPath or UnlistedGalleryPath, and the URLs of its images are built under it so that they can be served
+with the same visibility check.
+*/
+func InitViewGalleryData(userId int, gallery *models.Gallery, galleryPath string, galleryImages []*models.Image) GalleryData {
 	galleryData := GalleryData{
 		UserId:    userId,
-		GalleryId: galleryId,
-		Title:     galleryTitle,
-		ImageUrls: filePaths,
+		GalleryId: gallery.ID,
+		Title:     gallery.Title,
+		Images:    getGalleryImageData(galleryPath, galleryImages),
 		IsEdit:    false,
 		InputData: GalleryFunctionToInputData{},
+
+		DownloadPath: galleryPath + "/download",
 	}
-	return galleryData, nil
+	return galleryData
 }
 
-func InitEditGalleryData(userId int, galleryId int, loadTitleValue string, exts []string) (GalleryData, error) {
-	filePaths, err := getImageFilePaths(galleryId, exts)
-	if err != nil {
-		return GalleryData{}, err
+func InitEditGalleryData(userId int, gallery *models.Gallery, role models.GalleryRole, galleryImages []*models.Image,
+	members []*models.GalleryMember, shareLinks []*models.ShareLink) GalleryData {
+	visibilities := make([]string, len(models.GalleryVisibilities))
+	for i, visibility := range models.GalleryVisibilities {
+		visibilities[i] = string(visibility)
+	}
+	memberRoles := make([]string, len(models.MemberRoles))
+	for i, memberRole := range models.MemberRoles {
+		memberRoles[i] = string(memberRole)
+	}
+	memberData := make([]GalleryMemberData, len(members))
+	for i, member := range members {
+		memberData[i] = GalleryMemberData{member.ID, member.Email, string(member.Role), member.IsPending()}
+	}
+	shareLinkData := make([]ShareLinkData, len(shareLinks))
+	for i, link := range shareLinks {
+		shareLinkData[i] = ShareLinkData{link.ID, link.Label, link.CreatedAt, link.ExpiresAt, link.HasPassword(), link.AllowDownload}
+	}
+	imageData := getGalleryImageData(GalleryPath(gallery.ID), galleryImages)
+	for i, galleryImage := range galleryImages {
+		imageData[i].CanManage = role.CanManageImage(galleryImage, userId)
+	}
+	unlistedPath := ""
+	if gallery.Slug != "" {
+		unlistedPath = UnlistedGalleryPath(gallery.Slug)
 	}
 	galleryData :=
 		GalleryData{
-			UserId:    userId,
-			GalleryId: galleryId,
-			Title:     loadTitleValue,
-			ImageUrls: filePaths,
-			IsEdit:    true,
-			InputData: InitEditGalleryFunctionAndInputData(loadTitleValue),
+			UserId:            userId,
+			GalleryId:         gallery.ID,
+			Title:             gallery.Title,
+			Images:            imageData,
+			IsEdit:            true,
+			InputData:         InitEditGalleryFunctionAndInputData(gallery.Title),
+			KeepPhotoMetadata: gallery.KeepPhotoMetadata,
+			Visibility:        string(gallery.Visibility),
+			Visibilities:      visibilities,
+			UnlistedPath:      unlistedPath,
+			Role:              string(role),
+			CanEdit:           role.CanEdit(),
+			CanDeleteGallery:  role.CanDeleteGallery(),
+			CanManageMembers:  role.CanManageMembers(),
+			Members:           memberData,
+			MemberRoles:       memberRoles,
+			ShareLinks:        shareLinkData,
 		}
-	return galleryData, nil
+	return galleryData
 }
 
-func getImageFilePaths(galleryId int, exts []string) ([]string, error) {
-	galleryImages, err := models.GetImagesByGalleryId(galleryId, exts)
-	if err != nil {
-		return []string{}, err
+// InitSharedGalleryData loads the data needed to view a gallery through a share link, at SharedGalleryPath
+func InitSharedGalleryData(userId int, gallery *models.Gallery, link *models.ShareLink, token string, galleryImages []*models.Image) GalleryData {
+	galleryData := InitViewGalleryData(userId, gallery, SharedGalleryPath(token), galleryImages)
+	galleryData.AllowDownload = link.AllowDownload
+	if !link.AllowDownload {
+		galleryData.DownloadPath = ""
+	}
+	if link.AllowDownload {
+		for i := range galleryData.Images {
+			galleryData.Images[i].DownloadURL = galleryData.Images[i].URL + "?download=true"
+		}
 	}
-	filePaths := make([]string, len(galleryImages))
+	return galleryData
+}
+
+// InitLockedSharedGalleryData loads the data needed to ask for the password of a share link. No images are loaded
+func InitLockedSharedGalleryData(userId int, gallery *models.Gallery, token string) GalleryData {
+	return GalleryData{
+		UserId:     userId,
+		GalleryId:  gallery.ID,
+		Title:      gallery.Title,
+		Images:     []GalleryImageData{},
+		IsLocked:   true,
+		UnlockPath: SharedGalleryPath(token) + "/unlock",
+	}
+}
+
+// GalleryPath returns the path a gallery is viewed at by its id
+func GalleryPath(galleryId int) string {
+	return fmt.Sprintf("/galleries/%d", galleryId)
+}
+
+// UnlistedGalleryPath returns the path a gallery is viewed at by its slug, which is the link shared for unlisted galleries
+func UnlistedGalleryPath(slug string) string {
+	return fmt.Sprintf("/galleries/u/%s", url.PathEscape(slug))
+}
+
+// SharedGalleryPath returns the path a gallery is viewed at through a share link
+func SharedGalleryPath(token string) string {
+	return fmt.Sprintf("/s/%s", url.PathEscape(token))
+}
+
+// GalleryImagePath returns the path an image is served at, under the path its gallery is being viewed at
+func GalleryImagePath(galleryPath string, filename string) string {
+	return fmt.Sprintf("%s/images/%s", galleryPath, url.PathEscape(filename))
+}
+
+func getGalleryImageData(galleryPath string, galleryImages []*models.Image) []GalleryImageData {
+	imageData := make([]GalleryImageData, len(galleryImages))
 	for i, galleryImage := range galleryImages {
-		filePaths[i] = galleryImage.GetPath()
+		imageURL := GalleryImagePath(galleryPath, galleryImage.Filename)
+		imageData[i] = GalleryImageData{
+			URL:        imageURL,
+			SrcSet:     getImageSrcSet(imageURL, galleryImage.Width),
+			Filename:   galleryImage.Filename,
+			Caption:    galleryImage.Caption,
+			Width:      galleryImage.Width,
+			Height:     galleryImage.Height,
+			UploadedAt: galleryImage.UploadedAt,
+			TakenAt:    galleryImage.TakenAt,
+
+			CameraDetails: getCameraDetails(galleryImage),
+		}
 	}
-	return filePaths, nil
+	return imageData
+}
 
+// joins whichever camera fields were recorded for an image, leaving out the ones that are missing
+func getCameraDetails(galleryImage *models.Image) string {
+	details := []string{}
+	camera := galleryImage.CameraModel
+	if galleryImage.CameraMake != "" && !strings.HasPrefix(camera, galleryImage.CameraMake) {
+		camera = strings.TrimSpace(galleryImage.CameraMake + " " + camera)
+	}
+	if camera != "" {
+		details = append(details, camera)
+	}
+	if galleryImage.FocalLength > 0 {
+		details = append(details, fmt.Sprintf("%gmm", galleryImage.FocalLength))
+	}
+	if galleryImage.FNumber > 0 {
+		details = append(details, fmt.Sprintf("f/%g", galleryImage.FNumber))
+	}
+	if galleryImage.ExposureTime != "" {
+		details = append(details, galleryImage.ExposureTime+"s")
+	}
+	if galleryImage.ISO > 0 {
+		details = append(details, fmt.Sprintf("ISO %d", galleryImage.ISO))
+	}
+	return strings.Join(details, " · ")
+}
+
+/*
+builds the srcset for an image, listing each variant narrower than the original followed by the original itself.
+If the width of the original is not known, a blank string is returned and only the original will be used.
+*/
+func getImageSrcSet(imageURL string, width int) string {
+	if width == 0 {
+		return ""
+	}
+	sources := []string{}
+	for _, variant := range imaging.Variants {
+		if variant.MaxWidth >= width {
+			break
+		}
+		sources = append(sources, fmt.Sprintf("%s?size=%s %dw", imageURL, variant.Name, variant.MaxWidth))
+	}
+	sources = append(sources, fmt.Sprintf("%s %dw", imageURL, width))
+	return strings.Join(sources, ", ")
 }
 
 type GalleryFunctionToInputData struct {
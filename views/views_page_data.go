@@ -2,8 +2,18 @@ package views
 
 type SignInSignUpForm struct {
 	EmailInputAttribs, PasswordInputAttribs inputHTMLAttribs
+	SocialProviders                         []SocialProvider
 }
 
+// SocialProvider is an OpenID Connect provider that users can sign in with
+type SocialProvider struct {
+	Name        string
+	DisplayName string
+}
+
+// SocialSignInProviders are the providers shown on the sign in, sign up and user_info pages, set when the server starts
+var SocialSignInProviders []SocialProvider
+
 var SignUpSignInFormData = SignInSignUpForm{
 	EmailInputAttribs: inputHTMLAttribs{
 		"email",
@@ -79,6 +89,11 @@ var ResetPasswordFormData = ResetPasswordForm{
 	ResetPasswordToken: "",
 }
 
+// MagicLinkForm is the data of magic_link.gohtml, where a sign in link sent by email is used to sign in
+type MagicLinkForm struct {
+	MagicLinkToken string
+}
+
 type PageData struct {
 	UserId    int
 	OtherData any
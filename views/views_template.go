@@ -122,6 +122,15 @@ var pageTplStrings = []string{
 	"reset_password.gohtml",
 	"check_email.gohtml",
 	"test_alert.gohtml",
+	"two_factor.gohtml",
+	"verify_email.gohtml",
+	"sessions.gohtml",
+	"change_email.gohtml",
+	"magic_link.gohtml",
+	"passkeys.gohtml",
+	"admin_users.gohtml",
+	"admin_user.gohtml",
+	"admin_gallery.gohtml",
 }
 
 func GetAdditionalTemplateData(userInfo models.UserInfo) func(filename string) (data any, err error) {
@@ -129,16 +138,18 @@ func GetAdditionalTemplateData(userInfo models.UserInfo) func(filename string) (
 		switch filename {
 		case "faq.gohtml":
 			return models.QuestionsToAnswers, nil
-		case "signup.gohtml":
-			return SignUpSignInFormData, nil
-		case "signin.gohtml":
-			return SignUpSignInFormData, nil
+		case "signup.gohtml", "signin.gohtml":
+			formData := SignUpSignInFormData
+			formData.SocialProviders = SocialSignInProviders
+			return formData, nil
 		case "forgot_password.gohtml":
 			return ForgotPasswordFormData, nil
 		case "reset_password.gohtml":
 			return ResetPasswordFormData, nil
+		case "magic_link.gohtml":
+			return MagicLinkForm{}, nil
 		case "user_info.gohtml":
-			return userInfo, nil
+			return InitUserInfoData(userInfo, nil), nil
 		case "home.gohtml":
 			return nil, nil
 		case "contact.gohtml":
@@ -149,6 +160,12 @@ func GetAdditionalTemplateData(userInfo models.UserInfo) func(filename string) (
 			return nil, nil
 		case "check_email.gohtml":
 			return nil, nil
+		case "two_factor.gohtml":
+			return nil, nil
+		case "verify_email.gohtml":
+			return userInfo, nil
+		case "change_email.gohtml":
+			return userInfo, nil
 		case "test_alert.gohtml":
 			return nil, nil
 		default:
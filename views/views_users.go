@@ -0,0 +1,214 @@
+package views
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/sohWenMing/lenslocked/models"
+	"github.com/sohWenMing/lenslocked/totp"
+)
+
+/*
+UserInfoData is the data the user_info page is rendered with. models.UserInfo is embedded so the page can keep
+referring to .ID and .Email.
+*/
+type UserInfoData struct {
+	models.UserInfo
+	APITokens      []APITokenData
+	APITokenScopes []models.APITokenScope
+	// NewAPIToken is only set straight after a token is created, as it cannot be shown again
+	NewAPIToken string
+	TwoFactor   models.TwoFactorStatus
+	// TwoFactorSetup is only set while the user is setting up two factor authentication
+	TwoFactorSetup *TwoFactorSetupData
+	// RecoveryCodes is only set straight after the codes are generated, as they cannot be shown again
+	RecoveryCodes []string
+	// PendingEmailChange is only set while a new email address is waiting to be confirmed
+	PendingEmailChange *models.EmailChange
+	// Identities are the accounts with social sign in providers linked to the user
+	Identities      []models.Identity
+	SocialProviders []SocialProvider
+	// DataExport is the user's latest export of their data, if they have one that has not expired
+	DataExport *DataExportData
+	// DeletionScheduledFor is the zero time unless the user has asked for their account to be deleted
+	DeletionScheduledFor time.Time
+}
+
+// DataExportData is an export of the user's data, with its size described for the user to read
+type DataExportData struct {
+	models.DataExport
+	Size string
+}
+
+func InitDataExportData(export models.DataExport) *DataExportData {
+	return &DataExportData{export, DescribeFileSize(export.SizeBytes)}
+}
+
+// DescribeFileSize describes a number of bytes in the largest unit there is at least one of, such as "4.2 MB"
+func DescribeFileSize(sizeBytes int64) string {
+	const unit = 1000
+	if sizeBytes < unit {
+		return fmt.Sprintf("%d B", sizeBytes)
+	}
+	size := float64(sizeBytes) / unit
+	prefixes := "kMGT"
+	i := 0
+	for size >= unit && i < len(prefixes)-1 {
+		size /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %cB", size, prefixes[i])
+}
+
+/*
+TwoFactorSetupData is what the user needs to add their TOTP secret to an authenticator app - either the QR code to scan,
+or the secret to type in. QRCode is a data URL of a PNG image, so it does not need to be served separately.
+*/
+type TwoFactorSetupData struct {
+	Secret string
+	URI    string
+	QRCode template.URL
+}
+
+type APITokenData struct {
+	Name       string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokePath string
+}
+
+func InitUserInfoData(userInfo models.UserInfo, apiTokens []*models.APIToken) UserInfoData {
+	apiTokenData := make([]APITokenData, len(apiTokens))
+	for i, apiToken := range apiTokens {
+		apiTokenData[i] = APITokenData{
+			Name:       apiToken.Name,
+			Scope:      string(apiToken.Scope),
+			CreatedAt:  apiToken.CreatedAt,
+			LastUsedAt: apiToken.LastUsedAt,
+			RevokePath: fmt.Sprintf("/user/api_tokens/%d/revoke", apiToken.ID),
+		}
+	}
+	return UserInfoData{
+		UserInfo:        userInfo,
+		APITokens:       apiTokenData,
+		APITokenScopes:  models.APITokenScopes,
+		SocialProviders: SocialSignInProviders,
+	}
+}
+
+func InitTwoFactorSetupData(secret string, accountName string) (*TwoFactorSetupData, error) {
+	uri := totp.URI(secret, models.TwoFactorIssuer, accountName)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetupData{
+		Secret: secret,
+		URI:    uri,
+		// the data URL is built here from the PNG encoded above, so it is safe to mark as trusted
+		QRCode: template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+	}, nil
+}
+
+// SessionsData is the data the sessions page is rendered with
+type SessionsData struct {
+	Sessions []SessionData
+}
+
+type SessionData struct {
+	Device     string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// IsCurrent is set on the session the page was requested with
+	IsCurrent  bool
+	RevokePath string
+}
+
+// PasskeysData is the data the passkeys page is rendered with
+type PasskeysData struct {
+	Passkeys []PasskeyData
+}
+
+type PasskeyData struct {
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	DeletePath string
+}
+
+// InitPasskeysData maps the passkeys of a user to the data the passkeys page needs
+func InitPasskeysData(passkeys []models.Passkey) PasskeysData {
+	passkeyData := make([]PasskeyData, len(passkeys))
+	for i, passkey := range passkeys {
+		passkeyData[i] = PasskeyData{
+			Name:       passkey.Name,
+			CreatedAt:  passkey.CreatedAt,
+			LastUsedAt: passkey.LastUsedAt,
+			DeletePath: fmt.Sprintf("/user/passkeys/%d/delete", passkey.ID),
+		}
+	}
+	return PasskeysData{passkeyData}
+}
+
+/*
+InitSessionsData maps the active sessions of a user to the data the sessions page needs. currentTokenHash is the hash of
+the session token the page was requested with, which is used to mark the current session.
+*/
+func InitSessionsData(sessions []*models.Session, currentTokenHash string) SessionsData {
+	sessionData := make([]SessionData, len(sessions))
+	for i, session := range sessions {
+		sessionData[i] = SessionData{
+			Device:     DescribeUserAgent(session.UserAgent),
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			IsCurrent:  session.TokenHash == currentTokenHash,
+			RevokePath: fmt.Sprintf("/user/sessions/%d/revoke", session.ID),
+		}
+	}
+	return SessionsData{sessionData}
+}
+
+/*
+DescribeUserAgent gives a short description of the browser and operating system in a user agent, such as
+"Firefox on Windows", for the user to recognise their devices by. Anything it does not recognise is described as unknown.
+*/
+func DescribeUserAgent(userAgent string) string {
+	browser := "Unknown browser"
+	// the order matters, as most browsers also claim to be the browsers they are based on
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	platform := "unknown device"
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			platform = o.name
+			break
+		}
+	}
+	return fmt.Sprintf("%s on %s", browser, platform)
+}
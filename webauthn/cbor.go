@@ -0,0 +1,138 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth is how deeply arrays and maps can be nested, so that a crafted response cannot exhaust the stack
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: data is truncated")
+
+/*
+decodeCBOR decodes the first CBOR item in data, returning what follows it. Only the subset of CBOR that authenticators
+use is supported - items of definite length, with integers decoded to int64, byte strings to []byte, text to string,
+arrays to []any and maps to map[any]any. Tags are skipped, and floats are not supported.
+*/
+func decodeCBOR(data []byte) (value any, rest []byte, err error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("cbor: items are nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+	majorType := data[0] >> 5
+	additional := data[0] & 0x1f
+	if majorType == 7 {
+		switch additional {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22, 23:
+			return nil, data[1:], nil
+		default:
+			return nil, nil, fmt.Errorf("cbor: simple value or float %d is not supported", additional)
+		}
+	}
+	argument, data, err := decodeCBORArgument(additional, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	switch majorType {
+	case 0:
+		if argument > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer is too large")
+		}
+		return int64(argument), data, nil
+	case 1:
+		if argument > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer is too small")
+		}
+		return -1 - int64(argument), data, nil
+	case 2, 3:
+		if argument > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		if majorType == 3 {
+			return string(data[:argument]), data[argument:], nil
+		}
+		return data[:argument:argument], data[argument:], nil
+	case 4:
+		// every item takes at least a byte, which stops a huge length from allocating before the data runs out
+		if argument > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]any, argument)
+		for i := range items {
+			items[i], data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, data, nil
+	case 5:
+		if argument > uint64(len(data))/2 {
+			return nil, nil, errCBORTruncated
+		}
+		items := make(map[any]any, argument)
+		for range argument {
+			var key, value any
+			key, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: map keys of type %T are not supported", key)
+			}
+			if _, isFound := items[key]; isFound {
+				return nil, nil, fmt.Errorf("cbor: map key %v is repeated", key)
+			}
+			value, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+		}
+		return items, data, nil
+	default:
+		// the only major type left is 6, a tag, which only describes the item that follows it
+		return decodeCBORItem(data, depth+1)
+	}
+}
+
+// decodes the argument of an item that its first byte's additional information describes
+func decodeCBORArgument(additional byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case additional < 24:
+		return uint64(additional), data, nil
+	case additional <= 27:
+		size := 1 << (additional - 24)
+		if len(data) < size {
+			return 0, nil, errCBORTruncated
+		}
+		var argument uint64
+		switch size {
+		case 1:
+			argument = uint64(data[0])
+		case 2:
+			argument = uint64(binary.BigEndian.Uint16(data))
+		case 4:
+			argument = uint64(binary.BigEndian.Uint32(data))
+		case 8:
+			argument = binary.BigEndian.Uint64(data)
+		}
+		return argument, data[size:], nil
+	default:
+		return 0, nil, errors.New("cbor: items of indefinite length are not supported")
+	}
+}
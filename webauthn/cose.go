@@ -0,0 +1,120 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// the COSE algorithms of RFC 9053 that credentials can be created with, in the order they are preferred
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms are the algorithms asked for when a credential is created
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// the labels and values of COSE keys used by the supported algorithms
+const (
+	coseKeyType      int64 = 1
+	coseKeyAlgorithm int64 = 3
+
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurveP256    int64 = 1
+	coseCurveEd25519 int64 = 6
+)
+
+// minRSAKeyBits is the size of the smallest RSA key that is accepted
+const minRSAKeyBits = 2048
+
+// publicKey is the public key of a credential, parsed from the COSE key it was registered with
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parseCOSEKey parses a COSE_Key as found in the attested credential data of authenticator data
+func parseCOSEKey(data []byte) (*publicKey, error) {
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("parsing public key: unexpected data after the key")
+	}
+	coseKey, ok := value.(map[any]any)
+	if !ok {
+		return nil, errors.New("parsing public key: key is not a map")
+	}
+	keyType, _ := coseKey[coseKeyType].(int64)
+	algorithm, _ := coseKey[coseKeyAlgorithm].(int64)
+	// the parameters of each key type share labels, which are negative
+	param := func(label int64) []byte {
+		b, _ := coseKey[label].([]byte)
+		return b
+	}
+	curve, _ := coseKey[int64(-1)].(int64)
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == AlgES256:
+		x, y := param(-2), param(-3)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("parsing public key: ES256 key is not on P-256")
+		}
+		// ecdh checks that the point is on the curve, which ecdsa does not
+		uncompressed := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(uncompressed); err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{algorithm, key}, nil
+	case keyType == coseKeyTypeOKP && algorithm == AlgEdDSA:
+		x := param(-2)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("parsing public key: EdDSA key is not an Ed25519 key")
+		}
+		return &publicKey{algorithm, ed25519.PublicKey(x)}, nil
+	case keyType == coseKeyTypeRSA && algorithm == AlgRS256:
+		n, e := param(-1), param(-2)
+		if len(n)*8 < minRSAKeyBits || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("parsing public key: RS256 key is too small or has an invalid exponent")
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		if exponent < 3 || exponent%2 == 0 {
+			return nil, errors.New("parsing public key: RS256 key has an invalid exponent")
+		}
+		return &publicKey{algorithm, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	default:
+		return nil, fmt.Errorf("parsing public key: key type %d with algorithm %d is not supported", keyType, algorithm)
+	}
+}
+
+// verify checks that signature is the signature of the key over signed
+func (k *publicKey) verify(signed, signature []byte) error {
+	isValid := false
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		isValid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		isValid = ed25519.Verify(key, signed, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		isValid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !isValid {
+		return errors.New("signature is not valid")
+	}
+	return nil
+}
@@ -0,0 +1,479 @@
+/*
+Package webauthn implements the relying party side of the Web Authentication ceremonies that register and sign in with
+passkeys. Attestation is not asked for, so the statements authenticators make about themselves are not checked - what
+matters is that the same key signs every sign in. Credentials can use ES256, EdDSA or RS256 keys.
+
+Binary values are exchanged with the browser base64url encoded without padding, in the same shape as the JSON of
+PublicKeyCredential.toJSON().
+*/
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// ChallengeSize is the size of challenges in bytes
+	ChallengeSize = 32
+	// Timeout is how long the browser gives the user to use their authenticator
+	Timeout = 5 * time.Minute
+	// maxCredentialIDSize is the largest credential id the specification allows
+	maxCredentialIDSize = 1023
+)
+
+// the bits of the flags in authenticator data
+const (
+	flagUserPresent            byte = 0x01
+	flagUserVerified           byte = 0x04
+	flagAttestedCredentialData byte = 0x40
+)
+
+// ErrSignCount is returned when a credential's signature counter has not gone up, which means it may have been cloned
+var ErrSignCount = errors.New("webauthn: the signature counter of the credential did not increase")
+
+var encoding = base64.RawURLEncoding
+
+// EncodeID base64url encodes a credential id or user handle, as it is sent to the browser
+func EncodeID(id []byte) string {
+	return encoding.EncodeToString(id)
+}
+
+/*
+RelyingParty is the site credentials are registered with. ID is the domain the credentials are scoped to, which must be
+the domain of Origin or one it is a subdomain of.
+*/
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// NewRelyingParty returns the relying party for the site served at baseUrl, with its host as the ID
+func NewRelyingParty(name, baseUrl string) (RelyingParty, error) {
+	parsed, err := url.Parse(baseUrl)
+	if err != nil {
+		return RelyingParty{}, fmt.Errorf("webauthn: parsing base url: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Hostname() == "" {
+		return RelyingParty{}, fmt.Errorf("webauthn: base url %s must have a scheme and a host", baseUrl)
+	}
+	return RelyingParty{
+		ID:     parsed.Hostname(),
+		Name:   name,
+		Origin: parsed.Scheme + "://" + parsed.Host,
+	}, nil
+}
+
+// NewChallenge returns a new random challenge, base64url encoded
+func NewChallenge() (string, error) {
+	challenge := make([]byte, ChallengeSize)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", fmt.Errorf("webauthn: generating challenge: %w", err)
+	}
+	return encoding.EncodeToString(challenge), nil
+}
+
+// User is the account a credential is registered for. ID must not hold anything that identifies the person.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// CredentialDescriptor identifies a credential in options sent to the browser
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// NewCredentialDescriptor returns the descriptor of the credential with id, which can be used over transports
+func NewCredentialDescriptor(id []byte, transports []string) CredentialDescriptor {
+	return CredentialDescriptor{Type: "public-key", ID: EncodeID(id), Transports: transports}
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options passed to navigator.credentials.create() to register a credential
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+/*
+CreationOptions returns the options to register a credential for user with. Only discoverable credentials - passkeys -
+can be registered, as signing in does not ask for an email address to find the user's credentials by. The credentials
+in exclude are not registered again.
+*/
+func (rp RelyingParty) CreationOptions(challenge string, user User, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]credentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = credentialParameter{"public-key", alg}
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		Challenge:              challenge,
+		RP:                     rpEntity{rp.ID, rp.Name},
+		User:                   userEntity{EncodeID(user.ID), user.Name, user.DisplayName},
+		PubKeyCredParams:       params,
+		Timeout:                Timeout.Milliseconds(),
+		ExcludeCredentials:     exclude,
+		AuthenticatorSelection: authenticatorSelection{ResidentKey: "required", UserVerification: "preferred"},
+		Attestation:            "none",
+	}
+}
+
+// RequestOptions are the options passed to navigator.credentials.get() to sign in with a credential
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+/*
+RequestOptions returns the options to sign in with. No credentials are allowed in particular, so the user can pick any
+passkey they have registered with the site.
+*/
+func (rp RelyingParty) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+}
+
+// ClientData is the part of the client data JSON that is checked
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// checks the client data was made by the browser for the ceremony of ceremonyType with challenge, on the site's origin
+func (rp RelyingParty) checkClientData(clientData ClientData, ceremonyType, challenge string) error {
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("client data type is %s, want %s", clientData.Type, ceremonyType)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return errors.New("client data challenge does not match")
+	}
+	if clientData.Origin != rp.Origin {
+		return fmt.Errorf("client data origin is %s, want %s", clientData.Origin, rp.Origin)
+	}
+	return nil
+}
+
+// authenticatorData is the data an authenticator signs, parsed
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// the attested credential data is only included when a credential is registered
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, errors.New("authenticator data is too short")
+	}
+	authData := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagAttestedCredentialData == 0 {
+		return authData, nil
+	}
+	// the attested credential data is the AAGUID of the authenticator, then the credential id and public key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, errors.New("attested credential data is too short")
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength > maxCredentialIDSize || len(rest) < idLength {
+		return authenticatorData{}, errors.New("credential id is too long")
+	}
+	authData.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+	_, afterKey, err := decodeCBOR(rest)
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("credential public key: %w", err)
+	}
+	authData.publicKey = rest[:len(rest)-len(afterKey)]
+	return authData, nil
+}
+
+// checks the authenticator data is for the site, and that the user was there to use the authenticator
+func (rp RelyingParty) checkAuthenticatorData(authData authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return errors.New("authenticator data is for another relying party")
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return errors.New("user was not present")
+	}
+	return nil
+}
+
+// decodes base64url, allowing padding as some browsers add it
+func decodeBase64URL(field, value string) ([]byte, error) {
+	decoded, err := encoding.DecodeString(trimPadding(value))
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: %s is not base64url: %w", field, err)
+	}
+	return decoded, nil
+}
+
+func trimPadding(value string) string {
+	for len(value) > 0 && value[len(value)-1] == '=' {
+		value = value[:len(value)-1]
+	}
+	return value
+}
+
+type registrationJSON struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// RegistrationResponse is the credential the browser returned from navigator.credentials.create()
+type RegistrationResponse struct {
+	ClientData        ClientData
+	clientDataJSON    []byte
+	attestationObject []byte
+	Transports        []string
+}
+
+// ParseRegistrationResponse parses the JSON of the credential returned from navigator.credentials.create()
+func ParseRegistrationResponse(data []byte) (*RegistrationResponse, error) {
+	parsed := registrationJSON{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: parsing registration response: %w", err)
+	}
+	if parsed.Type != "public-key" {
+		return nil, fmt.Errorf("webauthn: credential type is %s, want public-key", parsed.Type)
+	}
+	resp := &RegistrationResponse{Transports: parsed.Response.Transports}
+	resp.clientDataJSON, err = decodeBase64URL("clientDataJSON", parsed.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	resp.attestationObject, err = decodeBase64URL("attestationObject", parsed.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(resp.clientDataJSON, &resp.ClientData)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: parsing client data: %w", err)
+	}
+	return resp, nil
+}
+
+// Credential is a credential that has been registered, to store for the user to sign in with
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE key of the credential, as VerifyAssertion takes it
+	PublicKey    []byte
+	SignCount    uint32
+	Transports   []string
+	UserVerified bool
+}
+
+// VerifyRegistration checks resp was made for the registration with challenge, returning the credential to store
+func (rp RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge string) (Credential, error) {
+	err := rp.checkClientData(resp.ClientData, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: %w", err)
+	}
+	value, rest, err := decodeCBOR(resp.attestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: attestation object: %w", err)
+	}
+	if len(rest) != 0 {
+		return Credential{}, errors.New("webauthn: unexpected data after the attestation object")
+	}
+	attestation, ok := value.(map[any]any)
+	if !ok {
+		return Credential{}, errors.New("webauthn: attestation object is not a map")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, errors.New("webauthn: attestation object has no authenticator data")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: %w", err)
+	}
+	err = rp.checkAuthenticatorData(authData)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: %w", err)
+	}
+	if authData.credentialID == nil {
+		return Credential{}, errors.New("webauthn: authenticator data has no attested credential")
+	}
+	_, err = parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: %w", err)
+	}
+	return Credential{
+		ID:           bytes.Clone(authData.credentialID),
+		PublicKey:    bytes.Clone(authData.publicKey),
+		SignCount:    authData.signCount,
+		Transports:   resp.Transports,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+type assertionJSON struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential the browser returned from navigator.credentials.get()
+type AssertionResponse struct {
+	CredentialID []byte
+	// UserHandle is the ID of the user the credential was registered for, if the authenticator returned it
+	UserHandle        []byte
+	ClientData        ClientData
+	clientDataJSON    []byte
+	authenticatorData []byte
+	signature         []byte
+}
+
+// ParseAssertionResponse parses the JSON of the credential returned from navigator.credentials.get()
+func ParseAssertionResponse(data []byte) (*AssertionResponse, error) {
+	parsed := assertionJSON{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: parsing assertion response: %w", err)
+	}
+	if parsed.Type != "public-key" {
+		return nil, fmt.Errorf("webauthn: credential type is %s, want public-key", parsed.Type)
+	}
+	resp := &AssertionResponse{}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *[]byte
+	}{
+		{"id", parsed.ID, &resp.CredentialID},
+		{"userHandle", parsed.Response.UserHandle, &resp.UserHandle},
+		{"clientDataJSON", parsed.Response.ClientDataJSON, &resp.clientDataJSON},
+		{"authenticatorData", parsed.Response.AuthenticatorData, &resp.authenticatorData},
+		{"signature", parsed.Response.Signature, &resp.signature},
+	} {
+		*field.dst, err = decodeBase64URL(field.name, field.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(resp.CredentialID) == 0 {
+		return nil, errors.New("webauthn: assertion response has no credential id")
+	}
+	err = json.Unmarshal(resp.clientDataJSON, &resp.ClientData)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: parsing client data: %w", err)
+	}
+	return resp, nil
+}
+
+// Assertion is the result of a sign in with a credential
+type Assertion struct {
+	// SignCount is the credential's new signature counter, to store in place of the old one
+	SignCount    uint32
+	UserVerified bool
+}
+
+/*
+VerifyAssertion checks resp was signed for the sign in with challenge by the credential with publicKey. storedSignCount
+is the signature counter the credential had after it was last used - if either it or the new counter is not 0, the new
+one must be higher, or ErrSignCount is returned as the credential may have been cloned.
+*/
+func (rp RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge string, publicKey []byte,
+	storedSignCount uint32) (Assertion, error) {
+	err := rp.checkClientData(resp.ClientData, "webauthn.get", challenge)
+	if err != nil {
+		return Assertion{}, fmt.Errorf("webauthn: %w", err)
+	}
+	authData, err := parseAuthenticatorData(resp.authenticatorData)
+	if err != nil {
+		return Assertion{}, fmt.Errorf("webauthn: %w", err)
+	}
+	err = rp.checkAuthenticatorData(authData)
+	if err != nil {
+		return Assertion{}, fmt.Errorf("webauthn: %w", err)
+	}
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return Assertion{}, fmt.Errorf("webauthn: %w", err)
+	}
+	clientDataHash := sha256.Sum256(resp.clientDataJSON)
+	signed := append(bytes.Clone(resp.authenticatorData), clientDataHash[:]...)
+	err = key.verify(signed, resp.signature)
+	if err != nil {
+		return Assertion{}, fmt.Errorf("webauthn: %w", err)
+	}
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return Assertion{}, ErrSignCount
+	}
+	return Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
@@ -0,0 +1,212 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sohWenMing/lenslocked/webauthn"
+	"github.com/sohWenMing/lenslocked/webauthn/webauthntest"
+)
+
+var rp = webauthn.RelyingParty{ID: "localhost", Name: "Lenslocked", Origin: "http://localhost:3000"}
+
+// registers a passkey with authenticator, returning the credential stored for it
+func register(t *testing.T, authenticator *webauthntest.Authenticator) (webauthn.Credential, *webauthntest.Credential) {
+	t.Helper()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	options := rp.CreationOptions(challenge, webauthn.User{ID: []byte("7"), Name: "a@b.com", DisplayName: "a@b.com"}, nil)
+	data, authenticatorCredential, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	resp, err := webauthn.ParseRegistrationResponse(data)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	credential, err := rp.VerifyRegistration(resp, challenge)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	return credential, authenticatorCredential
+}
+
+func assert(t *testing.T, authenticator *webauthntest.Authenticator, credential *webauthntest.Credential,
+) (*webauthn.AssertionResponse, string) {
+	t.Helper()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	data, err := authenticator.Assert(credential, rp.RequestOptions(challenge))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	resp, err := webauthn.ParseAssertionResponse(data)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	return resp, challenge
+}
+
+func TestRegisterAndAssert(t *testing.T) {
+	authenticator := webauthntest.New(rp)
+	credential, authenticatorCredential := register(t, authenticator)
+	if !bytes.Equal(credential.ID, authenticatorCredential.ID) || !credential.UserVerified {
+		t.Errorf("got credential %+v, want the authenticator's verified credential\n", credential)
+	}
+	signCount := credential.SignCount
+	for range 2 {
+		resp, challenge := assert(t, authenticator, authenticatorCredential)
+		if !bytes.Equal(resp.CredentialID, credential.ID) || string(resp.UserHandle) != "7" {
+			t.Errorf("got credential %x for user %s, want %x for user 7\n", resp.CredentialID, resp.UserHandle,
+				credential.ID)
+		}
+		assertion, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, signCount)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		if assertion.SignCount <= signCount || !assertion.UserVerified {
+			t.Errorf("got %+v, want a higher sign count than %d with the user verified\n", assertion, signCount)
+		}
+		signCount = assertion.SignCount
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	type test struct {
+		name         string
+		relyingParty webauthn.RelyingParty
+		challenge    string
+	}
+	tests := []test{
+		{"wrong challenge", rp, "wrong-challenge"},
+		{"wrong origin", webauthn.RelyingParty{ID: "localhost", Origin: "http://localhost:4000"}, ""},
+		{"wrong relying party id", webauthn.RelyingParty{ID: "example.com", Origin: "http://localhost:3000"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			challenge, _ := webauthn.NewChallenge()
+			data, _, err := webauthntest.New(rp).Register(rp.CreationOptions(challenge, webauthn.User{ID: []byte("7")}, nil))
+			if err != nil {
+				t.Fatalf("didn't expect error, got %v\n", err)
+			}
+			resp, err := webauthn.ParseRegistrationResponse(data)
+			if err != nil {
+				t.Fatalf("didn't expect error, got %v\n", err)
+			}
+			if test.challenge != "" {
+				challenge = test.challenge
+			}
+			_, err = test.relyingParty.VerifyRegistration(resp, challenge)
+			if err == nil {
+				t.Errorf("expected error, didn't get one")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	authenticator := webauthntest.New(rp)
+	credential, authenticatorCredential := register(t, authenticator)
+
+	resp, challenge := assert(t, authenticator, authenticatorCredential)
+	_, err := rp.VerifyAssertion(resp, "wrong-challenge", credential.PublicKey, 0)
+	if err == nil {
+		t.Errorf("expected error for the wrong challenge, didn't get one")
+	}
+	otherCredential, _ := register(t, webauthntest.New(rp))
+	_, err = rp.VerifyAssertion(resp, challenge, otherCredential.PublicKey, 0)
+	if err == nil {
+		t.Errorf("expected error for the key of another credential, didn't get one")
+	}
+	// a counter that has not gone up past the stored one means the credential may have been cloned
+	_, err = rp.VerifyAssertion(resp, challenge, credential.PublicKey, authenticatorCredential.SignCount)
+	if !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("expected ErrSignCount, got %v\n", err)
+	}
+	// authenticators that never count stay at 0, which is allowed
+	authenticator.SkipSignCount = true
+	zeroCounter := &webauthntest.Credential{}
+	*zeroCounter = *authenticatorCredential
+	zeroCounter.SignCount = 0
+	resp, challenge = assert(t, authenticator, zeroCounter)
+	_, err = rp.VerifyAssertion(resp, challenge, credential.PublicKey, 0)
+	if err != nil {
+		t.Errorf("didn't expect error for a credential without a counter, got %v\n", err)
+	}
+}
+
+func TestVerifyAssertionTampered(t *testing.T) {
+	authenticator := webauthntest.New(rp)
+	credential, authenticatorCredential := register(t, authenticator)
+	challenge, _ := webauthn.NewChallenge()
+	data, err := authenticator.Assert(authenticatorCredential, rp.RequestOptions(challenge))
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	parsed := map[string]any{}
+	json.Unmarshal(data, &parsed)
+	response := parsed["response"].(map[string]any)
+	authData, _ := base64.RawURLEncoding.DecodeString(response["authenticatorData"].(string))
+	// setting the user verified flag invalidates the signature
+	authData[32] ^= 0x04
+	response["authenticatorData"] = base64.RawURLEncoding.EncodeToString(authData)
+	data, _ = json.Marshal(parsed)
+	resp, err := webauthn.ParseAssertionResponse(data)
+	if err != nil {
+		t.Fatalf("didn't expect error, got %v\n", err)
+	}
+	_, err = rp.VerifyAssertion(resp, challenge, credential.PublicKey, 0)
+	if err == nil {
+		t.Errorf("expected error for tampered authenticator data, didn't get one")
+	}
+}
+
+func TestParseRegistrationResponseMalformed(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`{"type":"public-key","response":{"clientDataJSON":"!!","attestationObject":""}}`,
+		`{"type":"password","response":{}}`,
+	}
+	for _, test := range tests {
+		_, err := webauthn.ParseRegistrationResponse([]byte(test))
+		if err == nil {
+			t.Errorf("expected error parsing %s, didn't get one", test)
+		}
+	}
+	// attestation objects that are not valid CBOR are rejected when they are verified
+	for _, attestationObject := range [][]byte{{0xa1}, {0x9f}, {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}} {
+		challenge, _ := webauthn.NewChallenge()
+		clientData, _ := json.Marshal(webauthn.ClientData{Type: "webauthn.create", Challenge: challenge, Origin: rp.Origin})
+		data, _ := json.Marshal(map[string]any{"type": "public-key", "response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		}})
+		resp, err := webauthn.ParseRegistrationResponse(data)
+		if err != nil {
+			t.Fatalf("didn't expect error, got %v\n", err)
+		}
+		_, err = rp.VerifyRegistration(resp, challenge)
+		if err == nil {
+			t.Errorf("expected error for attestation object %x, didn't get one", attestationObject)
+		}
+	}
+}
+
+func TestNewRelyingParty(t *testing.T) {
+	got, err := webauthn.NewRelyingParty("Lenslocked", "https://photos.example.com:8443/")
+	want := webauthn.RelyingParty{ID: "photos.example.com", Name: "Lenslocked", Origin: "https://photos.example.com:8443"}
+	if err != nil || got != want {
+		t.Errorf("got %+v %v, want %+v\n", got, err, want)
+	}
+	_, err = webauthn.NewRelyingParty("Lenslocked", "localhost:3000")
+	if err == nil {
+		t.Errorf("expected error for a base url without a scheme, didn't get one")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Package webauthntest provides a software authenticator, for testing the passkey ceremonies without a browser. It makes
+ES256 passkeys, and returns responses in the same JSON as the browser script does.
+*/
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sohWenMing/lenslocked/webauthn"
+)
+
+var encoding = base64.RawURLEncoding
+
+// Credential is a passkey the authenticator has made
+type Credential struct {
+	ID         []byte
+	UserHandle []byte
+	key        *ecdsa.PrivateKey
+	SignCount  uint32
+}
+
+/*
+Authenticator is a software authenticator for one relying party. UserVerified sets whether it reports that it verified
+the user, and the counter of each credential goes up on every sign in unless SkipSignCount is set.
+*/
+type Authenticator struct {
+	RelyingParty  webauthn.RelyingParty
+	UserVerified  bool
+	SkipSignCount bool
+	Credentials   []*Credential
+}
+
+// New returns an authenticator for rp that verifies the user
+func New(rp webauthn.RelyingParty) *Authenticator {
+	return &Authenticator{RelyingParty: rp, UserVerified: true}
+}
+
+// Register makes a new passkey for the creation options, returning the JSON of the registration response
+func (a *Authenticator) Register(options webauthn.CreationOptions) ([]byte, *Credential, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	userHandle, err := encoding.DecodeString(options.User.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("user id: %w", err)
+	}
+	credential := &Credential{ID: id, UserHandle: userHandle, key: key}
+	a.Credentials = append(a.Credentials, credential)
+
+	ecdhKey, err := key.PublicKey.ECDH()
+	if err != nil {
+		return nil, nil, err
+	}
+	// the uncompressed point is 0x04 followed by x and y
+	point := ecdhKey.Bytes()
+	coseKey := encodeCBOR(cborMap{
+		{int64(1), int64(2)},
+		{int64(3), webauthn.AlgES256},
+		{int64(-1), int64(1)},
+		{int64(-2), point[1:33]},
+		{int64(-3), point[33:]},
+	})
+	attestedCredential := make([]byte, 16, 16+2+len(id)+len(coseKey))
+	attestedCredential = binary.BigEndian.AppendUint16(attestedCredential, uint16(len(id)))
+	attestedCredential = append(append(attestedCredential, id...), coseKey...)
+	authData := a.authenticatorData(0x40, credential.SignCount, attestedCredential)
+	attestationObject := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+	clientDataJSON, err := a.clientDataJSON("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	response := map[string]any{
+		"id":    encoding.EncodeToString(id),
+		"rawId": encoding.EncodeToString(id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encoding.EncodeToString(clientDataJSON),
+			"attestationObject": encoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	}
+	data, err := json.Marshal(response)
+	return data, credential, err
+}
+
+// Assert signs in with credential for the request options, returning the JSON of the assertion response
+func (a *Authenticator) Assert(credential *Credential, options webauthn.RequestOptions) ([]byte, error) {
+	if credential == nil {
+		return nil, errors.New("no credential to sign in with")
+	}
+	if !a.SkipSignCount {
+		credential.SignCount++
+	}
+	authData := a.authenticatorData(0, credential.SignCount, nil)
+	clientDataJSON, err := a.clientDataJSON("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, credential.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	response := map[string]any{
+		"id":    encoding.EncodeToString(credential.ID),
+		"rawId": encoding.EncodeToString(credential.ID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encoding.EncodeToString(clientDataJSON),
+			"authenticatorData": encoding.EncodeToString(authData),
+			"signature":         encoding.EncodeToString(signature),
+			"userHandle":        encoding.EncodeToString(credential.UserHandle),
+		},
+	}
+	return json.Marshal(response)
+}
+
+func (a *Authenticator) authenticatorData(flags byte, signCount uint32, attestedCredential []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RelyingParty.ID))
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	authData := append(rpIDHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, signCount)
+	return append(authData, attestedCredential...)
+}
+
+func (a *Authenticator) clientDataJSON(ceremonyType, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      a.RelyingParty.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// cborMap is a CBOR map, with its entries in the order they are encoded in
+type cborMap [][2]any
+
+// encodeCBOR encodes the values the authenticator needs - int64, string, []byte and cborMap
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborMap:
+		encoded := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			encoded = append(encoded, encodeCBOR(entry[0])...)
+			encoded = append(encoded, encodeCBOR(entry[1])...)
+		}
+		return encoded
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T as CBOR", value))
+	}
+}
+
+func cborHead(majorType byte, argument uint64) []byte {
+	majorType <<= 5
+	switch {
+	case argument < 24:
+		return []byte{majorType | byte(argument)}
+	case argument <= 0xff:
+		return []byte{majorType | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{majorType | 25}, uint16(argument))
+	case argument <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{majorType | 26}, uint32(argument))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{majorType | 27}, argument)
+	}
+}